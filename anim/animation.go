@@ -0,0 +1,107 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxanim
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol/payloads"
+)
+
+// Keyframe is the color of a light at a point in an animation.
+type Keyframe struct {
+	// At is how far in to the animation the light is at the color.
+	At time.Duration
+
+	Color lifxpayloads.LightHSBK
+}
+
+// Animation is a sequence of keyframes. Between two keyframes the color is
+// interpolated in the color space of the animation; before the first
+// keyframe the light is at its color, and after the last one the light stays
+// at its color unless the animation loops.
+type Animation struct {
+	// Keyframes are the keyframes of the animation, sorted by their times.
+	Keyframes []Keyframe
+
+	// Space is the color space the colors are interpolated in.
+	Space lifxpayloads.ColorSpace
+
+	// Loop is whether the animation starts over after the last keyframe.
+	// It jumps straight back to the start, so an animation that loops
+	// smoothly ends with the color it starts with.
+	Loop bool
+}
+
+// Duration returns the length of the animation, which is the time of its
+// last keyframe.
+func (a *Animation) Duration() time.Duration {
+	if len(a.Keyframes) == 0 {
+		return 0
+	}
+
+	return a.Keyframes[len(a.Keyframes)-1].At
+}
+
+// Validate returns an error if the animation can't be played.
+func (a *Animation) Validate() error {
+	if len(a.Keyframes) == 0 {
+		return errors.New("the animation has no keyframes")
+	}
+
+	for i, kf := range a.Keyframes {
+		if kf.At < 0 {
+			return fmt.Errorf("keyframe %d: the time can't be negative", i+1)
+		}
+
+		if i > 0 && kf.At < a.Keyframes[i-1].At {
+			return fmt.Errorf("keyframe %d: the keyframes must be sorted by their times", i+1)
+		}
+
+		if kf.Color.Kelvin < lifxpayloads.MinKelvin || kf.Color.Kelvin > lifxpayloads.MaxKelvin {
+			return fmt.Errorf("keyframe %d: %s", i+1, lifxpayloads.ErrKelvinRange)
+		}
+	}
+
+	if a.Loop && a.Duration() == 0 {
+		return errors.New("an animation that loops must be longer than 0s")
+	}
+
+	return nil
+}
+
+// ColorAt returns the color of the light at the point in the animation. If
+// the animation loops, points past its end wrap around.
+func (a *Animation) ColorAt(t time.Duration) lifxpayloads.LightHSBK {
+	kfs := a.Keyframes
+
+	if d := a.Duration(); a.Loop && d > 0 {
+		t %= d
+
+		if t < 0 {
+			t += d
+		}
+	}
+
+	if t <= kfs[0].At {
+		return kfs[0].Color
+	}
+
+	for i := 1; i < len(kfs); i++ {
+		prev, next := kfs[i-1], kfs[i]
+
+		if t >= next.At {
+			continue
+		}
+
+		frac := float64(t-prev.At) / float64(next.At-prev.At)
+
+		return *lifxpayloads.Interpolate(&prev.Color, &next.Color, frac, a.Space)
+	}
+
+	return kfs[len(kfs)-1].Color
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxanim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol/payloads"
+
+	. "gopkg.in/check.v1"
+)
+
+type TestSuite struct{}
+
+var _ = Suite(&TestSuite{})
+
+func Test(t *testing.T) { TestingT(t) }
+
+var (
+	red   = lifxpayloads.LightHSBK{Hue: 0, Saturation: 65535, Brightness: 65535, Kelvin: 3500}
+	green = lifxpayloads.LightHSBK{Hue: 21845, Saturation: 65535, Brightness: 65535, Kelvin: 3500}
+	blue  = lifxpayloads.LightHSBK{Hue: 43690, Saturation: 65535, Brightness: 65535, Kelvin: 3500}
+)
+
+func (*TestSuite) TestAnimation_ColorAt(c *C) {
+	a := &Animation{
+		Keyframes: []Keyframe{
+			{At: 100 * time.Millisecond, Color: red},
+			{At: 300 * time.Millisecond, Color: green},
+			{At: 300 * time.Millisecond, Color: blue},
+			{At: 500 * time.Millisecond, Color: red},
+		},
+	}
+
+	c.Assert(a.Validate(), IsNil)
+	c.Check(a.Duration(), Equals, 500*time.Millisecond)
+
+	halfway := *lifxpayloads.Interpolate(&red, &green, 0.5, lifxpayloads.ColorSpaceHSB)
+
+	tests := []struct {
+		at    time.Duration
+		color lifxpayloads.LightHSBK
+	}{
+		{0, red},
+		{100 * time.Millisecond, red},
+		{200 * time.Millisecond, halfway},
+		{300 * time.Millisecond, blue},
+		{500 * time.Millisecond, red},
+		{time.Second, red},
+	}
+
+	for _, tt := range tests {
+		c.Check(a.ColorAt(tt.at), Equals, tt.color, Commentf("%s", tt.at))
+	}
+
+	// looping wraps around
+	a.Loop = true
+	c.Check(a.ColorAt(700*time.Millisecond), Equals, halfway)
+	c.Check(a.ColorAt(-300*time.Millisecond), Equals, halfway)
+
+	a.Space = lifxpayloads.ColorSpaceOklab
+	c.Check(a.ColorAt(200*time.Millisecond), Equals, *lifxpayloads.Interpolate(&red, &green, 0.5, lifxpayloads.ColorSpaceOklab))
+}
+
+func (*TestSuite) TestAnimation_Validate(c *C) {
+	tests := []struct {
+		a   *Animation
+		err string
+	}{
+		{&Animation{}, "the animation has no keyframes"},
+		{&Animation{Keyframes: []Keyframe{{At: -1, Color: red}}}, "keyframe 1: the time can't be negative"},
+		{&Animation{Keyframes: []Keyframe{{At: 2, Color: red}, {At: 1, Color: red}}}, "keyframe 2: the keyframes must be sorted by their times"},
+		{&Animation{Keyframes: []Keyframe{{At: 0, Color: red}, {At: 1}}}, "keyframe 2: " + lifxpayloads.ErrKelvinRange.Error()},
+		{&Animation{Keyframes: []Keyframe{{At: 0, Color: red}}, Loop: true}, "an animation that loops must be longer than 0s"},
+	}
+
+	for _, tt := range tests {
+		c.Check(tt.a.Validate(), ErrorMatches, tt.err)
+	}
+}
@@ -0,0 +1,357 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+// Package lifxanim plays keyframe animations on LIFX lights, by streaming
+// colors to them from the client. The transitions built in to the lights
+// only fade from one color to another; an animation can go through any
+// number of colors, and play on many lights at once.
+//
+// A *Player renders the animations at a target frame rate, and sends each
+// frame to the lights with LightSetColor. The duration of each message is
+// the time until the next one, so the lights fade smoothly between the
+// frames instead of stepping:
+//
+//	player, err := lifxanim.New(nil, &lifxanim.Track{
+//		Light: client.Light(mac, addr),
+//		Animation: &lifxanim.Animation{
+//			Keyframes: []lifxanim.Keyframe{
+//				{At: 0, Color: red},
+//				{At: 2 * time.Second, Color: blue},
+//				{At: 4 * time.Second, Color: red},
+//			},
+//			Loop: true,
+//		},
+//	})
+//
+//	if err != nil {
+//		// handle err
+//	}
+//
+//	err = player.Run(ctx)
+//
+// LIFX recommends sending no more than 20 messages a second to a light, so a
+// light is never sent frames faster than the player's max rate. A light that
+// hasn't acknowledged its last frame is skipped until it has, so a slow or
+// unreachable light has its frames dropped rather than queued, and it never
+// falls behind the others.
+package lifxanim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol/payloads"
+	"github.com/theckman/go-lifx/util"
+)
+
+const (
+	// DefaultFPS is the number of frames a second a *Player renders by
+	// default.
+	DefaultFPS = 20
+
+	// DefaultMaxRate is the most frames a second a *Player sends to each
+	// light by default, which is the limit recommended by LIFX.
+	DefaultMaxRate = 20
+)
+
+// ErrPlayerRunning is the error returned by Player.Run when the player is
+// already running, or has been run before.
+var ErrPlayerRunning = errors.New("the player has already been run")
+
+// Light is a light an animation is played on. A *lifx.Light satisfies it;
+// its SetColor waits for the light to acknowledge the color.
+type Light interface {
+	SetColor(ctx context.Context, hsbk lifxpayloads.LightHSBK, duration time.Duration) error
+}
+
+// Track is an animation played on a light. Each light should only be in one
+// of the tracks of a *Player, so its max rate holds.
+type Track struct {
+	Light     Light
+	Animation *Animation
+}
+
+// Config is the configuration for a *Player. The zero value is usable, and
+// any fields that aren't set use their defaults.
+type Config struct {
+	// FPS is the number of frames a second that are rendered. If 0,
+	// DefaultFPS is used.
+	FPS float64
+
+	// MaxRate is the most frames a second sent to each light; the frames
+	// that would go over it are dropped. If 0, DefaultMaxRate is used.
+	MaxRate float64
+
+	// Clock is the source of time used to schedule the frames. If nil, the
+	// system clock is used.
+	Clock lifxutil.Clock
+}
+
+// Stats are the counts of what a *Player has done.
+type Stats struct {
+	// Frames is the number of frames rendered.
+	Frames uint64
+
+	// Skipped is the number of frames that weren't rendered because the
+	// player fell behind.
+	Skipped uint64
+
+	// Sent is the number of colors sent to the lights, and Errors is the
+	// number of them the lights failed to set.
+	Sent   uint64
+	Errors uint64
+
+	// Dropped is the number of colors that weren't sent to a light, because
+	// it was still busy with the last one or it would've gone over the max
+	// rate.
+	Dropped uint64
+}
+
+// track is the state of a Track while it's played.
+type track struct {
+	*Track
+
+	busy   bool          // a color is being sent
+	sent   bool          // a color has been sent
+	lastAt time.Duration // the time in the animation of the last color
+	last   lifxpayloads.LightHSBK
+	done   bool // the animation doesn't loop, and has reached its end
+}
+
+// Player plays animations on lights. It's safe for concurrent use by multiple
+// goroutines.
+type Player struct {
+	tracks    []*track
+	interval  time.Duration // between frames
+	minGap    time.Duration // between the colors sent to a light
+	smoothing time.Duration // the duration of each color
+	clock     lifxutil.Clock
+
+	mu      sync.Mutex
+	running bool
+	stats   Stats
+}
+
+// New returns a *Player for the tracks, using the configuration. The config
+// can be nil to use the defaults. Call Run to play the animations.
+func New(config *Config, tracks ...*Track) (*Player, error) {
+	if config == nil {
+		config = &Config{}
+	}
+
+	if len(tracks) == 0 {
+		return nil, errors.New("there are no tracks to play")
+	}
+
+	fps, maxRate := config.FPS, config.MaxRate
+
+	if fps == 0 {
+		fps = DefaultFPS
+	}
+
+	if maxRate == 0 {
+		maxRate = DefaultMaxRate
+	}
+
+	if !(fps > 0) || math.IsInf(fps, 0) {
+		return nil, fmt.Errorf("the FPS must be a positive number, got %v", config.FPS)
+	}
+
+	if !(maxRate > 0) || math.IsInf(maxRate, 0) {
+		return nil, fmt.Errorf("the max rate must be a positive number, got %v", config.MaxRate)
+	}
+
+	p := &Player{
+		interval: time.Duration(float64(time.Second) / fps),
+		minGap:   time.Duration(float64(time.Second) / maxRate),
+		clock:    config.Clock,
+	}
+
+	if p.interval <= 0 {
+		return nil, fmt.Errorf("the FPS is too high, got %v", fps)
+	}
+
+	p.smoothing = p.interval
+
+	if p.minGap > p.smoothing {
+		p.smoothing = p.minGap
+	}
+
+	if p.clock == nil {
+		p.clock = lifxutil.SystemClock
+	}
+
+	for i, t := range tracks {
+		if t == nil || t.Light == nil || t.Animation == nil {
+			return nil, fmt.Errorf("track %d: the light and animation must be set", i+1)
+		}
+
+		if err := t.Animation.Validate(); err != nil {
+			return nil, fmt.Errorf("track %d: %s", i+1, err)
+		}
+
+		p.tracks = append(p.tracks, &track{Track: t})
+	}
+
+	return p, nil
+}
+
+// Stats returns the counts of what the player has done so far.
+func (p *Player) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.stats
+}
+
+// Run plays the animations until they've all reached their end, or the
+// context is done. It returns nil if the animations finished, and the
+// context's error otherwise. Run waits for the colors being sent to the
+// lights before it returns. A *Player can only be run once.
+//
+// When the animations that don't loop reach their end, the lights that
+// missed their last frame are sent it, so they always end up at the color of
+// the last keyframe.
+func (p *Player) Run(ctx context.Context) error {
+	p.mu.Lock()
+
+	if p.running {
+		p.mu.Unlock()
+		return ErrPlayerRunning
+	}
+
+	p.running = true
+	p.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+
+	start := p.clock.Now()
+	frame := int64(-1)
+
+	for {
+		n := int64(p.clock.Now().Sub(start) / p.interval)
+
+		if n > frame {
+			if frame+1 < n {
+				p.mu.Lock()
+				p.stats.Skipped += uint64(n - frame - 1)
+				p.mu.Unlock()
+			}
+
+			frame = n
+
+			if p.render(ctx, &wg, time.Duration(frame)*p.interval) {
+				break
+			}
+		}
+
+		next := start.Add(time.Duration(frame+1) * p.interval)
+
+		select {
+		case <-p.clock.After(next.Sub(p.clock.Now())):
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		}
+	}
+
+	wg.Wait()
+	p.finish(ctx)
+
+	return ctx.Err()
+}
+
+// render sends the frame at the time in the animations to the lights that
+// can take it, and returns whether all of the animations have reached their
+// end.
+func (p *Player) render(ctx context.Context, wg *sync.WaitGroup, t time.Duration) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.stats.Frames++
+
+	done := true
+
+	for _, tr := range p.tracks {
+		if tr.done {
+			continue
+		}
+
+		if tr.Animation.Loop || t < tr.Animation.Duration() {
+			done = false
+		} else {
+			tr.done = true
+		}
+
+		if tr.busy || (tr.sent && t-tr.lastAt < p.minGap) {
+			p.stats.Dropped++
+			continue
+		}
+
+		color := tr.Animation.ColorAt(t)
+		tr.sent, tr.lastAt, tr.last = true, t, color
+
+		p.sendLocked(ctx, wg, tr, color)
+	}
+
+	return done
+}
+
+// finish sends the last color of each animation to the lights that missed
+// it. It's only called once all of the animations have reached their end, so
+// none of them loop.
+func (p *Player) finish(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	p.mu.Lock()
+
+	for _, tr := range p.tracks {
+		color := tr.Animation.ColorAt(tr.Animation.Duration())
+
+		if tr.sent && tr.last == color {
+			continue
+		}
+
+		tr.sent, tr.last = true, color
+
+		p.sendLocked(ctx, &wg, tr, color)
+	}
+
+	p.mu.Unlock()
+
+	wg.Wait()
+}
+
+// sendLocked sends the color to the light of the track in a new goroutine.
+// The caller must hold the lock.
+func (p *Player) sendLocked(ctx context.Context, wg *sync.WaitGroup, tr *track, color lifxpayloads.LightHSBK) {
+	tr.busy = true
+	p.stats.Sent++
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		err := tr.Light.SetColor(ctx, color, p.smoothing)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		tr.busy = false
+
+		// the colors cut short by the context aren't the light's fault
+		if err != nil && ctx.Err() == nil {
+			p.stats.Errors++
+		}
+	}()
+}
@@ -0,0 +1,267 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxanim
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/theckman/go-lifx"
+	"github.com/theckman/go-lifx/emulator"
+	"github.com/theckman/go-lifx/protocol/payloads"
+	"github.com/theckman/go-lifx/util"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ Light = (*lifx.Light)(nil)
+
+// fakeLight records the colors it's sent.
+type fakeLight struct {
+	mu        sync.Mutex
+	block     chan struct{} // if set, SetColor waits for it to be closed
+	err       error
+	colors    []lifxpayloads.LightHSBK
+	durations []time.Duration
+}
+
+func (fl *fakeLight) SetColor(ctx context.Context, hsbk lifxpayloads.LightHSBK, duration time.Duration) error {
+	fl.mu.Lock()
+	fl.colors = append(fl.colors, hsbk)
+	fl.durations = append(fl.durations, duration)
+	block, err := fl.block, fl.err
+	fl.mu.Unlock()
+
+	if block != nil {
+		select {
+		case <-block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return err
+}
+
+func (fl *fakeLight) sent() []lifxpayloads.LightHSBK {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	return append([]lifxpayloads.LightHSBK(nil), fl.colors...)
+}
+
+// waitFor waits for the condition to become true.
+func waitFor(c *C, what string, cond func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+
+	for !cond() {
+		if time.Now().After(deadline) {
+			c.Fatalf("timed out waiting for %s", what)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// runPlayer runs the player, and returns the channel its
+// error is sent on.
+func runPlayer(p *Player) chan error {
+	errs := make(chan error, 1)
+
+	go func() { errs <- p.Run(context.Background()) }()
+
+	return errs
+}
+
+// step waits for the player to finish the frame, and then advances the clock
+// to the next one.
+func step(c *C, clock *lifxutil.ManualClock, d time.Duration) {
+	waitFor(c, "the frame", func() bool { return clock.Waiters() > 0 })
+	clock.Advance(d)
+}
+
+func (p *Player) idle(i int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return !p.tracks[i].busy
+}
+
+func (*TestSuite) TestPlayer(c *C) {
+	clock := lifxutil.NewManualClock(time.Unix(1456790400, 0))
+	fast, slow := &fakeLight{}, &fakeLight{block: make(chan struct{})}
+
+	a := &Animation{Keyframes: []Keyframe{{At: 0, Color: red}, {At: 500 * time.Millisecond, Color: blue}}}
+
+	p, err := New(&Config{FPS: 10, Clock: clock}, &Track{Light: fast, Animation: a}, &Track{Light: slow, Animation: a})
+	c.Assert(err, IsNil)
+
+	errs := runPlayer(p)
+
+	// the first frame is sent to both lights, and the slow one doesn't
+	// finish with it in time for the second frame
+	waitFor(c, "the first frame", func() bool { return len(slow.sent()) == 1 })
+	step(c, clock, 100*time.Millisecond)
+	waitFor(c, "the second frame", func() bool { return len(fast.sent()) == 2 })
+	c.Check(slow.sent(), HasLen, 1)
+
+	close(slow.block)
+	waitFor(c, "the slow light", func() bool { return p.idle(1) })
+
+	step(c, clock, 100*time.Millisecond)
+	waitFor(c, "the third frame", func() bool { return len(slow.sent()) == 2 })
+
+	// the player falls behind, and skips to the last frame
+	step(c, clock, 300*time.Millisecond)
+
+	select {
+	case err := <-errs:
+		c.Assert(err, IsNil)
+	case <-time.After(2 * time.Second):
+		c.Fatal("timed out waiting for the player to finish")
+	}
+
+	c.Check(fast.sent(), DeepEquals, []lifxpayloads.LightHSBK{red, a.ColorAt(100 * time.Millisecond), a.ColorAt(200 * time.Millisecond), blue})
+	c.Check(slow.sent(), DeepEquals, []lifxpayloads.LightHSBK{red, a.ColorAt(200 * time.Millisecond), blue})
+
+	for _, d := range fast.durations {
+		c.Check(d, Equals, 100*time.Millisecond)
+	}
+
+	c.Check(p.Stats(), Equals, Stats{Frames: 4, Skipped: 2, Sent: 7, Dropped: 1})
+	c.Check(p.Run(context.Background()), Equals, ErrPlayerRunning)
+}
+
+func (*TestSuite) TestPlayer_MaxRate(c *C) {
+	clock := lifxutil.NewManualClock(time.Unix(1456790400, 0))
+	light := &fakeLight{err: errors.New("boom")}
+
+	a := &Animation{Keyframes: []Keyframe{{At: 0, Color: red}, {At: time.Second, Color: blue}}, Loop: true}
+
+	p, err := New(&Config{FPS: 40, MaxRate: 20, Clock: clock}, &Track{Light: light, Animation: a})
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+
+	go func() { errs <- p.Run(ctx) }()
+
+	// only every other frame is sent to the light
+	for i := 1; i <= 4; i++ {
+		step(c, clock, 25*time.Millisecond)
+	}
+
+	waitFor(c, "the fifth frame", func() bool { return clock.Waiters() > 0 && p.idle(0) })
+	cancel()
+
+	select {
+	case err := <-errs:
+		c.Check(err, Equals, context.Canceled)
+	case <-time.After(2 * time.Second):
+		c.Fatal("timed out waiting for the player to stop")
+	}
+
+	c.Check(light.sent(), DeepEquals, []lifxpayloads.LightHSBK{red, a.ColorAt(50 * time.Millisecond), a.ColorAt(100 * time.Millisecond)})
+
+	// the colors fade over the time between the colors sent to the light,
+	// not between the frames
+	c.Check(light.durations, DeepEquals, []time.Duration{50 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond})
+	c.Check(p.Stats(), Equals, Stats{Frames: 5, Sent: 3, Errors: 3, Dropped: 2})
+}
+
+func (*TestSuite) TestPlayer_LastFrame(c *C) {
+	clock := lifxutil.NewManualClock(time.Unix(1456790400, 0))
+	light := &fakeLight{block: make(chan struct{})}
+
+	a := &Animation{Keyframes: []Keyframe{{At: 0, Color: red}, {At: 100 * time.Millisecond, Color: blue}}}
+
+	p, err := New(&Config{FPS: 10, Clock: clock}, &Track{Light: light, Animation: a})
+	c.Assert(err, IsNil)
+
+	errs := runPlayer(p)
+
+	// the light is busy with the first frame during the last one
+	step(c, clock, 100*time.Millisecond)
+	waitFor(c, "the last frame", func() bool { return p.Stats().Dropped == 1 })
+	close(light.block)
+
+	select {
+	case err := <-errs:
+		c.Assert(err, IsNil)
+	case <-time.After(2 * time.Second):
+		c.Fatal("timed out waiting for the player to finish")
+	}
+
+	c.Check(light.sent(), DeepEquals, []lifxpayloads.LightHSBK{red, blue})
+	c.Check(p.Stats(), Equals, Stats{Frames: 2, Sent: 2, Dropped: 1})
+}
+
+func (*TestSuite) TestPlayer_Emulator(c *C) {
+	network, err := lifxemulator.NewNetwork("")
+	c.Assert(err, IsNil)
+	defer network.Close()
+
+	lightClock := lifxutil.NewManualClock(time.Unix(1456790400, 0))
+
+	fleet, err := network.AddFleet(&lifxemulator.FleetConfig{Devices: 3, Clock: lightClock})
+	c.Assert(err, IsNil)
+
+	client, err := lifx.NewClient(&lifx.Config{Broadcast: network.Addr(), Timeout: 250 * time.Millisecond})
+	c.Assert(err, IsNil)
+	defer client.Close()
+
+	a := &Animation{Keyframes: []Keyframe{{At: 0, Color: red}, {At: 100 * time.Millisecond, Color: green}, {At: 200 * time.Millisecond, Color: blue}}}
+
+	var tracks []*Track
+
+	for _, device := range fleet {
+		tracks = append(tracks, &Track{Light: client.Light(device.HardwareAddr(), network.Addr()), Animation: a})
+	}
+
+	p, err := New(&Config{FPS: 50}, tracks...)
+	c.Assert(err, IsNil)
+	c.Assert(p.Run(context.Background()), IsNil)
+
+	stats := p.Stats()
+	c.Check(stats.Errors, Equals, uint64(0))
+	c.Check(stats.Sent > 3, Equals, true)
+
+	// let the lights finish fading to the last color
+	lightClock.Advance(time.Second)
+
+	for _, device := range fleet {
+		c.Check(device.State().Color, Equals, blue)
+	}
+}
+
+func (*TestSuite) TestNew(c *C) {
+	light := &fakeLight{}
+	a := &Animation{Keyframes: []Keyframe{{Color: red}}}
+
+	tests := []struct {
+		config *Config
+		tracks []*Track
+		err    string
+	}{
+		{nil, nil, "there are no tracks to play"},
+		{nil, []*Track{{Light: light}}, "track 1: the light and animation must be set"},
+		{nil, []*Track{{Light: light, Animation: a}, {Light: light, Animation: &Animation{}}}, "track 2: the animation has no keyframes"},
+		{&Config{FPS: -1}, []*Track{{Light: light, Animation: a}}, "the FPS must be a positive number, got -1"},
+		{&Config{MaxRate: -1}, []*Track{{Light: light, Animation: a}}, "the max rate must be a positive number, got -1"},
+		{&Config{FPS: 1e10}, []*Track{{Light: light, Animation: a}}, "the FPS is too high, got 1e\\+10"},
+	}
+
+	for _, tt := range tests {
+		_, err := New(tt.config, tt.tracks...)
+		c.Check(err, ErrorMatches, tt.err)
+	}
+
+	p, err := New(nil, &Track{Light: light, Animation: a})
+	c.Assert(err, IsNil)
+	c.Check(p.interval, Equals, time.Second/DefaultFPS)
+	c.Check(p.minGap, Equals, time.Second/DefaultMaxRate)
+}
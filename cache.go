@@ -0,0 +1,397 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/protocol/payloads"
+)
+
+// subscriptionBuffer is the number of events buffered for each subscription.
+const subscriptionBuffer = 64
+
+// ErrCacheDisabled is the error returned when subscribing to the changes of
+// a *Client that wasn't configured with the Cache option.
+var ErrCacheDisabled = errors.New("the state cache is not enabled; set the Cache field of the Config")
+
+// DeviceState is the last known state of a device, as recorded by the state
+// cache of a *Client. The pointer fields are nil until the client has seen a
+// message containing them.
+type DeviceState struct {
+	HardwareAddr net.HardwareAddr
+
+	// Addr is the address the device last sent a message from.
+	Addr *net.UDPAddr
+
+	// Online is false once a request to the device has timed out, until the
+	// next message is received from it.
+	Online bool
+
+	// LastSeen is when the last message was received from the device.
+	LastSeen time.Time
+
+	Label        *string
+	Power        *uint16
+	Color        *lifxpayloads.LightHSBK
+	Group        *lifxpayloads.DeviceStateGroup
+	Location     *lifxpayloads.DeviceStateLocation
+	HostFirmware *lifxpayloads.DeviceStateHostFirmware
+	WifiFirmware *lifxpayloads.DeviceStateWifiFirmware
+}
+
+// clone returns a deep copy of the state, so it can be handed out without
+// racing with later updates.
+func (ds *DeviceState) clone() *DeviceState {
+	cp := *ds
+	cp.HardwareAddr = append(net.HardwareAddr(nil), ds.HardwareAddr...)
+
+	if ds.Addr != nil {
+		addr := *ds.Addr
+		cp.Addr = &addr
+	}
+
+	if ds.Label != nil {
+		label := *ds.Label
+		cp.Label = &label
+	}
+
+	if ds.Power != nil {
+		power := *ds.Power
+		cp.Power = &power
+	}
+
+	if ds.Color != nil {
+		color := *ds.Color
+		cp.Color = &color
+	}
+
+	if ds.Group != nil {
+		group := *ds.Group
+		cp.Group = &group
+	}
+
+	if ds.Location != nil {
+		location := *ds.Location
+		cp.Location = &location
+	}
+
+	if ds.HostFirmware != nil {
+		hf := *ds.HostFirmware
+		cp.HostFirmware = &hf
+	}
+
+	if ds.WifiFirmware != nil {
+		wf := *ds.WifiFirmware
+		cp.WifiFirmware = &wf
+	}
+
+	return &cp
+}
+
+// EventType is the type of change described by an Event.
+type EventType uint8
+
+const (
+	// EventPowerChanged is sent when the power level of a device changes.
+	EventPowerChanged EventType = iota + 1
+
+	// EventColorChanged is sent when the color of a light changes.
+	EventColorChanged
+
+	// EventLabelChanged is sent when the label of a device changes.
+	EventLabelChanged
+
+	// EventOffline is sent when a request to a device times out.
+	EventOffline
+
+	// EventOnline is sent when a message is received from a device that
+	// was offline.
+	EventOnline
+)
+
+func (et EventType) String() string {
+	switch et {
+	case EventPowerChanged:
+		return "PowerChanged"
+	case EventColorChanged:
+		return "ColorChanged"
+	case EventLabelChanged:
+		return "LabelChanged"
+	case EventOffline:
+		return "Offline"
+	case EventOnline:
+		return "Online"
+	default:
+		return fmt.Sprintf("EventType(%d)", uint8(et))
+	}
+}
+
+// Event is a change to the state of a device. The change events are only
+// sent when a value changes from one that was already known, and not the
+// first time the value is seen.
+type Event struct {
+	Type EventType
+
+	// Time is when the change was noticed.
+	Time time.Time
+
+	// Previous and Current are the state of the device before and after
+	// the change.
+	Previous *DeviceState
+	Current  *DeviceState
+}
+
+func (e *Event) String() string {
+	if e == nil {
+		return "<*lifx.Event(nil)>"
+	}
+
+	return fmt.Sprintf("<*lifx.Event(%p): Type: %s, HardwareAddr: %s, Time: %s>", e, e.Type, e.Current.HardwareAddr, e.Time)
+}
+
+// Subscription receives the change events from the state cache of a
+// *Client. The events are sent on the C channel, which is closed when the
+// subscription or the client is closed. If the events aren't read quickly
+// enough the buffer fills up, and new events are dropped.
+type Subscription struct {
+	C <-chan Event
+
+	c     chan Event
+	cache *stateCache
+}
+
+// Close stops the subscription, and closes its channel.
+func (s *Subscription) Close() {
+	s.cache.unsubscribe(s)
+}
+
+// stateCache records the state of devices from the messages the client
+// receives.
+type stateCache struct {
+	mu     sync.Mutex
+	states map[string]*DeviceState
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+func newStateCache() *stateCache {
+	return &stateCache{
+		states: make(map[string]*DeviceState),
+		subs:   make(map[*Subscription]struct{}),
+	}
+}
+
+func (sc *stateCache) subscribe() (*Subscription, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.closed {
+		return nil, ErrClientClosed
+	}
+
+	c := make(chan Event, subscriptionBuffer)
+	sub := &Subscription{C: c, c: c, cache: sc}
+	sc.subs[sub] = struct{}{}
+
+	return sub, nil
+}
+
+func (sc *stateCache) unsubscribe(sub *Subscription) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if _, ok := sc.subs[sub]; ok {
+		delete(sc.subs, sub)
+		close(sub.c)
+	}
+}
+
+// close closes all of the subscriptions. The caller must make sure no more
+// packets are going to be passed to update.
+func (sc *stateCache) close() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.closed = true
+
+	for sub := range sc.subs {
+		delete(sc.subs, sub)
+		close(sub.c)
+	}
+}
+
+// get returns a copy of the state of the device, if it's known.
+func (sc *stateCache) get(mac net.HardwareAddr) (*DeviceState, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	ds, ok := sc.states[mac.String()]
+
+	if !ok {
+		return nil, false
+	}
+
+	return ds.clone(), true
+}
+
+// all returns a copy of the state of every device, sorted by MAC address.
+func (sc *stateCache) all() []*DeviceState {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	states := make([]*DeviceState, 0, len(sc.states))
+
+	for _, ds := range sc.states {
+		states = append(states, ds.clone())
+	}
+
+	sort.Sort(byStateHardwareAddr(states))
+
+	return states
+}
+
+type byStateHardwareAddr []*DeviceState
+
+func (b byStateHardwareAddr) Len() int      { return len(b) }
+func (b byStateHardwareAddr) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byStateHardwareAddr) Less(i, j int) bool {
+	return bytes.Compare(b[i].HardwareAddr, b[j].HardwareAddr) < 0
+}
+
+// update records the state from the packet, which was received from addr.
+// Packets without a target, or that aren't State* messages, only update the
+// address of the device and when it was last seen.
+func (sc *stateCache) update(packet *lifxprotocol.Packet, addr net.Addr) {
+	mac := packet.Header.FrameAddress.Target
+
+	if len(mac) == 0 || bytes.Equal(mac, make([]byte, len(mac))) {
+		return
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.closed {
+		return
+	}
+
+	now := time.Now()
+
+	ds, ok := sc.states[mac.String()]
+
+	if !ok {
+		ds = &DeviceState{HardwareAddr: append(net.HardwareAddr(nil), mac...), Online: true}
+		sc.states[mac.String()] = ds
+	}
+
+	prev := ds.clone()
+
+	ds.LastSeen = now
+
+	if udpAddr, ok := addr.(*net.UDPAddr); ok {
+		ds.Addr = udpAddr
+	}
+
+	var events []EventType
+
+	if !ds.Online {
+		ds.Online = true
+		events = append(events, EventOnline)
+	}
+
+	setPower := func(level uint16) {
+		if ds.Power != nil && *ds.Power != level {
+			events = append(events, EventPowerChanged)
+		}
+
+		ds.Power = &level
+	}
+
+	setLabel := func(dl lifxpayloads.DeviceLabel) {
+		label := string(bytes.TrimRight(dl[:], "\x00"))
+
+		if ds.Label != nil && *ds.Label != label {
+			events = append(events, EventLabelChanged)
+		}
+
+		ds.Label = &label
+	}
+
+	switch pl := packet.Payload.(type) {
+	case *lifxpayloads.LightState:
+		if pl.Color != nil {
+			color := *pl.Color
+
+			if ds.Color != nil && *ds.Color != color {
+				events = append(events, EventColorChanged)
+			}
+
+			ds.Color = &color
+		}
+
+		setPower(pl.Power)
+		setLabel(pl.Label)
+	case *lifxpayloads.DeviceStatePower:
+		setPower(pl.Level)
+	case *lifxpayloads.LightStatePower:
+		setPower(pl.Level)
+	case *lifxpayloads.DeviceStateLabel:
+		setLabel(pl.Label)
+	case *lifxpayloads.DeviceStateGroup:
+		group := *pl
+		ds.Group = &group
+	case *lifxpayloads.DeviceStateLocation:
+		location := *pl
+		ds.Location = &location
+	case *lifxpayloads.DeviceStateHostFirmware:
+		hf := *pl
+		ds.HostFirmware = &hf
+	case *lifxpayloads.DeviceStateWifiFirmware:
+		wf := *pl
+		ds.WifiFirmware = &wf
+	}
+
+	sc.notify(events, now, prev, ds)
+}
+
+// offline marks the device as offline, because a request to it timed out.
+func (sc *stateCache) offline(mac net.HardwareAddr) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	ds, ok := sc.states[mac.String()]
+
+	if sc.closed || !ok || !ds.Online {
+		return
+	}
+
+	prev := ds.clone()
+	ds.Online = false
+
+	sc.notify([]EventType{EventOffline}, time.Now(), prev, ds)
+}
+
+// notify sends the events to the subscribers. The caller must hold the lock.
+func (sc *stateCache) notify(events []EventType, now time.Time, prev, cur *DeviceState) {
+	for _, et := range events {
+		for sub := range sc.subs {
+			// each subscriber gets its own copy, so they can't race
+			event := Event{Type: et, Time: now, Previous: prev.clone(), Current: cur.clone()}
+
+			select {
+			case sub.c <- event:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"context"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol/payloads"
+
+	. "gopkg.in/check.v1"
+)
+
+// nextEvent returns the next event from the subscription, failing the test
+// if one doesn't arrive quickly.
+func nextEvent(c *C, sub *Subscription) Event {
+	select {
+	case event, ok := <-sub.C:
+		c.Assert(ok, Equals, true)
+		return event
+	case <-time.After(time.Second):
+		c.Fatal("timed out waiting for an event")
+		return Event{}
+	}
+}
+
+func (*TestSuite) TestEventType_String(c *C) {
+	c.Check(EventPowerChanged.String(), Equals, "PowerChanged")
+	c.Check(EventColorChanged.String(), Equals, "ColorChanged")
+	c.Check(EventLabelChanged.String(), Equals, "LabelChanged")
+	c.Check(EventOffline.String(), Equals, "Offline")
+	c.Check(EventOnline.String(), Equals, "Online")
+	c.Check(EventType(42).String(), Equals, "EventType(42)")
+}
+
+func (*TestSuite) TestClient_Cache(c *C) {
+	client := newTestClient(c, nil)
+
+	_, err := client.Subscribe()
+	c.Check(err, Equals, ErrCacheDisabled)
+	c.Check(client.CachedStates(), IsNil)
+
+	_, ok := client.CachedState(nil)
+	c.Check(ok, Equals, false)
+
+	client.Close()
+
+	fd := newFakeDevice(c)
+	defer fd.close()
+
+	client = newTestClient(c, &Config{Cache: true, Retries: -1})
+	defer client.Close()
+
+	sub, err := client.Subscribe()
+	c.Assert(err, IsNil)
+
+	light := client.Light(fd.mac, fd.addr())
+	ctx := context.Background()
+
+	_, ok = client.CachedState(fd.mac)
+	c.Check(ok, Equals, false)
+
+	//
+	// Test that the state is recorded from the responses
+	//
+	_, err = light.State(ctx)
+	c.Assert(err, IsNil)
+
+	_, err = light.Group(ctx)
+	c.Assert(err, IsNil)
+
+	_, err = light.HostFirmware(ctx)
+	c.Assert(err, IsNil)
+
+	state, ok := client.CachedState(fd.mac)
+	c.Assert(ok, Equals, true)
+	c.Check(state.HardwareAddr.String(), Equals, fd.mac.String())
+	c.Check(state.Addr.String(), Equals, fd.addr().String())
+	c.Check(state.Online, Equals, true)
+	c.Check(state.LastSeen.IsZero(), Equals, false)
+	c.Check(*state.Label, Equals, "Kitchen")
+	c.Check(*state.Power, Equals, uint16(0))
+	c.Check(*state.Color, Equals, lifxpayloads.LightHSBK{Hue: 21845, Saturation: 65535, Brightness: 32768, Kelvin: 3500})
+	c.Check(state.Group.Group, Equals, [16]byte{2})
+	c.Check(state.Location, IsNil)
+	c.Check(state.HostFirmware.Version, Equals, uint32(2))
+	c.Check(state.WifiFirmware, IsNil)
+
+	states := client.CachedStates()
+	c.Assert(states, HasLen, 1)
+	c.Check(states[0].HardwareAddr.String(), Equals, fd.mac.String())
+
+	// the first time a value is seen isn't a change
+	select {
+	case event := <-sub.C:
+		c.Fatalf("unexpected event: %s", &event)
+	default:
+	}
+
+	//
+	// Test that changes send events
+	//
+	c.Assert(light.SetPower(ctx, true, 0), IsNil)
+
+	_, err = light.Power(ctx)
+	c.Assert(err, IsNil)
+
+	event := nextEvent(c, sub)
+	c.Check(event.Type, Equals, EventPowerChanged)
+	c.Check(*event.Previous.Power, Equals, uint16(0))
+	c.Check(*event.Current.Power, Equals, uint16(65535))
+
+	c.Assert(light.SetLabel(ctx, "Pantry"), IsNil)
+	c.Assert(light.SetBrightness(ctx, 100, 0), IsNil)
+
+	event = nextEvent(c, sub)
+	c.Check(event.Type, Equals, EventLabelChanged)
+	c.Check(*event.Previous.Label, Equals, "Kitchen")
+	c.Check(*event.Current.Label, Equals, "Pantry")
+
+	_, err = light.State(ctx)
+	c.Assert(err, IsNil)
+
+	event = nextEvent(c, sub)
+	c.Check(event.Type, Equals, EventColorChanged)
+	c.Check(event.Previous.Color.Brightness, Equals, uint16(32768))
+	c.Check(event.Current.Color.Brightness, Equals, uint16(65535))
+
+	//
+	// Test that a timeout marks the device as offline, and that it comes back
+	// when it responds again
+	//
+	fd.mu.Lock()
+	fd.drop = 1
+	fd.mu.Unlock()
+
+	_, err = light.Power(ctx)
+	c.Check(err, Equals, ErrTimeout)
+
+	event = nextEvent(c, sub)
+	c.Check(event.Type, Equals, EventOffline)
+	c.Check(event.Previous.Online, Equals, true)
+	c.Check(event.Current.Online, Equals, false)
+
+	state, _ = client.CachedState(fd.mac)
+	c.Check(state.Online, Equals, false)
+
+	_, err = light.Power(ctx)
+	c.Assert(err, IsNil)
+
+	event = nextEvent(c, sub)
+	c.Check(event.Type, Equals, EventOnline)
+
+	//
+	// Test that closing the subscription, or the client, closes the channel
+	//
+	sub2, err := client.Subscribe()
+	c.Assert(err, IsNil)
+
+	sub2.Close()
+	sub2.Close()
+
+	_, ok = <-sub2.C
+	c.Check(ok, Equals, false)
+
+	client.Close()
+
+	_, ok = <-sub.C
+	c.Check(ok, Equals, false)
+
+	_, err = client.Subscribe()
+	c.Check(err, Equals, ErrClientClosed)
+}
@@ -0,0 +1,503 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+// Package lifx is a client for controlling LIFX devices over the LAN
+// Protocol (v2.0). It's built on top of the lifxprotocol package, and takes
+// care of building the packet headers, matching responses to their requests,
+// and retrying requests that go unanswered.
+//
+// To get started create a *Client, and then a *Device for each of the
+// devices you want to talk to:
+//
+//	client, err := lifx.NewClient(nil)
+//
+//	if err != nil {
+//		// handle err
+//	}
+//
+//	defer client.Close()
+//
+//	device := client.Device(mac, &net.UDPAddr{IP: ip, Port: lifx.DefaultPort})
+//
+//	label, err := device.Label(context.Background())
+//
+// The devices on the network can be found using the Discover method of the
+// *Client, and grouped by their groups or locations using the Groups and
+// Locations functions.
+package lifx
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol"
+)
+
+// DefaultPort is the UDP port LIFX devices listen on.
+const DefaultPort = 56700
+
+const (
+	// DefaultTimeout is the default amount of time to wait for a response
+	// before retrying a request.
+	DefaultTimeout = 500 * time.Millisecond
+
+	// DefaultRetries is the default number of times a request is retried
+	// before giving up.
+	DefaultRetries = 3
+)
+
+// maxPacketSize is the largest UDP datagram we'll read.
+const maxPacketSize = 65535
+
+// ErrTimeout is the error returned when a device doesn't respond to a request,
+// including all of its retries.
+var ErrTimeout = errors.New("timed out waiting for a response from the device")
+
+// ErrClientClosed is the error returned when a request is made on a *Client
+// that has been closed.
+var ErrClientClosed = errors.New("the client has been closed")
+
+// ErrTooManyRequests is the error returned when there are no sequence numbers
+// available for a new request. The sequence number is a uint8 in the protocol,
+// so there can only be 256 requests in flight at once.
+var ErrTooManyRequests = errors.New("too many requests in flight; there are no sequence numbers available")
+
+// byteOrder is the byte order used by the LIFX protocol.
+var byteOrder = binary.LittleEndian
+
+// Config is the configuration for a *Client. The zero value is usable, and
+// any fields that aren't set use their defaults.
+type Config struct {
+	// Conn is the connection used to send and receive packets. If nil, the
+	// client listens on a random UDP port on all interfaces.
+	Conn net.PacketConn
+
+	// Broadcast is the address used for messages sent to all devices. If
+	// nil, the IPv4 broadcast address (255.255.255.255) and DefaultPort are
+	// used.
+	Broadcast *net.UDPAddr
+
+	// Timeout is how long to wait for a response before retrying the
+	// request. If 0, DefaultTimeout is used.
+	Timeout time.Duration
+
+	// Retries is the number of times to retry a request that goes
+	// unanswered. If 0, DefaultRetries is used. Set it to a negative value
+	// to never retry.
+	Retries int
+
+	// Source is the unique value identifying this client to the devices.
+	// Devices include it in their responses. If 0, a random value is used.
+	Source uint32
+
+	// Cache enables the state cache, which records the state of each device
+	// from the State* messages the client receives. See the CachedState and
+	// Subscribe methods.
+	Cache bool
+}
+
+// Client is used for communicating with LIFX devices. It's safe for
+// concurrent use by multiple goroutines.
+type Client struct {
+	conn          net.PacketConn
+	broadcastAddr *net.UDPAddr
+	timeout       time.Duration
+	retries       int
+	source        uint32
+	cache         *stateCache
+	stats         *statsRecorder
+
+	mu      sync.Mutex
+	seq     uint8
+	pending map[uint8]*pendingRequest
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	done      chan struct{}
+}
+
+// pendingRequest is a request waiting for its response. If handler is set,
+// every response is passed to it instead of being sent on the channel; this
+// is used for broadcasts, which can have any number of responses.
+type pendingRequest struct {
+	target    net.HardwareAddr
+	resType   uint16
+	responses chan *lifxprotocol.Packet
+	handler   func(*lifxprotocol.Packet, net.Addr)
+}
+
+// NewClient returns a new *Client using the configuration. The config can be
+// nil to use the defaults. The client must be closed when it's no longer
+// needed.
+func NewClient(config *Config) (*Client, error) {
+	if config == nil {
+		config = &Config{}
+	}
+
+	c := &Client{
+		conn:          config.Conn,
+		broadcastAddr: config.Broadcast,
+		timeout:       config.Timeout,
+		retries:       config.Retries,
+		source:        config.Source,
+		stats:         newStatsRecorder(),
+		pending:       make(map[uint8]*pendingRequest),
+		closed:        make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	if config.Cache {
+		c.cache = newStateCache()
+	}
+
+	if c.conn == nil {
+		conn, err := net.ListenPacket("udp4", ":0")
+
+		if err != nil {
+			return nil, err
+		}
+
+		c.conn = conn
+	}
+
+	if c.broadcastAddr == nil {
+		c.broadcastAddr = &net.UDPAddr{IP: net.IPv4bcast, Port: DefaultPort}
+	}
+
+	if c.timeout <= 0 {
+		c.timeout = DefaultTimeout
+	}
+
+	switch {
+	case c.retries == 0:
+		c.retries = DefaultRetries
+	case c.retries < 0:
+		c.retries = 0
+	}
+
+	// a source of 0 tells the devices to broadcast their responses, and 1 is
+	// used by some of the LIFX apps, so avoid both of them
+	for c.source < 2 {
+		c.source = rand.New(rand.NewSource(time.Now().UnixNano())).Uint32()
+	}
+
+	go c.receive()
+
+	return c, nil
+}
+
+// Source returns the source identifier the client uses in its requests.
+func (c *Client) Source() uint32 { return c.source }
+
+// LocalAddr returns the local network address of the client's connection.
+func (c *Client) LocalAddr() net.Addr { return c.conn.LocalAddr() }
+
+// CachedState returns the last known state of the device with the MAC
+// address. The second value is false if the state cache isn't enabled, or
+// the client hasn't received any messages from the device.
+func (c *Client) CachedState(mac net.HardwareAddr) (*DeviceState, bool) {
+	if c.cache == nil {
+		return nil, false
+	}
+
+	return c.cache.get(mac)
+}
+
+// CachedStates returns the last known state of every device the client has
+// received messages from, sorted by MAC address. It returns nil if the state
+// cache isn't enabled.
+func (c *Client) CachedStates() []*DeviceState {
+	if c.cache == nil {
+		return nil
+	}
+
+	return c.cache.all()
+}
+
+// Subscribe returns a *Subscription that receives an Event for each change to
+// the state of a device. ErrCacheDisabled is returned if the state cache isn't
+// enabled.
+func (c *Client) Subscribe() (*Subscription, error) {
+	if c.cache == nil {
+		return nil, ErrCacheDisabled
+	}
+
+	return c.cache.subscribe()
+}
+
+// Close closes the client and its connection. Any requests still waiting for
+// a response return ErrClientClosed.
+func (c *Client) Close() error {
+	var err error
+
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		err = c.conn.Close()
+		<-c.done
+
+		if c.cache != nil {
+			c.cache.close()
+		}
+	})
+
+	return err
+}
+
+// receive reads packets from the connection and hands the responses to the
+// requests waiting for them.
+func (c *Client) receive() {
+	defer close(c.done)
+
+	buf := make([]byte, maxPacketSize)
+
+	for {
+		n, addr, err := c.conn.ReadFrom(buf)
+
+		if err != nil {
+			select {
+			case <-c.closed:
+				return
+			default:
+			}
+
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+
+			return
+		}
+
+		packet := &lifxprotocol.Packet{}
+
+		// ignore anything that isn't a valid packet for a known message type
+		if err := packet.UnmarshalPacket(bytes.NewReader(buf[:n]), byteOrder); err != nil {
+			continue
+		}
+
+		if c.cache != nil {
+			c.cache.update(packet, addr)
+		}
+
+		c.dispatch(packet, addr)
+	}
+}
+
+// dispatch delivers the packet to the request it's responding to, if there is
+// one waiting for it. The addr is the address the packet was received from.
+func (c *Client) dispatch(packet *lifxprotocol.Packet, addr net.Addr) {
+	if packet.Header.Frame.Source != c.source {
+		return
+	}
+
+	c.mu.Lock()
+	req, ok := c.pending[packet.Header.FrameAddress.Sequence]
+	c.mu.Unlock()
+
+	if !ok || packet.Header.ProtocolHeader.Type != req.resType {
+		return
+	}
+
+	if req.target != nil && !bytes.Equal(req.target, packet.Header.FrameAddress.Target) {
+		return
+	}
+
+	if req.handler != nil {
+		req.handler(packet, addr)
+		return
+	}
+
+	// if there's already a response waiting this is a duplicate, which
+	// happens when a retried request gets more than one response
+	select {
+	case req.responses <- packet:
+	default:
+	}
+}
+
+// register reserves a sequence number for a request.
+func (c *Client) register(req *pendingRequest) (uint8, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := 0; i < 256; i++ {
+		c.seq++
+
+		if _, ok := c.pending[c.seq]; !ok {
+			c.pending[c.seq] = req
+			return c.seq, nil
+		}
+	}
+
+	return 0, ErrTooManyRequests
+}
+
+func (c *Client) unregister(seq uint8) {
+	c.mu.Lock()
+	delete(c.pending, seq)
+	c.mu.Unlock()
+}
+
+// request sends the message to the device at addr, and waits for the response
+// of resType. If resType is DeviceAcknowledgement the message is sent with the
+// AckRequired flag, otherwise the ResRequired flag is set. The message is
+// retried if there is no response within the timeout.
+func (c *Client) request(ctx context.Context, addr net.Addr, target net.HardwareAddr, msgType uint16, payload lifxprotocol.PacketComponent, resType uint16) (*lifxprotocol.Packet, error) {
+	select {
+	case <-c.closed:
+		return nil, ErrClientClosed
+	default:
+	}
+
+	req := &pendingRequest{
+		target:    target,
+		resType:   resType,
+		responses: make(chan *lifxprotocol.Packet, 1),
+	}
+
+	seq, err := c.register(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer c.unregister(seq)
+
+	packet, err := c.marshal(target, seq, msgType, payload, resType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the stats are kept per device, so requests without a target aren't
+	// recorded
+	record := target != nil
+
+	if record {
+		c.stats.request(target)
+	}
+
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if _, err := c.conn.WriteTo(packet, addr); err != nil {
+			return nil, err
+		}
+
+		sent := time.Now()
+
+		if record {
+			c.stats.sent(target, msgType, attempt > 0)
+		}
+
+		timer := time.NewTimer(c.timeout)
+
+		select {
+		case res := <-req.responses:
+			timer.Stop()
+
+			// the response to a retried request could be for any of the
+			// attempts, so only the first attempt gives a usable RTT
+			if record {
+				c.stats.answered(target, time.Since(sent), attempt == 0)
+			}
+
+			return res, nil
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-c.done:
+			timer.Stop()
+			return nil, ErrClientClosed
+		case <-timer.C:
+			if record {
+				c.stats.lost(target)
+			}
+		}
+	}
+
+	if record {
+		c.stats.timeout(target)
+
+		if c.cache != nil {
+			c.cache.offline(target)
+		}
+	}
+
+	return nil, ErrTimeout
+}
+
+// broadcast sends the message to all devices, and calls fn with each of the
+// responses of resType along with the address it came from. The message is
+// sent again after each timeout until the retries are exhausted, so fn can be
+// called more than once for the same device. fn is called from the goroutine
+// receiving the packets, so it must not block.
+func (c *Client) broadcast(ctx context.Context, msgType uint16, payload lifxprotocol.PacketComponent, resType uint16, fn func(*lifxprotocol.Packet, net.Addr)) error {
+	select {
+	case <-c.closed:
+		return ErrClientClosed
+	default:
+	}
+
+	seq, err := c.register(&pendingRequest{resType: resType, handler: fn})
+
+	if err != nil {
+		return err
+	}
+
+	defer c.unregister(seq)
+
+	packet, err := c.marshal(nil, seq, msgType, payload, resType)
+
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if _, err := c.conn.WriteTo(packet, c.broadcastAddr); err != nil {
+			return err
+		}
+
+		timer := time.NewTimer(c.timeout)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-c.done:
+			timer.Stop()
+			return ErrClientClosed
+		case <-timer.C:
+		}
+	}
+
+	return nil
+}
+
+// marshal builds the packet for a request.
+func (c *Client) marshal(target net.HardwareAddr, seq uint8, msgType uint16, payload lifxprotocol.PacketComponent, resType uint16) ([]byte, error) {
+	frame := lifxprotocol.NewFrame()
+	frame.Source = c.source
+	frame.Tagged = target == nil
+
+	fra := lifxprotocol.NewFrameAddress()
+	fra.Target = target
+	fra.Sequence = seq
+	fra.AckRequired = resType == lifxprotocol.DeviceAcknowledgement
+	fra.ResRequired = !fra.AckRequired
+
+	p := &lifxprotocol.Packet{
+		Header: &lifxprotocol.Header{
+			Frame:          frame,
+			FrameAddress:   fra,
+			ProtocolHeader: &lifxprotocol.ProtocolHeader{Type: msgType},
+		},
+		Payload: payload,
+	}
+
+	return p.MarshalPacket(byteOrder)
+}
@@ -0,0 +1,389 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/protocol/payloads"
+
+	. "gopkg.in/check.v1"
+)
+
+type TestSuite struct{}
+
+var _ = Suite(&TestSuite{})
+
+func Test(t *testing.T) { TestingT(t) }
+
+// fakeDevice is a minimal LIFX device listening on the loopback interface,
+// used to test the client without any real devices.
+type fakeDevice struct {
+	conn net.PacketConn
+	mac  net.HardwareAddr
+
+	mu       sync.Mutex
+	drop     int // number of packets to ignore before responding
+	source   uint32
+	received []*lifxprotocol.Packet
+	label    lifxpayloads.DeviceLabel
+	power    uint16
+	color    lifxpayloads.LightHSBK
+	group    lifxpayloads.DeviceStateGroup
+	location lifxpayloads.DeviceStateLocation
+	echo     func(lifxpayloads.DeviceEchoPayload) lifxpayloads.DeviceEchoPayload
+}
+
+func newFakeDevice(c *C) *fakeDevice {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+
+	fd := &fakeDevice{
+		conn:  conn,
+		mac:   net.HardwareAddr{0xd0, 0x73, 0xd5, 0x01, 0x02, 0x03},
+		label: lifxpayloads.NewDeviceLabelTrunc([]byte("Kitchen")),
+		color: lifxpayloads.LightHSBK{Hue: 21845, Saturation: 65535, Brightness: 32768, Kelvin: 3500},
+		group: lifxpayloads.DeviceStateGroup{
+			Group:     [16]byte{2},
+			Label:     lifxpayloads.NewDeviceLabelTrunc([]byte("Downstairs")),
+			UpdatedAt: 2,
+		},
+		location: lifxpayloads.DeviceStateLocation{
+			Location:  [16]byte{1},
+			Label:     lifxpayloads.NewDeviceLabelTrunc([]byte("Home")),
+			UpdatedAt: 1,
+		},
+	}
+
+	go fd.serve()
+
+	return fd
+}
+
+func (fd *fakeDevice) addr() *net.UDPAddr { return fd.conn.LocalAddr().(*net.UDPAddr) }
+
+func (fd *fakeDevice) close() { fd.conn.Close() }
+
+func (fd *fakeDevice) packets() []*lifxprotocol.Packet {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+
+	return append([]*lifxprotocol.Packet(nil), fd.received...)
+}
+
+func (fd *fakeDevice) serve() {
+	buf := make([]byte, maxPacketSize)
+
+	for {
+		n, addr, err := fd.conn.ReadFrom(buf)
+
+		if err != nil {
+			return
+		}
+
+		req := &lifxprotocol.Packet{}
+
+		if err := req.UnmarshalPacket(bytes.NewReader(buf[:n]), byteOrder); err != nil {
+			continue
+		}
+
+		fd.mu.Lock()
+
+		fd.received = append(fd.received, req)
+
+		if fd.drop > 0 {
+			fd.drop--
+			fd.mu.Unlock()
+			continue
+		}
+
+		responses := fd.handle(req)
+
+		fd.mu.Unlock()
+
+		for _, res := range responses {
+			fd.conn.WriteTo(res, addr)
+		}
+	}
+}
+
+// handle returns the responses to the packet. The caller must hold the lock.
+func (fd *fakeDevice) handle(req *lifxprotocol.Packet) [][]byte {
+	var responses [][]byte
+
+	respond := func(msgType uint16, payload lifxprotocol.PacketComponent) {
+		source := req.Header.Frame.Source
+
+		if fd.source != 0 {
+			source = fd.source
+		}
+
+		frame := lifxprotocol.NewFrame()
+		frame.Source = source
+
+		p := &lifxprotocol.Packet{
+			Header: &lifxprotocol.Header{
+				Frame:          frame,
+				FrameAddress:   &lifxprotocol.FrameAddress{Target: fd.mac, Sequence: req.Header.FrameAddress.Sequence},
+				ProtocolHeader: &lifxprotocol.ProtocolHeader{Type: msgType},
+			},
+			Payload: payload,
+		}
+
+		data, err := p.MarshalPacket(byteOrder)
+
+		if err != nil {
+			panic(err)
+		}
+
+		responses = append(responses, data)
+	}
+
+	if req.Header.FrameAddress.AckRequired {
+		respond(lifxprotocol.DeviceAcknowledgement, &lifxpayloads.Empty{})
+	}
+
+	switch payload := req.Payload.(type) {
+	case *lifxpayloads.DeviceStateLabel:
+		fd.label = payload.Label
+	case *lifxpayloads.DeviceStatePower:
+		fd.power = payload.Level
+	case *lifxpayloads.LightSetPower:
+		fd.power = payload.Level
+	case *lifxpayloads.LightSetColor:
+		fd.color = *payload.Color
+	case *lifxpayloads.LightSetWaveform:
+		// a non-transient waveform leaves the light at the waveform color
+		if !payload.Transient {
+			fd.color = *payload.Color
+		}
+	}
+
+	switch req.Header.ProtocolHeader.Type {
+	case lifxprotocol.DeviceGetService:
+		respond(lifxprotocol.DeviceStateService, &lifxpayloads.DeviceStateService{Service: ServiceUDP, Port: uint32(fd.addr().Port)})
+	case lifxprotocol.DeviceGetLabel:
+		respond(lifxprotocol.DeviceStateLabel, &lifxpayloads.DeviceStateLabel{Label: fd.label})
+	case lifxprotocol.DeviceGetPower:
+		respond(lifxprotocol.DeviceStatePower, &lifxpayloads.DeviceStatePower{Level: fd.power})
+	case lifxprotocol.LightGetPower:
+		respond(lifxprotocol.LightStatePower, &lifxpayloads.LightStatePower{Level: fd.power})
+	case lifxprotocol.LightGet:
+		color := fd.color
+		respond(lifxprotocol.LightState, &lifxpayloads.LightState{Color: &color, Power: fd.power, Label: fd.label})
+	case lifxprotocol.DeviceGetHostInfo:
+		respond(lifxprotocol.DeviceStateHostInfo, &lifxpayloads.DeviceStateHostInfo{Signal: 1e-5, Tx: 1, Rx: 2})
+	case lifxprotocol.DeviceGetHostFirmware:
+		respond(lifxprotocol.DeviceStateHostFirmware, &lifxpayloads.DeviceStateHostFirmware{Build: 1, Version: 2})
+	case lifxprotocol.DeviceGetWifiInfo:
+		respond(lifxprotocol.DeviceStateWifiInfo, &lifxpayloads.DeviceStateWifiInfo{Signal: 1e-6, Tx: 3, Rx: 4})
+	case lifxprotocol.DeviceGetWifiFirmware:
+		respond(lifxprotocol.DeviceStateWifiFirmware, &lifxpayloads.DeviceStateWifiFirmware{Build: 3, Version: 4})
+	case lifxprotocol.DeviceGetVersion:
+		respond(lifxprotocol.DeviceStateVersion, &lifxpayloads.DeviceStateVersion{Vendor: 1, Product: 22, Version: 0})
+	case lifxprotocol.DeviceGetInfo:
+		respond(lifxprotocol.DeviceStateInfo, &lifxpayloads.DeviceStateInfo{Time: 1, Uptime: 2, Downtime: 3})
+	case lifxprotocol.DeviceGetLocation:
+		location := fd.location
+		respond(lifxprotocol.DeviceStateLocation, &location)
+	case lifxprotocol.DeviceGetGroup:
+		group := fd.group
+		respond(lifxprotocol.DeviceStateGroup, &group)
+	case lifxprotocol.DeviceEchoRequest:
+		echo := *req.Payload.(*lifxpayloads.DeviceEcho)
+
+		if fd.echo != nil {
+			echo.Payload = fd.echo(echo.Payload)
+		}
+
+		respond(lifxprotocol.DeviceEchoResponse, &echo)
+	}
+
+	return responses
+}
+
+// newTestClient returns a client on the loopback interface with a short
+// timeout, so that the tests for retries run quickly.
+func newTestClient(c *C, config *Config) *Client {
+	if config == nil {
+		config = &Config{}
+	}
+
+	if config.Conn == nil {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		c.Assert(err, IsNil)
+
+		config.Conn = conn
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = 50 * time.Millisecond
+	}
+
+	client, err := NewClient(config)
+	c.Assert(err, IsNil)
+
+	return client
+}
+
+func (*TestSuite) TestNewClient(c *C) {
+	client, err := NewClient(nil)
+	c.Assert(err, IsNil)
+	defer client.Close()
+
+	c.Check(client.Source() > 1, Equals, true)
+	c.Check(client.timeout, Equals, DefaultTimeout)
+	c.Check(client.retries, Equals, DefaultRetries)
+	c.Check(client.broadcastAddr.String(), Equals, "255.255.255.255:56700")
+	c.Check(client.LocalAddr(), NotNil)
+
+	client = newTestClient(c, &Config{Source: 42, Retries: -1, Broadcast: &net.UDPAddr{IP: net.IPv4(10, 0, 0, 255), Port: 1234}})
+	defer client.Close()
+
+	c.Check(client.Source(), Equals, uint32(42))
+	c.Check(client.retries, Equals, 0)
+	c.Check(client.broadcastAddr.String(), Equals, "10.0.0.255:1234")
+}
+
+func (*TestSuite) TestClient_Close(c *C) {
+	client := newTestClient(c, nil)
+
+	c.Check(client.Close(), IsNil)
+
+	// closing twice should be safe
+	c.Check(client.Close(), IsNil)
+
+	_, err := client.Device(nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: DefaultPort}).Label(context.Background())
+	c.Check(err, Equals, ErrClientClosed)
+}
+
+func (*TestSuite) TestClient_request(c *C) {
+	fd := newFakeDevice(c)
+	defer fd.close()
+
+	client := newTestClient(c, &Config{Source: 4242})
+	defer client.Close()
+
+	device := client.Device(fd.mac, fd.addr())
+
+	//
+	// Test that the request has the right header
+	//
+	_, err := device.Label(context.Background())
+	c.Assert(err, IsNil)
+
+	packets := fd.packets()
+	c.Assert(packets, HasLen, 1)
+
+	hdr := packets[0].Header
+	c.Check(hdr.Frame.Source, Equals, uint32(4242))
+	c.Check(hdr.Frame.Tagged, Equals, false)
+	c.Check(hdr.Frame.Addressable, Equals, true)
+	c.Check(hdr.Frame.Protocol, Equals, uint16(1024))
+	c.Check(hdr.FrameAddress.Target.String(), Equals, fd.mac.String())
+	c.Check(hdr.FrameAddress.ResRequired, Equals, true)
+	c.Check(hdr.FrameAddress.AckRequired, Equals, false)
+	c.Check(hdr.ProtocolHeader.Type, Equals, lifxprotocol.DeviceGetLabel)
+
+	// setters should only ask for an acknowledgement
+	c.Assert(device.SetLabel(context.Background(), "Bedroom"), IsNil)
+
+	packets = fd.packets()
+	c.Assert(packets, HasLen, 2)
+	c.Check(packets[1].Header.FrameAddress.AckRequired, Equals, true)
+	c.Check(packets[1].Header.FrameAddress.ResRequired, Equals, false)
+
+	// each request should use a new sequence number
+	c.Check(packets[1].Header.FrameAddress.Sequence, Not(Equals), packets[0].Header.FrameAddress.Sequence)
+}
+
+func (*TestSuite) TestClient_request_Retries(c *C) {
+	fd := newFakeDevice(c)
+	defer fd.close()
+
+	client := newTestClient(c, &Config{Retries: 2})
+	defer client.Close()
+
+	device := client.Device(fd.mac, fd.addr())
+
+	// the device ignores the first two attempts
+	fd.mu.Lock()
+	fd.drop = 2
+	fd.mu.Unlock()
+
+	label, err := device.Label(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(label, Equals, "Kitchen")
+
+	packets := fd.packets()
+	c.Assert(packets, HasLen, 3)
+
+	// the retries should be the same packet
+	for _, p := range packets {
+		c.Check(p.Header.FrameAddress.Sequence, Equals, packets[0].Header.FrameAddress.Sequence)
+	}
+
+	//
+	// Test that the request times out after the last retry
+	//
+	fd.mu.Lock()
+	fd.drop = 3
+	fd.mu.Unlock()
+
+	_, err = device.Label(context.Background())
+	c.Check(err, Equals, ErrTimeout)
+	c.Check(fd.packets(), HasLen, 6)
+}
+
+func (*TestSuite) TestClient_request_Context(c *C) {
+	fd := newFakeDevice(c)
+	defer fd.close()
+
+	client := newTestClient(c, &Config{Timeout: time.Second})
+	defer client.Close()
+
+	fd.mu.Lock()
+	fd.drop = 1
+	fd.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	_, err := client.Device(fd.mac, fd.addr()).Label(ctx)
+	c.Check(err, Equals, context.DeadlineExceeded)
+	c.Check(time.Since(start) < time.Second, Equals, true)
+}
+
+func (*TestSuite) TestClient_request_IgnoresOtherResponses(c *C) {
+	fd := newFakeDevice(c)
+	defer fd.close()
+
+	client := newTestClient(c, &Config{Retries: -1})
+	defer client.Close()
+
+	// responses for another client should be ignored
+	fd.mu.Lock()
+	fd.source = client.Source() + 1
+	fd.mu.Unlock()
+
+	_, err := client.Device(fd.mac, fd.addr()).Label(context.Background())
+	c.Check(err, Equals, ErrTimeout)
+
+	// responses from another device should be ignored
+	fd.mu.Lock()
+	fd.source = 0
+	fd.mu.Unlock()
+
+	_, err = client.Device(net.HardwareAddr{1, 2, 3, 4, 5, 6}, fd.addr()).Label(context.Background())
+	c.Check(err, Equals, ErrTimeout)
+}
@@ -0,0 +1,157 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/theckman/go-lifx"
+	"github.com/theckman/go-lifx/protocol/payloads"
+)
+
+func init() {
+	register(&command{
+		name:    "on",
+		args:    "<selector...>",
+		summary: "power devices on",
+		setup:   setupPower(true),
+	})
+
+	register(&command{
+		name:    "off",
+		args:    "<selector...>",
+		summary: "power devices off",
+		setup:   setupPower(false),
+	})
+
+	register(&command{
+		name:    "color",
+		args:    "<selector...> <color>",
+		summary: "change the color of lights",
+		setup: func(fs *flag.FlagSet) func(*env, []string) error {
+			duration := fs.Duration("duration", 0, "how long to fade to the color over")
+
+			return func(e *env, args []string) error {
+				return runColor(e, args, *duration)
+			}
+		},
+	})
+
+	register(&command{
+		name:    "scene",
+		args:    "<file>",
+		summary: "apply a scene from a JSON, YAML, or TOML file",
+		setup: func(fs *flag.FlagSet) func(*env, []string) error {
+			return runScene
+		},
+	})
+}
+
+// setupPower returns the setup function of the on or off command.
+func setupPower(on bool) func(*flag.FlagSet) func(*env, []string) error {
+	return func(fs *flag.FlagSet) func(*env, []string) error {
+		duration := fs.Duration("duration", 0, "how long to fade the power over")
+
+		return func(e *env, args []string) error {
+			return runPower(e, args, on, *duration)
+		}
+	}
+}
+
+func runPower(e *env, args []string, on bool, duration time.Duration) error {
+	client, err := e.client(false)
+
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	devices, err := e.resolve(client, args)
+
+	if err != nil {
+		return err
+	}
+
+	errs := each(e.ctx, devices, func(ctx context.Context, _ int, device *lifx.Device) error {
+		return client.Light(device.HardwareAddr, device.Addr).SetPower(ctx, on, duration)
+	})
+
+	return e.writeResults(devices, errs)
+}
+
+func runColor(e *env, args []string, duration time.Duration) error {
+	if len(args) < 2 {
+		return usageError("color takes at least one selector, and the color")
+	}
+
+	hsbk, err := lifxpayloads.ParseColor(args[len(args)-1])
+
+	if err != nil {
+		return usageError(err.Error())
+	}
+
+	client, err := e.client(false)
+
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	devices, err := e.resolve(client, args[:len(args)-1])
+
+	if err != nil {
+		return err
+	}
+
+	errs := each(e.ctx, devices, func(ctx context.Context, _ int, device *lifx.Device) error {
+		return client.Light(device.HardwareAddr, device.Addr).SetColor(ctx, *hsbk, duration)
+	})
+
+	return e.writeResults(devices, errs)
+}
+
+func runScene(e *env, args []string) error {
+	if len(args) != 1 {
+		return usageError("scene takes the file of the scene")
+	}
+
+	scene, err := lifx.LoadScene(args[0])
+
+	if err != nil {
+		return usageError(err.Error())
+	}
+
+	client, err := e.client(false)
+
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	results, err := client.ApplyScene(e.ctx, scene)
+
+	if err != nil {
+		return err
+	}
+
+	if len(results) == 0 {
+		return fmt.Errorf("no devices match the scene in %s", args[0])
+	}
+
+	devices := make([]*lifx.Device, len(results))
+	errs := make([]error, len(results))
+
+	for i, result := range results {
+		devices[i], errs[i] = result.Device, result.Err
+	}
+
+	return e.writeResults(devices, errs)
+}
@@ -0,0 +1,459 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/theckman/go-lifx"
+	"github.com/theckman/go-lifx/protocol"
+)
+
+// the exit statuses of the decode command, in addition to the usual ones
+const (
+	exitMalformed   = 3
+	exitUnknownType = 4
+)
+
+// the input formats of the decode command
+const (
+	inputAuto   = "auto"
+	inputHex    = "hex"
+	inputBase64 = "base64"
+	inputRaw    = "raw"
+	inputPcap   = "pcap"
+)
+
+func init() {
+	register(&command{
+		name:    "decode",
+		args:    "[packet...]",
+		summary: "decode packets from hex, base64, binary, or capture files",
+		setup: func(fs *flag.FlagSet) func(*env, []string) error {
+			cfg := &decodeConfig{}
+
+			fs.StringVar(&cfg.file, "file", "", "read the packets from the file, or stdin if it's -")
+			fs.StringVar(&cfg.input, "input", inputAuto, "the input format: auto, hex, base64, raw, or pcap")
+			fs.IntVar(&cfg.port, "port", lifx.DefaultPort, "only decode the UDP datagrams in a capture sent from or to the port; 0 for all")
+			fs.BoolVar(&cfg.hexdump, "hexdump", false, "print an annotated hex dump instead of a tree")
+
+			return func(e *env, args []string) error {
+				return runDecode(e, args, cfg)
+			}
+		},
+	})
+}
+
+type decodeConfig struct {
+	file    string
+	input   string
+	port    int
+	hexdump bool
+}
+
+// encodedPacket is a packet to decode, and where it came from.
+type encodedPacket struct {
+	source  string
+	capture *capturedPacket
+	data    []byte
+}
+
+// decodedJSON is a decoded packet in the JSON output. The packet is set if
+// at least its header could be decoded.
+type decodedJSON struct {
+	Source string               `json:"source"`
+	Time   *time.Time           `json:"time,omitempty"`
+	Src    string               `json:"src,omitempty"`
+	Dst    string               `json:"dst,omitempty"`
+	Packet *lifxprotocol.Packet `json:"packet,omitempty"`
+	Error  string               `json:"error,omitempty"`
+}
+
+func runDecode(e *env, args []string, cfg *decodeConfig) error {
+	switch cfg.input {
+	case inputAuto, inputHex, inputBase64, inputRaw, inputPcap:
+	default:
+		return usageError(fmt.Sprintf("unknown input format %q", cfg.input))
+	}
+
+	if len(args) > 0 && cfg.file != "" {
+		return usageError("packets can't be given as arguments and with --file")
+	}
+
+	var (
+		packets []*encodedPacket
+		err     error
+	)
+
+	if len(args) > 0 {
+		packets, err = decodeArgs(args, cfg.input)
+	} else {
+		packets, err = readPackets(cfg)
+	}
+
+	if err != nil {
+		if _, ok := err.(usageError); ok {
+			return err
+		}
+
+		fmt.Fprintf(e.stderr, "lifx decode: %s\n", err)
+		return exitError(exitMalformed)
+	}
+
+	var (
+		out       []decodedJSON
+		malformed bool
+		unknown   bool
+	)
+
+	for i, ep := range packets {
+		packet, status, err := decodePacket(ep.data)
+
+		switch status {
+		case exitMalformed:
+			malformed = true
+		case exitUnknownType:
+			unknown = true
+		}
+
+		if err != nil {
+			fmt.Fprintf(e.stderr, "lifx decode: %s: %s\n", ep.source, err)
+		}
+
+		if e.opts.json {
+			dj := decodedJSON{Source: ep.source, Packet: packet}
+
+			if ep.capture != nil {
+				dj.Time = &ep.capture.time
+				dj.Src, dj.Dst = ep.capture.src.String(), ep.capture.dst.String()
+			}
+
+			if err != nil {
+				dj.Error = err.Error()
+			}
+
+			out = append(out, dj)
+			continue
+		}
+
+		if packet == nil {
+			continue
+		}
+
+		if i > 0 {
+			fmt.Fprintln(e.stdout)
+		}
+
+		title := ep.source
+
+		if ep.capture != nil {
+			title = fmt.Sprintf("%s, %s, %s -> %s", ep.source, ep.capture.time.Format(time.RFC3339Nano), ep.capture.src, ep.capture.dst)
+		}
+
+		fmt.Fprintf(e.stdout, "%s:\n%s\n", title, dissect(packet, cfg.hexdump))
+	}
+
+	if e.opts.json {
+		if out == nil {
+			out = []decodedJSON{}
+		}
+
+		if err := writeJSON(e.stdout, out); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case malformed:
+		return exitError(exitMalformed)
+	case unknown:
+		return exitError(exitUnknownType)
+	}
+
+	return nil
+}
+
+// dissect renders the packet as a tree, or as an annotated hex dump. Packets
+// without a payload can only be rendered as a tree.
+func dissect(packet *lifxprotocol.Packet, hexdump bool) string {
+	if hexdump && packet.Payload != nil {
+		if dump, err := lifxprotocol.DissectHex(packet, binary.LittleEndian); err == nil {
+			return dump
+		}
+	}
+
+	return lifxprotocol.Dissect(packet)
+}
+
+// decodePacket unmarshals the packet, and returns the exit status the result
+// should cause. The packet is returned along with the error if its header
+// could be decoded, so it can still be shown.
+func decodePacket(data []byte) (*lifxprotocol.Packet, int, error) {
+	packet := &lifxprotocol.Packet{}
+
+	err := packet.UnmarshalPacket(bytes.NewReader(data), binary.LittleEndian)
+
+	switch {
+	case err == lifxprotocol.ErrUnknownMessageType:
+		return packet, exitUnknownType, fmt.Errorf("unknown message type %d", packet.Header.ProtocolHeader.Type)
+	case err != nil && packet.Header != nil:
+		return packet, exitMalformed, fmt.Errorf("the payload is malformed: %s", err)
+	case err != nil:
+		return nil, exitMalformed, fmt.Errorf("the header is malformed: %s", err)
+	}
+
+	if size := int(packet.Header.Frame.Size); size != len(data) {
+		return packet, exitMalformed, fmt.Errorf("the frame size is %d bytes, but the packet is %d bytes", size, len(data))
+	}
+
+	return packet, exitOK, nil
+}
+
+// decodeArgs decodes the packets given as arguments, which are text.
+func decodeArgs(args []string, input string) ([]*encodedPacket, error) {
+	if input == inputRaw || input == inputPcap {
+		return nil, usageError(fmt.Sprintf("packets given as arguments can't be in the %s format", input))
+	}
+
+	packets := make([]*encodedPacket, len(args))
+
+	for i, arg := range args {
+		source := fmt.Sprintf("argument %d", i+1)
+
+		data, err := decodeText(arg, input)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", source, err)
+		}
+
+		packets[i] = &encodedPacket{source: source, data: data}
+	}
+
+	return packets, nil
+}
+
+// readPackets reads the packets from the file, or stdin.
+func readPackets(cfg *decodeConfig) ([]*encodedPacket, error) {
+	var (
+		data []byte
+		err  error
+	)
+
+	if cfg.file == "" || cfg.file == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(cfg.file)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	input := cfg.input
+
+	if input == inputAuto {
+		switch {
+		case isCapture(data):
+			input = inputPcap
+		case isText(data):
+			input = inputAuto
+		default:
+			input = inputRaw
+		}
+	}
+
+	switch input {
+	case inputRaw:
+		return []*encodedPacket{{source: "packet 1", data: data}}, nil
+
+	case inputPcap:
+		captured, err := readCapture(data, cfg.port)
+
+		if err != nil {
+			return nil, err
+		}
+
+		packets := make([]*encodedPacket, len(captured))
+
+		for i, cp := range captured {
+			packets[i] = &encodedPacket{source: fmt.Sprintf("frame %d", cp.n), capture: cp, data: cp.data}
+		}
+
+		return packets, nil
+	}
+
+	// text input has a packet in each block of lines, separated by blank
+	// lines, so a multi-line hex dump is a single packet
+	var packets []*encodedPacket
+
+	for _, block := range splitBlocks(string(data)) {
+		source := fmt.Sprintf("packet %d", len(packets)+1)
+
+		data, err := decodeText(block, input)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", source, err)
+		}
+
+		packets = append(packets, &encodedPacket{source: source, data: data})
+	}
+
+	if len(packets) == 0 {
+		return nil, errors.New("there are no packets in the input")
+	}
+
+	return packets, nil
+}
+
+// isText returns whether the data is printable text.
+func isText(data []byte) bool {
+	for _, r := range string(data) {
+		if r == unicode.ReplacementChar || !(unicode.IsPrint(r) || unicode.IsSpace(r)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// splitBlocks splits the text in to blocks of lines separated by blank lines.
+func splitBlocks(s string) []string {
+	var (
+		blocks []string
+		lines  []string
+	)
+
+	for _, line := range strings.Split(s, "\n") {
+		if strings.TrimSpace(line) == "" {
+			if len(lines) > 0 {
+				blocks = append(blocks, strings.Join(lines, "\n"))
+				lines = nil
+			}
+
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	if len(lines) > 0 {
+		blocks = append(blocks, strings.Join(lines, "\n"))
+	}
+
+	return blocks
+}
+
+// decodeText decodes a packet encoded as hex or base64. In the auto format
+// hex is tried first.
+func decodeText(s, input string) ([]byte, error) {
+	if input == inputAuto || input == inputHex {
+		data, err := decodeHex(s)
+
+		if err == nil || input == inputHex {
+			return data, err
+		}
+	}
+
+	data, err := decodeBase64(s)
+
+	if err != nil && input == inputAuto {
+		return nil, errors.New("the input is neither hex nor base64")
+	}
+
+	return data, err
+}
+
+var (
+	// hexDumpOffset matches the offset at the start of a line of a hex dump,
+	// like "0000  " (Wireshark) or "00000000: " (xxd)
+	hexDumpOffset = regexp.MustCompile(`^[0-9a-fA-F]{4,8}(:\s*|\s{2,})`)
+
+	// hexGroups matches space-separated groups of hex digits
+	hexGroups = regexp.MustCompile(`^[0-9a-fA-F]{2,}( [0-9a-fA-F]{2,})*$`)
+
+	// columnSeparator separates the columns of a hex dump
+	columnSeparator = regexp.MustCompile(`\s{2,}`)
+
+	// hexNoise are the prefixes and separators that can appear between the
+	// bytes of hex input
+	hexNoise = strings.NewReplacer("0x", "", "0X", "", `\x`, "", " ", "", "\t", "", "\r", "", ":", "", "-", "", ",", "")
+)
+
+// decodeHex decodes hex input. It can be a plain hex string, bytes separated
+// by spaces, colons, or commas, C-style escapes, or a hex dump with offsets
+// and an ASCII column like the ones printed by Wireshark, xxd, or hexdump -C.
+func decodeHex(s string) ([]byte, error) {
+	var digits []string
+
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+
+		if loc := hexDumpOffset.FindStringIndex(line); loc != nil {
+			line = line[loc[1]:]
+
+			if i := strings.IndexByte(line, '|'); i != -1 {
+				line = line[:i]
+			}
+
+			// the ASCII column is the first one that isn't hex
+			var columns []string
+
+			for _, column := range columnSeparator.Split(strings.TrimSpace(line), -1) {
+				if !hexGroups.MatchString(column) {
+					break
+				}
+
+				columns = append(columns, column)
+			}
+
+			line = strings.Join(columns, "")
+		}
+
+		digits = append(digits, hexNoise.Replace(line))
+	}
+
+	data, err := hex.DecodeString(strings.Join(digits, ""))
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex: %s", err)
+	}
+
+	if len(data) == 0 {
+		return nil, errors.New("the input is empty")
+	}
+
+	return data, nil
+}
+
+// decodeBase64 decodes standard or URL-safe base64 input, with or without
+// padding.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.Join(strings.Fields(s), "")
+	s = strings.TrimRight(s, "=")
+
+	if s == "" {
+		return nil, errors.New("the input is empty")
+	}
+
+	for _, enc := range []*base64.Encoding{base64.RawStdEncoding, base64.RawURLEncoding} {
+		if data, err := enc.DecodeString(s); err == nil {
+			return data, nil
+		}
+	}
+
+	return nil, errors.New("invalid base64")
+}
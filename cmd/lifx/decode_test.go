@@ -0,0 +1,208 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/protocol/payloads"
+
+	. "gopkg.in/check.v1"
+)
+
+// echoPacket returns a marshaled echo request.
+func echoPacket(c *C) []byte {
+	var payload [64]byte
+	copy(payload[:], "lifx")
+
+	p := &lifxprotocol.Packet{
+		Header: &lifxprotocol.Header{
+			Frame:          &lifxprotocol.Frame{Protocol: 1024, Addressable: true, Source: 42},
+			FrameAddress:   &lifxprotocol.FrameAddress{Target: []byte{0xd0, 0x73, 0xd5, 0x01, 0x02, 0x03}, Sequence: 7},
+			ProtocolHeader: &lifxprotocol.ProtocolHeader{Type: lifxprotocol.DeviceEchoRequest},
+		},
+		Payload: &lifxpayloads.DeviceEcho{Payload: payload},
+	}
+
+	data, err := p.MarshalPacket(binary.LittleEndian)
+	c.Assert(err, IsNil)
+
+	return data
+}
+
+func runDecodeArgs(args ...string) (string, string, int) {
+	var stdout, stderr bytes.Buffer
+
+	code := run(context.Background(), append([]string{"decode"}, args...), &stdout, &stderr)
+
+	return stdout.String(), stderr.String(), code
+}
+
+func (*TestSuite) TestDecode_Text(c *C) {
+	data := echoPacket(c)
+
+	inputs := []string{
+		hex.EncodeToString(data),
+		strings.ToUpper(hex.EncodeToString(data)),
+		base64.StdEncoding.EncodeToString(data),
+		base64.RawURLEncoding.EncodeToString(data),
+	}
+
+	// bytes separated by colons, spaces, and as C-style escapes
+	var colons, spaced, escaped []string
+
+	for _, b := range data {
+		colons = append(colons, fmt.Sprintf("%02x", b))
+		spaced = append(spaced, fmt.Sprintf("0x%02x,", b))
+		escaped = append(escaped, fmt.Sprintf(`\x%02x`, b))
+	}
+
+	inputs = append(inputs, strings.Join(colons, ":"), strings.Join(spaced, " "), strings.Join(escaped, ""))
+
+	for _, in := range inputs {
+		stdout, stderr, code := runDecodeArgs(in)
+		c.Assert(code, Equals, exitOK, Commentf("%q: %s", in, stderr))
+		c.Check(stdout, Matches, `(?s)argument 1:\nLIFX Packet: DeviceEchoRequest \(58\)\n.*`)
+		c.Check(stdout, Matches, `(?s).*d0:73:d5:01:02:03.*`)
+	}
+
+	// several packets, and an annotated hex dump
+	stdout, stderr, code := runDecodeArgs("--hexdump", hex.EncodeToString(data), hex.EncodeToString(data))
+	c.Assert(code, Equals, exitOK, Commentf("%s", stderr))
+	c.Check(stdout, Matches, `(?s)argument 1:\n.*\n\nargument 2:\n.*`)
+}
+
+func (*TestSuite) TestDecode_HexDumps(c *C) {
+	data := echoPacket(c)
+
+	// a Wireshark-style dump with two packets separated by a blank line,
+	// and an xxd-style dump with an ASCII column
+	var wireshark, xxd bytes.Buffer
+
+	for offset := 0; offset < len(data); offset += 16 {
+		line := data[offset:]
+
+		if len(line) > 16 {
+			line = line[:16]
+		}
+
+		// the echo request is 100 bytes, so the lines have an even length
+		var groups []string
+
+		for i := 0; i < len(line); i += 2 {
+			groups = append(groups, hex.EncodeToString(line[i:i+2]))
+		}
+
+		fmt.Fprintf(&wireshark, "%04x   % x  ", offset, line)
+		fmt.Fprintf(&wireshark, "%s\n", strings.Repeat(".", len(line)))
+		fmt.Fprintf(&xxd, "%08x: %-40s  %s\n", offset, strings.Join(groups, " "), strings.Repeat(".", len(line)))
+	}
+
+	dir, err := ioutil.TempDir("", "lifx-decode")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"wireshark.txt": wireshark.String() + "\n" + wireshark.String(),
+		"xxd.txt":       xxd.String(),
+	}
+
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		c.Assert(ioutil.WriteFile(path, []byte(contents), 0600), IsNil)
+
+		stdout, stderr, code := runDecodeArgs("--json", "--file", path)
+		c.Assert(code, Equals, exitOK, Commentf("%s: %s", name, stderr))
+
+		var out []decodedJSON
+		c.Assert(json.Unmarshal([]byte(stdout), &out), IsNil)
+
+		for i, dj := range out {
+			c.Check(dj.Source, Equals, fmt.Sprintf("packet %d", i+1))
+			c.Check(dj.Error, Equals, "")
+			c.Assert(dj.Packet, NotNil)
+			c.Check(dj.Packet.Header.FrameAddress.Sequence, Equals, uint8(7))
+			c.Check(dj.Packet.Payload, FitsTypeOf, &lifxpayloads.DeviceEcho{})
+		}
+
+		if name == "wireshark.txt" {
+			c.Check(out, HasLen, 2)
+		} else {
+			c.Check(out, HasLen, 1)
+		}
+	}
+
+	// raw binary files are a single packet
+	path := filepath.Join(dir, "packet.bin")
+	c.Assert(ioutil.WriteFile(path, data, 0600), IsNil)
+
+	stdout, stderr, code := runDecodeArgs("--file", path)
+	c.Assert(code, Equals, exitOK, Commentf("%s", stderr))
+	c.Check(stdout, Matches, `(?s)packet 1:\nLIFX Packet: DeviceEchoRequest \(58\)\n.*`)
+}
+
+func (*TestSuite) TestDecode_Errors(c *C) {
+	data := echoPacket(c)
+
+	// an unknown message type still prints the header
+	unknown := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint16(unknown[32:34], 9999)
+
+	stdout, stderr, code := runDecodeArgs(hex.EncodeToString(unknown))
+	c.Check(code, Equals, exitUnknownType)
+	c.Check(stdout, Matches, `(?s)argument 1:\nLIFX Packet: .*\(9999\).*`)
+	c.Check(stderr, Equals, "lifx decode: argument 1: unknown message type 9999\n")
+
+	// a truncated payload is malformed, and takes precedence
+	_, stderr, code = runDecodeArgs(hex.EncodeToString(unknown), hex.EncodeToString(data[:50]))
+	c.Check(code, Equals, exitMalformed)
+	c.Check(stderr, Matches, `(?s).*lifx decode: argument 2: the payload is malformed: .*`)
+
+	// a frame size that doesn't match the data
+	stdout, stderr, code = runDecodeArgs("--json", hex.EncodeToString(append(data, 0)))
+	c.Check(code, Equals, exitMalformed)
+	c.Check(stderr, Equals, "lifx decode: argument 1: the frame size is 100 bytes, but the packet is 101 bytes\n")
+
+	var out []decodedJSON
+	c.Assert(json.Unmarshal([]byte(stdout), &out), IsNil)
+	c.Assert(out, HasLen, 1)
+	c.Check(out[0].Packet, NotNil)
+	c.Check(out[0].Error, Equals, "the frame size is 100 bytes, but the packet is 101 bytes")
+
+	// too short for a header
+	stdout, stderr, code = runDecodeArgs("2400")
+	c.Check(code, Equals, exitMalformed)
+	c.Check(stdout, Equals, "")
+	c.Check(stderr, Matches, "lifx decode: argument 1: the header is malformed: .*\n")
+
+	// neither hex nor base64
+	_, stderr, code = runDecodeArgs("not a packet!")
+	c.Check(code, Equals, exitMalformed)
+	c.Check(stderr, Equals, "lifx decode: argument 1: the input is neither hex nor base64\n")
+
+	_, stderr, code = runDecodeArgs("--input", "hex", base64.StdEncoding.EncodeToString(data))
+	c.Check(code, Equals, exitMalformed)
+	c.Check(stderr, Matches, "lifx decode: argument 1: invalid hex: .*\n")
+
+	_, _, code = runDecodeArgs("--input", "pcap", hex.EncodeToString(data))
+	c.Check(code, Equals, exitUsage)
+
+	_, _, code = runDecodeArgs("--input", "yaml")
+	c.Check(code, Equals, exitUsage)
+
+	_, _, code = runDecodeArgs("--file", "packet.bin", hex.EncodeToString(data))
+	c.Check(code, Equals, exitUsage)
+}
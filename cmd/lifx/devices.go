@@ -0,0 +1,425 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/theckman/go-lifx"
+	"github.com/theckman/go-lifx/protocol/payloads"
+)
+
+func init() {
+	register(&command{
+		name:    "discover",
+		summary: "find the devices on the network",
+		setup: func(fs *flag.FlagSet) func(*env, []string) error {
+			return runDiscover
+		},
+	})
+
+	register(&command{
+		name:    "list",
+		args:    "[selector...]",
+		summary: "show the label, power, and color of devices",
+		setup: func(fs *flag.FlagSet) func(*env, []string) error {
+			return runList
+		},
+	})
+
+	register(&command{
+		name:    "label",
+		args:    "<selector> [label]",
+		summary: "show or change the label of devices",
+		setup: func(fs *flag.FlagSet) func(*env, []string) error {
+			return runLabel
+		},
+	})
+
+	register(&command{
+		name:    "info",
+		args:    "<selector...>",
+		summary: "show the details of devices",
+		setup: func(fs *flag.FlagSet) func(*env, []string) error {
+			return runInfo
+		},
+	})
+}
+
+// deviceJSON identifies a device in the JSON output.
+type deviceJSON struct {
+	HardwareAddr string `json:"mac"`
+	Addr         string `json:"addr"`
+}
+
+func newDeviceJSON(device *lifx.Device) deviceJSON {
+	return deviceJSON{HardwareAddr: device.HardwareAddr.String(), Addr: device.Addr.String()}
+}
+
+func runDiscover(e *env, args []string) error {
+	if len(args) != 0 {
+		return usageError("discover takes no arguments")
+	}
+
+	client, err := e.client(false)
+
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	devices, err := client.Discover(e.ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if e.opts.json {
+		out := make([]deviceJSON, len(devices))
+
+		for i, device := range devices {
+			out[i] = newDeviceJSON(device)
+		}
+
+		return writeJSON(e.stdout, out)
+	}
+
+	t := newTable(e.stdout, "MAC", "ADDRESS")
+
+	for _, device := range devices {
+		t.row(device.HardwareAddr.String(), device.Addr.String())
+	}
+
+	return t.flush()
+}
+
+type listJSON struct {
+	deviceJSON
+	Label    string                  `json:"label"`
+	Power    bool                    `json:"power"`
+	Color    *lifxpayloads.LightHSBK `json:"color"`
+	Group    string                  `json:"group"`
+	Location string                  `json:"location"`
+}
+
+func runList(e *env, args []string) error {
+	if len(args) == 0 {
+		args = []string{"all"}
+	}
+
+	client, err := e.client(false)
+
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	devices, err := e.resolve(client, args)
+
+	if err != nil {
+		return err
+	}
+
+	entries := make([]*listJSON, len(devices))
+	levels := make([]uint16, len(devices))
+
+	errs := each(e.ctx, devices, func(ctx context.Context, i int, device *lifx.Device) error {
+		state, err := client.Light(device.HardwareAddr, device.Addr).State(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		group, err := device.Group(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		location, err := device.Location(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		levels[i] = state.Power
+		entries[i] = &listJSON{
+			deviceJSON: newDeviceJSON(device),
+			Label:      labelString(state.Label),
+			Power:      state.Power != 0,
+			Color:      state.Color,
+			Group:      labelString(group.Label),
+			Location:   labelString(location.Label),
+		}
+
+		return nil
+	})
+
+	failed := e.warnEach(devices, errs)
+
+	if e.opts.json {
+		out := make([]*listJSON, 0, len(entries))
+
+		for _, entry := range entries {
+			if entry != nil {
+				out = append(out, entry)
+			}
+		}
+
+		err = writeJSON(e.stdout, out)
+	} else {
+		t := newTable(e.stdout, "MAC", "LABEL", "POWER", "COLOR", "GROUP", "LOCATION")
+
+		for i, entry := range entries {
+			if entry != nil {
+				t.row(entry.HardwareAddr, entry.Label, powerString(levels[i]), colorString(entry.Color), entry.Group, entry.Location)
+			}
+		}
+
+		err = t.flush()
+	}
+
+	if err == nil && failed {
+		err = errReported
+	}
+
+	return err
+}
+
+type labelJSON struct {
+	deviceJSON
+	Label string `json:"label"`
+}
+
+func runLabel(e *env, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return usageError("label takes a selector, and optionally the new label")
+	}
+
+	client, err := e.client(false)
+
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	devices, err := e.resolve(client, args[:1])
+
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 2 {
+		if len(devices) != 1 {
+			return fmt.Errorf("%s matches %d devices; a label can only be set on one", args[0], len(devices))
+		}
+
+		return e.writeResults(devices, []error{devices[0].SetLabel(e.ctx, args[1])})
+	}
+
+	labels := make([]string, len(devices))
+
+	errs := each(e.ctx, devices, func(ctx context.Context, i int, device *lifx.Device) error {
+		label, err := device.Label(ctx)
+		labels[i] = label
+
+		return err
+	})
+
+	failed := e.warnEach(devices, errs)
+
+	if e.opts.json {
+		out := make([]labelJSON, 0, len(devices))
+
+		for i, device := range devices {
+			if errs[i] == nil {
+				out = append(out, labelJSON{deviceJSON: newDeviceJSON(device), Label: labels[i]})
+			}
+		}
+
+		err = writeJSON(e.stdout, out)
+	} else {
+		t := newTable(e.stdout, "MAC", "ADDRESS", "LABEL")
+
+		for i, device := range devices {
+			if errs[i] == nil {
+				t.row(device.HardwareAddr.String(), device.Addr.String(), labels[i])
+			}
+		}
+
+		err = t.flush()
+	}
+
+	if err == nil && failed {
+		err = errReported
+	}
+
+	return err
+}
+
+type infoJSON struct {
+	deviceJSON
+	Label        string                                `json:"label"`
+	Version      *lifxpayloads.DeviceStateVersion      `json:"version"`
+	HostFirmware *lifxpayloads.DeviceStateHostFirmware `json:"host_firmware"`
+	WifiInfo     *lifxpayloads.DeviceStateWifiInfo     `json:"wifi_info"`
+	WifiFirmware *lifxpayloads.DeviceStateWifiFirmware `json:"wifi_firmware"`
+	Info         *lifxpayloads.DeviceStateInfo         `json:"info"`
+	Group        *lifxpayloads.DeviceStateGroup        `json:"group"`
+	Location     *lifxpayloads.DeviceStateLocation     `json:"location"`
+}
+
+// getInfo asks the device for all of its details.
+func getInfo(ctx context.Context, device *lifx.Device) (*infoJSON, error) {
+	label, err := device.Label(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := device.Version(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hostFirmware, err := device.HostFirmware(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	wifiInfo, err := device.WifiInfo(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	wifiFirmware, err := device.WifiFirmware(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	devInfo, err := device.Info(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	group, err := device.Group(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	location, err := device.Location(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &infoJSON{
+		deviceJSON:   newDeviceJSON(device),
+		Label:        label,
+		Version:      version,
+		HostFirmware: hostFirmware,
+		WifiInfo:     wifiInfo,
+		WifiFirmware: wifiFirmware,
+		Info:         devInfo,
+		Group:        group,
+		Location:     location,
+	}, nil
+}
+
+func runInfo(e *env, args []string) error {
+	client, err := e.client(false)
+
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	devices, err := e.resolve(client, args)
+
+	if err != nil {
+		return err
+	}
+
+	infos := make([]*infoJSON, len(devices))
+
+	errs := each(e.ctx, devices, func(ctx context.Context, i int, device *lifx.Device) error {
+		info, err := getInfo(ctx, device)
+		infos[i] = info
+
+		return err
+	})
+
+	failed := e.warnEach(devices, errs)
+
+	var out []*infoJSON
+
+	for _, info := range infos {
+		if info != nil {
+			out = append(out, info)
+		}
+	}
+
+	if e.opts.json {
+		err = writeJSON(e.stdout, out)
+	} else {
+		t := newTable(e.stdout)
+
+		for i, info := range out {
+			if i > 0 {
+				t.row()
+			}
+
+			signal := info.WifiInfo.SignalRating().String()
+
+			if dbm, ok := info.WifiInfo.SignalDBm(); ok {
+				signal = fmt.Sprintf("%d dBm (%s)", dbm, signal)
+			}
+
+			t.row(info.HardwareAddr, info.Addr)
+			t.row("  Label:", info.Label)
+			t.row("  Product:", fmt.Sprintf("vendor %d, product %d, version %d", info.Version.Vendor, info.Version.Product, info.Version.Version))
+			t.row("  Host firmware:", firmwareString(info.HostFirmware.Version, info.HostFirmware.Build))
+			t.row("  Wi-Fi firmware:", firmwareString(info.WifiFirmware.Version, info.WifiFirmware.Build))
+			t.row("  Wi-Fi signal:", signal)
+			t.row("  Uptime:", time.Duration(info.Info.Uptime).String())
+			t.row("  Downtime:", time.Duration(info.Info.Downtime).String())
+			t.row("  Group:", labelString(info.Group.Label))
+			t.row("  Location:", labelString(info.Location.Label))
+		}
+
+		err = t.flush()
+	}
+
+	if err == nil && failed {
+		err = errReported
+	}
+
+	return err
+}
+
+// firmwareString returns the firmware version as major.minor, along with
+// when it was built if that's known.
+func firmwareString(version uint32, build uint64) string {
+	s := fmt.Sprintf("%d.%d", version>>16, version&0xffff)
+
+	if build != 0 {
+		s += fmt.Sprintf(" (built %s)", time.Unix(0, int64(build)).UTC().Format(time.RFC3339))
+	}
+
+	return s
+}
@@ -0,0 +1,165 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/theckman/go-lifx"
+)
+
+func init() {
+	register(&command{
+		name:    "echo",
+		args:    "<selector...>",
+		summary: "ping devices with echo requests",
+		setup: func(fs *flag.FlagSet) func(*env, []string) error {
+			cfg := &echoConfig{}
+
+			fs.IntVar(&cfg.count, "count", 3, "how many echo requests to send to each device")
+			fs.DurationVar(&cfg.interval, "interval", time.Second, "how long to wait between echo requests")
+			fs.StringVar(&cfg.payload, "payload", "lifx", "the payload to send, which the devices echo back")
+
+			return func(e *env, args []string) error {
+				return runEcho(e, args, cfg)
+			}
+		},
+	})
+}
+
+type echoConfig struct {
+	count    int
+	interval time.Duration
+	payload  string
+}
+
+// echoStats are the results of pinging a device.
+type echoStats struct {
+	deviceJSON
+	Sent     int    `json:"sent"`
+	Received int    `json:"received"`
+	Min      string `json:"min,omitempty"`
+	Avg      string `json:"avg,omitempty"`
+	Max      string `json:"max,omitempty"`
+
+	min, max, sum time.Duration
+}
+
+func (es *echoStats) record(rtt time.Duration) {
+	if es.Received == 0 || rtt < es.min {
+		es.min = rtt
+	}
+
+	if rtt > es.max {
+		es.max = rtt
+	}
+
+	es.sum += rtt
+	es.Received++
+}
+
+func runEcho(e *env, args []string, cfg *echoConfig) error {
+	if cfg.count < 1 {
+		return usageError("--count must be at least 1")
+	}
+
+	client, err := e.client(false)
+
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	devices, err := e.resolve(client, args)
+
+	if err != nil {
+		return err
+	}
+
+	stats := make([]*echoStats, len(devices))
+
+	for i, device := range devices {
+		stats[i] = &echoStats{deviceJSON: newDeviceJSON(device)}
+	}
+
+	var mu sync.Mutex
+
+	for seq := 1; seq <= cfg.count; seq++ {
+		if seq > 1 {
+			select {
+			case <-e.ctx.Done():
+				return e.ctx.Err()
+			case <-time.After(cfg.interval):
+			}
+		}
+
+		each(e.ctx, devices, func(ctx context.Context, i int, device *lifx.Device) error {
+			start := time.Now()
+			_, err := device.Echo(ctx, []byte(cfg.payload))
+			rtt := time.Since(start)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			stats[i].Sent++
+
+			if err != nil {
+				if !e.opts.json {
+					fmt.Fprintf(e.stdout, "%s: seq=%d error: %s\n", device.HardwareAddr, seq, err)
+				}
+
+				return err
+			}
+
+			stats[i].record(rtt)
+
+			if !e.opts.json {
+				fmt.Fprintf(e.stdout, "%s: seq=%d time=%s\n", device.HardwareAddr, seq, rtt)
+			}
+
+			return nil
+		})
+	}
+
+	var failed bool
+
+	for _, es := range stats {
+		if es.Received == 0 {
+			failed = true
+			continue
+		}
+
+		es.Min = es.min.String()
+		es.Avg = (es.sum / time.Duration(es.Received)).String()
+		es.Max = es.max.String()
+	}
+
+	if e.opts.json {
+		err = writeJSON(e.stdout, stats)
+	} else {
+		fmt.Fprintln(e.stdout)
+
+		t := newTable(e.stdout, "MAC", "SENT", "RECEIVED", "LOSS", "MIN", "AVG", "MAX")
+
+		for _, es := range stats {
+			loss := fmt.Sprintf("%g%%", round2(float64(es.Sent-es.Received)/float64(es.Sent)*100))
+			t.row(es.HardwareAddr, fmt.Sprint(es.Sent), fmt.Sprint(es.Received), loss, es.Min, es.Avg, es.Max)
+		}
+
+		err = t.flush()
+	}
+
+	// like ping, it's only a failure if a device never answered
+	if err == nil && failed {
+		err = errReported
+	}
+
+	return err
+}
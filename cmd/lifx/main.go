@@ -0,0 +1,284 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+// Command lifx controls LIFX devices on the local network from the shell,
+// using the LIFX LAN Protocol.
+//
+//	lifx [flags] <command> [flags] [arguments]
+//
+// The commands are:
+//
+//	discover                      find the devices on the network
+//	list [selector...]            show the label, power, and color of devices
+//	on <selector...>              power devices on
+//	off <selector...>             power devices off
+//	color <selector> <color>      change the color of lights
+//	scene <file>                  apply a scene from a JSON, YAML, or TOML file
+//	label <selector> [label]      show or change the label of devices
+//	info <selector...>            show the details of devices
+//	echo <selector...>            ping devices with echo requests
+//	watch [selector...]           poll devices, and print their changes
+//	decode [packet...]            decode packets from hex, base64, or captures
+//	send --type <type> [flags]    send a hand-crafted packet, and print the replies
+//	sniff                         decode the LIFX traffic on the network as it happens
+//
+// A selector picks devices by "label:<label>", "mac:<mac address>",
+// "group:<group label>", or "location:<location label>". Labels are matched
+// without regard to case. A selector without a prefix is a MAC address if it
+// looks like one, and a label otherwise; "all" selects every device.
+//
+// Colors can be given in any of the forms understood by
+// lifxpayloads.ParseColor, like "red", "#ff8800", or "hue:120 saturation:1".
+//
+// The global flags, which can be given before or after the command, are:
+//
+//	--timeout    how long to wait for a response before retrying (500ms)
+//	--retries    how many times to retry a request; 0 to never retry (3)
+//	--broadcast  the address to broadcast to, as host or host:port
+//	--json       print JSON instead of a table
+//
+// The exit status is 0 on success, 1 if the command or any device failed,
+// and 2 if the command line is invalid. The decode command exits with 3 if
+// any packet is malformed, or else 4 if any has an unknown message type.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/theckman/go-lifx"
+)
+
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// exitError is returned by a command that has already reported its errors.
+// It only sets the exit status.
+type exitError int
+
+func (ee exitError) Error() string { return fmt.Sprintf("exit status %d", int(ee)) }
+
+// errReported is returned by a command that has already reported its
+// errors, like when some of the devices failed.
+var errReported error = exitError(exitFailure)
+
+// usageError is an error in the command line.
+type usageError string
+
+func (ue usageError) Error() string { return string(ue) }
+
+// options are the global flags.
+type options struct {
+	timeout   time.Duration
+	retries   int
+	broadcast string
+	json      bool
+}
+
+// register adds the global flags to the flag set, defaulting to their
+// current values so they can be given before or after the command.
+func (o *options) register(fs *flag.FlagSet) {
+	fs.DurationVar(&o.timeout, "timeout", o.timeout, "how long to wait for a response before retrying")
+	fs.IntVar(&o.retries, "retries", o.retries, "how many times to retry a request; 0 to never retry")
+	fs.StringVar(&o.broadcast, "broadcast", o.broadcast, "the address to broadcast to, as host or host:port")
+	fs.BoolVar(&o.json, "json", o.json, "print JSON instead of a table")
+}
+
+// env is the environment a command runs in.
+type env struct {
+	ctx    context.Context
+	opts   options
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// client returns a new *lifx.Client configured from the global flags.
+func (e *env) client(cache bool) (*lifx.Client, error) {
+	config := &lifx.Config{
+		Timeout: e.opts.timeout,
+		Retries: e.opts.retries,
+		Cache:   cache,
+	}
+
+	// the client treats 0 as the default number of retries
+	if config.Retries == 0 {
+		config.Retries = -1
+	}
+
+	if e.opts.broadcast != "" {
+		addr, err := parseBroadcast(e.opts.broadcast)
+
+		if err != nil {
+			return nil, err
+		}
+
+		config.Broadcast = addr
+	}
+
+	return lifx.NewClient(config)
+}
+
+// parseBroadcast parses the --broadcast flag. The port defaults to
+// lifx.DefaultPort.
+func parseBroadcast(s string) (*net.UDPAddr, error) { return parseAddr("--broadcast", s) }
+
+// parseAddr parses the address given to the named flag. The port defaults to
+// lifx.DefaultPort.
+func parseAddr(name, s string) (*net.UDPAddr, error) {
+	if _, _, err := net.SplitHostPort(s); err != nil {
+		s = net.JoinHostPort(s, strconv.Itoa(lifx.DefaultPort))
+	}
+
+	addr, err := net.ResolveUDPAddr("udp4", s)
+
+	if err != nil {
+		return nil, usageError(fmt.Sprintf("invalid %s address: %s", name, err))
+	}
+
+	return addr, nil
+}
+
+// warn reports a problem that doesn't stop the command.
+func (e *env) warn(format string, a ...interface{}) {
+	fmt.Fprintf(e.stderr, "lifx: "+format+"\n", a...)
+}
+
+// command is a subcommand of the tool.
+type command struct {
+	name    string
+	args    string
+	summary string
+
+	// setup registers the flags of the command, and returns the function
+	// that runs it with the remaining arguments.
+	setup func(fs *flag.FlagSet) func(e *env, args []string) error
+}
+
+var commands = map[string]*command{}
+
+func register(cmd *command) { commands[cmd.name] = cmd }
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+
+	cancel()
+	os.Exit(code)
+}
+
+// run runs the command line, and returns the exit status.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	e := &env{
+		ctx:    ctx,
+		opts:   options{timeout: lifx.DefaultTimeout, retries: lifx.DefaultRetries},
+		stdout: stdout,
+		stderr: stderr,
+	}
+
+	fs := flag.NewFlagSet("lifx", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { usage(stderr) }
+	e.opts.register(fs)
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+
+		return exitUsage
+	}
+
+	if fs.NArg() == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+
+	name := fs.Arg(0)
+
+	if name == "help" {
+		usage(stdout)
+		return exitOK
+	}
+
+	cmd, ok := commands[name]
+
+	if !ok {
+		fmt.Fprintf(stderr, "lifx: unknown command %q\n\n", name)
+		usage(stderr)
+		return exitUsage
+	}
+
+	cfs := flag.NewFlagSet("lifx "+cmd.name, flag.ContinueOnError)
+	cfs.SetOutput(stderr)
+	e.opts.register(cfs)
+	fn := cmd.setup(cfs)
+
+	cfs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: lifx %s [flags] %s\n\n%s\n\nflags:\n", cmd.name, cmd.args, cmd.summary)
+		cfs.PrintDefaults()
+	}
+
+	if err := cfs.Parse(fs.Args()[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+
+		return exitUsage
+	}
+
+	err := fn(e, cfs.Args())
+
+	switch err := err.(type) {
+	case nil:
+		return exitOK
+	case usageError:
+		fmt.Fprintf(stderr, "lifx %s: %s\n", cmd.name, err)
+		cfs.Usage()
+		return exitUsage
+	case exitError:
+		return int(err)
+	}
+
+	fmt.Fprintf(stderr, "lifx %s: %s\n", cmd.name, err)
+	return exitFailure
+}
+
+// usage prints the list of commands.
+func usage(w io.Writer) {
+	fmt.Fprint(w, "usage: lifx [flags] <command> [flags] [arguments]\n\ncommands:\n")
+
+	names := make([]string, 0, len(commands))
+
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].summary)
+	}
+
+	fmt.Fprint(w, "\nRun 'lifx <command> -h' for the flags and arguments of a command.\n")
+}
@@ -0,0 +1,361 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theckman/go-lifx"
+	"github.com/theckman/go-lifx/emulator"
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/protocol/payloads"
+
+	. "gopkg.in/check.v1"
+)
+
+type TestSuite struct{}
+
+var _ = Suite(&TestSuite{})
+
+func Test(t *testing.T) { TestingT(t) }
+
+// newFleet returns a network of emulated devices, spread across two groups
+// and two locations.
+func newFleet(c *C, devices int) (*lifxemulator.Network, []*lifxemulator.Device) {
+	network, err := lifxemulator.NewNetwork("")
+	c.Assert(err, IsNil)
+
+	fleet, err := network.AddFleet(&lifxemulator.FleetConfig{Devices: devices, Groups: 2, Locations: 2})
+	c.Assert(err, IsNil)
+
+	return network, fleet
+}
+
+// runLifx runs the command line against the network, with short timeouts.
+func runLifx(c *C, network *lifxemulator.Network, args ...string) (string, string, int) {
+	var stdout, stderr bytes.Buffer
+
+	args = append([]string{"--broadcast", network.Addr().String(), "--timeout", "50ms", "--retries", "1"}, args...)
+	code := run(context.Background(), args, &stdout, &stderr)
+
+	return stdout.String(), stderr.String(), code
+}
+
+func label(s string) lifxpayloads.DeviceLabel {
+	return lifxpayloads.NewDeviceLabelTrunc([]byte(s))
+}
+
+func (*TestSuite) TestRun_Usage(c *C) {
+	var stdout, stderr bytes.Buffer
+
+	c.Check(run(context.Background(), nil, &stdout, &stderr), Equals, exitUsage)
+	c.Check(stderr.String(), Matches, "(?s)usage: lifx .*discover .*watch .*")
+
+	stdout.Reset()
+	c.Check(run(context.Background(), []string{"help"}, &stdout, &stderr), Equals, exitOK)
+	c.Check(stdout.String(), Matches, "(?s)usage: lifx .*")
+
+	stderr.Reset()
+	c.Check(run(context.Background(), []string{"frobnicate"}, &stdout, &stderr), Equals, exitUsage)
+	c.Check(stderr.String(), Matches, `lifx: unknown command "frobnicate"\n(?s).*`)
+
+	c.Check(run(context.Background(), []string{"--nope", "discover"}, &stdout, &stderr), Equals, exitUsage)
+	c.Check(run(context.Background(), []string{"discover", "--nope"}, &stdout, &stderr), Equals, exitUsage)
+
+	stderr.Reset()
+	c.Check(run(context.Background(), []string{"discover", "extra"}, &stdout, &stderr), Equals, exitUsage)
+	c.Check(stderr.String(), Matches, "(?s)lifx discover: discover takes no arguments\nusage: lifx discover .*")
+
+	c.Check(run(context.Background(), []string{"--broadcast", "not an address:x", "discover"}, &stdout, &stderr), Equals, exitUsage)
+}
+
+func (*TestSuite) Test_parseBroadcast(c *C) {
+	addr, err := parseBroadcast("192.168.1.255")
+	c.Assert(err, IsNil)
+	c.Check(addr.String(), Equals, "192.168.1.255:56700")
+
+	addr, err = parseBroadcast("127.0.0.1:1234")
+	c.Assert(err, IsNil)
+	c.Check(addr.String(), Equals, "127.0.0.1:1234")
+
+	_, err = parseBroadcast("127.0.0.1:port")
+	c.Check(err, FitsTypeOf, usageError(""))
+}
+
+func (*TestSuite) TestDiscover(c *C) {
+	network, fleet := newFleet(c, 3)
+	defer network.Close()
+
+	stdout, stderr, code := runLifx(c, network, "discover")
+	c.Assert(code, Equals, exitOK, Commentf("stderr: %s", stderr))
+
+	addr := network.Addr().String()
+	c.Check(stdout, Equals, strings.Join([]string{
+		"MAC                ADDRESS",
+		"d0:73:d5:00:00:01  " + addr,
+		"d0:73:d5:00:00:02  " + addr,
+		"d0:73:d5:00:00:03  " + addr,
+		"",
+	}, "\n"))
+
+	stdout, _, code = runLifx(c, network, "discover", "--json")
+	c.Assert(code, Equals, exitOK)
+
+	var devices []deviceJSON
+	c.Assert(json.Unmarshal([]byte(stdout), &devices), IsNil)
+	c.Assert(devices, HasLen, 3)
+	c.Check(devices[2], Equals, deviceJSON{HardwareAddr: fleet[2].HardwareAddr().String(), Addr: addr})
+}
+
+func (*TestSuite) TestList(c *C) {
+	network, fleet := newFleet(c, 4)
+	defer network.Close()
+
+	fleet[0].Update(func(state *lifxemulator.State) {
+		state.Power = 65535
+		state.Color = lifxpayloads.LightHSBK{Hue: 21845, Saturation: 65535, Brightness: 32768, Kelvin: 3500}
+	})
+
+	stdout, stderr, code := runLifx(c, network, "list")
+	c.Assert(code, Equals, exitOK, Commentf("stderr: %s", stderr))
+
+	lines := strings.Split(stdout, "\n")
+	c.Assert(lines, HasLen, 6)
+	c.Check(lines[0], Matches, `MAC +LABEL +POWER +COLOR +GROUP +LOCATION`)
+	c.Check(lines[1], Matches, `d0:73:d5:00:00:01 +Bulb 1 +on +hue:120 saturation:1 brightness:0.5 kelvin:3500 +Group 1 +Location 1`)
+	c.Check(lines[2], Matches, `d0:73:d5:00:00:02 +Bulb 2 +off +hue:0 saturation:0 brightness:1 kelvin:3500 +Group 2 +Location 2`)
+
+	// selectors pick the devices by group, and others can be added
+	stdout, _, code = runLifx(c, network, "--json", "list", "group:group 2", "Bulb 1")
+	c.Assert(code, Equals, exitOK)
+
+	var entries []struct {
+		MAC   string `json:"mac"`
+		Label string `json:"label"`
+		Power bool   `json:"power"`
+		Group string `json:"group"`
+	}
+
+	c.Assert(json.Unmarshal([]byte(stdout), &entries), IsNil)
+	c.Assert(entries, HasLen, 3)
+	c.Check(entries[0].Label, Equals, "Bulb 1")
+	c.Check(entries[0].Power, Equals, true)
+	c.Check(entries[1].Group, Equals, "Group 2")
+	c.Check(entries[2].MAC, Equals, "d0:73:d5:00:00:04")
+
+	// a device that doesn't answer is reported, and fails the command
+	fleet[2].SetQuirks(lifxemulator.Quirks{Unsupported: []uint16{lifxprotocol.LightGet}})
+
+	stdout, stderr, code = runLifx(c, network, "list", "location:location 1")
+	c.Check(code, Equals, exitFailure)
+	c.Check(strings.Count(stdout, "\n"), Equals, 2)
+	c.Check(stderr, Equals, "lifx: device d0:73:d5:00:00:03: "+lifx.ErrTimeout.Error()+"\n")
+
+	_, stderr, code = runLifx(c, network, "list", "location:nowhere")
+	c.Check(code, Equals, exitFailure)
+	c.Check(stderr, Equals, "lifx list: no devices match location:nowhere\n")
+}
+
+func (*TestSuite) TestPowerAndColor(c *C) {
+	network, fleet := newFleet(c, 3)
+	defer network.Close()
+
+	stdout, stderr, code := runLifx(c, network, "on", "bulb 2", "d0:73:d5:00:00:03")
+	c.Assert(code, Equals, exitOK, Commentf("stderr: %s", stderr))
+	c.Check(stdout, Matches, "MAC +ADDRESS +RESULT\nd0:73:d5:00:00:02 .* ok\nd0:73:d5:00:00:03 .* ok\n")
+
+	c.Check(fleet[0].State().Power, Equals, uint16(0))
+	c.Check(fleet[1].State().Power, Equals, uint16(65535))
+	c.Check(fleet[2].State().Power, Equals, uint16(65535))
+
+	_, _, code = runLifx(c, network, "off", "mac:d0:73:d5:00:00:02")
+	c.Assert(code, Equals, exitOK)
+	c.Check(fleet[1].State().Power, Equals, uint16(0))
+
+	_, _, code = runLifx(c, network, "color", "all", "red brightness:0.5")
+	c.Assert(code, Equals, exitOK)
+
+	for _, device := range fleet {
+		c.Check(device.State().Color, Equals, lifxpayloads.LightHSBK{Brightness: 32768, Saturation: 65535, Kelvin: 6500})
+	}
+
+	stdout, _, code = runLifx(c, network, "--json", "color", "--duration", "1ms", "Bulb 1", "#00ff00")
+	c.Assert(code, Equals, exitOK)
+	c.Check(stdout, Equals, `[
+  {
+    "mac": "d0:73:d5:00:00:01",
+    "addr": "`+network.Addr().String()+`"
+  }
+]
+`)
+
+	// the device fails to acknowledge the message
+	fleet[0].SetQuirks(lifxemulator.Quirks{IgnoreAcks: true})
+
+	stdout, _, code = runLifx(c, network, "off", "group:Group 1")
+	c.Check(code, Equals, exitFailure)
+	c.Check(stdout, Matches, "(?s).*d0:73:d5:00:00:01 .* error: "+lifx.ErrTimeout.Error()+"\nd0:73:d5:00:00:03 .* ok\n")
+
+	_, stderr, code = runLifx(c, network, "color", "all", "not a color")
+	c.Check(code, Equals, exitUsage)
+	c.Check(stderr, Matches, `(?s)lifx color: "not a color" is not a valid color: .*`)
+
+	_, _, code = runLifx(c, network, "color", "red")
+	c.Check(code, Equals, exitUsage)
+
+	_, _, code = runLifx(c, network, "on")
+	c.Check(code, Equals, exitUsage)
+
+	_, _, code = runLifx(c, network, "on", "mac:nope")
+	c.Check(code, Equals, exitUsage)
+}
+
+func (*TestSuite) TestScene(c *C) {
+	network, fleet := newFleet(c, 3)
+	defer network.Close()
+
+	filename := filepath.Join(c.MkDir(), "scene.yaml")
+
+	err := ioutil.WriteFile(filename, []byte(`
+name: Evening
+lights:
+  - selector: group:Group 1
+    color: red brightness:0.5
+    power: on
+  - selector: Bulb 3
+    power: off
+`), 0644)
+	c.Assert(err, IsNil)
+
+	stdout, stderr, code := runLifx(c, network, "scene", filename)
+	c.Assert(code, Equals, exitOK, Commentf("stderr: %s", stderr))
+	c.Check(stdout, Matches, "MAC +ADDRESS +RESULT\nd0:73:d5:00:00:01 .* ok\nd0:73:d5:00:00:03 .* ok\n")
+
+	c.Check(fleet[0].State().Power, Equals, uint16(65535))
+	c.Check(fleet[0].State().Color, Equals, lifxpayloads.LightHSBK{Brightness: 32768, Saturation: 65535, Kelvin: 6500})
+	c.Check(fleet[1].State().Power, Equals, uint16(0))
+	c.Check(fleet[2].State().Power, Equals, uint16(0))
+	c.Check(fleet[2].State().Color, Not(Equals), fleet[0].State().Color)
+
+	c.Assert(ioutil.WriteFile(filename, []byte("lights:\n  - selector: Bulb 3\n"), 0644), IsNil)
+
+	_, stderr, code = runLifx(c, network, "scene", filename)
+	c.Check(code, Equals, exitUsage)
+	c.Check(stderr, Matches, "(?s)lifx scene: .*scene.yaml: scene entry 1: it sets neither the color nor the power\n.*")
+
+	c.Assert(ioutil.WriteFile(filename, []byte("lights:\n  - selector: Bulb 9\n    power: on\n"), 0644), IsNil)
+
+	_, stderr, code = runLifx(c, network, "scene", filename)
+	c.Check(code, Equals, exitFailure)
+	c.Check(stderr, Equals, "lifx scene: no devices match the scene in "+filename+"\n")
+
+	_, _, code = runLifx(c, network, "scene")
+	c.Check(code, Equals, exitUsage)
+}
+
+func (*TestSuite) TestLabel(c *C) {
+	network, fleet := newFleet(c, 2)
+	defer network.Close()
+
+	stdout, _, code := runLifx(c, network, "label", "all")
+	c.Assert(code, Equals, exitOK)
+	c.Check(stdout, Matches, "MAC +ADDRESS +LABEL\nd0:73:d5:00:00:01 .* Bulb 1\nd0:73:d5:00:00:02 .* Bulb 2\n")
+
+	_, _, code = runLifx(c, network, "label", "bulb 2", "Porch")
+	c.Assert(code, Equals, exitOK)
+	c.Check(fleet[1].State().Label, Equals, label("Porch"))
+
+	_, stderr, code := runLifx(c, network, "label", "all", "Porch")
+	c.Check(code, Equals, exitFailure)
+	c.Check(stderr, Equals, "lifx label: all matches 2 devices; a label can only be set on one\n")
+
+	_, _, code = runLifx(c, network, "label")
+	c.Check(code, Equals, exitUsage)
+}
+
+func (*TestSuite) TestInfo(c *C) {
+	network, _ := newFleet(c, 2)
+	defer network.Close()
+
+	stdout, stderr, code := runLifx(c, network, "info", "Bulb 2")
+	c.Assert(code, Equals, exitOK, Commentf("stderr: %s", stderr))
+	c.Check(stdout, Matches, "(?s)d0:73:d5:00:00:02 .*\n  Label: +Bulb 2\n  Product: +vendor 1, product 27, version 0\n  Host firmware: +2.80\n.*  Wi-Fi signal: +-50 dBm \\(good\\)\n.*  Group: +Group 2\n  Location: +Location 2\n")
+
+	stdout, _, code = runLifx(c, network, "--json", "info", "all")
+	c.Assert(code, Equals, exitOK)
+
+	var infos []map[string]interface{}
+	c.Assert(json.Unmarshal([]byte(stdout), &infos), IsNil)
+	c.Assert(infos, HasLen, 2)
+	c.Check(infos[0]["label"], Equals, "Bulb 1")
+	c.Check(infos[0]["version"], DeepEquals, map[string]interface{}{"vendor": 1.0, "product": 27.0, "version": 0.0})
+
+	_, _, code = runLifx(c, network, "info")
+	c.Check(code, Equals, exitUsage)
+}
+
+func (*TestSuite) TestEcho(c *C) {
+	network, fleet := newFleet(c, 2)
+	defer network.Close()
+
+	stdout, stderr, code := runLifx(c, network, "echo", "--count", "2", "--interval", "1ms", "all")
+	c.Assert(code, Equals, exitOK, Commentf("stderr: %s", stderr))
+	c.Check(stdout, Matches, "(?s)(d0:73:d5:00:00:0[12]: seq=1 time=.*\n){2}(d0:73:d5:00:00:0[12]: seq=2 time=.*\n){2}\nMAC +SENT +RECEIVED +LOSS +MIN +AVG +MAX\nd0:73:d5:00:00:01 +2 +2 +0% .*")
+
+	// a device that never answers fails the command
+	fleet[1].SetQuirks(lifxemulator.Quirks{Unsupported: []uint16{lifxprotocol.DeviceEchoRequest}})
+
+	stdout, _, code = runLifx(c, network, "--json", "echo", "--count", "1", "all")
+	c.Check(code, Equals, exitFailure)
+
+	var stats []map[string]interface{}
+	c.Assert(json.Unmarshal([]byte(stdout), &stats), IsNil)
+	c.Assert(stats, HasLen, 2)
+	c.Check(stats[0]["received"], Equals, 1.0)
+	c.Check(stats[1]["received"], Equals, 0.0)
+	c.Check(stats[1]["min"], IsNil)
+
+	_, _, code = runLifx(c, network, "echo", "--count", "0", "all")
+	c.Check(code, Equals, exitUsage)
+}
+
+func (*TestSuite) TestWatch(c *C) {
+	network, fleet := newFleet(c, 2)
+	defer network.Close()
+
+	// start a long fade, so the color is different every time it's polled
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+
+	client, err := lifx.NewClient(&lifx.Config{Conn: conn})
+	c.Assert(err, IsNil)
+	defer client.Close()
+
+	light := client.Light(fleet[0].HardwareAddr(), fleet[0].Addr())
+	c.Assert(light.SetColor(context.Background(), lifxpayloads.LightHSBK{Hue: 32768, Saturation: 65535, Brightness: 65535, Kelvin: 3500}, time.Minute), IsNil)
+
+	stdout, stderr, code := runLifx(c, network, "watch", "--count", "2", "--interval", "10ms", "Bulb 1")
+	c.Assert(code, Equals, exitOK, Commentf("stderr: %s", stderr))
+	c.Check(stdout, Matches, `\d\d:\d\d:\d\d\.\d\d\d  d0:73:d5:00:00:01  "Bulb 1"    ColorChanged  hue:.* -> hue:.*\n`)
+
+	stdout, _, code = runLifx(c, network, "--json", "watch", "--count", "2", "--interval", "10ms", "Bulb 1")
+	c.Assert(code, Equals, exitOK)
+
+	var ev watchEvent
+	c.Assert(json.Unmarshal([]byte(stdout), &ev), IsNil)
+	c.Check(ev.MAC, Equals, "d0:73:d5:00:00:01")
+	c.Check(ev.Type, Equals, "ColorChanged")
+
+	_, _, code = runLifx(c, network, "watch", "--interval", "0")
+	c.Check(code, Equals, exitUsage)
+}
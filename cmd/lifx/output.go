@@ -0,0 +1,134 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/theckman/go-lifx"
+	"github.com/theckman/go-lifx/protocol/payloads"
+)
+
+// table writes rows of aligned columns.
+type table struct {
+	tw *tabwriter.Writer
+}
+
+// newTable returns a table that writes to w, starting with the headers.
+func newTable(w io.Writer, headers ...string) *table {
+	t := &table{tw: tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)}
+
+	if len(headers) > 0 {
+		t.row(headers...)
+	}
+
+	return t
+}
+
+func (t *table) row(columns ...string) {
+	fmt.Fprintln(t.tw, strings.Join(columns, "\t"))
+}
+
+func (t *table) flush() error {
+	return t.tw.Flush()
+}
+
+// writeJSON writes the value as indented JSON.
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(v)
+}
+
+// result is the outcome of a command that changes devices.
+type result struct {
+	HardwareAddr string `json:"mac"`
+	Addr         string `json:"addr"`
+	Error        string `json:"error,omitempty"`
+}
+
+// writeResults writes the outcome of the command for each device. It returns
+// errReported if any of them failed.
+func (e *env) writeResults(devices []*lifx.Device, errs []error) error {
+	results := make([]result, len(devices))
+	failed := false
+
+	for i, device := range devices {
+		results[i] = result{HardwareAddr: device.HardwareAddr.String(), Addr: device.Addr.String()}
+
+		if errs[i] != nil {
+			results[i].Error = errs[i].Error()
+			failed = true
+		}
+	}
+
+	var err error
+
+	if e.opts.json {
+		err = writeJSON(e.stdout, results)
+	} else {
+		t := newTable(e.stdout, "MAC", "ADDRESS", "RESULT")
+
+		for _, r := range results {
+			status := "ok"
+
+			if r.Error != "" {
+				status = "error: " + r.Error
+			}
+
+			t.row(r.HardwareAddr, r.Addr, status)
+		}
+
+		err = t.flush()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if failed {
+		return errReported
+	}
+
+	return nil
+}
+
+// labelString returns the label without its trailing NUL bytes.
+func labelString(dl lifxpayloads.DeviceLabel) string {
+	return string(bytes.TrimRight(dl[:], "\x00"))
+}
+
+// powerString returns "on" or "off" for the power level, or a percentage if
+// the power is in the middle of fading.
+func powerString(level uint16) string {
+	switch level {
+	case 0:
+		return "off"
+	case 65535:
+		return "on"
+	}
+
+	return fmt.Sprintf("%g%%", round2(float64(level)/65535*100))
+}
+
+// colorString returns the color as a LIFX color string, which can be given
+// back to the color command.
+func colorString(hsbk *lifxpayloads.LightHSBK) string {
+	return fmt.Sprintf(
+		"hue:%g saturation:%g brightness:%g kelvin:%d",
+		round2(hsbk.HueDegrees()), round2(hsbk.SaturationPercent()/100), round2(hsbk.BrightnessPercent()/100), hsbk.Kelvin,
+	)
+}
+
+// round2 rounds to 2 decimal places.
+func round2(f float64) float64 {
+	return float64(int64(f*100+0.5)) / 100
+}
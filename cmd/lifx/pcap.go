@@ -0,0 +1,498 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// the magic numbers at the start of the capture files, as big-endian values
+const (
+	pcapMagicMicro   = 0xa1b2c3d4
+	pcapMagicNano    = 0xa1b23c4d
+	pcapngMagic      = 0x0a0d0d0a
+	pcapngByteMagic  = 0x1a2b3c4d
+	pcapngSectionLen = 28
+)
+
+// the pcapng block types we read
+const (
+	pcapngInterface      = 1
+	pcapngSimplePacket   = 3
+	pcapngEnhancedPacket = 6
+)
+
+// the link-layer header types we can read packets from
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkLoop     = 108
+	linkSLL      = 113
+	linkIPv4     = 228
+	linkIPv6     = 229
+	linkSLL2     = 276
+)
+
+// the BSD loopback (DLT_NULL) address families of IPv6, which vary by OS
+var nullIPv6Families = map[uint32]bool{24: true, 28: true, 30: true}
+
+// errNotCapture is returned when the data isn't a capture file.
+var errNotCapture = errors.New("not a pcap or pcapng file")
+
+// capturedPacket is a UDP datagram read from a capture file.
+type capturedPacket struct {
+	// n is the number of the frame within the capture file, counting from 1
+	n    int
+	time time.Time
+	src  *net.UDPAddr
+	dst  *net.UDPAddr
+	data []byte
+}
+
+// isCapture returns whether the data starts with the magic number of a pcap
+// or pcapng file.
+func isCapture(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+
+	switch binary.BigEndian.Uint32(data) {
+	case pcapMagicMicro, pcapMagicNano, pcapngMagic:
+		return true
+	}
+
+	switch binary.LittleEndian.Uint32(data) {
+	case pcapMagicMicro, pcapMagicNano:
+		return true
+	}
+
+	return false
+}
+
+// readCapture returns the UDP datagrams in the pcap or pcapng file that were
+// sent from or to the port. If the port is 0 all of the UDP datagrams are
+// returned. Frames that aren't UDP, or that can't be parsed, are skipped.
+func readCapture(data []byte, port int) ([]*capturedPacket, error) {
+	if len(data) < 4 {
+		return nil, errNotCapture
+	}
+
+	var (
+		packets []*capturedPacket
+		err     error
+	)
+
+	if binary.BigEndian.Uint32(data) == pcapngMagic {
+		packets, err = readPcapng(data)
+	} else {
+		packets, err = readPcap(data)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []*capturedPacket
+
+	for _, cp := range packets {
+		if cp != nil && (port == 0 || cp.src.Port == port || cp.dst.Port == port) {
+			filtered = append(filtered, cp)
+		}
+	}
+
+	return filtered, nil
+}
+
+// readPcap reads a classic libpcap file. The entries of the returned slice
+// are nil for frames that aren't UDP datagrams.
+func readPcap(data []byte) ([]*capturedPacket, error) {
+	if len(data) < 24 {
+		return nil, errNotCapture
+	}
+
+	var (
+		order binary.ByteOrder
+		nano  bool
+	)
+
+	switch {
+	case binary.BigEndian.Uint32(data) == pcapMagicMicro:
+		order = binary.BigEndian
+	case binary.BigEndian.Uint32(data) == pcapMagicNano:
+		order, nano = binary.BigEndian, true
+	case binary.LittleEndian.Uint32(data) == pcapMagicMicro:
+		order = binary.LittleEndian
+	case binary.LittleEndian.Uint32(data) == pcapMagicNano:
+		order, nano = binary.LittleEndian, true
+	default:
+		return nil, errNotCapture
+	}
+
+	link := order.Uint32(data[20:24]) & 0x0fffffff
+
+	var packets []*capturedPacket
+
+	for offset, n := 24, 1; offset < len(data); n++ {
+		if len(data)-offset < 16 {
+			return nil, fmt.Errorf("frame %d: the record header is truncated", n)
+		}
+
+		sec := int64(order.Uint32(data[offset:]))
+		frac := int64(order.Uint32(data[offset+4:]))
+		size := int(order.Uint32(data[offset+8:]))
+		offset += 16
+
+		if size > len(data)-offset {
+			return nil, fmt.Errorf("frame %d: the frame is truncated", n)
+		}
+
+		if !nano {
+			frac *= int64(time.Microsecond)
+		}
+
+		cp := parseFrame(link, data[offset:offset+size])
+		offset += size
+
+		if cp != nil {
+			cp.n = n
+			cp.time = time.Unix(sec, frac).UTC()
+		}
+
+		packets = append(packets, cp)
+	}
+
+	return packets, nil
+}
+
+// pcapngInterfaceInfo is the link type and timestamp resolution of an
+// interface in a pcapng file.
+type pcapngInterfaceInfo struct {
+	link uint32
+
+	// units is the number of timestamp units in a second
+	units uint64
+}
+
+// readPcapng reads a pcapng file. The entries of the returned slice are nil
+// for frames that aren't UDP datagrams.
+func readPcapng(data []byte) ([]*capturedPacket, error) {
+	var (
+		order      binary.ByteOrder = binary.LittleEndian
+		interfaces []pcapngInterfaceInfo
+		packets    []*capturedPacket
+	)
+
+	for offset, n := 0, 1; offset < len(data); {
+		if len(data)-offset < 12 {
+			return nil, errors.New("a pcapng block header is truncated")
+		}
+
+		block := data[offset:]
+
+		// each section declares its own byte order
+		if binary.BigEndian.Uint32(block) == pcapngMagic {
+			if len(block) < pcapngSectionLen {
+				return nil, errors.New("the pcapng section header is truncated")
+			}
+
+			switch {
+			case binary.BigEndian.Uint32(block[8:]) == pcapngByteMagic:
+				order = binary.BigEndian
+			case binary.LittleEndian.Uint32(block[8:]) == pcapngByteMagic:
+				order = binary.LittleEndian
+			default:
+				return nil, errNotCapture
+			}
+
+			interfaces = nil
+		}
+
+		blockType := order.Uint32(block)
+		length := int(order.Uint32(block[4:]))
+
+		if length < 12 || length > len(block) {
+			return nil, fmt.Errorf("a pcapng block has an invalid length of %d bytes", length)
+		}
+
+		body := block[8 : length-4]
+		offset += length
+
+		switch blockType {
+		case pcapngInterface:
+			if len(body) < 8 {
+				return nil, errors.New("a pcapng interface block is truncated")
+			}
+
+			interfaces = append(interfaces, pcapngInterfaceInfo{
+				link:  uint32(order.Uint16(body)),
+				units: pcapngResolution(body[8:], order),
+			})
+
+		case pcapngEnhancedPacket:
+			if len(body) < 20 {
+				return nil, fmt.Errorf("frame %d: the pcapng packet block is truncated", n)
+			}
+
+			id := int(order.Uint32(body))
+			ts := uint64(order.Uint32(body[4:]))<<32 | uint64(order.Uint32(body[8:]))
+			size := int(order.Uint32(body[12:]))
+
+			if id >= len(interfaces) {
+				return nil, fmt.Errorf("frame %d: unknown pcapng interface %d", n, id)
+			}
+
+			if size > len(body)-20 {
+				return nil, fmt.Errorf("frame %d: the frame is truncated", n)
+			}
+
+			cp := parseFrame(interfaces[id].link, body[20:20+size])
+
+			if cp != nil {
+				cp.n = n
+				units := interfaces[id].units
+				nsec := float64(ts%units) / float64(units) * 1e9
+				cp.time = time.Unix(int64(ts/units), int64(nsec)).UTC()
+			}
+
+			packets = append(packets, cp)
+			n++
+
+		case pcapngSimplePacket:
+			if len(body) < 4 || len(interfaces) == 0 {
+				return nil, fmt.Errorf("frame %d: the pcapng packet block is invalid", n)
+			}
+
+			size := int(order.Uint32(body))
+
+			if size > len(body)-4 {
+				size = len(body) - 4
+			}
+
+			cp := parseFrame(interfaces[0].link, body[4:4+size])
+
+			if cp != nil {
+				cp.n = n
+			}
+
+			packets = append(packets, cp)
+			n++
+		}
+	}
+
+	return packets, nil
+}
+
+// pcapngResolution returns the number of timestamp units in a second, from
+// the if_tsresol option of an interface block. The default is microseconds.
+func pcapngResolution(options []byte, order binary.ByteOrder) uint64 {
+	for len(options) >= 4 {
+		code := order.Uint16(options)
+		length := int(order.Uint16(options[2:]))
+		options = options[4:]
+
+		if length > len(options) {
+			break
+		}
+
+		// if_tsresol
+		if code == 9 && length == 1 {
+			v := options[0]
+
+			// anything finer than 2^-63 or 10^-19 seconds doesn't fit
+			if v&0x80 != 0 && v&0x7f < 64 {
+				return 1 << (v & 0x7f)
+			}
+
+			if v < 20 {
+				units := uint64(1)
+
+				for i := byte(0); i < v; i++ {
+					units *= 10
+				}
+
+				return units
+			}
+
+			break
+		}
+
+		// the option values are padded to 32 bits
+		padded := (length + 3) &^ 3
+
+		if padded > len(options) {
+			break
+		}
+
+		options = options[padded:]
+	}
+
+	return 1e6
+}
+
+// parseFrame returns the UDP datagram in the frame, or nil if the frame
+// doesn't contain one.
+func parseFrame(link uint32, frame []byte) *capturedPacket {
+	var (
+		etherType uint16
+		payload   []byte
+	)
+
+	switch link {
+	case linkEthernet:
+		if len(frame) < 14 {
+			return nil
+		}
+
+		etherType, payload = binary.BigEndian.Uint16(frame[12:]), frame[14:]
+
+		// skip any VLAN tags
+		for (etherType == 0x8100 || etherType == 0x88a8) && len(payload) >= 4 {
+			etherType, payload = binary.BigEndian.Uint16(payload[2:]), payload[4:]
+		}
+
+	case linkNull, linkLoop:
+		if len(frame) < 4 {
+			return nil
+		}
+
+		// the address family is in the byte order of the machine that
+		// wrote the capture, or big-endian for DLT_LOOP
+		family := binary.LittleEndian.Uint32(frame)
+
+		if family > 0xffff {
+			family = binary.BigEndian.Uint32(frame)
+		}
+
+		switch {
+		case family == 2:
+			etherType = 0x0800
+		case nullIPv6Families[family]:
+			etherType = 0x86dd
+		}
+
+		payload = frame[4:]
+
+	case linkSLL:
+		if len(frame) < 16 {
+			return nil
+		}
+
+		etherType, payload = binary.BigEndian.Uint16(frame[14:]), frame[16:]
+
+	case linkSLL2:
+		if len(frame) < 20 {
+			return nil
+		}
+
+		etherType, payload = binary.BigEndian.Uint16(frame), frame[20:]
+
+	case linkRaw, linkIPv4, linkIPv6:
+		if len(frame) == 0 {
+			return nil
+		}
+
+		switch frame[0] >> 4 {
+		case 4:
+			etherType = 0x0800
+		case 6:
+			etherType = 0x86dd
+		}
+
+		payload = frame
+	}
+
+	switch etherType {
+	case 0x0800:
+		return parseIPv4(payload)
+	case 0x86dd:
+		return parseIPv6(payload)
+	}
+
+	return nil
+}
+
+// parseIPv4 returns the UDP datagram in the IPv4 packet, or nil if it isn't
+// one. Fragments are ignored.
+func parseIPv4(packet []byte) *capturedPacket {
+	if len(packet) < 20 || packet[0]>>4 != 4 {
+		return nil
+	}
+
+	ihl := int(packet[0]&0x0f) * 4
+	total := int(binary.BigEndian.Uint16(packet[2:]))
+	flags := binary.BigEndian.Uint16(packet[6:])
+
+	// more fragments, or a fragment offset
+	if flags&0x2000 != 0 || flags&0x1fff != 0 || packet[9] != 17 {
+		return nil
+	}
+
+	if ihl < 20 || total < ihl || total > len(packet) {
+		return nil
+	}
+
+	return parseUDP(net.IP(packet[12:16]), net.IP(packet[16:20]), packet[ihl:total])
+}
+
+// parseIPv6 returns the UDP datagram in the IPv6 packet, or nil if it isn't
+// one. Fragments are ignored.
+func parseIPv6(packet []byte) *capturedPacket {
+	if len(packet) < 40 || packet[0]>>4 != 6 {
+		return nil
+	}
+
+	next := packet[6]
+	src, dst := net.IP(packet[8:24]), net.IP(packet[24:40])
+	payload := packet[40:]
+
+	if length := int(binary.BigEndian.Uint16(packet[4:])); length < len(payload) {
+		payload = payload[:length]
+	}
+
+	// skip the hop-by-hop, routing, and destination options headers
+	for next == 0 || next == 43 || next == 60 {
+		if len(payload) < 8 {
+			return nil
+		}
+
+		length := (int(payload[1]) + 1) * 8
+
+		if length > len(payload) {
+			return nil
+		}
+
+		next, payload = payload[0], payload[length:]
+	}
+
+	if next != 17 {
+		return nil
+	}
+
+	return parseUDP(src, dst, payload)
+}
+
+// parseUDP returns the UDP datagram.
+func parseUDP(src, dst net.IP, segment []byte) *capturedPacket {
+	if len(segment) < 8 {
+		return nil
+	}
+
+	length := int(binary.BigEndian.Uint16(segment[4:]))
+
+	if length < 8 || length > len(segment) {
+		length = len(segment)
+	}
+
+	return &capturedPacket{
+		src:  &net.UDPAddr{IP: append(net.IP(nil), src...), Port: int(binary.BigEndian.Uint16(segment))},
+		dst:  &net.UDPAddr{IP: append(net.IP(nil), dst...), Port: int(binary.BigEndian.Uint16(segment[2:]))},
+		data: append([]byte(nil), segment[8:length]...),
+	}
+}
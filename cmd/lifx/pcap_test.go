@@ -0,0 +1,202 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+// udpSegment returns a UDP header followed by the payload.
+func udpSegment(srcPort, dstPort int, payload []byte) []byte {
+	segment := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(segment, uint16(srcPort))
+	binary.BigEndian.PutUint16(segment[2:], uint16(dstPort))
+	binary.BigEndian.PutUint16(segment[4:], uint16(8+len(payload)))
+
+	return append(segment, payload...)
+}
+
+// ethernetIPv4 returns an Ethernet frame with an IPv4 UDP datagram.
+func ethernetIPv4(src, dst *net.UDPAddr, payload []byte) []byte {
+	segment := udpSegment(src.Port, dst.Port, payload)
+
+	ip := make([]byte, 20, 20+len(segment))
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+len(segment)))
+	binary.BigEndian.PutUint16(ip[6:], 0x4000) // don't fragment
+	ip[8] = 64
+	ip[9] = 17
+	copy(ip[12:], src.IP.To4())
+	copy(ip[16:], dst.IP.To4())
+
+	frame := make([]byte, 14, 14+len(ip)+len(segment))
+	binary.BigEndian.PutUint16(frame[12:], 0x0800)
+
+	return append(append(frame, ip...), segment...)
+}
+
+// rawIPv6 returns an IPv6 UDP datagram behind a hop-by-hop options header.
+func rawIPv6(src, dst *net.UDPAddr, payload []byte) []byte {
+	segment := udpSegment(src.Port, dst.Port, payload)
+
+	ip := make([]byte, 48, 48+len(segment))
+	ip[0] = 0x60
+	binary.BigEndian.PutUint16(ip[4:], uint16(8+len(segment)))
+	ip[6] = 0
+	ip[7] = 64
+	copy(ip[8:], src.IP.To16())
+	copy(ip[24:], dst.IP.To16())
+	ip[40] = 17
+
+	return append(ip, segment...)
+}
+
+// pcapFile returns a little-endian libpcap file with microsecond timestamps.
+func pcapFile(link uint32, times []time.Time, frames [][]byte) []byte {
+	buf := &bytes.Buffer{}
+
+	binary.Write(buf, binary.LittleEndian, []uint32{pcapMagicMicro, 0x00040002, 0, 0, 65535, link})
+
+	for i, frame := range frames {
+		t := times[i]
+		binary.Write(buf, binary.LittleEndian, []uint32{uint32(t.Unix()), uint32(t.Nanosecond() / 1000), uint32(len(frame)), uint32(len(frame))})
+		buf.Write(frame)
+	}
+
+	return buf.Bytes()
+}
+
+// pcapngBlock returns a big-endian pcapng block.
+func pcapngBlock(blockType uint32, body []byte) []byte {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.BigEndian, []uint32{blockType, uint32(12 + len(body))})
+	buf.Write(body)
+	binary.Write(buf, binary.BigEndian, uint32(12+len(body)))
+
+	return buf.Bytes()
+}
+
+func (*TestSuite) Test_readCapture_pcap(c *C) {
+	data := echoPacket(c)
+
+	client := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 10), Port: 50000}
+	bulb := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 20), Port: 56700}
+	dns := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 1), Port: 53}
+
+	start := time.Date(2016, 10, 1, 12, 0, 0, 250000000, time.UTC)
+	times := []time.Time{start, start.Add(time.Millisecond), start.Add(2 * time.Millisecond)}
+
+	file := pcapFile(linkEthernet, times, [][]byte{
+		ethernetIPv4(client, bulb, data),
+		ethernetIPv4(client, dns, []byte("query")),
+		ethernetIPv4(bulb, client, data),
+	})
+
+	c.Check(isCapture(file), Equals, true)
+	c.Check(isCapture(data), Equals, false)
+
+	packets, err := readCapture(file, 56700)
+	c.Assert(err, IsNil)
+	c.Assert(packets, HasLen, 2)
+
+	c.Check(packets[0].n, Equals, 1)
+	c.Check(packets[0].time.Equal(times[0]), Equals, true)
+	c.Check(packets[0].src.String(), Equals, "192.168.1.10:50000")
+	c.Check(packets[0].dst.String(), Equals, "192.168.1.20:56700")
+	c.Check(packets[0].data, DeepEquals, data)
+
+	c.Check(packets[1].n, Equals, 3)
+	c.Check(packets[1].time.Equal(times[2]), Equals, true)
+	c.Check(packets[1].src.String(), Equals, "192.168.1.20:56700")
+
+	packets, err = readCapture(file, 0)
+	c.Assert(err, IsNil)
+	c.Check(packets, HasLen, 3)
+
+	_, err = readCapture(file[:len(file)-10], 56700)
+	c.Check(err, ErrorMatches, "frame 3: the frame is truncated")
+
+	_, err = readCapture(data, 56700)
+	c.Check(err, Equals, errNotCapture)
+}
+
+func (*TestSuite) Test_readCapture_pcapng(c *C) {
+	data := echoPacket(c)
+
+	client := &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 50000}
+	bulb := &net.UDPAddr{IP: net.ParseIP("fe80::2"), Port: 56700}
+
+	// the section header, and an interface with nanosecond timestamps
+	section := []byte{0x1a, 0x2b, 0x3c, 0x4d, 0, 1, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	iface := []byte{0, byte(linkRaw), 0, 0, 0, 0, 0xff, 0xff, 0, 9, 0, 1, 9, 0, 0, 0, 0, 0, 0, 0}
+
+	ts := uint64(time.Date(2016, 10, 1, 12, 0, 0, 123456789, time.UTC).UnixNano())
+	frame := rawIPv6(client, bulb, data)
+
+	packet := &bytes.Buffer{}
+	binary.Write(packet, binary.BigEndian, []uint32{0, uint32(ts >> 32), uint32(ts), uint32(len(frame)), uint32(len(frame))})
+	packet.Write(frame)
+
+	file := append(pcapngBlock(pcapngMagic, section), pcapngBlock(pcapngInterface, iface)...)
+	file = append(file, pcapngBlock(pcapngEnhancedPacket, packet.Bytes())...)
+
+	c.Check(isCapture(file), Equals, true)
+
+	packets, err := readCapture(file, 56700)
+	c.Assert(err, IsNil)
+	c.Assert(packets, HasLen, 1)
+
+	c.Check(packets[0].n, Equals, 1)
+	c.Check(packets[0].time.UnixNano(), Equals, int64(ts))
+	c.Check(packets[0].src.String(), Equals, "[fe80::1]:50000")
+	c.Check(packets[0].dst.String(), Equals, "[fe80::2]:56700")
+	c.Check(packets[0].data, DeepEquals, data)
+
+	// decode the capture from a file
+	dir, err := ioutil.TempDir("", "lifx-decode")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "capture.pcapng")
+	c.Assert(ioutil.WriteFile(path, file, 0600), IsNil)
+
+	stdout, stderr, code := runDecodeArgs("--json", "--file", path)
+	c.Assert(code, Equals, exitOK, Commentf("%s", stderr))
+
+	var out []decodedJSON
+	c.Assert(json.Unmarshal([]byte(stdout), &out), IsNil)
+	c.Assert(out, HasLen, 1)
+	c.Check(out[0].Source, Equals, "frame 1")
+	c.Check(out[0].Src, Equals, "[fe80::1]:50000")
+	c.Check(out[0].Dst, Equals, "[fe80::2]:56700")
+	c.Assert(out[0].Time, NotNil)
+	c.Check(out[0].Time.UnixNano(), Equals, int64(ts))
+	c.Assert(out[0].Packet, NotNil)
+	c.Check(out[0].Packet.Header.FrameAddress.Sequence, Equals, uint8(7))
+}
+
+func (*TestSuite) Test_pcapngResolution(c *C) {
+	order := binary.LittleEndian
+
+	c.Check(pcapngResolution(nil, order), Equals, uint64(1e6))
+	c.Check(pcapngResolution([]byte{9, 0, 1, 0, 3, 0, 0, 0}, order), Equals, uint64(1e3))
+	c.Check(pcapngResolution([]byte{9, 0, 1, 0, 0x8a, 0, 0, 0}, order), Equals, uint64(1024))
+
+	// if_tsresol after another option, which is padded
+	c.Check(pcapngResolution([]byte{2, 0, 3, 0, 'e', 't', 'h', 0, 9, 0, 1, 0, 9, 0, 0, 0}, order), Equals, uint64(1e9))
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/theckman/go-lifx"
+)
+
+// maxConcurrency is the maximum number of devices talked to at once.
+const maxConcurrency = 64
+
+// parseSelectors parses the selectors from the command line.
+func parseSelectors(args []string) ([]lifx.Selector, error) {
+	selectors := make([]lifx.Selector, 0, len(args))
+
+	for _, arg := range args {
+		sel, err := lifx.ParseSelector(arg)
+
+		if err != nil {
+			return nil, usageError(err.Error())
+		}
+
+		selectors = append(selectors, sel)
+	}
+
+	return selectors, nil
+}
+
+// resolve discovers the devices on the network, and returns the ones picked
+// by any of the selectors, sorted by MAC address. It's an error if none of
+// them are. The devices that fail to answer while they're being matched are
+// reported as warnings.
+func (e *env) resolve(client *lifx.Client, args []string) ([]*lifx.Device, error) {
+	if len(args) == 0 {
+		return nil, usageError("at least one selector is required")
+	}
+
+	selectors, err := parseSelectors(args)
+
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := client.Discover(e.ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err := lifx.Select(e.ctx, devices, selectors)
+
+	if me, ok := err.(lifx.MultiError); ok {
+		for _, de := range me {
+			e.warn("%s", de)
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no devices match %s", strings.Join(args, ", "))
+	}
+
+	return selected, nil
+}
+
+// each calls fn concurrently for each of the devices, along with its index,
+// and returns the errors in the same order as the devices.
+func each(ctx context.Context, devices []*lifx.Device, fn func(context.Context, int, *lifx.Device) error) []error {
+	var wg sync.WaitGroup
+
+	errs := make([]error, len(devices))
+	sem := make(chan struct{}, maxConcurrency)
+
+	for i, device := range devices {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, device *lifx.Device) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			errs[i] = fn(ctx, i, device)
+		}(i, device)
+	}
+
+	wg.Wait()
+
+	return errs
+}
+
+// warnEach reports the errors returned by each as warnings, and returns
+// whether there were any.
+func (e *env) warnEach(devices []*lifx.Device, errs []error) bool {
+	var failed bool
+
+	for i, err := range errs {
+		if err != nil {
+			e.warn("device %s: %s", devices[i].HardwareAddr, err)
+			failed = true
+		}
+	}
+
+	return failed
+}
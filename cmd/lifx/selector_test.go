@@ -0,0 +1,25 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/theckman/go-lifx"
+
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) Test_parseSelectors(c *C) {
+	selectors, err := parseSelectors([]string{"all", "group:Downstairs"})
+	c.Assert(err, IsNil)
+	c.Check(selectors, DeepEquals, []lifx.Selector{
+		{Kind: lifx.SelectAll},
+		{Kind: lifx.SelectGroup, Value: "Downstairs"},
+	})
+
+	for _, in := range []string{"label:", "group:", "mac:kitchen", "mac:d0:73:d5:01:02:03:04:05"} {
+		_, err := parseSelectors([]string{"all", in})
+		c.Check(err, FitsTypeOf, usageError(""), Commentf("%q", in))
+	}
+}
@@ -0,0 +1,414 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/theckman/go-lifx"
+	"github.com/theckman/go-lifx/protocol"
+)
+
+func init() {
+	register(&command{
+		name:    "send",
+		args:    "--type <type> [--target <mac>]",
+		summary: "send a hand-crafted packet, and print the replies",
+		setup: func(fs *flag.FlagSet) func(*env, []string) error {
+			cfg := &sendConfig{}
+
+			fs.StringVar(&cfg.msgType, "type", "", "the message type, as a number or a name like LightSetColor")
+			fs.StringVar(&cfg.target, "target", "", "the MAC address of the device; empty to target all devices")
+			fs.StringVar(&cfg.addr, "addr", "", "the address to send to, as host or host:port; defaults to --broadcast")
+			fs.BoolVar(&cfg.ack, "ack", false, "set the ack_required flag")
+			fs.BoolVar(&cfg.res, "res", false, "set the res_required flag")
+			fs.UintVar(&cfg.seq, "seq", 0, "the sequence number")
+			fs.UintVar(&cfg.source, "source", 0, "the source identifier; 0 for a random one")
+			fs.StringVar(&cfg.header, "header", "", "JSON overriding any of the header fields, like the reserved ones")
+			fs.StringVar(&cfg.payload, "payload", "", "the payload as JSON, in the form printed by 'lifx decode --json'")
+			fs.StringVar(&cfg.payloadHex, "payload-hex", "", "the raw payload as hex, for unknown types or malformed payloads")
+			fs.IntVar(&cfg.size, "size", -1, "override the frame size; -1 to use the one in --header, or the size of the packet")
+			fs.DurationVar(&cfg.wait, "wait", 0, "how long to wait for replies; defaults to --timeout")
+
+			return func(e *env, args []string) error {
+				if len(args) > 0 {
+					return usageError("send doesn't take any arguments")
+				}
+
+				return runSend(e, cfg)
+			}
+		},
+	})
+}
+
+type sendConfig struct {
+	msgType    string
+	target     string
+	addr       string
+	ack        bool
+	res        bool
+	seq        uint
+	source     uint
+	header     string
+	payload    string
+	payloadHex string
+	size       int
+	wait       time.Duration
+}
+
+// sentJSON is a packet in the JSON output of the send command. The bytes are
+// included, since the packet may not be what its header says it is.
+type sentJSON struct {
+	Addr    string               `json:"addr"`
+	Latency string               `json:"latency,omitempty"`
+	Bytes   string               `json:"bytes"`
+	Packet  *lifxprotocol.Packet `json:"packet,omitempty"`
+	Error   string               `json:"error,omitempty"`
+}
+
+type sendJSON struct {
+	Sent    sentJSON   `json:"sent"`
+	Replies []sentJSON `json:"replies"`
+}
+
+func runSend(e *env, cfg *sendConfig) error {
+	header, err := sendHeader(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	payload, err := sendPayload(header, cfg)
+
+	if err != nil {
+		return err
+	}
+
+	size := lifxprotocol.HeaderByteSize + len(payload)
+
+	switch {
+	case size > 0xffff:
+		return usageError(fmt.Sprintf("the packet is %d bytes, which doesn't fit in the frame size", size))
+	case cfg.size > 0xffff:
+		return usageError(fmt.Sprintf("the frame size can't be more than %d bytes", 0xffff))
+	case cfg.size >= 0:
+		header.Frame.Size = uint16(cfg.size)
+	case headerSetsSize(cfg.header):
+		// the size from the --header is sent as given
+	default:
+		header.Frame.Size = uint16(size)
+	}
+
+	data, err := header.MarshalPacket(binary.LittleEndian)
+
+	if err != nil {
+		return usageError(fmt.Sprintf("invalid header: %s", err))
+	}
+
+	data = append(data, payload...)
+
+	addr, err := sendAddr(e, cfg.addr)
+
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenUDP("udp4", nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	wait := cfg.wait
+
+	if wait <= 0 {
+		wait = e.opts.timeout
+	}
+
+	sent := time.Now()
+
+	if _, err := conn.WriteTo(data, addr); err != nil {
+		return err
+	}
+
+	out := sendJSON{Sent: newSentJSON(addr, data)}
+
+	if !e.opts.json {
+		fmt.Fprintf(e.stdout, "sent %d bytes to %s:\n%s\n", len(data), addr, dissectSent(out.Sent, data))
+	}
+
+	if err := conn.SetReadDeadline(sent.Add(wait)); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		// unblock the read if the command is interrupted
+		select {
+		case <-e.ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	buf := make([]byte, 0xffff)
+
+	for {
+		n, from, err := conn.ReadFrom(buf)
+
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			}
+
+			return err
+		}
+
+		reply := newSentJSON(from, buf[:n])
+
+		// skip the packets meant for other clients; the ones too
+		// malformed to tell are shown
+		if reply.Packet != nil && reply.Packet.Header.Frame.Source != header.Frame.Source {
+			continue
+		}
+
+		reply.Latency = time.Since(sent).String()
+		out.Replies = append(out.Replies, reply)
+
+		if !e.opts.json {
+			fmt.Fprintf(e.stdout, "\nreply from %s after %s:\n%s\n", from, reply.Latency, dissectSent(reply, buf[:n]))
+		}
+	}
+
+	if e.opts.json {
+		if out.Replies == nil {
+			out.Replies = []sentJSON{}
+		}
+
+		if err := writeJSON(e.stdout, out); err != nil {
+			return err
+		}
+	}
+
+	if len(out.Replies) == 0 && (header.FrameAddress.AckRequired || header.FrameAddress.ResRequired) {
+		return fmt.Errorf("no replies within %s", wait)
+	}
+
+	return nil
+}
+
+// newSentJSON decodes the packet. Any error is recorded, since the packets
+// sent may be malformed on purpose.
+func newSentJSON(addr net.Addr, data []byte) sentJSON {
+	packet, _, err := decodePacket(data)
+
+	sj := sentJSON{
+		Addr:   addr.String(),
+		Bytes:  hex.EncodeToString(data),
+		Packet: packet,
+	}
+
+	if err != nil {
+		sj.Error = err.Error()
+	}
+
+	return sj
+}
+
+// dissectSent renders the packet as a tree, or as hex if it can't be decoded.
+func dissectSent(sj sentJSON, data []byte) string {
+	if sj.Packet == nil {
+		return fmt.Sprintf("%s\n% x", sj.Error, data)
+	}
+
+	s := lifxprotocol.Dissect(sj.Packet)
+
+	if sj.Error != "" {
+		s = sj.Error + "\n" + s
+	}
+
+	return s
+}
+
+// sendHeader builds the header from the flags, and then applies the JSON
+// overrides.
+func sendHeader(cfg *sendConfig) (*lifxprotocol.Header, error) {
+	if cfg.msgType == "" {
+		return nil, usageError("the --type flag is required")
+	}
+
+	msgType, err := parseMessageType(cfg.msgType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var target net.HardwareAddr
+
+	if cfg.target != "" {
+		if target, err = net.ParseMAC(cfg.target); err != nil {
+			return nil, usageError(fmt.Sprintf("invalid --target: %s", err))
+		}
+	}
+
+	if cfg.seq > 0xff {
+		return nil, usageError("the --seq must be between 0 and 255")
+	}
+
+	if cfg.source > 0xffffffff {
+		return nil, usageError("the --source must fit in 32 bits")
+	}
+
+	source := uint32(cfg.source)
+
+	// a source of 0 tells the devices to broadcast their responses, and 1
+	// is used by some of the LIFX apps, so neither is picked at random
+	if source == 0 {
+		rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+		for source < 2 {
+			source = rng.Uint32()
+		}
+	}
+
+	frame := lifxprotocol.NewFrame()
+	frame.Tagged = len(target) == 0
+	frame.Source = source
+
+	header := &lifxprotocol.Header{
+		Frame: frame,
+		FrameAddress: &lifxprotocol.FrameAddress{
+			Target:      target,
+			AckRequired: cfg.ack,
+			ResRequired: cfg.res,
+			Sequence:    uint8(cfg.seq),
+		},
+		ProtocolHeader: &lifxprotocol.ProtocolHeader{Type: msgType},
+	}
+
+	if cfg.header == "" {
+		return header, nil
+	}
+
+	if err := json.Unmarshal([]byte(cfg.header), header); err != nil {
+		return nil, usageError(fmt.Sprintf("invalid --header: %s", err))
+	}
+
+	if header.Frame == nil || header.FrameAddress == nil || header.ProtocolHeader == nil {
+		return nil, usageError("the --header can't remove a part of the header")
+	}
+
+	return header, nil
+}
+
+// headerSetsSize returns whether the --header JSON sets the frame size. It's
+// only called once the JSON has been unmarshaled into the header, so it's
+// known to be valid.
+func headerSetsSize(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	var header struct {
+		Frame struct {
+			Size *json.RawMessage `json:"size"`
+		} `json:"frame"`
+	}
+
+	if err := json.Unmarshal([]byte(s), &header); err != nil {
+		return false
+	}
+
+	return header.Frame.Size != nil
+}
+
+// parseMessageType parses a message type given as a number or a name.
+func parseMessageType(s string) (uint16, error) {
+	if t, ok := lifxprotocol.TypeFromName(s); ok {
+		return t, nil
+	}
+
+	t, err := strconv.ParseUint(s, 0, 16)
+
+	if err != nil {
+		return 0, usageError(fmt.Sprintf("unknown message type %q", s))
+	}
+
+	return uint16(t), nil
+}
+
+// sendPayload returns the marshaled payload for the message type in the
+// header. Unknown message types have an empty payload, unless it's given in
+// hex.
+func sendPayload(header *lifxprotocol.Header, cfg *sendConfig) ([]byte, error) {
+	if cfg.payloadHex != "" {
+		if cfg.payload != "" {
+			return nil, usageError("only one of --payload and --payload-hex can be given")
+		}
+
+		payload, err := decodeHex(cfg.payloadHex)
+
+		if err != nil {
+			return nil, usageError(fmt.Sprintf("invalid --payload-hex: %s", err))
+		}
+
+		return payload, nil
+	}
+
+	raw := json.RawMessage("null")
+
+	if cfg.payload != "" {
+		raw = json.RawMessage(cfg.payload)
+	}
+
+	doc, err := json.Marshal(struct {
+		Payload json.RawMessage `json:"payload"`
+	}{raw})
+
+	if err != nil {
+		return nil, usageError(fmt.Sprintf("invalid --payload: %s", err))
+	}
+
+	// the payload is unmarshaled in to the type for the header's message
+	// type; the header itself is left alone
+	packet := &lifxprotocol.Packet{Header: header}
+
+	err = json.Unmarshal(doc, packet)
+
+	switch {
+	case err == lifxprotocol.ErrUnknownMessageType && cfg.payload == "":
+		return nil, nil
+	case err == lifxprotocol.ErrUnknownMessageType:
+		return nil, usageError(fmt.Sprintf("message type %d is unknown, so its payload must be given with --payload-hex", header.ProtocolHeader.Type))
+	case err != nil:
+		return nil, usageError(fmt.Sprintf("invalid --payload: %s", err))
+	}
+
+	return packet.Payload.MarshalPacket(binary.LittleEndian)
+}
+
+// sendAddr returns the address to send the packet to.
+func sendAddr(e *env, addr string) (*net.UDPAddr, error) {
+	switch {
+	case addr != "":
+		return parseAddr("--addr", addr)
+	case e.opts.broadcast != "":
+		return parseAddr("--broadcast", e.opts.broadcast)
+	}
+
+	return &net.UDPAddr{IP: net.IPv4bcast, Port: lifx.DefaultPort}, nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/protocol/payloads"
+
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) TestSend_SetColor(c *C) {
+	network, fleet := newFleet(c, 2)
+	defer network.Close()
+
+	stdout, stderr, code := runLifx(c, network, "--json", "send",
+		"--type", "LightSetColor", "--target", fleet[0].HardwareAddr().String(),
+		"--ack", "--res", "--seq", "5", "--source", "1234", "--wait", "200ms",
+		"--payload", `{"color": {"hue": 21845, "saturation": 65535, "brightness": 65535, "kelvin": 3500}, "duration": "0s"}`,
+	)
+	c.Assert(code, Equals, exitOK, Commentf("%s", stderr))
+
+	var out sendJSON
+	c.Assert(json.Unmarshal([]byte(stdout), &out), IsNil)
+
+	c.Check(out.Sent.Addr, Equals, network.Addr().String())
+	c.Check(out.Sent.Error, Equals, "")
+	c.Assert(out.Sent.Packet, NotNil)
+	c.Check(out.Sent.Packet.Header.ProtocolHeader.Type, Equals, lifxprotocol.LightSetColor)
+	c.Check(out.Sent.Packet.Header.Frame.Tagged, Equals, false)
+	c.Check(len(out.Sent.Bytes), Equals, 2*(lifxprotocol.HeaderByteSize+13))
+
+	// an acknowledgement and the state of the light
+	c.Assert(out.Replies, HasLen, 2)
+
+	var types []uint16
+
+	for _, reply := range out.Replies {
+		c.Check(reply.Error, Equals, "")
+		c.Check(reply.Latency, Not(Equals), "")
+		c.Assert(reply.Packet, NotNil)
+		c.Check(reply.Packet.Header.Frame.Source, Equals, uint32(1234))
+		c.Check(reply.Packet.Header.FrameAddress.Sequence, Equals, uint8(5))
+		types = append(types, reply.Packet.Header.ProtocolHeader.Type)
+	}
+
+	c.Check(types, DeepEquals, []uint16{lifxprotocol.DeviceAcknowledgement, lifxprotocol.LightState})
+
+	c.Check(fleet[0].State().Color, Equals, lifxpayloads.LightHSBK{Hue: 21845, Saturation: 65535, Brightness: 65535, Kelvin: 3500})
+	c.Check(fleet[1].State().Color, Not(Equals), fleet[0].State().Color)
+}
+
+func (*TestSuite) TestSend_Broadcast(c *C) {
+	network, fleet := newFleet(c, 3)
+	defer network.Close()
+
+	stdout, stderr, code := runLifx(c, network, "send", "--type", "2", "--wait", "200ms")
+	c.Assert(code, Equals, exitOK, Commentf("%s", stderr))
+
+	c.Check(stdout, Matches, `(?s)sent 36 bytes to .*:\nLIFX Packet: DeviceGetService \(2\)\n.*`)
+	c.Check(strings.Count(stdout, "\nreply from "), Equals, 3)
+	c.Check(strings.Count(stdout, "LIFX Packet: DeviceStateService (3)"), Equals, 3)
+
+	for _, device := range fleet {
+		c.Check(stdout, Matches, `(?s).*Target: `+device.HardwareAddr().String()+`.*`)
+	}
+}
+
+func (*TestSuite) TestSend_Overrides(c *C) {
+	network, fleet := newFleet(c, 1)
+	defer network.Close()
+
+	// reserved fields are sent as given
+	_, stderr, code := runLifx(c, network, "send",
+		"--type", "DeviceGetLabel", "--target", fleet[0].HardwareAddr().String(), "--res",
+		"--header", `{"frame_address": {"reserved_block": "0102030405ff"}, "protocol_header": {"reserved_end": 7}}`,
+	)
+	c.Assert(code, Equals, exitOK, Commentf("%s", stderr))
+
+	received := fleet[0].Received()
+	c.Assert(received, HasLen, 1)
+	c.Check(received[0].Header.FrameAddress.ReservedBlock, Equals, [6]uint8{1, 2, 3, 4, 5, 0xff})
+	c.Check(received[0].Header.ProtocolHeader.ReservedEnd, Equals, uint16(7))
+
+	// an unknown message type with a frame size that doesn't match, which
+	// the device ignores
+	stdout, stderr, code := runLifx(c, network, "--json", "send",
+		"--type", "9999", "--target", fleet[0].HardwareAddr().String(), "--ack",
+		"--payload-hex", "01 02 03", "--size", "10",
+	)
+	c.Check(code, Equals, exitFailure)
+	c.Check(stderr, Equals, "lifx send: no replies within 50ms\n")
+
+	// packets of unknown types can't be unmarshaled from JSON
+	var out struct {
+		Sent struct {
+			Bytes string
+			Error string
+		}
+		Replies []json.RawMessage
+	}
+
+	c.Assert(json.Unmarshal([]byte(stdout), &out), IsNil)
+	c.Check(out.Sent.Bytes, Matches, "0a00.*010203")
+	c.Check(out.Sent.Error, Equals, "unknown message type 9999")
+	c.Check(out.Replies, HasLen, 0)
+	c.Check(fleet[0].Received(), HasLen, 1)
+
+	// the frame size can be set in the --header too, and --size wins over it
+	stdout, _, _ = runLifx(c, network, "--json", "send",
+		"--type", "9999", "--target", fleet[0].HardwareAddr().String(),
+		"--header", `{"frame": {"size": 12}}`,
+	)
+	c.Assert(json.Unmarshal([]byte(stdout), &out), IsNil)
+	c.Check(out.Sent.Bytes, Matches, "0c00.*")
+
+	stdout, _, _ = runLifx(c, network, "--json", "send",
+		"--type", "9999", "--target", fleet[0].HardwareAddr().String(),
+		"--header", `{"frame": {"size": 12}}`, "--size", "14",
+	)
+	c.Assert(json.Unmarshal([]byte(stdout), &out), IsNil)
+	c.Check(out.Sent.Bytes, Matches, "0e00.*")
+}
+
+func (*TestSuite) TestSend_Usage(c *C) {
+	network, _ := newFleet(c, 1)
+	defer network.Close()
+
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{nil, "the --type flag is required"},
+		{[]string{"--type", "LightSetColour"}, `unknown message type "LightSetColour"`},
+		{[]string{"--type", "LightGet", "extra"}, "send doesn't take any arguments"},
+		{[]string{"--type", "LightGet", "--target", "kitchen"}, "invalid --target: .*"},
+		{[]string{"--type", "LightGet", "--seq", "256"}, "the --seq must be between 0 and 255"},
+		{[]string{"--type", "LightGet", "--header", `{"frame": null}`}, "the --header can't remove a part of the header"},
+		{[]string{"--type", "LightSetPower", "--payload", `{"level": `}, "invalid --payload: .*"},
+		{[]string{"--type", "LightSetPower", "--payload", "{}", "--payload-hex", "00"}, "only one of --payload and --payload-hex can be given"},
+		{[]string{"--type", "9999", "--payload", "{}"}, "message type 9999 is unknown, so its payload must be given with --payload-hex"},
+		{[]string{"--type", "LightGet", "--addr", "256.0.0.1"}, "invalid --addr address: .*"},
+	}
+
+	for _, tt := range tests {
+		_, stderr, code := runLifx(c, network, append([]string{"send"}, tt.args...)...)
+		c.Check(code, Equals, exitUsage, Commentf("%q", tt.args))
+		c.Check(stderr, Matches, "(?s)lifx send: "+tt.err+"\n.*", Commentf("%q", tt.args))
+	}
+}
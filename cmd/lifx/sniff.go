@@ -0,0 +1,193 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/sniffer"
+)
+
+func init() {
+	register(&command{
+		name:    "sniff",
+		args:    "",
+		summary: "decode the LIFX traffic on the network as it happens",
+		setup: func(fs *flag.FlagSet) func(*env, []string) error {
+			cfg := &sniffConfig{}
+
+			fs.StringVar(&cfg.addr, "addr", lifxsniffer.DefaultAddr, "the address to listen on; on Linux, a program on this host listening on the same port loses some of its unicast packets to the sniffer")
+			fs.DurationVar(&cfg.pairTimeout, "pair-timeout", lifxsniffer.DefaultPairTimeout, "how long a request waits to be paired with its responses")
+			fs.IntVar(&cfg.count, "count", 0, "stop after this many packets; 0 to run until interrupted")
+
+			return func(e *env, args []string) error {
+				if len(args) > 0 {
+					return usageError("sniff doesn't take any arguments")
+				}
+
+				return runSniff(e, cfg)
+			}
+		},
+	})
+}
+
+type sniffConfig struct {
+	addr        string
+	pairTimeout time.Duration
+	count       int
+}
+
+// sniffEvent is a packet, as printed by the sniff command.
+type sniffEvent struct {
+	Time           time.Time            `json:"time"`
+	Kind           string               `json:"kind"`
+	Addr           string               `json:"addr"`
+	Bytes          string               `json:"bytes"`
+	Packet         *lifxprotocol.Packet `json:"packet,omitempty"`
+	Error          string               `json:"error,omitempty"`
+	RequestType    string               `json:"request_type,omitempty"`
+	Latency        string               `json:"latency,omitempty"`
+	SourceConflict string               `json:"source_conflict,omitempty"`
+}
+
+func newSniffEvent(p *lifxsniffer.Packet) sniffEvent {
+	se := sniffEvent{
+		Time:   p.Time,
+		Kind:   p.Kind.String(),
+		Addr:   p.Addr.String(),
+		Bytes:  hex.EncodeToString(p.Data),
+		Packet: p.Packet,
+	}
+
+	if p.Err != nil {
+		se.Error = p.Err.Error()
+	}
+
+	if p.Request != nil {
+		se.RequestType = lifxprotocol.TypeName(p.Request.Packet.Header.ProtocolHeader.Type)
+		se.Latency = p.Latency.String()
+	}
+
+	if p.SourceConflict != nil {
+		se.SourceConflict = p.SourceConflict.String()
+	}
+
+	return se
+}
+
+// sniffLine formats the packet as a line of the timeline.
+func sniffLine(p *lifxsniffer.Packet) string {
+	arrow := "??"
+
+	switch p.Kind {
+	case lifxsniffer.KindRequest:
+		arrow = "->"
+	case lifxsniffer.KindResponse:
+		arrow = "<-"
+	}
+
+	line := fmt.Sprintf("%s  %s  %-21s", p.Time.Format("15:04:05.000"), arrow, p.Addr)
+
+	if p.Packet == nil {
+		return fmt.Sprintf("%s  malformed %d bytes: %s", line, len(p.Data), p.Err)
+	}
+
+	h := p.Packet.Header
+	target := "all"
+
+	if !h.Frame.Tagged && len(h.FrameAddress.Target) > 0 && !isZero(h.FrameAddress.Target) {
+		target = h.FrameAddress.Target.String()
+	}
+
+	line += fmt.Sprintf(
+		"  source 0x%08x  seq %-3d  %-17s  %s (%d)",
+		h.Frame.Source, h.FrameAddress.Sequence, target,
+		lifxprotocol.TypeName(h.ProtocolHeader.Type), h.ProtocolHeader.Type,
+	)
+
+	if h.FrameAddress.AckRequired {
+		line += "  ack"
+	}
+
+	if h.FrameAddress.ResRequired {
+		line += "  res"
+	}
+
+	if p.Request != nil {
+		line += fmt.Sprintf("  reply to %s after %s", lifxprotocol.TypeName(p.Request.Packet.Header.ProtocolHeader.Type), p.Latency)
+	}
+
+	if p.SourceConflict != nil {
+		line += fmt.Sprintf("  source also used by %s", p.SourceConflict)
+	}
+
+	if p.Err != nil {
+		line += fmt.Sprintf("  error: %s", p.Err)
+	}
+
+	return line
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func runSniff(e *env, cfg *sniffConfig) error {
+	if cfg.pairTimeout <= 0 {
+		return usageError("--pair-timeout must be positive")
+	}
+
+	s, err := lifxsniffer.New(&lifxsniffer.Config{Addr: cfg.addr, PairTimeout: cfg.pairTimeout})
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(e.stderr, "lifx sniff: listening on %s\n", s.LocalAddr())
+
+	ctx, cancel := context.WithCancel(e.ctx)
+	defer cancel()
+
+	errs := make(chan error, 1)
+
+	go func() { errs <- s.Run(ctx) }()
+
+	enc := json.NewEncoder(e.stdout)
+	n := 0
+
+	for p := range s.Packets() {
+		if e.opts.json {
+			enc.Encode(newSniffEvent(p))
+		} else {
+			fmt.Fprintln(e.stdout, sniffLine(p))
+		}
+
+		n++
+
+		if cfg.count > 0 && n >= cfg.count {
+			cancel()
+			break
+		}
+	}
+
+	// being interrupted, or reaching the count, isn't a failure
+	if err := <-errs; err != context.Canceled {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/protocol/payloads"
+
+	. "gopkg.in/check.v1"
+)
+
+// startSniff runs the sniff command on a free port of the loopback interface,
+// and returns its address once it's listening. The exit status is sent on the
+// channel when it returns.
+func startSniff(c *C, args ...string) (*net.UDPAddr, *bytes.Buffer, chan int) {
+	// find a free port
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+
+	addr := conn.LocalAddr().(*net.UDPAddr)
+	c.Assert(conn.Close(), IsNil)
+
+	stdout := &bytes.Buffer{}
+	pr, pw := io.Pipe()
+	code := make(chan int, 1)
+
+	args = append([]string{"sniff", "--addr", addr.String()}, args...)
+
+	go func() {
+		code <- run(context.Background(), args, stdout, pw)
+		pw.Close()
+	}()
+
+	line, err := bufio.NewReader(pr).ReadString('\n')
+	c.Assert(err, IsNil)
+	c.Assert(line, Equals, "lifx sniff: listening on "+addr.String()+"\n")
+
+	go io.Copy(ioutil.Discard, pr)
+
+	return addr, stdout, code
+}
+
+func sniffPacket(c *C, source uint32, seq uint8, target net.HardwareAddr, msgType uint16, payload lifxprotocol.PacketComponent, ack bool) []byte {
+	frame := lifxprotocol.NewFrame()
+	frame.Source = source
+	frame.Tagged = len(target) == 0
+
+	p := &lifxprotocol.Packet{
+		Header: &lifxprotocol.Header{
+			Frame:          frame,
+			FrameAddress:   &lifxprotocol.FrameAddress{Target: target, Sequence: seq, AckRequired: ack},
+			ProtocolHeader: &lifxprotocol.ProtocolHeader{Type: msgType},
+		},
+		Payload: payload,
+	}
+
+	data, err := p.MarshalPacket(binary.LittleEndian)
+	c.Assert(err, IsNil)
+
+	return data
+}
+
+func waitExit(c *C, code chan int) int {
+	select {
+	case n := <-code:
+		return n
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for the command to exit")
+	}
+
+	return 0
+}
+
+func (*TestSuite) TestSniff(c *C) {
+	addr, stdout, code := startSniff(c, "--count", "4")
+
+	client, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer client.Close()
+
+	device, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer device.Close()
+
+	mac := net.HardwareAddr{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x01}
+
+	packets := []struct {
+		conn net.PacketConn
+		data []byte
+	}{
+		{client, sniffPacket(c, 0xabcd, 3, nil, lifxprotocol.DeviceGetService, &lifxpayloads.Empty{}, false)},
+		{device, sniffPacket(c, 0xabcd, 3, mac, lifxprotocol.DeviceStateService, &lifxpayloads.DeviceStateService{Service: 1, Port: 56700}, false)},
+		{client, sniffPacket(c, 0xabcd, 4, mac, lifxprotocol.LightSetPower, &lifxpayloads.LightSetPower{Level: 65535}, true)},
+		{client, []byte("hello")},
+	}
+
+	for _, p := range packets {
+		_, err := p.conn.WriteTo(p.data, addr)
+		c.Assert(err, IsNil)
+
+		// keep them in order
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c.Assert(waitExit(c, code), Equals, exitOK)
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	c.Assert(lines, HasLen, 4)
+
+	c.Check(lines[0], Matches, `\d\d:\d\d:\d\d\.\d{3}  ->  127\.0\.0\.1:\d+ +source 0x0000abcd  seq 3    all +DeviceGetService \(2\)`)
+	c.Check(lines[1], Matches, `.*  <-  127\.0\.0\.1:\d+ +source 0x0000abcd  seq 3    d0:73:d5:00:00:01  DeviceStateService \(3\)  reply to DeviceGetService after .*`)
+	c.Check(lines[2], Matches, `.*  ->  .*  seq 4    d0:73:d5:00:00:01  LightSetPower \(117\)  ack`)
+	c.Check(lines[3], Matches, `.*  \?\?  127\.0\.0\.1:\d+ +malformed 5 bytes: .*`)
+}
+
+func (*TestSuite) TestSniff_JSON(c *C) {
+	addr, stdout, code := startSniff(c, "--json", "--count", "1")
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	data := sniffPacket(c, 42, 1, nil, lifxprotocol.LightGet, &lifxpayloads.Empty{}, false)
+
+	_, err = conn.WriteTo(data, addr)
+	c.Assert(err, IsNil)
+
+	c.Assert(waitExit(c, code), Equals, exitOK)
+
+	var se sniffEvent
+	c.Assert(json.Unmarshal(stdout.Bytes(), &se), IsNil)
+	c.Check(se.Kind, Equals, "request")
+	c.Check(se.Addr, Equals, conn.LocalAddr().String())
+	c.Assert(se.Packet, NotNil)
+	c.Check(se.Packet.Header.ProtocolHeader.Type, Equals, lifxprotocol.LightGet)
+	c.Check(se.Packet.Header.Frame.Source, Equals, uint32(42))
+}
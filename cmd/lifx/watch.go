@@ -0,0 +1,153 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/theckman/go-lifx"
+)
+
+func init() {
+	register(&command{
+		name:    "watch",
+		args:    "[selector...]",
+		summary: "poll devices, and print their changes",
+		setup: func(fs *flag.FlagSet) func(*env, []string) error {
+			cfg := &watchConfig{}
+
+			fs.DurationVar(&cfg.interval, "interval", 5*time.Second, "how long to wait between polls")
+			fs.IntVar(&cfg.count, "count", 0, "stop after this many polls; 0 to run until interrupted")
+
+			return func(e *env, args []string) error {
+				return runWatch(e, args, cfg)
+			}
+		},
+	})
+}
+
+type watchConfig struct {
+	interval time.Duration
+	count    int
+}
+
+// watchEvent is a change to a device, as printed by the watch command.
+type watchEvent struct {
+	Time     time.Time `json:"time"`
+	MAC      string    `json:"mac"`
+	Label    string    `json:"label"`
+	Type     string    `json:"type"`
+	Previous string    `json:"previous,omitempty"`
+	Current  string    `json:"current,omitempty"`
+}
+
+func newWatchEvent(ev lifx.Event) watchEvent {
+	we := watchEvent{
+		Time: ev.Time,
+		MAC:  ev.Current.HardwareAddr.String(),
+		Type: ev.Type.String(),
+	}
+
+	if ev.Current.Label != nil {
+		we.Label = *ev.Current.Label
+	}
+
+	prev, cur := ev.Previous, ev.Current
+
+	switch ev.Type {
+	case lifx.EventPowerChanged:
+		we.Previous, we.Current = powerString(*prev.Power), powerString(*cur.Power)
+	case lifx.EventColorChanged:
+		we.Previous, we.Current = colorString(prev.Color), colorString(cur.Color)
+	case lifx.EventLabelChanged:
+		we.Previous, we.Current = *prev.Label, *cur.Label
+	}
+
+	return we
+}
+
+func runWatch(e *env, args []string, cfg *watchConfig) error {
+	if cfg.interval <= 0 {
+		return usageError("--interval must be positive")
+	}
+
+	if len(args) == 0 {
+		args = []string{"all"}
+	}
+
+	client, err := e.client(true)
+
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	sub, err := client.Subscribe()
+
+	if err != nil {
+		return err
+	}
+
+	devices, err := e.resolve(client, args)
+
+	if err != nil {
+		return err
+	}
+
+	printed := make(chan struct{})
+
+	go func() {
+		defer close(printed)
+
+		enc := json.NewEncoder(e.stdout)
+
+		for ev := range sub.C {
+			we := newWatchEvent(ev)
+
+			if e.opts.json {
+				enc.Encode(we)
+				continue
+			}
+
+			line := fmt.Sprintf("%s  %s  %-10q  %s", we.Time.Format("15:04:05.000"), we.MAC, we.Label, we.Type)
+
+			if we.Previous != "" || we.Current != "" {
+				line += fmt.Sprintf("  %s -> %s", we.Previous, we.Current)
+			}
+
+			fmt.Fprintln(e.stdout, line)
+		}
+	}()
+
+	// the events have all been printed once the subscription is closed
+	defer func() {
+		sub.Close()
+		<-printed
+	}()
+
+	for n := 1; ; n++ {
+		// the state cache sends the events; the errors show up as the
+		// devices going offline
+		each(e.ctx, devices, func(ctx context.Context, _ int, device *lifx.Device) error {
+			_, err := client.Light(device.HardwareAddr, device.Addr).State(ctx)
+			return err
+		})
+
+		if cfg.count > 0 && n >= cfg.count {
+			return nil
+		}
+
+		select {
+		case <-e.ctx.Done():
+			return nil
+		case <-time.After(cfg.interval):
+		}
+	}
+}
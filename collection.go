@@ -0,0 +1,270 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol/payloads"
+)
+
+// maxConcurrency is the most requests that are made at once when an operation
+// is fanned out across devices. It's well below the 256 requests a *Client
+// can have in flight, to leave room for other requests.
+const maxConcurrency = 64
+
+// DeviceError is an error from an operation on a single device, as part of an
+// operation on many devices.
+type DeviceError struct {
+	Device *Device
+	Err    error
+}
+
+func (e *DeviceError) Error() string {
+	return fmt.Sprintf("device %s: %s", e.Device.HardwareAddr, e.Err)
+}
+
+// MultiError is the error returned by operations on many devices when one or
+// more of them fails. The errors are sorted by the MAC address of the device.
+type MultiError []*DeviceError
+
+func (me MultiError) Error() string {
+	if len(me) == 1 {
+		return me[0].Error()
+	}
+
+	msgs := make([]string, len(me))
+
+	for i, err := range me {
+		msgs[i] = err.Error()
+	}
+
+	return fmt.Sprintf("%d devices failed: %s", len(me), strings.Join(msgs, "; "))
+}
+
+// forEach calls fn concurrently for each of the devices, and returns a
+// MultiError of the ones that failed. If none of them failed, nil is returned.
+func forEach(ctx context.Context, devices []*Device, fn func(context.Context, *Device) error) error {
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs MultiError
+	)
+
+	sem := make(chan struct{}, maxConcurrency)
+
+	for _, device := range devices {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(device *Device) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := fn(ctx, device); err != nil {
+				mu.Lock()
+				errs = append(errs, &DeviceError{Device: device, Err: err})
+				mu.Unlock()
+			}
+		}(device)
+	}
+
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	sort.Sort(byDeviceError(errs))
+
+	return errs
+}
+
+type byDeviceError MultiError
+
+func (b byDeviceError) Len() int      { return len(b) }
+func (b byDeviceError) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byDeviceError) Less(i, j int) bool {
+	return bytes.Compare(b[i].Device.HardwareAddr, b[j].Device.HardwareAddr) < 0
+}
+
+// Collection is a set of devices that share a group or a location. Each
+// device reports the label of its group and location, along with when the
+// label was last updated; the label of the Collection is the one that was
+// updated most recently, which is what the LIFX app shows.
+type Collection struct {
+	// ID is the unique identifier of the group or location.
+	ID [16]byte
+
+	// Label is the most recently updated label of the group or location.
+	Label string
+
+	// UpdatedAt is when the label was last updated.
+	UpdatedAt time.Time
+
+	// Devices are the devices in the group or location, sorted by their MAC
+	// addresses.
+	Devices []*Device
+}
+
+func (col *Collection) String() string {
+	if col == nil {
+		return "<*lifx.Collection(nil)>"
+	}
+
+	return fmt.Sprintf(
+		"<*lifx.Collection(%p): ID: %x, Label: %q, UpdatedAt: %s, Devices: %d>",
+		col, col.ID, col.Label, col.UpdatedAt, len(col.Devices),
+	)
+}
+
+// Each calls fn concurrently for each device in the collection, and returns a
+// MultiError of the ones that failed. If none of them failed, nil is returned.
+func (col *Collection) Each(ctx context.Context, fn func(context.Context, *Device) error) error {
+	return forEach(ctx, col.Devices, fn)
+}
+
+// SetPower powers all of the devices in the collection on or off. See
+// Device.SetPower for details.
+func (col *Collection) SetPower(ctx context.Context, on bool, duration time.Duration) error {
+	return col.Each(ctx, func(ctx context.Context, device *Device) error {
+		return device.SetPower(ctx, on, duration)
+	})
+}
+
+// SetColor changes the color of all of the lights in the collection, fading
+// to it over the duration.
+func (col *Collection) SetColor(ctx context.Context, hsbk lifxpayloads.LightHSBK, duration time.Duration) error {
+	return col.Each(ctx, func(ctx context.Context, device *Device) error {
+		return (&Light{Device: device}).SetColor(ctx, hsbk, duration)
+	})
+}
+
+// SetWaveform runs the waveform effect on all of the lights in the
+// collection.
+func (col *Collection) SetWaveform(ctx context.Context, waveform *lifxpayloads.LightSetWaveform) error {
+	return col.Each(ctx, func(ctx context.Context, device *Device) error {
+		return (&Light{Device: device}).SetWaveform(ctx, waveform)
+	})
+}
+
+// membership is the group or location a single device reported.
+type membership struct {
+	device    *Device
+	id        [16]byte
+	label     lifxpayloads.DeviceLabel
+	updatedAt uint64
+}
+
+// Groups asks each of the devices which group it's in, and returns the
+// groups sorted by label. The devices are queried concurrently; if some of
+// them fail the groups of the others are returned along with a MultiError.
+func Groups(ctx context.Context, devices []*Device) ([]*Collection, error) {
+	return collect(ctx, devices, func(ctx context.Context, device *Device) (*membership, error) {
+		dsg, err := device.Group(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &membership{device: device, id: dsg.Group, label: dsg.Label, updatedAt: dsg.UpdatedAt}, nil
+	})
+}
+
+// Locations asks each of the devices which location it's in, and returns the
+// locations sorted by label. The devices are queried concurrently; if some of
+// them fail the locations of the others are returned along with a
+// MultiError.
+func Locations(ctx context.Context, devices []*Device) ([]*Collection, error) {
+	return collect(ctx, devices, func(ctx context.Context, device *Device) (*membership, error) {
+		dsl, err := device.Location(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &membership{device: device, id: dsl.Location, label: dsl.Label, updatedAt: dsl.UpdatedAt}, nil
+	})
+}
+
+// collect builds the collections from the membership of each device.
+func collect(ctx context.Context, devices []*Device, get func(context.Context, *Device) (*membership, error)) ([]*Collection, error) {
+	var (
+		mu      sync.Mutex
+		members []*membership
+	)
+
+	err := forEach(ctx, devices, func(ctx context.Context, device *Device) error {
+		m, err := get(ctx, device)
+
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		members = append(members, m)
+		mu.Unlock()
+
+		return nil
+	})
+
+	byID := make(map[[16]byte]*Collection)
+	newest := make(map[[16]byte]*membership)
+
+	for _, m := range members {
+		col, ok := byID[m.id]
+
+		if !ok {
+			col = &Collection{ID: m.id}
+			byID[m.id] = col
+		}
+
+		col.Devices = append(col.Devices, m.device)
+
+		// the most recently updated label wins; ties are broken by the label
+		// itself, so the result doesn't depend on the order of the responses
+		if n, ok := newest[m.id]; !ok || m.updatedAt > n.updatedAt ||
+			(m.updatedAt == n.updatedAt && bytes.Compare(m.label[:], n.label[:]) < 0) {
+			newest[m.id] = m
+		}
+	}
+
+	cols := make([]*Collection, 0, len(byID))
+
+	for id, col := range byID {
+		n := newest[id]
+
+		col.Label = string(bytes.TrimRight(n.label[:], "\x00"))
+		col.UpdatedAt = time.Unix(0, int64(n.updatedAt)).UTC()
+
+		sortDevices(col.Devices)
+
+		cols = append(cols, col)
+	}
+
+	sort.Sort(byLabel(cols))
+
+	return cols, err
+}
+
+type byLabel []*Collection
+
+func (b byLabel) Len() int      { return len(b) }
+func (b byLabel) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byLabel) Less(i, j int) bool {
+	if b[i].Label != b[j].Label {
+		return b[i].Label < b[j].Label
+	}
+
+	return bytes.Compare(b[i].ID[:], b[j].ID[:]) < 0
+}
@@ -0,0 +1,125 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol/payloads"
+
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) TestMultiError(c *C) {
+	d1 := &Device{HardwareAddr: net.HardwareAddr{1, 2, 3, 4, 5, 6}}
+	d2 := &Device{HardwareAddr: net.HardwareAddr{1, 2, 3, 4, 5, 7}}
+
+	me := MultiError{{Device: d1, Err: errors.New("boom")}}
+	c.Check(me.Error(), Equals, "device 01:02:03:04:05:06: boom")
+
+	me = append(me, &DeviceError{Device: d2, Err: ErrTimeout})
+	c.Check(me.Error(), Equals, "2 devices failed: device 01:02:03:04:05:06: boom; device 01:02:03:04:05:07: "+ErrTimeout.Error())
+}
+
+// newFakeGroupDevice returns a fake device with the MAC address ending in n,
+// in the group with the ID, label, and time it was updated.
+func newFakeGroupDevice(c *C, n byte, id byte, label string, updatedAt uint64) *fakeDevice {
+	fd := newFakeDevice(c)
+
+	fd.mu.Lock()
+	fd.mac = net.HardwareAddr{0xd0, 0x73, 0xd5, 0x00, 0x00, n}
+	fd.group = lifxpayloads.DeviceStateGroup{
+		Group:     [16]byte{id},
+		Label:     lifxpayloads.NewDeviceLabelTrunc([]byte(label)),
+		UpdatedAt: updatedAt,
+	}
+	fd.mu.Unlock()
+
+	return fd
+}
+
+func (*TestSuite) TestGroups(c *C) {
+	// the label of group 1 was renamed from Upstairs to Bedrooms, but the
+	// second device hasn't heard about it yet
+	fd1 := newFakeGroupDevice(c, 3, 1, "Bedrooms", 200)
+	defer fd1.close()
+
+	fd2 := newFakeGroupDevice(c, 1, 1, "Upstairs", 100)
+	defer fd2.close()
+
+	fd3 := newFakeGroupDevice(c, 2, 2, "Kitchen", 50)
+	defer fd3.close()
+
+	client := newTestClient(c, &Config{Retries: -1})
+	defer client.Close()
+
+	devices := []*Device{
+		client.Device(fd1.mac, fd1.addr()),
+		client.Device(fd2.mac, fd2.addr()),
+		client.Device(fd3.mac, fd3.addr()),
+	}
+
+	groups, err := Groups(context.Background(), devices)
+	c.Assert(err, IsNil)
+	c.Assert(groups, HasLen, 2)
+
+	c.Check(groups[0].ID, Equals, [16]byte{1})
+	c.Check(groups[0].Label, Equals, "Bedrooms")
+	c.Check(groups[0].UpdatedAt, Equals, time.Unix(0, 200).UTC())
+	c.Assert(groups[0].Devices, HasLen, 2)
+	c.Check(groups[0].Devices[0], Equals, devices[1])
+	c.Check(groups[0].Devices[1], Equals, devices[0])
+
+	c.Check(groups[1].ID, Equals, [16]byte{2})
+	c.Check(groups[1].Label, Equals, "Kitchen")
+	c.Assert(groups[1].Devices, HasLen, 1)
+	c.Check(groups[1].Devices[0], Equals, devices[2])
+
+	locations, err := Locations(context.Background(), devices)
+	c.Assert(err, IsNil)
+	c.Assert(locations, HasLen, 1)
+	c.Check(locations[0].Label, Equals, "Home")
+	c.Check(locations[0].Devices, HasLen, 3)
+
+	//
+	// Test that the operations are fanned out to each device
+	//
+	c.Assert(groups[0].SetPower(context.Background(), true, 0), IsNil)
+
+	red := lifxpayloads.LightHSBK{Saturation: 65535, Brightness: 65535, Kelvin: 3500}
+	c.Assert(groups[0].SetColor(context.Background(), red, time.Second), IsNil)
+
+	for _, fd := range []*fakeDevice{fd1, fd2} {
+		fd.mu.Lock()
+		c.Check(fd.power, Equals, uint16(65535))
+		c.Check(fd.color, Equals, red)
+		fd.mu.Unlock()
+	}
+
+	fd3.mu.Lock()
+	c.Check(fd3.power, Equals, uint16(0))
+	fd3.mu.Unlock()
+
+	//
+	// Test that the devices that respond are returned when some fail
+	//
+	fd3.close()
+
+	groups, err = Groups(context.Background(), devices)
+	c.Assert(groups, HasLen, 1)
+	c.Check(groups[0].Label, Equals, "Bedrooms")
+
+	me, ok := err.(MultiError)
+	c.Assert(ok, Equals, true)
+	c.Assert(me, HasLen, 1)
+	c.Check(me[0].Device, Equals, devices[2])
+	c.Check(me[0].Err, Equals, ErrTimeout)
+
+	err = (&Collection{Devices: devices}).SetPower(context.Background(), false, 0)
+	c.Check(err, ErrorMatches, "device d0:73:d5:00:00:02: "+ErrTimeout.Error())
+}
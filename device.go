@@ -0,0 +1,341 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/protocol/payloads"
+)
+
+// ServiceUDP is the value of the DeviceStateService.Service field for the
+// UDP service, which is the only service this package supports.
+const ServiceUDP uint8 = 1
+
+// ErrEchoMismatch is the error returned by Device.Echo when the payload sent
+// back by the device doesn't match the one that was sent.
+var ErrEchoMismatch = errors.New("the echo response payload did not match the request")
+
+// Device is a LIFX device on the network. It provides the operations that are
+// supported by all LIFX devices.
+type Device struct {
+	// HardwareAddr is the MAC address of the device, which is used as the
+	// target of the messages sent to it.
+	HardwareAddr net.HardwareAddr
+
+	// Addr is the network address of the device.
+	Addr *net.UDPAddr
+
+	client *Client
+}
+
+// Device returns a *Device for the device with the MAC address at the network
+// address.
+func (c *Client) Device(mac net.HardwareAddr, addr *net.UDPAddr) *Device {
+	return &Device{HardwareAddr: mac, Addr: addr, client: c}
+}
+
+// DeviceFromService returns a *Device using the port from the service the
+// device advertised in its DeviceStateService response. An error is returned
+// if the service isn't the UDP service or if it's temporarily unavailable.
+func (c *Client) DeviceFromService(mac net.HardwareAddr, ip net.IP, service *lifxpayloads.DeviceStateService) (*Device, error) {
+	if service == nil {
+		return nil, errors.New("the service cannot be nil")
+	}
+
+	if service.Service != ServiceUDP {
+		return nil, fmt.Errorf("service %d is not supported; only UDP (%d) is supported", service.Service, ServiceUDP)
+	}
+
+	if service.Port == 0 || service.Port > 65535 {
+		return nil, fmt.Errorf("port %d is not valid; the service may be temporarily unavailable", service.Port)
+	}
+
+	return c.Device(mac, &net.UDPAddr{IP: ip, Port: int(service.Port)}), nil
+}
+
+func (d *Device) String() string {
+	if d == nil {
+		return "<*lifx.Device(nil)>"
+	}
+
+	return fmt.Sprintf("<*lifx.Device(%p): HardwareAddr: %s, Addr: %s>", d, d.HardwareAddr, d.Addr)
+}
+
+// Label returns the label (name) of the device.
+func (d *Device) Label(ctx context.Context) (string, error) {
+	pc, err := d.get(ctx, lifxprotocol.DeviceGetLabel, lifxprotocol.DeviceStateLabel)
+
+	if err != nil {
+		return "", err
+	}
+
+	dsl, ok := pc.(*lifxpayloads.DeviceStateLabel)
+
+	if !ok {
+		return "", unexpectedPayload(pc)
+	}
+
+	return string(bytes.TrimRight(dsl.Label[:], "\x00")), nil
+}
+
+// SetLabel sets the label (name) of the device. The label cannot be longer
+// than 32 bytes.
+func (d *Device) SetLabel(ctx context.Context, label string) error {
+	dl, err := lifxpayloads.NewDeviceLabel([]byte(label))
+
+	if err != nil {
+		return err
+	}
+
+	return d.set(ctx, lifxprotocol.DeviceSetLabel, &lifxpayloads.DeviceStateLabel{Label: dl})
+}
+
+// Power returns whether the device is powered on.
+func (d *Device) Power(ctx context.Context) (bool, error) {
+	pc, err := d.get(ctx, lifxprotocol.DeviceGetPower, lifxprotocol.DeviceStatePower)
+
+	if err != nil {
+		return false, err
+	}
+
+	dsp, ok := pc.(*lifxpayloads.DeviceStatePower)
+
+	if !ok {
+		return false, unexpectedPayload(pc)
+	}
+
+	return dsp.Level != 0, nil
+}
+
+// SetPower powers the device on or off. If the duration is not 0 the change
+// is made using the LightSetPower message, which fades the light over the
+// duration; only lights support this.
+func (d *Device) SetPower(ctx context.Context, on bool, duration time.Duration) error {
+	level := powerLevel(on)
+
+	if duration == 0 {
+		return d.set(ctx, lifxprotocol.DeviceSetPower, &lifxpayloads.DeviceStatePower{Level: level})
+	}
+
+	return d.set(ctx, lifxprotocol.LightSetPower, &lifxpayloads.LightSetPower{Level: level, Duration: duration})
+}
+
+// HostInfo returns the signal and traffic information of the host MCU.
+func (d *Device) HostInfo(ctx context.Context) (*lifxpayloads.DeviceStateHostInfo, error) {
+	pc, err := d.get(ctx, lifxprotocol.DeviceGetHostInfo, lifxprotocol.DeviceStateHostInfo)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dshi, ok := pc.(*lifxpayloads.DeviceStateHostInfo)
+
+	if !ok {
+		return nil, unexpectedPayload(pc)
+	}
+
+	return dshi, nil
+}
+
+// HostFirmware returns the firmware information of the host MCU.
+func (d *Device) HostFirmware(ctx context.Context) (*lifxpayloads.DeviceStateHostFirmware, error) {
+	pc, err := d.get(ctx, lifxprotocol.DeviceGetHostFirmware, lifxprotocol.DeviceStateHostFirmware)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dshf, ok := pc.(*lifxpayloads.DeviceStateHostFirmware)
+
+	if !ok {
+		return nil, unexpectedPayload(pc)
+	}
+
+	return dshf, nil
+}
+
+// WifiInfo returns the signal and traffic information of the Wi-Fi subsystem.
+func (d *Device) WifiInfo(ctx context.Context) (*lifxpayloads.DeviceStateWifiInfo, error) {
+	pc, err := d.get(ctx, lifxprotocol.DeviceGetWifiInfo, lifxprotocol.DeviceStateWifiInfo)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dswi, ok := pc.(*lifxpayloads.DeviceStateWifiInfo)
+
+	if !ok {
+		return nil, unexpectedPayload(pc)
+	}
+
+	return dswi, nil
+}
+
+// WifiFirmware returns the firmware information of the Wi-Fi subsystem.
+func (d *Device) WifiFirmware(ctx context.Context) (*lifxpayloads.DeviceStateWifiFirmware, error) {
+	pc, err := d.get(ctx, lifxprotocol.DeviceGetWifiFirmware, lifxprotocol.DeviceStateWifiFirmware)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dswf, ok := pc.(*lifxpayloads.DeviceStateWifiFirmware)
+
+	if !ok {
+		return nil, unexpectedPayload(pc)
+	}
+
+	return dswf, nil
+}
+
+// Version returns the vendor, product and hardware version of the device.
+func (d *Device) Version(ctx context.Context) (*lifxpayloads.DeviceStateVersion, error) {
+	pc, err := d.get(ctx, lifxprotocol.DeviceGetVersion, lifxprotocol.DeviceStateVersion)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dsv, ok := pc.(*lifxpayloads.DeviceStateVersion)
+
+	if !ok {
+		return nil, unexpectedPayload(pc)
+	}
+
+	return dsv, nil
+}
+
+// Info returns the current time, uptime, and last downtime of the device.
+func (d *Device) Info(ctx context.Context) (*lifxpayloads.DeviceStateInfo, error) {
+	pc, err := d.get(ctx, lifxprotocol.DeviceGetInfo, lifxprotocol.DeviceStateInfo)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dsi, ok := pc.(*lifxpayloads.DeviceStateInfo)
+
+	if !ok {
+		return nil, unexpectedPayload(pc)
+	}
+
+	return dsi, nil
+}
+
+// Location returns the location the device belongs to.
+func (d *Device) Location(ctx context.Context) (*lifxpayloads.DeviceStateLocation, error) {
+	pc, err := d.get(ctx, lifxprotocol.DeviceGetLocation, lifxprotocol.DeviceStateLocation)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dsl, ok := pc.(*lifxpayloads.DeviceStateLocation)
+
+	if !ok {
+		return nil, unexpectedPayload(pc)
+	}
+
+	return dsl, nil
+}
+
+// Group returns the group the device belongs to.
+func (d *Device) Group(ctx context.Context) (*lifxpayloads.DeviceStateGroup, error) {
+	pc, err := d.get(ctx, lifxprotocol.DeviceGetGroup, lifxprotocol.DeviceStateGroup)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dsg, ok := pc.(*lifxpayloads.DeviceStateGroup)
+
+	if !ok {
+		return nil, unexpectedPayload(pc)
+	}
+
+	return dsg, nil
+}
+
+// Echo sends the payload to the device, which sends it back. The payload is
+// truncated to 64 bytes. The payload the device sent back is returned, and
+// ErrEchoMismatch is returned along with it if it doesn't match.
+func (d *Device) Echo(ctx context.Context, payload []byte) ([]byte, error) {
+	req := &lifxpayloads.DeviceEcho{Payload: lifxpayloads.NewDeviceEchoPayloadTrunc(payload)}
+
+	pc, err := d.do(ctx, lifxprotocol.DeviceEchoRequest, req, lifxprotocol.DeviceEchoResponse)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res, ok := pc.(*lifxpayloads.DeviceEcho)
+
+	if !ok {
+		return nil, unexpectedPayload(pc)
+	}
+
+	n := len(payload)
+
+	if n > len(res.Payload) {
+		n = len(res.Payload)
+	}
+
+	echoed := make([]byte, n)
+	copy(echoed, res.Payload[:n])
+
+	if res.Payload != req.Payload {
+		return echoed, ErrEchoMismatch
+	}
+
+	return echoed, nil
+}
+
+// get sends the Get* message of msgType, and returns the payload of the State*
+// response of resType.
+func (d *Device) get(ctx context.Context, msgType, resType uint16) (lifxprotocol.PacketComponent, error) {
+	return d.do(ctx, msgType, &lifxpayloads.Empty{}, resType)
+}
+
+// set sends the Set* message of msgType, and waits for it to be acknowledged.
+func (d *Device) set(ctx context.Context, msgType uint16, payload lifxprotocol.PacketComponent) error {
+	_, err := d.do(ctx, msgType, payload, lifxprotocol.DeviceAcknowledgement)
+	return err
+}
+
+// do sends the message, and returns the payload of the response of resType.
+func (d *Device) do(ctx context.Context, msgType uint16, req lifxprotocol.PacketComponent, resType uint16) (lifxprotocol.PacketComponent, error) {
+	if d.client == nil {
+		return nil, errors.New("the device was not created by a *lifx.Client")
+	}
+
+	packet, err := d.client.request(ctx, d.Addr, d.HardwareAddr, msgType, req, resType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return packet.Payload, nil
+}
+
+// unexpectedPayload returns the error for a response with the wrong payload
+// type, which should only happen if a device misbehaves.
+func unexpectedPayload(pc lifxprotocol.PacketComponent) error {
+	return fmt.Errorf("unexpected response payload type %T", pc)
+}
+
+func powerLevel(on bool) uint16 {
+	if on {
+		return 65535
+	}
+
+	return 0
+}
@@ -0,0 +1,181 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/protocol/payloads"
+
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) TestClient_DeviceFromService(c *C) {
+	client := newTestClient(c, nil)
+	defer client.Close()
+
+	mac := net.HardwareAddr{1, 2, 3, 4, 5, 6}
+	ip := net.IPv4(10, 0, 0, 1)
+
+	device, err := client.DeviceFromService(mac, ip, &lifxpayloads.DeviceStateService{Service: ServiceUDP, Port: 56700})
+	c.Assert(err, IsNil)
+	c.Check(device.HardwareAddr.String(), Equals, mac.String())
+	c.Check(device.Addr.String(), Equals, "10.0.0.1:56700")
+
+	_, err = client.DeviceFromService(mac, ip, &lifxpayloads.DeviceStateService{Service: 5, Port: 56700})
+	c.Check(err, ErrorMatches, `service 5 is not supported; only UDP \(1\) is supported`)
+
+	_, err = client.DeviceFromService(mac, ip, &lifxpayloads.DeviceStateService{Service: ServiceUDP})
+	c.Check(err, ErrorMatches, "port 0 is not valid; the service may be temporarily unavailable")
+
+	_, err = client.DeviceFromService(mac, ip, nil)
+	c.Check(err, NotNil)
+}
+
+func (*TestSuite) TestDevice_String(c *C) {
+	device := &Device{HardwareAddr: net.HardwareAddr{1, 2, 3, 4, 5, 6}, Addr: &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 56700}}
+	c.Check(device.String(), Equals, fmt.Sprintf("<*lifx.Device(%p): HardwareAddr: 01:02:03:04:05:06, Addr: 10.0.0.1:56700>", device))
+
+	device = nil
+	c.Check(device.String(), Equals, "<*lifx.Device(nil)>")
+}
+
+func (*TestSuite) TestDevice_Label(c *C) {
+	fd := newFakeDevice(c)
+	defer fd.close()
+
+	client := newTestClient(c, nil)
+	defer client.Close()
+
+	device := client.Device(fd.mac, fd.addr())
+	ctx := context.Background()
+
+	label, err := device.Label(ctx)
+	c.Assert(err, IsNil)
+	c.Check(label, Equals, "Kitchen")
+
+	c.Assert(device.SetLabel(ctx, "Living Room"), IsNil)
+
+	label, err = device.Label(ctx)
+	c.Assert(err, IsNil)
+	c.Check(label, Equals, "Living Room")
+
+	c.Check(device.SetLabel(ctx, "this label is far too long to fit in 32 bytes"), NotNil)
+}
+
+func (*TestSuite) TestDevice_Power(c *C) {
+	fd := newFakeDevice(c)
+	defer fd.close()
+
+	client := newTestClient(c, nil)
+	defer client.Close()
+
+	device := client.Device(fd.mac, fd.addr())
+	ctx := context.Background()
+
+	on, err := device.Power(ctx)
+	c.Assert(err, IsNil)
+	c.Check(on, Equals, false)
+
+	c.Assert(device.SetPower(ctx, true, 0), IsNil)
+
+	on, err = device.Power(ctx)
+	c.Assert(err, IsNil)
+	c.Check(on, Equals, true)
+
+	// a duration should use the LightSetPower message
+	c.Assert(device.SetPower(ctx, false, 2*time.Second), IsNil)
+
+	on, err = device.Power(ctx)
+	c.Assert(err, IsNil)
+	c.Check(on, Equals, false)
+
+	packets := fd.packets()
+	c.Assert(packets, HasLen, 5)
+	c.Check(packets[1].Header.ProtocolHeader.Type, Equals, lifxprotocol.DeviceSetPower)
+	c.Check(packets[3].Header.ProtocolHeader.Type, Equals, lifxprotocol.LightSetPower)
+	c.Check(packets[3].Payload.(*lifxpayloads.LightSetPower).Duration, Equals, 2*time.Second)
+}
+
+func (*TestSuite) TestDevice_Getters(c *C) {
+	fd := newFakeDevice(c)
+	defer fd.close()
+
+	client := newTestClient(c, nil)
+	defer client.Close()
+
+	device := client.Device(fd.mac, fd.addr())
+	ctx := context.Background()
+
+	hostInfo, err := device.HostInfo(ctx)
+	c.Assert(err, IsNil)
+	c.Check(*hostInfo, Equals, lifxpayloads.DeviceStateHostInfo{Signal: 1e-5, Tx: 1, Rx: 2})
+
+	hostFirmware, err := device.HostFirmware(ctx)
+	c.Assert(err, IsNil)
+	c.Check(*hostFirmware, Equals, lifxpayloads.DeviceStateHostFirmware{Build: 1, Version: 2})
+
+	wifiInfo, err := device.WifiInfo(ctx)
+	c.Assert(err, IsNil)
+	c.Check(*wifiInfo, Equals, lifxpayloads.DeviceStateWifiInfo{Signal: 1e-6, Tx: 3, Rx: 4})
+
+	wifiFirmware, err := device.WifiFirmware(ctx)
+	c.Assert(err, IsNil)
+	c.Check(*wifiFirmware, Equals, lifxpayloads.DeviceStateWifiFirmware{Build: 3, Version: 4})
+
+	version, err := device.Version(ctx)
+	c.Assert(err, IsNil)
+	c.Check(*version, Equals, lifxpayloads.DeviceStateVersion{Vendor: 1, Product: 22})
+
+	info, err := device.Info(ctx)
+	c.Assert(err, IsNil)
+	c.Check(*info, Equals, lifxpayloads.DeviceStateInfo{Time: 1, Uptime: 2, Downtime: 3})
+
+	location, err := device.Location(ctx)
+	c.Assert(err, IsNil)
+	c.Check(location.Location, Equals, [16]byte{1})
+	c.Check(location.Label, Equals, lifxpayloads.NewDeviceLabelTrunc([]byte("Home")))
+
+	group, err := device.Group(ctx)
+	c.Assert(err, IsNil)
+	c.Check(group.Group, Equals, [16]byte{2})
+	c.Check(group.Label, Equals, lifxpayloads.NewDeviceLabelTrunc([]byte("Downstairs")))
+}
+
+func (*TestSuite) TestDevice_Echo(c *C) {
+	fd := newFakeDevice(c)
+	defer fd.close()
+
+	client := newTestClient(c, nil)
+	defer client.Close()
+
+	device := client.Device(fd.mac, fd.addr())
+	ctx := context.Background()
+
+	echoed, err := device.Echo(ctx, []byte("hello"))
+	c.Assert(err, IsNil)
+	c.Check(string(echoed), Equals, "hello")
+
+	fd.mu.Lock()
+	fd.echo = func(lifxpayloads.DeviceEchoPayload) lifxpayloads.DeviceEchoPayload {
+		return lifxpayloads.NewDeviceEchoPayloadTrunc([]byte("jello"))
+	}
+	fd.mu.Unlock()
+
+	echoed, err = device.Echo(ctx, []byte("hello"))
+	c.Check(err, Equals, ErrEchoMismatch)
+	c.Check(string(echoed), Equals, "jello")
+}
+
+func (*TestSuite) TestDevice_NoClient(c *C) {
+	device := &Device{}
+
+	_, err := device.Label(context.Background())
+	c.Check(err, ErrorMatches, "the device was not created by a \\*lifx.Client")
+}
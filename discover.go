@@ -0,0 +1,88 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/protocol/payloads"
+)
+
+// Discover finds the devices on the network by broadcasting a
+// DeviceGetService message, and returns them sorted by MAC address. The
+// message is broadcast once for each attempt (1 + the configured retries),
+// and Discover waits for the client's timeout after each one, so the
+// responses from all of the devices can be collected.
+//
+// If the context is done before all of the attempts have been made the
+// devices found so far are returned, along with the context's error.
+func (c *Client) Discover(ctx context.Context) ([]*Device, error) {
+	var mu sync.Mutex
+
+	found := make(map[string]*Device)
+
+	err := c.broadcast(ctx, lifxprotocol.DeviceGetService, &lifxpayloads.Empty{}, lifxprotocol.DeviceStateService, func(packet *lifxprotocol.Packet, addr net.Addr) {
+		udpAddr, ok := addr.(*net.UDPAddr)
+
+		if !ok {
+			return
+		}
+
+		service, ok := packet.Payload.(*lifxpayloads.DeviceStateService)
+
+		if !ok {
+			return
+		}
+
+		mac := append(net.HardwareAddr(nil), packet.Header.FrameAddress.Target...)
+
+		// devices send a response for each of their services, and we only
+		// support the UDP one
+		device, err := c.DeviceFromService(mac, udpAddr.IP, service)
+
+		if err != nil {
+			return
+		}
+
+		mu.Lock()
+		found[mac.String()] = device
+		mu.Unlock()
+	})
+
+	if err != nil && err != ctx.Err() {
+		return nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	devices := make([]*Device, 0, len(found))
+
+	for _, device := range found {
+		devices = append(devices, device)
+	}
+
+	sortDevices(devices)
+
+	return devices, err
+}
+
+// sortDevices sorts the devices by their MAC addresses.
+func sortDevices(devices []*Device) {
+	sort.Sort(byHardwareAddr(devices))
+}
+
+type byHardwareAddr []*Device
+
+func (b byHardwareAddr) Len() int      { return len(b) }
+func (b byHardwareAddr) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byHardwareAddr) Less(i, j int) bool {
+	return bytes.Compare(b[i].HardwareAddr, b[j].HardwareAddr) < 0
+}
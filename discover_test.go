@@ -0,0 +1,57 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"context"
+
+	"github.com/theckman/go-lifx/protocol"
+
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) TestClient_Discover(c *C) {
+	fd := newFakeDevice(c)
+	defer fd.close()
+
+	client := newTestClient(c, &Config{Broadcast: fd.addr(), Retries: 2})
+	defer client.Close()
+
+	devices, err := client.Discover(context.Background())
+	c.Assert(err, IsNil)
+
+	// the device answers each of the broadcasts, but is only returned once
+	c.Assert(devices, HasLen, 1)
+	c.Check(devices[0].HardwareAddr.String(), Equals, fd.mac.String())
+	c.Check(devices[0].Addr.String(), Equals, fd.addr().String())
+
+	packets := fd.packets()
+	c.Assert(packets, HasLen, 3)
+
+	for _, packet := range packets {
+		c.Check(packet.Header.Frame.Tagged, Equals, true)
+		c.Check(packet.Header.ProtocolHeader.Type, Equals, lifxprotocol.DeviceGetService)
+	}
+
+	// the device should be usable
+	label, err := devices[0].Label(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(label, Equals, "Kitchen")
+
+	//
+	// Test that a cancelled context stops the discovery
+	//
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	devices, err = client.Discover(ctx)
+	c.Check(err, Equals, context.Canceled)
+	c.Check(devices, HasLen, 0)
+
+	client.Close()
+
+	_, err = client.Discover(context.Background())
+	c.Check(err, Equals, ErrClientClosed)
+}
@@ -0,0 +1,158 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxeffects
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/theckman/go-lifx/anim"
+	"github.com/theckman/go-lifx/protocol/payloads"
+)
+
+const (
+	// candleStep is the time between the keyframes of a candle, and
+	// candleSteps is the number of them before the flicker repeats.
+	candleStep  = 50 * time.Millisecond
+	candleSteps = 1024
+
+	// candleScale is the number of keyframes between the points of the
+	// slower octave of noise. The faster octave has points twice as often.
+	candleScale = 4
+)
+
+// DefaultFlicker is the percentage a Candle's brightness flickers by if its
+// Flicker isn't set.
+const DefaultFlicker = 30
+
+var errFlicker = errors.New("the flicker must be between 0% and 100%")
+
+// Candle flickers the brightness of the light like a candle flame, using
+// Perlin noise so the flicker wanders rather than jumping around. It's
+// streamed to the lights. The flicker repeats after about 50 seconds.
+type Candle struct {
+	// Color is the color of the flame at its brightest. If nil, the light's
+	// own color is used.
+	Color *lifxpayloads.LightHSBK
+
+	// Flicker is the percentage (0-100) of the brightness the flame can
+	// dim by. If 0, DefaultFlicker is used.
+	Flicker float64
+
+	// Length is how long the candle burns for. If 0, it burns until the
+	// effect is cancelled.
+	Length time.Duration
+
+	// Seed seeds the noise. The lights flicker in unison if it's set; if 0,
+	// each light flickers differently.
+	Seed int64
+}
+
+// Validate returns an error if the effect can't be played.
+func (cd *Candle) Validate() error {
+	if cd.Color != nil {
+		if err := validateColor(cd.Color); err != nil {
+			return err
+		}
+	}
+
+	if !(cd.Flicker >= 0 && cd.Flicker <= 100) {
+		return errFlicker
+	}
+
+	if cd.Length < 0 {
+		return errDuration
+	}
+
+	return nil
+}
+
+// Duration returns how long the effect plays for, or 0 if it goes on until
+// it's cancelled.
+func (cd *Candle) Duration() time.Duration {
+	return cd.Length
+}
+
+// Waveform returns nil, as the effect can't be played by the lights.
+func (cd *Candle) Waveform(from lifxpayloads.LightHSBK) *lifxpayloads.LightSetWaveform {
+	return nil
+}
+
+// Animation returns the flicker of the flame, starting from the color if the
+// candle's color isn't set.
+func (cd *Candle) Animation(from lifxpayloads.LightHSBK) *lifxanim.Animation {
+	color := from
+
+	if cd.Color != nil {
+		color = *cd.Color
+	}
+
+	flicker := cd.Flicker
+
+	if flicker == 0 {
+		flicker = DefaultFlicker
+	}
+
+	rng := newRand(cd.Seed)
+	slow := newNoise(rng, candleSteps/candleScale)
+	fast := newNoise(rng, 2*candleSteps/candleScale)
+
+	a := &lifxanim.Animation{Loop: true}
+
+	for i := 0; i <= candleSteps; i++ {
+		x := float64(i) / candleScale
+
+		// each octave is between -0.5 and 0.5, so the sum of them with the
+		// faster one at half the amplitude is between -0.75 and 0.75. They're
+		// offset so they're never both 0 at once.
+		dim := (slow.at(x+0.5)+fast.at(2*x+0.5)/2)/1.5 + 0.5
+
+		c := color
+		c.Brightness = uint16(math.Floor(float64(color.Brightness)*(1-flicker/100*dim) + 0.5))
+
+		a.Keyframes = append(a.Keyframes, lifxanim.Keyframe{At: candleStep * time.Duration(i), Color: c})
+	}
+
+	return a
+}
+
+// noise is one-dimensional Perlin noise that repeats after as many points as
+// it has gradients, so an animation of it can loop smoothly.
+type noise []float64
+
+func newNoise(rng *rand.Rand, points int) noise {
+	n := make(noise, points)
+
+	for i := range n {
+		n[i] = rng.Float64()*2 - 1
+	}
+
+	return n
+}
+
+// at returns the noise at the position, which is between -0.5 and 0.5. The
+// noise is 0 at each whole number.
+func (n noise) at(x float64) float64 {
+	i := math.Floor(x)
+	f := x - i
+
+	g0 := n[mod(int(i), len(n))]
+	g1 := n[mod(int(i)+1, len(n))]
+
+	// the quintic fade curve of improved Perlin noise
+	u := f * f * f * (f*(f*6-15) + 10)
+
+	return g0*f + (g1*(f-1)-g0*f)*u
+}
+
+func mod(a, b int) int {
+	if m := a % b; m >= 0 {
+		return m
+	}
+
+	return a%b + b
+}
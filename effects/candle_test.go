@@ -0,0 +1,76 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxeffects
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol/payloads"
+
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) TestCandle(c *C) {
+	flame := lifxpayloads.LightHSBK{Hue: 5461, Saturation: 32768, Brightness: 40000, Kelvin: 2000}
+	cd := &Candle{Color: &flame, Flicker: 50, Seed: 7}
+
+	c.Assert(cd.Validate(), IsNil)
+	c.Check(cd.Duration(), Equals, time.Duration(0))
+	c.Check(cd.Waveform(white), IsNil)
+
+	a := cd.Animation(white)
+	c.Assert(a.Validate(), IsNil)
+	c.Check(a.Loop, Equals, true)
+	c.Check(a.Duration(), Equals, candleSteps*candleStep)
+	c.Check(a.ColorAt(0), Equals, a.ColorAt(a.Duration()))
+
+	// the same seed gives the same flicker
+	c.Check(cd.Animation(white), DeepEquals, a)
+
+	min, max := flame.Brightness, uint16(0)
+
+	for _, kf := range a.Keyframes {
+		color := kf.Color
+
+		c.Check(color.Hue, Equals, flame.Hue)
+		c.Check(color.Kelvin, Equals, flame.Kelvin)
+		c.Assert(color.Brightness <= flame.Brightness && color.Brightness >= flame.Brightness/2, Equals, true)
+
+		if color.Brightness < min {
+			min = color.Brightness
+		}
+
+		if color.Brightness > max {
+			max = color.Brightness
+		}
+	}
+
+	// it actually flickers
+	c.Check(max-min > flame.Brightness/10, Equals, true, Commentf("between %d and %d", min, max))
+
+	// without a color, the light's own color flickers
+	cd.Color = nil
+	c.Check(cd.Animation(red).ColorAt(0).Hue, Equals, red.Hue)
+}
+
+func (*TestSuite) Test_noise(c *C) {
+	n := newNoise(rand.New(rand.NewSource(1)), 8)
+
+	for x := -16.0; x <= 16; x += 0.125 {
+		v := n.at(x)
+
+		c.Assert(v >= -0.5 && v <= 0.5, Equals, true, Commentf("%g: %g", x, v))
+		c.Check(n.at(x+8), Equals, v)
+	}
+
+	c.Check(n.at(3), Equals, 0.0)
+
+	// the noise is smooth between the points
+	for x := 0.0; x < 8; x += 0.01 {
+		d := n.at(x+0.01) - n.at(x)
+		c.Check(d < 0.05 && d > -0.05, Equals, true, Commentf("%g", x))
+	}
+}
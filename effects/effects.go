@@ -0,0 +1,450 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxeffects
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/theckman/go-lifx/anim"
+	"github.com/theckman/go-lifx/protocol/payloads"
+)
+
+// sineSamples is the number of keyframes each cycle of a sine wave is
+// streamed as.
+const sineSamples = 16
+
+// paletteSteps is the number of colors picked for one loop of a
+// RandomPalette.
+const paletteSteps = 64
+
+var (
+	errNoColor      = errors.New("the color must be set")
+	errPeriod       = fmt.Errorf("the period must be between 1ms and %s", lifxpayloads.MaxDuration)
+	errCycles       = errors.New("the number of cycles must be 0 or more")
+	errDuration     = errors.New("the duration can't be negative")
+	errTooLong      = errors.New("the effect is too long")
+	errDuty         = errors.New("the duty cycle must be between 0% and 100%")
+	errSaturation   = errors.New("the saturation must be between 0% and 100%")
+	errRate         = errors.New("the rate must be between 0 and 1000 flashes a second")
+	errNoColors     = errors.New("the palette has no colors")
+	errPaletteTimes = errors.New("the hold and fade times can't be negative, or both 0")
+)
+
+// Breathe fades the light smoothly to a color and back again, like it's
+// breathing. It's played by the lights with the sine waveform.
+type Breathe struct {
+	// Color is the color the light breathes to, from its own color.
+	Color *lifxpayloads.LightHSBK
+
+	// Period is the length of one breath.
+	Period time.Duration
+
+	// Cycles is the number of breaths, which can be fractional. If 0, the
+	// light breathes until the effect is cancelled.
+	Cycles float64
+}
+
+// Validate returns an error if the effect can't be played.
+func (b *Breathe) Validate() error {
+	return validateWave(b.Color, b.Period, b.Cycles)
+}
+
+// Duration returns how long the effect plays for, or 0 if it goes on until
+// it's cancelled.
+func (b *Breathe) Duration() time.Duration {
+	return time.Duration(float64(b.Period) * b.Cycles)
+}
+
+// Waveform returns the sine waveform from the color to the breathe color.
+func (b *Breathe) Waveform(from lifxpayloads.LightHSBK) *lifxpayloads.LightSetWaveform {
+	return waveform(*b.Color, b.Period, lifxpayloads.WaveformSine, 0)
+}
+
+// Animation returns one breath from the color to the breathe color.
+func (b *Breathe) Animation(from lifxpayloads.LightHSBK) *lifxanim.Animation {
+	points := make([][2]float64, sineSamples+1)
+
+	for i := range points {
+		t := float64(i) / sineSamples
+		points[i] = [2]float64{t, (1 - math.Cos(2*math.Pi*t)) / 2}
+	}
+
+	return waveAnimation(from, *b.Color, b.Period, points)
+}
+
+// Pulse switches the light between its own color and another one. It's
+// played by the lights with the pulse waveform.
+type Pulse struct {
+	// Color is the color the light switches to.
+	Color *lifxpayloads.LightHSBK
+
+	// Period is the length of one pulse.
+	Period time.Duration
+
+	// Cycles is the number of pulses, which can be fractional. If 0, the
+	// light pulses until the effect is cancelled.
+	Cycles float64
+
+	// Duty is the percentage (0-100) of each period the light spends at
+	// the color, at the end of the period. If 0, 50% is used.
+	Duty float64
+}
+
+// Validate returns an error if the effect can't be played.
+func (p *Pulse) Validate() error {
+	if err := validateWave(p.Color, p.Period, p.Cycles); err != nil {
+		return err
+	}
+
+	return validateDuty(p.Duty)
+}
+
+// Duration returns how long the effect plays for, or 0 if it goes on until
+// it's cancelled.
+func (p *Pulse) Duration() time.Duration {
+	return time.Duration(float64(p.Period) * p.Cycles)
+}
+
+// Waveform returns the pulse waveform from the color to the pulse color.
+func (p *Pulse) Waveform(from lifxpayloads.LightHSBK) *lifxpayloads.LightSetWaveform {
+	return waveform(*p.Color, p.Period, lifxpayloads.WaveformPulse, p.Duty)
+}
+
+// Animation returns one pulse from the color to the pulse color.
+func (p *Pulse) Animation(from lifxpayloads.LightHSBK) *lifxanim.Animation {
+	return waveAnimation(from, *p.Color, p.Period, pulsePoints(p.Duty))
+}
+
+// Strobe flashes the light on and off, at its own color. It's played by the
+// lights with the pulse waveform. The lights that it's streamed to are sent
+// no more than lifxanim.DefaultMaxRate colors a second by default, so they
+// can only strobe at half of that rate.
+type Strobe struct {
+	// Rate is the number of flashes a second.
+	Rate float64
+
+	// Length is how long the light strobes for. If 0, it strobes until the
+	// effect is cancelled.
+	Length time.Duration
+}
+
+// Validate returns an error if the effect can't be played.
+func (s *Strobe) Validate() error {
+	if !(s.Rate > 0) || s.Rate > 1000 {
+		return errRate
+	}
+
+	if s.Length < 0 {
+		return errDuration
+	}
+
+	return nil
+}
+
+// Duration returns how long the effect plays for, or 0 if it goes on until
+// it's cancelled.
+func (s *Strobe) Duration() time.Duration {
+	return s.Length
+}
+
+// Waveform returns the pulse waveform from the color to darkness.
+func (s *Strobe) Waveform(from lifxpayloads.LightHSBK) *lifxpayloads.LightSetWaveform {
+	return waveform(dark(from), s.period(), lifxpayloads.WaveformPulse, 0)
+}
+
+// Animation returns one flash of the color.
+func (s *Strobe) Animation(from lifxpayloads.LightHSBK) *lifxanim.Animation {
+	return waveAnimation(from, dark(from), s.period(), pulsePoints(0))
+}
+
+func (s *Strobe) period() time.Duration {
+	return time.Duration(float64(time.Second) / s.Rate)
+}
+
+// ColorCycle takes the light around the color wheel, starting from its own
+// hue. It's streamed to the lights, as the waveforms take the shortest path
+// between two hues.
+type ColorCycle struct {
+	// Period is how long it takes to go around the color wheel once.
+	Period time.Duration
+
+	// Cycles is the number of times around the color wheel, which can be
+	// fractional. If 0, the light cycles until the effect is cancelled.
+	Cycles float64
+
+	// Saturation is the saturation of the colors, as a percentage (0-100).
+	// The light keeps its own brightness and Kelvin value. If 0, 100% is
+	// used.
+	Saturation float64
+}
+
+// Validate returns an error if the effect can't be played.
+func (cc *ColorCycle) Validate() error {
+	if err := validatePeriod(cc.Period, cc.Cycles); err != nil {
+		return err
+	}
+
+	if !(cc.Saturation >= 0 && cc.Saturation <= 100) {
+		return errSaturation
+	}
+
+	return nil
+}
+
+// Duration returns how long the effect plays for, or 0 if it goes on until
+// it's cancelled.
+func (cc *ColorCycle) Duration() time.Duration {
+	return time.Duration(float64(cc.Period) * cc.Cycles)
+}
+
+// Waveform returns nil, as the effect can't be played by the lights.
+func (cc *ColorCycle) Waveform(from lifxpayloads.LightHSBK) *lifxpayloads.LightSetWaveform {
+	return nil
+}
+
+// Animation returns one trip around the color wheel, from the hue of the
+// color.
+func (cc *ColorCycle) Animation(from lifxpayloads.LightHSBK) *lifxanim.Animation {
+	saturation := cc.Saturation
+
+	if saturation == 0 {
+		saturation = 100
+	}
+
+	color := from
+	color.Saturation = uint16(math.Floor(saturation/100*65535 + 0.5))
+
+	// the keyframes are a sixth of the way around the color wheel apart, so
+	// the interpolation between them goes the right way around
+	a := &lifxanim.Animation{Loop: true}
+
+	for i := 0; i <= 6; i++ {
+		a.Keyframes = append(a.Keyframes, lifxanim.Keyframe{At: cc.Period * time.Duration(i) / 6, Color: color})
+		color.Hue += 65536 / 6
+	}
+
+	a.Keyframes[6].Color.Hue = a.Keyframes[0].Color.Hue
+
+	return a
+}
+
+// RandomPalette moves the light between colors picked at random from a
+// palette, holding each of them for a while. It's streamed to the lights.
+type RandomPalette struct {
+	// Colors are the colors of the palette, like the ones returned by
+	// lifxpayloads.NewHSBK or lifxpayloads.ParseColor.
+	Colors []*lifxpayloads.LightHSBK
+
+	// Hold is how long the light stays at each color, and Fade is how long
+	// it takes to fade to the next one.
+	Hold time.Duration
+	Fade time.Duration
+
+	// Length is how long the light moves between the colors. If 0, it
+	// does so until the effect is cancelled.
+	Length time.Duration
+
+	// Seed seeds the random number generator that picks the colors. The
+	// lights are given the same colors if it's set; if 0, each light is
+	// given different colors.
+	Seed int64
+}
+
+// Validate returns an error if the effect can't be played.
+func (rp *RandomPalette) Validate() error {
+	if len(rp.Colors) == 0 {
+		return errNoColors
+	}
+
+	for i, color := range rp.Colors {
+		if err := validateColor(color); err != nil {
+			return fmt.Errorf("color %d: %s", i+1, err)
+		}
+	}
+
+	if rp.Hold < 0 || rp.Fade < 0 || rp.Hold+rp.Fade <= 0 {
+		return errPaletteTimes
+	}
+
+	if rp.Hold+rp.Fade > math.MaxInt64/paletteSteps {
+		return errTooLong
+	}
+
+	if rp.Length < 0 {
+		return errDuration
+	}
+
+	return nil
+}
+
+// Duration returns how long the effect plays for, or 0 if it goes on until
+// it's cancelled.
+func (rp *RandomPalette) Duration() time.Duration {
+	return rp.Length
+}
+
+// Waveform returns nil, as the effect can't be played by the lights.
+func (rp *RandomPalette) Waveform(from lifxpayloads.LightHSBK) *lifxpayloads.LightSetWaveform {
+	return nil
+}
+
+// Animation returns a loop through colors picked from the palette. The color
+// the light starts at isn't used.
+func (rp *RandomPalette) Animation(from lifxpayloads.LightHSBK) *lifxanim.Animation {
+	rng := newRand(rp.Seed)
+
+	// the same color is never picked twice in a row, including across the
+	// end of the loop, unless there's only one
+	picks := make([]int, paletteSteps)
+
+	for i := range picks {
+		for {
+			picks[i] = rng.Intn(len(rp.Colors))
+
+			if len(rp.Colors) == 1 || i == 0 || (picks[i] != picks[i-1] && (i < paletteSteps-1 || picks[i] != picks[0])) {
+				break
+			}
+		}
+	}
+
+	a := &lifxanim.Animation{Loop: true}
+	step := rp.Hold + rp.Fade
+
+	for i, pick := range picks {
+		at := step * time.Duration(i)
+
+		a.Keyframes = append(a.Keyframes,
+			lifxanim.Keyframe{At: at, Color: *rp.Colors[pick]},
+			lifxanim.Keyframe{At: at + rp.Hold, Color: *rp.Colors[pick]},
+		)
+	}
+
+	a.Keyframes = append(a.Keyframes, lifxanim.Keyframe{At: step * paletteSteps, Color: *rp.Colors[picks[0]]})
+
+	return a
+}
+
+// newRand returns a random number generator with the seed, or with one based
+// on the current time if it's 0.
+func newRand(seed int64) *rand.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	return rand.New(rand.NewSource(seed))
+}
+
+func validateColor(color *lifxpayloads.LightHSBK) error {
+	if color == nil {
+		return errNoColor
+	}
+
+	if color.Kelvin < lifxpayloads.MinKelvin || color.Kelvin > lifxpayloads.MaxKelvin {
+		return lifxpayloads.ErrKelvinRange
+	}
+
+	return nil
+}
+
+func validatePeriod(period time.Duration, cycles float64) error {
+	if period < time.Millisecond || period > lifxpayloads.MaxDuration {
+		return errPeriod
+	}
+
+	if !(cycles >= 0) || math.IsInf(cycles, 0) {
+		return errCycles
+	}
+
+	if float64(period)*cycles > math.MaxInt64 {
+		return errTooLong
+	}
+
+	return nil
+}
+
+func validateWave(color *lifxpayloads.LightHSBK, period time.Duration, cycles float64) error {
+	if err := validateColor(color); err != nil {
+		return err
+	}
+
+	return validatePeriod(period, cycles)
+}
+
+func validateDuty(duty float64) error {
+	if !(duty >= 0 && duty <= 100) {
+		return errDuty
+	}
+
+	return nil
+}
+
+// dark returns the color with no brightness.
+func dark(color lifxpayloads.LightHSBK) lifxpayloads.LightHSBK {
+	color.Brightness = 0
+	return color
+}
+
+// waveform returns a transient waveform to the color. The duty cycle is only
+// used by the pulse waveform.
+func waveform(color lifxpayloads.LightHSBK, period time.Duration, shape lifxpayloads.Waveform, duty float64) *lifxpayloads.LightSetWaveform {
+	wf := &lifxpayloads.LightSetWaveform{
+		Transient: true,
+		Color:     &color,
+		Period:    period,
+		Waveform:  shape,
+	}
+
+	if shape == lifxpayloads.WaveformPulse {
+		wf.SkewRatio = skewRatio(duty)
+	}
+
+	return wf
+}
+
+// skewRatio returns the SkewRatio of a pulse waveform that spends the duty
+// cycle, as a percentage, at the waveform color. If the duty cycle is 0, 50%
+// is used.
+func skewRatio(duty float64) int16 {
+	if duty == 0 {
+		duty = 50
+	}
+
+	// the skew ratio is the part of the period spent at the original color
+	skew := math.Floor((1-duty/100)*65535 - 32768 + 0.5)
+
+	return int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, skew)))
+}
+
+// pulsePoints returns the points of a pulse waveform with the duty cycle,
+// for waveAnimation.
+func pulsePoints(duty float64) [][2]float64 {
+	if duty == 0 {
+		duty = 50
+	}
+
+	switchAt := 1 - duty/100
+
+	return [][2]float64{{0, 0}, {switchAt, 0}, {switchAt, 1}, {1, 1}}
+}
+
+// waveAnimation returns one cycle of a waveform between two colors, as an
+// animation that loops. Each of the points is a position in the cycle (0-1),
+// and how far from the first color to the second the light is there (0-1).
+func waveAnimation(from, to lifxpayloads.LightHSBK, period time.Duration, points [][2]float64) *lifxanim.Animation {
+	a := &lifxanim.Animation{Loop: true}
+
+	for _, p := range points {
+		a.Keyframes = append(a.Keyframes, lifxanim.Keyframe{
+			At:    time.Duration(p[0] * float64(period)),
+			Color: *lifxpayloads.Interpolate(&from, &to, p[1], lifxpayloads.ColorSpaceHSB),
+		})
+	}
+
+	return a
+}
@@ -0,0 +1,237 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxeffects
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol/payloads"
+
+	. "gopkg.in/check.v1"
+)
+
+type TestSuite struct{}
+
+var _ = Suite(&TestSuite{})
+
+func Test(t *testing.T) { TestingT(t) }
+
+var (
+	white = lifxpayloads.LightHSBK{Hue: 0, Saturation: 0, Brightness: 65535, Kelvin: 3500}
+	blue  = lifxpayloads.LightHSBK{Hue: 43691, Saturation: 65535, Brightness: 13107, Kelvin: 3500}
+	red   = lifxpayloads.LightHSBK{Hue: 0, Saturation: 65535, Brightness: 65535, Kelvin: 3500}
+)
+
+func (*TestSuite) TestBreathe(c *C) {
+	color, err := lifxpayloads.NewHSBK(240, 100, 20, 3500)
+	c.Assert(err, IsNil)
+	c.Assert(*color, Equals, blue)
+
+	b := &Breathe{Color: color, Period: 2 * time.Second, Cycles: 1.5}
+
+	c.Assert(b.Validate(), IsNil)
+	c.Check(b.Duration(), Equals, 3*time.Second)
+
+	c.Check(b.Waveform(white), DeepEquals, &lifxpayloads.LightSetWaveform{
+		Transient: true,
+		Color:     &blue,
+		Period:    2 * time.Second,
+		Waveform:  lifxpayloads.WaveformSine,
+	})
+
+	a := b.Animation(white)
+	c.Assert(a.Validate(), IsNil)
+	c.Check(a.Loop, Equals, true)
+	c.Check(a.Duration(), Equals, 2*time.Second)
+	c.Check(a.ColorAt(0), Equals, white)
+	c.Check(a.ColorAt(time.Second), Equals, blue)
+	c.Check(a.ColorAt(500*time.Millisecond), Equals, *lifxpayloads.Interpolate(&white, &blue, (1-math.Cos(math.Pi/2))/2, lifxpayloads.ColorSpaceHSB))
+	c.Check(a.ColorAt(2*time.Second), Equals, white)
+}
+
+func (*TestSuite) TestPulse(c *C) {
+	p := &Pulse{Color: &red, Period: time.Second, Duty: 25}
+
+	c.Assert(p.Validate(), IsNil)
+	c.Check(p.Duration(), Equals, time.Duration(0))
+
+	wf := p.Waveform(white)
+	c.Check(wf.Waveform, Equals, lifxpayloads.WaveformPulse)
+	c.Check(wf.SkewRatio, Equals, int16(16383))
+	c.Check(*wf.Color, Equals, red)
+
+	// the light is at the pulse color for the last quarter of each period
+	a := p.Animation(white)
+	c.Assert(a.Validate(), IsNil)
+	c.Check(a.ColorAt(700*time.Millisecond), Equals, white)
+	c.Check(a.ColorAt(800*time.Millisecond), Equals, red)
+	c.Check(a.ColorAt(1200*time.Millisecond), Equals, white)
+
+	p.Duty = 0
+	c.Check(p.Waveform(white).SkewRatio, Equals, int16(0))
+
+	p.Duty = 100
+	c.Check(p.Waveform(white).SkewRatio, Equals, int16(-32768))
+}
+
+func (*TestSuite) TestStrobe(c *C) {
+	s := &Strobe{Rate: 4, Length: 2 * time.Second}
+
+	c.Assert(s.Validate(), IsNil)
+	c.Check(s.Duration(), Equals, 2*time.Second)
+
+	wf := s.Waveform(red)
+	c.Check(wf.Period, Equals, 250*time.Millisecond)
+	c.Check(wf.Waveform, Equals, lifxpayloads.WaveformPulse)
+	c.Check(wf.Transient, Equals, true)
+	c.Check(*wf.Color, Equals, lifxpayloads.LightHSBK{Hue: 0, Saturation: 65535, Brightness: 0, Kelvin: 3500})
+
+	a := s.Animation(red)
+	c.Assert(a.Validate(), IsNil)
+	c.Check(a.ColorAt(100*time.Millisecond), Equals, red)
+	c.Check(a.ColorAt(200*time.Millisecond).Brightness, Equals, uint16(0))
+}
+
+func (*TestSuite) TestColorCycle(c *C) {
+	cc := &ColorCycle{Period: 6 * time.Second, Cycles: 2}
+
+	c.Assert(cc.Validate(), IsNil)
+	c.Check(cc.Duration(), Equals, 12*time.Second)
+	c.Check(cc.Waveform(white), IsNil)
+
+	from := lifxpayloads.LightHSBK{Hue: 60000, Saturation: 0, Brightness: 32768, Kelvin: 2700}
+	a := cc.Animation(from)
+	c.Assert(a.Validate(), IsNil)
+	c.Check(a.Loop, Equals, true)
+
+	// the hue goes all the way around the color wheel, forwards
+	var last float64
+
+	for at := time.Duration(0); at <= 6*time.Second; at += 100 * time.Millisecond {
+		color := a.ColorAt(at)
+
+		c.Check(color.Saturation, Equals, uint16(65535))
+		c.Check(color.Brightness, Equals, from.Brightness)
+		c.Check(color.Kelvin, Equals, from.Kelvin)
+
+		moved := math.Mod(color.HueDegrees()-from.HueDegrees()+360, 360)
+
+		if at > 0 && at < 6*time.Second {
+			c.Check(moved > last, Equals, true, Commentf("%s: %g <= %g", at, moved, last))
+		}
+
+		last = moved
+	}
+
+	c.Check(a.ColorAt(3*time.Second).Hue, Equals, from.Hue+32766)
+
+	cc.Saturation = 50
+	c.Check(cc.Animation(from).ColorAt(time.Second).Saturation, Equals, uint16(32768))
+}
+
+func (*TestSuite) TestRandomPalette(c *C) {
+	parsed, err := lifxpayloads.ParseColor("hue:240 saturation:1.0 brightness:0.2 kelvin:3500")
+	c.Assert(err, IsNil)
+	c.Assert(*parsed, Equals, blue)
+
+	rp := &RandomPalette{
+		Colors: []*lifxpayloads.LightHSBK{&white, parsed, &red},
+		Hold:   time.Second,
+		Fade:   500 * time.Millisecond,
+		Seed:   1,
+	}
+
+	c.Assert(rp.Validate(), IsNil)
+	c.Check(rp.Duration(), Equals, time.Duration(0))
+	c.Check(rp.Waveform(white), IsNil)
+
+	a := rp.Animation(white)
+	c.Assert(a.Validate(), IsNil)
+	c.Check(a.Loop, Equals, true)
+	c.Check(a.Duration(), Equals, paletteSteps*1500*time.Millisecond)
+
+	// the same seed gives the same colors
+	c.Check(rp.Animation(white), DeepEquals, a)
+
+	var prev lifxpayloads.LightHSBK
+
+	for i := 0; i < paletteSteps; i++ {
+		at := time.Duration(i) * 1500 * time.Millisecond
+		color := a.ColorAt(at)
+
+		c.Check(color == white || color == blue || color == red, Equals, true)
+		c.Check(a.ColorAt(at+time.Second), Equals, color)
+		c.Check(color, Not(Equals), prev)
+
+		prev = color
+	}
+
+	c.Check(prev, Not(Equals), a.ColorAt(0))
+
+	// a palette of one color holds it
+	rp.Colors = rp.Colors[:1]
+	a = rp.Animation(blue)
+	c.Check(a.ColorAt(0), Equals, white)
+	c.Check(a.ColorAt(time.Minute), Equals, white)
+}
+
+func (*TestSuite) TestValidate(c *C) {
+	badKelvin := lifxpayloads.LightHSBK{Brightness: 65535}
+
+	tests := []struct {
+		effect Effect
+		err    string
+	}{
+		{&Breathe{Period: time.Second}, "the color must be set"},
+		{&Breathe{Color: &badKelvin, Period: time.Second}, lifxpayloads.ErrKelvinRange.Error()},
+		{&Breathe{Color: &blue}, "the period must be between 1ms and 1193h2m47.295s"},
+		{&Breathe{Color: &blue, Period: 1194 * time.Hour}, "the period must be between 1ms and 1193h2m47.295s"},
+		{&Breathe{Color: &blue, Period: time.Second, Cycles: -1}, "the number of cycles must be 0 or more"},
+		{&Breathe{Color: &blue, Period: time.Second, Cycles: math.NaN()}, "the number of cycles must be 0 or more"},
+		{&Breathe{Color: &blue, Period: time.Second, Cycles: math.Inf(1)}, "the number of cycles must be 0 or more"},
+		{&Breathe{Color: &blue, Period: time.Hour, Cycles: 1e10}, "the effect is too long"},
+		{&Pulse{Color: &blue, Period: time.Second, Duty: 101}, "the duty cycle must be between 0% and 100%"},
+		{&Strobe{}, "the rate must be between 0 and 1000 flashes a second"},
+		{&Strobe{Rate: 1001}, "the rate must be between 0 and 1000 flashes a second"},
+		{&Strobe{Rate: 10, Length: -1}, "the duration can't be negative"},
+		{&ColorCycle{Period: time.Second, Saturation: -1}, "the saturation must be between 0% and 100%"},
+		{&RandomPalette{Hold: time.Second}, "the palette has no colors"},
+		{&RandomPalette{Colors: []*lifxpayloads.LightHSBK{&blue, &badKelvin}, Hold: time.Second}, "color 2: " + lifxpayloads.ErrKelvinRange.Error()},
+		{&RandomPalette{Colors: []*lifxpayloads.LightHSBK{&blue, nil}, Hold: time.Second}, "color 2: the color must be set"},
+		{&RandomPalette{Colors: []*lifxpayloads.LightHSBK{&blue}}, "the hold and fade times can't be negative, or both 0"},
+		{&RandomPalette{Colors: []*lifxpayloads.LightHSBK{&blue}, Hold: time.Second, Fade: -1}, "the hold and fade times can't be negative, or both 0"},
+		{&RandomPalette{Colors: []*lifxpayloads.LightHSBK{&blue}, Hold: time.Duration(math.MaxInt64 / 2)}, "the effect is too long"},
+		{&RandomPalette{Colors: []*lifxpayloads.LightHSBK{&blue}, Hold: time.Second, Length: -1}, "the duration can't be negative"},
+		{&Candle{Color: &badKelvin}, lifxpayloads.ErrKelvinRange.Error()},
+		{&Candle{Flicker: 101}, "the flicker must be between 0% and 100%"},
+		{&Candle{Length: -1}, "the duration can't be negative"},
+	}
+
+	for _, tt := range tests {
+		c.Check(tt.effect.Validate(), ErrorMatches, tt.err, Commentf("%#v", tt.effect))
+	}
+}
+
+func (*TestSuite) Test_waveformRun(c *C) {
+	tests := []struct {
+		period, remaining time.Duration
+		cycles            float32
+		d                 time.Duration
+	}{
+		{time.Second, 2500 * time.Millisecond, 2.5, 2500 * time.Millisecond},
+		{time.Second, maxWaveformRun, 3600, maxWaveformRun},
+		{time.Second, 0, 3600, maxWaveformRun},
+		{7 * time.Second, 2 * maxWaveformRun, 514, 3598 * time.Second},
+		{2 * maxWaveformRun, 0, 1, 2 * maxWaveformRun},
+	}
+
+	for _, tt := range tests {
+		cycles, d := waveformRun(tt.period, tt.remaining)
+		c.Check(cycles, Equals, tt.cycles)
+		c.Check(d, Equals, tt.d)
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+// Package lifxeffects is a library of ready-made effects for LIFX lights:
+// breathing, pulsing, strobing, a flickering candle, a cycle around the color
+// wheel, and a random walk through a palette of colors.
+//
+// An effect is played on the lights with Play. The effects that can be
+// described by a LightSetWaveform message are played by the lights
+// themselves, which is smooth and takes no further traffic. The lights that
+// don't acknowledge the waveform, and the effects that can't be described by
+// one, are streamed from the client with LightSetColor messages instead,
+// using a lifxanim.Player.
+//
+// The colors of the effects are the *lifxpayloads.LightHSBK values returned
+// by lifxpayloads.NewHSBK, which takes the hue in degrees and the saturation
+// and brightness as percentages, or by lifxpayloads.ParseColor:
+//
+//	blue, err := lifxpayloads.NewHSBK(240, 100, 20, 3500)
+//
+//	if err != nil {
+//		// handle err
+//	}
+//
+//	err = lifxeffects.Play(ctx, nil, &lifxeffects.Breathe{
+//		Color:  blue,
+//		Period: 4 * time.Second,
+//	}, client.Light(mac, addr))
+//
+// The effects play until they're done, or until the context is done if they
+// go on forever. Either way, the lights are left at the colors they had
+// before the effect started.
+package lifxeffects
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/theckman/go-lifx"
+	"github.com/theckman/go-lifx/anim"
+	"github.com/theckman/go-lifx/protocol/payloads"
+	"github.com/theckman/go-lifx/util"
+)
+
+// maxWaveformRun is the longest a single LightSetWaveform message is made to
+// run for. The effects that go on for longer are sent again when it's over.
+const maxWaveformRun = time.Hour
+
+// Effect is an effect that can be played on lights. The effects in this
+// package satisfy it, and other packages can implement their own.
+type Effect interface {
+	// Validate returns an error if the effect can't be played.
+	Validate() error
+
+	// Duration returns how long the effect plays for, or 0 if it goes on
+	// until it's cancelled.
+	Duration() time.Duration
+
+	// Waveform returns the message that makes a light at the color play
+	// the effect by itself, or nil if the effect can't be described by a
+	// waveform. The Cycles of the message are set by Play, to make it last
+	// for the duration of the effect.
+	Waveform(from lifxpayloads.LightHSBK) *lifxpayloads.LightSetWaveform
+
+	// Animation returns the animation that's streamed to a light at the
+	// color, if the light doesn't play the effect by itself. It should
+	// loop, as it's played until the duration of the effect has passed.
+	Animation(from lifxpayloads.LightHSBK) *lifxanim.Animation
+}
+
+// Config is the configuration for Play. The zero value is usable.
+type Config struct {
+	// Animation is the configuration of the player used to stream the
+	// effect to the lights. If nil, the lifxanim defaults are used. Its
+	// Clock also times the effect, and the waveforms played by the lights.
+	Animation *lifxanim.Config
+
+	// Stream makes the effect be streamed to all of the lights, even the
+	// ones that could play it by themselves.
+	Stream bool
+}
+
+// run is the state of a light while an effect is played on it.
+type run struct {
+	light    *lifx.Light
+	from     lifxpayloads.LightHSBK
+	onDevice bool  // the light is playing the effect's waveform
+	waited   bool  // the light's waveform has run to its end
+	err      error // the light failed, and isn't playing the effect
+}
+
+// Play plays the effect on the lights, and returns once it's done or the
+// context is done. The config can be nil to use the defaults.
+//
+// Each light is first sent the effect's waveform. If a light doesn't
+// acknowledge it before the client times out, which is what older firmware
+// does with messages it doesn't know, the effect is streamed to it instead.
+// When the effect finishes or is cancelled, the lights are set back to their
+// colors from before it; the colors are restored even if the context is done.
+//
+// If the context is done, its error is returned. Otherwise, if any of the
+// lights fail, a lifx.MultiError of them is returned, and the effect is still
+// played on the others.
+func Play(ctx context.Context, config *Config, effect Effect, lights ...*lifx.Light) error {
+	if config == nil {
+		config = &Config{}
+	}
+
+	if err := effect.Validate(); err != nil {
+		return err
+	}
+
+	if len(lights) == 0 {
+		return errors.New("there are no lights to play the effect on")
+	}
+
+	runs := make([]*run, len(lights))
+
+	for i, light := range lights {
+		runs[i] = &run{light: light}
+	}
+
+	eachRun(runs, func(r *run) { r.start(ctx, effect, config.Stream) })
+
+	// the streamed lights play in step with each other
+	var tracks []*lifxanim.Track
+
+	for _, r := range runs {
+		if r.err == nil && !r.onDevice {
+			tracks = append(tracks, &lifxanim.Track{Light: r.light, Animation: effect.Animation(r.from)})
+		}
+	}
+
+	clock := lifxutil.SystemClock
+
+	if config.Animation != nil && config.Animation.Clock != nil {
+		clock = config.Animation.Clock
+	}
+
+	var wg sync.WaitGroup
+
+	playCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if d := effect.Duration(); d > 0 {
+		go func() {
+			select {
+			case <-clock.After(d):
+				cancel()
+			case <-playCtx.Done():
+			}
+		}()
+	}
+
+	if len(tracks) > 0 {
+		player, err := lifxanim.New(config.Animation, tracks...)
+
+		if err != nil {
+			// the lights that are already playing the waveform are
+			// stopped again
+			eachRun(runs, func(r *run) { r.restore(ctx) })
+			return err
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			player.Run(playCtx)
+		}()
+	}
+
+	for _, r := range runs {
+		if r.err == nil && r.onDevice {
+			wg.Add(1)
+
+			go func(r *run) {
+				defer wg.Done()
+				r.playWaveform(ctx, clock, effect)
+			}(r)
+		}
+	}
+
+	wg.Wait()
+
+	eachRun(runs, func(r *run) { r.restore(ctx) })
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var errs lifx.MultiError
+
+	for _, r := range runs {
+		if r.err != nil {
+			errs = append(errs, &lifx.DeviceError{Device: r.light.Device, Err: r.err})
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.Sort(byHardwareAddr(errs))
+		return errs
+	}
+
+	return nil
+}
+
+// eachRun calls the function for each of the runs concurrently, and waits
+// for them all to return.
+func eachRun(runs []*run, fn func(*run)) {
+	var wg sync.WaitGroup
+
+	for _, r := range runs {
+		wg.Add(1)
+
+		go func(r *run) {
+			defer wg.Done()
+			fn(r)
+		}(r)
+	}
+
+	wg.Wait()
+}
+
+// start gets the current color of the light, and sends it the first run of
+// the effect's waveform unless it's to be streamed.
+func (r *run) start(ctx context.Context, effect Effect, stream bool) {
+	r.from, r.err = r.light.Color(ctx)
+
+	if r.err != nil || stream {
+		return
+	}
+
+	wf := effect.Waveform(r.from)
+
+	if wf == nil {
+		return
+	}
+
+	wf.Cycles, _ = waveformRun(wf.Period, effect.Duration())
+
+	err := r.light.SetWaveform(ctx, wf)
+
+	switch err {
+	case nil:
+		r.onDevice = true
+	case lifx.ErrTimeout:
+		// the light doesn't support the waveform, so it's streamed
+	default:
+		r.err = err
+	}
+}
+
+// playWaveform waits for the effect's waveform to run on the light, sending
+// it again for as long as the effect lasts.
+func (r *run) playWaveform(ctx context.Context, clock lifxutil.Clock, effect Effect) {
+	remaining := effect.Duration()
+
+	for {
+		wf := effect.Waveform(r.from)
+
+		// wait for the run that was sent last
+		_, d := waveformRun(wf.Period, remaining)
+
+		select {
+		case <-clock.After(d):
+		case <-ctx.Done():
+			return
+		}
+
+		if remaining > 0 {
+			if remaining -= d; remaining <= 0 {
+				r.waited = true
+				return
+			}
+		}
+
+		wf.Cycles, _ = waveformRun(wf.Period, remaining)
+
+		if err := r.light.SetWaveform(ctx, wf); err != nil {
+			if ctx.Err() == nil {
+				r.err = err
+			}
+
+			return
+		}
+	}
+}
+
+// restore sets the light back to its color from before the effect. A light
+// that played the effect's waveform to its end is already back at it.
+func (r *run) restore(ctx context.Context) {
+	if r.err != nil || r.waited {
+		return
+	}
+
+	// the color is restored even if the effect was cancelled, in which case
+	// the client's timeout and retries bound the request instead
+	if ctx.Err() != nil {
+		ctx = context.Background()
+	}
+
+	r.err = r.light.SetColor(ctx, r.from, 0)
+}
+
+// waveformRun returns the number of cycles of a waveform with the period to
+// send, and how long they take, for the remaining duration of an effect. If
+// the remaining duration is 0 the effect goes on forever. The runs are kept
+// under maxWaveformRun, as whole cycles if they're cut short.
+func waveformRun(period, remaining time.Duration) (float32, time.Duration) {
+	if remaining > 0 && remaining <= maxWaveformRun {
+		return float32(float64(remaining) / float64(period)), remaining
+	}
+
+	cycles := math.Max(1, math.Floor(float64(maxWaveformRun)/float64(period)))
+
+	return float32(cycles), time.Duration(cycles) * period
+}
+
+// byHardwareAddr sorts the errors of a lifx.MultiError by the MAC addresses
+// of their devices.
+type byHardwareAddr lifx.MultiError
+
+func (b byHardwareAddr) Len() int      { return len(b) }
+func (b byHardwareAddr) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byHardwareAddr) Less(i, j int) bool {
+	return bytes.Compare(b[i].Device.HardwareAddr, b[j].Device.HardwareAddr) < 0
+}
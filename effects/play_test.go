@@ -0,0 +1,221 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxeffects
+
+import (
+	"context"
+	"time"
+
+	"github.com/theckman/go-lifx"
+	"github.com/theckman/go-lifx/anim"
+	"github.com/theckman/go-lifx/emulator"
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/protocol/payloads"
+	"github.com/theckman/go-lifx/util"
+
+	. "gopkg.in/check.v1"
+)
+
+// newFleet returns a client, and lights for the n devices of an emulated
+// network using the clock, which can be nil. The client doesn't retry, so the
+// devices that don't support a message time out quickly.
+func newFleet(c *C, n int, clock lifxutil.Clock) (*lifxemulator.Network, []*lifxemulator.Device, *lifx.Client, []*lifx.Light) {
+	network, err := lifxemulator.NewNetwork("")
+	c.Assert(err, IsNil)
+
+	fleet, err := network.AddFleet(&lifxemulator.FleetConfig{Devices: n, Clock: clock})
+	c.Assert(err, IsNil)
+
+	client, err := lifx.NewClient(&lifx.Config{Broadcast: network.Addr(), Timeout: 50 * time.Millisecond, Retries: -1})
+	c.Assert(err, IsNil)
+
+	lights := make([]*lifx.Light, n)
+
+	for i, device := range fleet {
+		lights[i] = client.Light(device.HardwareAddr(), network.Addr())
+	}
+
+	return network, fleet, client, lights
+}
+
+// received returns the payloads of the messages of the type the device has
+// received.
+func received(device *lifxemulator.Device, msgType uint16) []lifxprotocol.PacketComponent {
+	var payloads []lifxprotocol.PacketComponent
+
+	for _, packet := range device.Received() {
+		if packet.Header.ProtocolHeader.Type == msgType {
+			payloads = append(payloads, packet.Payload)
+		}
+	}
+
+	return payloads
+}
+
+// waitFor waits for the condition to be true, failing the test if it takes
+// too long.
+func waitFor(c *C, what string, cond func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+
+	for !cond() {
+		if time.Now().After(deadline) {
+			c.Fatalf("timed out waiting for %s", what)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (*TestSuite) TestPlay(c *C) {
+	clock := lifxutil.NewManualClock(time.Unix(1456790400, 0))
+
+	network, fleet, client, lights := newFleet(c, 3, clock)
+	defer network.Close()
+	defer client.Close()
+
+	fleet[1].SetQuirks(lifxemulator.Quirks{Unsupported: []uint16{lifxprotocol.LightGet}})
+	fleet[2].SetQuirks(lifxemulator.Quirks{Unsupported: []uint16{lifxprotocol.LightSetWaveform}})
+
+	from := fleet[0].State().Color
+	config := &Config{Animation: &lifxanim.Config{Clock: clock}}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- Play(context.Background(), config, &Breathe{Color: &blue, Period: 100 * time.Millisecond, Cycles: 2}, lights...)
+	}()
+
+	// the effect, the waveform of the first light, and the frames streamed
+	// to the last one are all timed by the clock; each frame is sent before
+	// the clock moves on to the next one
+	for i := 0; i < 4; i++ {
+		waitFor(c, "the frame", func() bool {
+			return clock.Waiters() == 3 && len(received(fleet[2], lifxprotocol.LightSetColor)) > i
+		})
+
+		clock.Advance(50 * time.Millisecond)
+	}
+
+	var err error
+
+	select {
+	case err = <-done:
+	case <-time.After(2 * time.Second):
+		c.Fatal("the effect didn't stop at the end of its duration")
+	}
+
+	// the light that couldn't be read from doesn't play the effect
+	c.Assert(err, FitsTypeOf, lifx.MultiError{})
+	errs := err.(lifx.MultiError)
+	c.Assert(errs, HasLen, 1)
+	c.Check(errs[0].Device.HardwareAddr, DeepEquals, fleet[1].HardwareAddr())
+	c.Check(errs[0].Err, Equals, lifx.ErrTimeout)
+	c.Check(received(fleet[1], lifxprotocol.LightSetWaveform), HasLen, 0)
+	c.Check(received(fleet[1], lifxprotocol.LightSetColor), HasLen, 0)
+
+	// the light that supports the waveform plays the effect by itself, and
+	// it's left at its color when the waveform is done
+	waveforms := received(fleet[0], lifxprotocol.LightSetWaveform)
+	c.Assert(waveforms, HasLen, 1)
+	c.Check(waveforms[0], DeepEquals, &lifxpayloads.LightSetWaveform{
+		Transient: true,
+		Color:     &blue,
+		Period:    100 * time.Millisecond,
+		Cycles:    2,
+		Waveform:  lifxpayloads.WaveformSine,
+	})
+	c.Check(received(fleet[0], lifxprotocol.LightSetColor), HasLen, 0)
+	c.Check(fleet[0].State().Color, Equals, from)
+
+	// the other light has the effect streamed to it, and is set back to its
+	// color at the end
+	c.Check(received(fleet[2], lifxprotocol.LightSetWaveform), HasLen, 1)
+
+	colors := received(fleet[2], lifxprotocol.LightSetColor)
+	c.Assert(len(colors) > 2, Equals, true)
+	c.Check(*colors[len(colors)-1].(*lifxpayloads.LightSetColor).Color, Equals, from)
+	c.Check(fleet[2].State().Color, Equals, from)
+}
+
+func (*TestSuite) TestPlay_Cancel(c *C) {
+	network, fleet, client, lights := newFleet(c, 2, nil)
+	defer network.Close()
+	defer client.Close()
+
+	fleet[1].SetQuirks(lifxemulator.Quirks{Unsupported: []uint16{lifxprotocol.LightSetWaveform}})
+
+	for _, device := range fleet {
+		device.Update(func(s *lifxemulator.State) { s.Color = red })
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	err := Play(ctx, nil, &Pulse{Color: &blue, Period: 100 * time.Millisecond}, lights...)
+	c.Check(err, Equals, context.DeadlineExceeded)
+
+	// the effect goes on forever, so the lights are stopped and set back to
+	// their colors
+	for _, device := range fleet {
+		colors := received(device, lifxprotocol.LightSetColor)
+		c.Assert(len(colors) > 0, Equals, true)
+		c.Check(*colors[len(colors)-1].(*lifxpayloads.LightSetColor).Color, Equals, red)
+		c.Check(device.State().Color, Equals, red)
+	}
+
+	// the effect is played by the first light for an hour, before it's
+	// sent again
+	waveforms := received(fleet[0], lifxprotocol.LightSetWaveform)
+	c.Assert(waveforms, HasLen, 1)
+	c.Check(waveforms[0].(*lifxpayloads.LightSetWaveform).Cycles, Equals, float32(36000))
+	c.Check(waveforms[0].(*lifxpayloads.LightSetWaveform).SkewRatio, Equals, int16(0))
+}
+
+func (*TestSuite) TestPlay_Stream(c *C) {
+	network, fleet, client, lights := newFleet(c, 2, nil)
+	defer network.Close()
+	defer client.Close()
+
+	config := &Config{Stream: true, Animation: &lifxanim.Config{FPS: 50, MaxRate: 50}}
+
+	err := Play(context.Background(), config, &Strobe{Rate: 10, Length: 200 * time.Millisecond}, lights...)
+	c.Assert(err, IsNil)
+
+	for _, device := range fleet {
+		c.Check(received(device, lifxprotocol.LightSetWaveform), HasLen, 0)
+
+		// the light flashes off and on again
+		var off, on bool
+
+		for _, pc := range received(device, lifxprotocol.LightSetColor) {
+			if pc.(*lifxpayloads.LightSetColor).Color.Brightness == 0 {
+				off = true
+			} else if off {
+				on = true
+			}
+		}
+
+		c.Check(off && on, Equals, true)
+		c.Check(device.State().Color, Equals, lifxemulator.DefaultState().Color)
+	}
+}
+
+func (*TestSuite) TestPlay_Invalid(c *C) {
+	network, _, client, lights := newFleet(c, 1, nil)
+	defer network.Close()
+	defer client.Close()
+
+	err := Play(context.Background(), nil, &Strobe{}, lights...)
+	c.Check(err, ErrorMatches, "the rate must be between 0 and 1000 flashes a second")
+
+	err = Play(context.Background(), nil, &Strobe{Rate: 1})
+	c.Check(err, ErrorMatches, "there are no lights to play the effect on")
+
+	// a bad player config stops the lights that started the waveform
+	config := &Config{Animation: &lifxanim.Config{FPS: -1}}
+
+	err = Play(context.Background(), config, &Candle{}, lights...)
+	c.Check(err, ErrorMatches, "the FPS must be a positive number, got -1")
+}
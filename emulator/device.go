@@ -0,0 +1,696 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+// Package lifxemulator provides virtual LIFX devices for testing code that
+// talks to LIFX devices over the LAN Protocol, without any real devices.
+//
+// A virtual *Device listens on a local UDP port, and answers the messages it
+// receives from an in-memory State. The tests can change the state, and
+// script packet loss, latency, and some of the quirks of real firmware:
+//
+//	device, err := lifxemulator.NewDevice(nil)
+//
+//	if err != nil {
+//		// handle err
+//	}
+//
+//	defer device.Close()
+//
+//	device.SetLoss(0.25)
+//	device.SetLatency(10 * time.Millisecond)
+//
+//	client, err := lifx.NewClient(nil)
+//	light := client.Light(device.HardwareAddr(), device.Addr())
+//
+// Like real bulbs, the device fades its color and power level over the
+// duration of the LightSetColor and LightSetPower messages, and runs the
+// waveform of the LightSetWaveform message, so a LightGet in the middle of a
+// transition returns the color at that point. Set the Clock field of the
+// Config to a *lifxutil.ManualClock to step through the transitions
+// deterministically.
+//
+// To test code against many devices at once, create them on a *Network. The
+// devices share the network's UDP socket, which answers broadcasts from all
+// of them:
+//
+//	network, err := lifxemulator.NewNetwork("")
+//	fleet, err := network.AddFleet(&lifxemulator.FleetConfig{Devices: 200, Groups: 10})
+//
+//	client, err := lifx.NewClient(&lifx.Config{Broadcast: network.Addr()})
+//	devices, err := client.Discover(ctx)
+package lifxemulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/protocol/payloads"
+	"github.com/theckman/go-lifx/util"
+)
+
+// maxPacketSize is the largest UDP datagram we'll read.
+const maxPacketSize = 65535
+
+// MaxReceived is the number of packets a device remembers receiving. Once
+// it's received more, the oldest ones are forgotten.
+const MaxReceived = 1024
+
+// defaultPort is the UDP port LIFX devices listen on.
+const defaultPort = 56700
+
+// ServiceUDP is the value of the DeviceStateService.Service field for the UDP
+// service.
+const ServiceUDP uint8 = 1
+
+// byteOrder is the byte order used by the LIFX protocol.
+var byteOrder = binary.LittleEndian
+
+// State is the state of an emulated device. The messages the device receives
+// are answered from, and change, the state.
+type State struct {
+	Label    lifxpayloads.DeviceLabel
+	Power    uint16
+	Color    lifxpayloads.LightHSBK
+	Group    lifxpayloads.DeviceStateGroup
+	Location lifxpayloads.DeviceStateLocation
+
+	Version      lifxpayloads.DeviceStateVersion
+	HostFirmware lifxpayloads.DeviceStateHostFirmware
+	WifiFirmware lifxpayloads.DeviceStateWifiFirmware
+
+	// HostSignal and WifiSignal are the raw signal values reported in the
+	// DeviceStateHostInfo and DeviceStateWifiInfo messages.
+	HostSignal float32
+	WifiSignal float32
+
+	// Downtime is the reported length of the last power outage.
+	Downtime time.Duration
+}
+
+// DefaultState returns the state of a newly created emulated device: a LIFX
+// A19 that's powered off, and set to a neutral white.
+func DefaultState() State {
+	return State{
+		Label: lifxpayloads.NewDeviceLabelTrunc([]byte("LIFX Bulb")),
+		Color: lifxpayloads.LightHSBK{Brightness: 65535, Kelvin: 3500},
+		Group: lifxpayloads.DeviceStateGroup{
+			Label: lifxpayloads.NewDeviceLabelTrunc([]byte("Group")),
+		},
+		Location: lifxpayloads.DeviceStateLocation{
+			Label: lifxpayloads.NewDeviceLabelTrunc([]byte("Location")),
+		},
+		Version:      lifxpayloads.DeviceStateVersion{Vendor: 1, Product: 27},
+		HostFirmware: lifxpayloads.DeviceStateHostFirmware{Version: 2<<16 | 80},
+		WifiFirmware: lifxpayloads.DeviceStateWifiFirmware{Version: 2<<16 | 80},
+		HostSignal:   1e-5,
+		WifiSignal:   1e-5,
+	}
+}
+
+// Quirks are behaviors of real firmware that can be turned on to test how
+// code handles them.
+type Quirks struct {
+	// IgnoreAcks makes the device ignore the AckRequired flag, like a
+	// device that's too busy to acknowledge messages.
+	IgnoreAcks bool
+
+	// StateOnSet makes the device respond to Set* messages with a State*
+	// message, even if the ResRequired flag isn't set.
+	StateOnSet bool
+
+	// DuplicateResponses makes the device send every response twice.
+	DuplicateResponses bool
+
+	// Unsupported are message types the device doesn't respond to at all,
+	// like older firmware that doesn't know about newer messages.
+	Unsupported []uint16
+}
+
+// Config is the configuration for a *Device. The zero value is usable, and
+// any fields that aren't set use their defaults.
+type Config struct {
+	// HardwareAddr is the MAC address of the device. If nil, a random
+	// address with the LIFX prefix (d0:73:d5) is used.
+	HardwareAddr net.HardwareAddr
+
+	// Addr is the address to listen on. If empty, a random port on the IPv4
+	// loopback interface is used.
+	Addr string
+
+	// State is the initial state of the device. If nil, DefaultState is
+	// used.
+	State *State
+
+	// Seed seeds the random number generator used for packet loss, so that
+	// tests can be repeatable. If 0, the current time is used.
+	Seed int64
+
+	// Clock is the source of the current time, used for the transitions
+	// and waveforms. If nil, the system clock is used.
+	Clock lifxutil.Clock
+}
+
+// Device is an emulated LIFX device. It's safe for concurrent use by multiple
+// goroutines.
+type Device struct {
+	conn    net.PacketConn
+	addr    *net.UDPAddr
+	network *Network
+	mac     net.HardwareAddr
+	clock   lifxutil.Clock
+	boot    time.Time
+
+	mu       sync.Mutex
+	state    State
+	color    *colorFade
+	power    *powerFade
+	wave     *waveform
+	quirks   Quirks
+	loss     float64
+	latency  time.Duration
+	drop     int
+	rand     *rand.Rand
+	received []*lifxprotocol.Packet
+	next     int
+
+	duplicate    float64
+	reorder      float64
+	reorderDelay time.Duration
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewDevice returns a new *Device listening for messages. The config can be
+// nil to use the defaults. The device must be closed when it's no longer
+// needed.
+func NewDevice(config *Config) (*Device, error) {
+	if config == nil {
+		config = &Config{}
+	}
+
+	addr := config.Addr
+
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+
+	conn, err := net.ListenPacket("udp4", addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	d := newDevice(config)
+	d.conn = conn
+	d.addr = conn.LocalAddr().(*net.UDPAddr)
+
+	go d.serve()
+
+	return d, nil
+}
+
+// newDevice returns a *Device that isn't listening on a connection.
+func newDevice(config *Config) *Device {
+	seed := config.Seed
+
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	d := &Device{
+		mac:   config.HardwareAddr,
+		clock: config.Clock,
+		state: DefaultState(),
+		rand:  rand.New(rand.NewSource(seed)),
+		done:  make(chan struct{}),
+	}
+
+	if d.clock == nil {
+		d.clock = lifxutil.SystemClock
+	}
+
+	d.boot = d.clock.Now()
+
+	if d.mac == nil {
+		d.mac = net.HardwareAddr{0xd0, 0x73, 0xd5, 0, 0, 0}
+		d.rand.Read(d.mac[3:])
+	}
+
+	if config.State != nil {
+		d.state = *config.State
+	}
+
+	return d
+}
+
+// HardwareAddr returns the MAC address of the device.
+func (d *Device) HardwareAddr() net.HardwareAddr { return d.mac }
+
+// Addr returns the address the device is listening on. For a device on a
+// *Network this is the address of the network.
+func (d *Device) Addr() *net.UDPAddr { return d.addr }
+
+// Close stops the device, and closes its connection. A device on a *Network
+// leaves the network instead.
+func (d *Device) Close() error {
+	if d.network != nil {
+		d.network.Remove(d.mac)
+		return nil
+	}
+
+	var err error
+
+	d.closeOnce.Do(func() {
+		err = d.conn.Close()
+		<-d.done
+	})
+
+	return err
+}
+
+// State returns a copy of the current state of the device. If the color or
+// power level is in the middle of a transition or waveform, the value at the
+// current time of the device's clock is returned.
+func (d *Device) State() State {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.current(d.clock.Now())
+}
+
+// Update calls fn with the state of the device, so it can be changed. Any
+// transitions or waveforms in progress are stopped at their current values
+// first. The device doesn't handle any messages until fn returns.
+func (d *Device) Update(fn func(*State)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.state = d.current(d.clock.Now())
+	d.color, d.power, d.wave = nil, nil, nil
+
+	fn(&d.state)
+}
+
+// current returns the state at the time, with the color and power level
+// of any transitions or waveforms in progress. The caller must hold the lock.
+func (d *Device) current(now time.Time) State {
+	// the state holds the values the transitions end at, so the finished
+	// ones can be forgotten
+	if d.color != nil && d.color.progress(now) >= 1 {
+		d.color = nil
+	}
+
+	if d.power != nil && d.power.progress(now) >= 1 {
+		d.power = nil
+	}
+
+	if d.wave != nil && d.wave.progress(now) >= 1 {
+		d.wave = nil
+	}
+
+	state := d.state
+
+	switch {
+	case d.wave != nil:
+		state.Color = d.wave.at(now)
+	case d.color != nil:
+		state.Color = d.color.at(now)
+	}
+
+	if d.power != nil {
+		state.Power = d.power.at(now)
+	}
+
+	return state
+}
+
+// SetQuirks sets the firmware quirks the device emulates.
+func (d *Device) SetQuirks(quirks Quirks) {
+	d.mu.Lock()
+	d.quirks = quirks
+	d.mu.Unlock()
+}
+
+// SetLoss sets the fraction (0-1) of the received packets that are dropped
+// without being handled, chosen at random.
+func (d *Device) SetLoss(ratio float64) {
+	d.mu.Lock()
+	d.loss = ratio
+	d.mu.Unlock()
+}
+
+// SetLatency sets how long the device waits before sending its responses.
+func (d *Device) SetLatency(latency time.Duration) {
+	d.mu.Lock()
+	d.latency = latency
+	d.mu.Unlock()
+}
+
+// SetDuplicate sets the fraction (0-1) of the responses that are delivered
+// twice, chosen at random.
+func (d *Device) SetDuplicate(ratio float64) {
+	d.mu.Lock()
+	d.duplicate = ratio
+	d.mu.Unlock()
+}
+
+// SetReorder sets the fraction (0-1) of the responses that are held back by
+// the delay, chosen at random, so that later responses can overtake them.
+func (d *Device) SetReorder(ratio float64, delay time.Duration) {
+	d.mu.Lock()
+	d.reorder = ratio
+	d.reorderDelay = delay
+	d.mu.Unlock()
+}
+
+// DropNext makes the device drop the next n packets it receives.
+func (d *Device) DropNext(n int) {
+	d.mu.Lock()
+	d.drop = n
+	d.mu.Unlock()
+}
+
+// Received returns the last MaxReceived packets the device has received,
+// including the ones that were dropped, in the order they were received.
+func (d *Device) Received() []*lifxprotocol.Packet {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	packets := append([]*lifxprotocol.Packet(nil), d.received[d.next:]...)
+
+	return append(packets, d.received[:d.next]...)
+}
+
+// ResetReceived forgets the packets the device has received.
+func (d *Device) ResetReceived() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.received = nil
+	d.next = 0
+}
+
+// serve reads packets from the connection, and sends the responses.
+func (d *Device) serve() {
+	defer close(d.done)
+
+	buf := make([]byte, maxPacketSize)
+
+	for {
+		n, addr, err := d.conn.ReadFrom(buf)
+
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+
+			return
+		}
+
+		req := &lifxprotocol.Packet{}
+
+		// ignore anything that isn't a valid packet for a known message type
+		if err := req.UnmarshalPacket(bytes.NewReader(buf[:n]), byteOrder); err != nil {
+			continue
+		}
+
+		deliver(d.conn, d.receive(req), addr)
+	}
+}
+
+// delivery is a response, and how long to wait before sending it.
+type delivery struct {
+	packet *lifxprotocol.Packet
+	delay  time.Duration
+}
+
+// deliver writes the responses to addr after their delays. Responses with the
+// same delay are sent in order.
+func deliver(conn net.PacketConn, deliveries []delivery, addr net.Addr) {
+	var (
+		delays  []time.Duration
+		byDelay = make(map[time.Duration][][]byte)
+	)
+
+	for _, dl := range deliveries {
+		data, err := dl.packet.MarshalPacket(byteOrder)
+
+		if err != nil {
+			continue
+		}
+
+		if _, ok := byDelay[dl.delay]; !ok {
+			delays = append(delays, dl.delay)
+		}
+
+		byDelay[dl.delay] = append(byDelay[dl.delay], data)
+	}
+
+	for _, delay := range delays {
+		packets := byDelay[delay]
+
+		if delay <= 0 {
+			for _, data := range packets {
+				conn.WriteTo(data, addr)
+			}
+
+			continue
+		}
+
+		go func(delay time.Duration, packets [][]byte) {
+			time.Sleep(delay)
+
+			for _, data := range packets {
+				conn.WriteTo(data, addr)
+			}
+		}(delay, packets)
+	}
+}
+
+// receive records the packet, and returns the responses to it. The responses
+// are nil if the packet is dropped, or isn't for this device.
+func (d *Device) receive(req *lifxprotocol.Packet) []delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// once the buffer is full, it's used as a ring, with the oldest packet
+	// at next
+	if len(d.received) < MaxReceived {
+		d.received = append(d.received, req)
+	} else {
+		d.received[d.next] = req
+		d.next = (d.next + 1) % MaxReceived
+	}
+
+	if d.drop > 0 {
+		d.drop--
+		return nil
+	}
+
+	if d.loss > 0 && d.rand.Float64() < d.loss {
+		return nil
+	}
+
+	var deliveries []delivery
+
+	for _, res := range d.handle(req) {
+		delay := d.latency
+
+		if d.reorder > 0 && d.rand.Float64() < d.reorder {
+			delay += d.reorderDelay
+		}
+
+		deliveries = append(deliveries, delivery{packet: res, delay: delay})
+
+		if d.duplicate > 0 && d.rand.Float64() < d.duplicate {
+			deliveries = append(deliveries, delivery{packet: res, delay: delay})
+		}
+	}
+
+	return deliveries
+}
+
+// handle applies the message to the state, and returns the responses. The
+// caller must hold the lock.
+func (d *Device) handle(req *lifxprotocol.Packet) []*lifxprotocol.Packet {
+	target := req.Header.FrameAddress.Target
+
+	if !req.Header.Frame.Tagged && len(target) != 0 && !bytes.Equal(target, d.mac) && !bytes.Equal(target, make([]byte, len(target))) {
+		return nil
+	}
+
+	msgType := req.Header.ProtocolHeader.Type
+
+	for _, t := range d.quirks.Unsupported {
+		if t == msgType {
+			return nil
+		}
+	}
+
+	var responses []*lifxprotocol.Packet
+
+	now := d.clock.Now()
+	cur := d.current(now)
+
+	respond := func(resType uint16, payload lifxprotocol.PacketComponent) {
+		res := d.response(req, resType, payload)
+		responses = append(responses, res)
+
+		if d.quirks.DuplicateResponses {
+			responses = append(responses, res)
+		}
+	}
+
+	if req.Header.FrameAddress.AckRequired && !d.quirks.IgnoreAcks {
+		respond(lifxprotocol.DeviceAcknowledgement, &lifxpayloads.Empty{})
+	}
+
+	// Set* messages only get a State* response if one was asked for
+	stateOnSet := req.Header.FrameAddress.ResRequired || d.quirks.StateOnSet
+
+	switch pl := req.Payload.(type) {
+	case *lifxpayloads.DeviceStatePower:
+		if msgType == lifxprotocol.DeviceSetPower {
+			d.state.Power = pl.Level
+			d.power = nil
+
+			if stateOnSet {
+				respond(lifxprotocol.DeviceStatePower, &lifxpayloads.DeviceStatePower{Level: d.state.Power})
+			}
+		}
+	case *lifxpayloads.DeviceStateLabel:
+		if msgType == lifxprotocol.DeviceSetLabel {
+			d.state.Label = pl.Label
+
+			if stateOnSet {
+				respond(lifxprotocol.DeviceStateLabel, &lifxpayloads.DeviceStateLabel{Label: d.state.Label})
+			}
+		}
+	case *lifxpayloads.LightSetColor:
+		// a new color stops any waveform, and fades from wherever the
+		// light currently is
+		if pl.Color != nil {
+			d.state.Color = *pl.Color
+			d.wave = nil
+			d.color = nil
+
+			if pl.Duration > 0 {
+				d.color = &colorFade{fade: fade{start: now, duration: pl.Duration}, from: cur.Color, to: *pl.Color}
+			}
+		}
+
+		if stateOnSet {
+			respond(lifxprotocol.LightState, d.lightState(now))
+		}
+	case *lifxpayloads.LightSetWaveform:
+		if pl.Color != nil {
+			d.wave = newWaveform(now, cur.Color, pl)
+			d.color = nil
+			d.state.Color = d.wave.final()
+		}
+
+		if stateOnSet {
+			respond(lifxprotocol.LightState, d.lightState(now))
+		}
+	case *lifxpayloads.LightSetPower:
+		d.state.Power = pl.Level
+		d.power = nil
+
+		if pl.Duration > 0 {
+			d.power = &powerFade{fade: fade{start: now, duration: pl.Duration}, from: cur.Power, to: pl.Level}
+		}
+
+		if stateOnSet {
+			respond(lifxprotocol.LightStatePower, &lifxpayloads.LightStatePower{Level: d.current(now).Power})
+		}
+	case *lifxpayloads.DeviceEcho:
+		if msgType == lifxprotocol.DeviceEchoRequest {
+			respond(lifxprotocol.DeviceEchoResponse, &lifxpayloads.DeviceEcho{Payload: pl.Payload})
+		}
+	}
+
+	// Get* messages are always answered
+	switch msgType {
+	case lifxprotocol.DeviceGetService:
+		respond(lifxprotocol.DeviceStateService, &lifxpayloads.DeviceStateService{Service: ServiceUDP, Port: d.port()})
+	case lifxprotocol.DeviceGetHostInfo:
+		respond(lifxprotocol.DeviceStateHostInfo, &lifxpayloads.DeviceStateHostInfo{Signal: d.state.HostSignal})
+	case lifxprotocol.DeviceGetHostFirmware:
+		hf := d.state.HostFirmware
+		respond(lifxprotocol.DeviceStateHostFirmware, &hf)
+	case lifxprotocol.DeviceGetWifiInfo:
+		respond(lifxprotocol.DeviceStateWifiInfo, &lifxpayloads.DeviceStateWifiInfo{Signal: d.state.WifiSignal})
+	case lifxprotocol.DeviceGetWifiFirmware:
+		wf := d.state.WifiFirmware
+		respond(lifxprotocol.DeviceStateWifiFirmware, &wf)
+	case lifxprotocol.DeviceGetPower:
+		respond(lifxprotocol.DeviceStatePower, &lifxpayloads.DeviceStatePower{Level: d.current(now).Power})
+	case lifxprotocol.DeviceGetLabel:
+		respond(lifxprotocol.DeviceStateLabel, &lifxpayloads.DeviceStateLabel{Label: d.state.Label})
+	case lifxprotocol.DeviceGetVersion:
+		version := d.state.Version
+		respond(lifxprotocol.DeviceStateVersion, &version)
+	case lifxprotocol.DeviceGetInfo:
+		respond(lifxprotocol.DeviceStateInfo, &lifxpayloads.DeviceStateInfo{
+			Time:     uint64(now.UnixNano()),
+			Uptime:   uint64(now.Sub(d.boot)),
+			Downtime: uint64(d.state.Downtime),
+		})
+	case lifxprotocol.DeviceGetLocation:
+		location := d.state.Location
+		respond(lifxprotocol.DeviceStateLocation, &location)
+	case lifxprotocol.DeviceGetGroup:
+		group := d.state.Group
+		respond(lifxprotocol.DeviceStateGroup, &group)
+	case lifxprotocol.LightGet:
+		respond(lifxprotocol.LightState, d.lightState(now))
+	case lifxprotocol.LightGetPower:
+		respond(lifxprotocol.LightStatePower, &lifxpayloads.LightStatePower{Level: d.current(now).Power})
+	}
+
+	return responses
+}
+
+// lightState returns the LightState payload for the state at the time. The
+// caller must hold the lock.
+func (d *Device) lightState(now time.Time) *lifxpayloads.LightState {
+	state := d.current(now)
+
+	return &lifxpayloads.LightState{Color: &state.Color, Power: state.Power, Label: state.Label}
+}
+
+// port returns the port the device is listening on, or defaultPort if it
+// isn't listening on a UDP port.
+func (d *Device) port() uint32 {
+	if d.addr == nil {
+		return defaultPort
+	}
+
+	return uint32(d.addr.Port)
+}
+
+// response builds the packet responding to the request.
+func (d *Device) response(req *lifxprotocol.Packet, resType uint16, payload lifxprotocol.PacketComponent) *lifxprotocol.Packet {
+	frame := lifxprotocol.NewFrame()
+	frame.Source = req.Header.Frame.Source
+
+	fra := lifxprotocol.NewFrameAddress()
+	fra.Target = d.mac
+	fra.Sequence = req.Header.FrameAddress.Sequence
+
+	return &lifxprotocol.Packet{
+		Header: &lifxprotocol.Header{
+			Frame:          frame,
+			FrameAddress:   fra,
+			ProtocolHeader: &lifxprotocol.ProtocolHeader{Type: resType},
+		},
+		Payload: payload,
+	}
+}
@@ -0,0 +1,311 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxemulator
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/theckman/go-lifx"
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/protocol/payloads"
+	"github.com/theckman/go-lifx/util"
+
+	. "gopkg.in/check.v1"
+)
+
+type TestSuite struct{}
+
+var _ = Suite(&TestSuite{})
+
+func Test(t *testing.T) { TestingT(t) }
+
+// newTestClient returns a client on the loopback interface with a short
+// timeout.
+func newTestClient(c *C, config *lifx.Config) *lifx.Client {
+	if config == nil {
+		config = &lifx.Config{}
+	}
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+
+	config.Conn = conn
+
+	if config.Timeout == 0 {
+		config.Timeout = 50 * time.Millisecond
+	}
+
+	client, err := lifx.NewClient(config)
+	c.Assert(err, IsNil)
+
+	return client
+}
+
+func (*TestSuite) TestNewDevice(c *C) {
+	device, err := NewDevice(nil)
+	c.Assert(err, IsNil)
+	defer device.Close()
+
+	c.Check(device.HardwareAddr()[:3], DeepEquals, net.HardwareAddr{0xd0, 0x73, 0xd5})
+	c.Check(device.Addr().IP.String(), Equals, "127.0.0.1")
+	c.Check(device.State(), DeepEquals, DefaultState())
+
+	mac := net.HardwareAddr{1, 2, 3, 4, 5, 6}
+	state := DefaultState()
+	state.Power = 65535
+
+	device2, err := NewDevice(&Config{HardwareAddr: mac, State: &state})
+	c.Assert(err, IsNil)
+	defer device2.Close()
+
+	c.Check(device2.HardwareAddr().String(), Equals, mac.String())
+	c.Check(device2.State().Power, Equals, uint16(65535))
+
+	c.Check(device2.Close(), IsNil)
+	c.Check(device2.Close(), IsNil)
+}
+
+func (*TestSuite) TestDevice_Messages(c *C) {
+	clock := lifxutil.NewManualClock(time.Unix(1456790400, 0))
+
+	device, err := NewDevice(&Config{Clock: clock})
+	c.Assert(err, IsNil)
+	defer device.Close()
+
+	client := newTestClient(c, nil)
+	defer client.Close()
+
+	light := client.Light(device.HardwareAddr(), device.Addr())
+	ctx := context.Background()
+
+	label, err := light.Label(ctx)
+	c.Assert(err, IsNil)
+	c.Check(label, Equals, "LIFX Bulb")
+
+	c.Assert(light.SetLabel(ctx, "Porch"), IsNil)
+	c.Check(device.State().Label, Equals, lifxpayloads.NewDeviceLabelTrunc([]byte("Porch")))
+
+	c.Assert(light.SetPower(ctx, true, time.Second), IsNil)
+	clock.Advance(time.Second)
+
+	on, err := light.Power(ctx)
+	c.Assert(err, IsNil)
+	c.Check(on, Equals, true)
+
+	c.Assert(light.Device.SetPower(ctx, false, 0), IsNil)
+
+	on, err = light.Device.Power(ctx)
+	c.Assert(err, IsNil)
+	c.Check(on, Equals, false)
+
+	red := lifxpayloads.LightHSBK{Saturation: 65535, Brightness: 65535, Kelvin: 3500}
+	c.Assert(light.SetColor(ctx, red, 0), IsNil)
+
+	color, err := light.Color(ctx)
+	c.Assert(err, IsNil)
+	c.Check(color, Equals, red)
+
+	blue := &lifxpayloads.LightHSBK{Hue: 43690, Saturation: 65535, Brightness: 65535, Kelvin: 3500}
+	c.Assert(light.SetWaveform(ctx, &lifxpayloads.LightSetWaveform{Transient: true, Color: blue, Period: time.Second, Cycles: 1}), IsNil)
+	clock.Advance(time.Second)
+	c.Check(device.State().Color, Equals, red)
+
+	c.Assert(light.SetWaveform(ctx, &lifxpayloads.LightSetWaveform{Color: blue, Period: time.Second, Cycles: 1}), IsNil)
+	clock.Advance(time.Second)
+	c.Check(device.State().Color, Equals, *blue)
+
+	echoed, err := light.Echo(ctx, []byte("ping"))
+	c.Assert(err, IsNil)
+	c.Check(string(echoed), Equals, "ping")
+
+	device.Update(func(s *State) {
+		s.Group.Group = [16]byte{1}
+		s.Location.Location = [16]byte{2}
+		s.Downtime = time.Minute
+	})
+
+	group, err := light.Group(ctx)
+	c.Assert(err, IsNil)
+	c.Check(group.Group, Equals, [16]byte{1})
+
+	location, err := light.Location(ctx)
+	c.Assert(err, IsNil)
+	c.Check(location.Location, Equals, [16]byte{2})
+
+	version, err := light.Version(ctx)
+	c.Assert(err, IsNil)
+	c.Check(version.Product, Equals, uint32(27))
+
+	info, err := light.Info(ctx)
+	c.Assert(err, IsNil)
+	c.Check(info.Downtime, Equals, uint64(time.Minute))
+	c.Check(info.Time, Equals, uint64(clock.Now().UnixNano()))
+	c.Check(info.Uptime, Equals, uint64(3*time.Second))
+
+	hostFirmware, err := light.HostFirmware(ctx)
+	c.Assert(err, IsNil)
+	c.Check(hostFirmware.Version, Equals, uint32(2<<16|80))
+
+	_, err = light.HostInfo(ctx)
+	c.Assert(err, IsNil)
+
+	wifi, err := light.WifiReport(ctx)
+	c.Assert(err, IsNil)
+	c.Check(wifi.DBm, Equals, -50)
+
+	bclient := newTestClient(c, &lifx.Config{Broadcast: device.Addr(), Retries: -1})
+	defer bclient.Close()
+
+	devices, err := bclient.Discover(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(devices, HasLen, 1)
+	c.Check(devices[0].Addr.String(), Equals, device.Addr().String())
+}
+
+func (*TestSuite) TestDevice_ResRequired(c *C) {
+	device := newDevice(&Config{HardwareAddr: net.HardwareAddr{1, 2, 3, 4, 5, 6}})
+
+	req := func(msgType uint16, payload lifxprotocol.PacketComponent, ack, res bool) *lifxprotocol.Packet {
+		fra := lifxprotocol.NewFrameAddress()
+		fra.Target = device.mac
+		fra.AckRequired = ack
+		fra.ResRequired = res
+
+		return &lifxprotocol.Packet{
+			Header: &lifxprotocol.Header{
+				Frame:          &lifxprotocol.Frame{Source: 42},
+				FrameAddress:   fra,
+				ProtocolHeader: &lifxprotocol.ProtocolHeader{Type: msgType},
+			},
+			Payload: payload,
+		}
+	}
+
+	types := func(packets []*lifxprotocol.Packet) []uint16 {
+		var t []uint16
+
+		for _, p := range packets {
+			t = append(t, p.Header.ProtocolHeader.Type)
+		}
+
+		return t
+	}
+
+	setPower := &lifxpayloads.DeviceStatePower{Level: 65535}
+
+	c.Check(types(device.handle(req(lifxprotocol.DeviceSetPower, setPower, false, false))), HasLen, 0)
+	c.Check(types(device.handle(req(lifxprotocol.DeviceSetPower, setPower, true, false))), DeepEquals, []uint16{lifxprotocol.DeviceAcknowledgement})
+	c.Check(types(device.handle(req(lifxprotocol.DeviceSetPower, setPower, false, true))), DeepEquals, []uint16{lifxprotocol.DeviceStatePower})
+	c.Check(types(device.handle(req(lifxprotocol.DeviceSetPower, setPower, true, true))), DeepEquals, []uint16{lifxprotocol.DeviceAcknowledgement, lifxprotocol.DeviceStatePower})
+
+	// Get* messages are always answered
+	c.Check(types(device.handle(req(lifxprotocol.LightGet, &lifxpayloads.Empty{}, false, false))), DeepEquals, []uint16{lifxprotocol.LightState})
+
+	res := device.handle(req(lifxprotocol.LightGet, &lifxpayloads.Empty{}, false, false))
+	c.Check(res[0].Header.Frame.Source, Equals, uint32(42))
+	c.Check(res[0].Header.FrameAddress.Target.String(), Equals, device.mac.String())
+
+	// messages for other devices are ignored
+	other := req(lifxprotocol.LightGet, &lifxpayloads.Empty{}, false, false)
+	other.Header.FrameAddress.Target = net.HardwareAddr{6, 5, 4, 3, 2, 1}
+	c.Check(device.handle(other), HasLen, 0)
+
+	other.Header.Frame.Tagged = true
+	c.Check(device.handle(other), HasLen, 1)
+
+	//
+	// Test the quirks
+	//
+	device.SetQuirks(Quirks{IgnoreAcks: true, StateOnSet: true})
+	c.Check(types(device.handle(req(lifxprotocol.DeviceSetPower, setPower, true, false))), DeepEquals, []uint16{lifxprotocol.DeviceStatePower})
+
+	device.SetQuirks(Quirks{DuplicateResponses: true, Unsupported: []uint16{lifxprotocol.DeviceGetWifiInfo}})
+	c.Check(types(device.handle(req(lifxprotocol.LightGetPower, &lifxpayloads.Empty{}, false, false))), DeepEquals, []uint16{lifxprotocol.LightStatePower, lifxprotocol.LightStatePower})
+	c.Check(device.handle(req(lifxprotocol.DeviceGetWifiInfo, &lifxpayloads.Empty{}, false, false)), HasLen, 0)
+}
+
+func (*TestSuite) TestDevice_LossAndLatency(c *C) {
+	device, err := NewDevice(&Config{Seed: 1})
+	c.Assert(err, IsNil)
+	defer device.Close()
+
+	client := newTestClient(c, &lifx.Config{Retries: -1})
+	defer client.Close()
+
+	dev := client.Device(device.HardwareAddr(), device.Addr())
+	ctx := context.Background()
+
+	device.DropNext(1)
+
+	_, err = dev.Label(ctx)
+	c.Check(err, Equals, lifx.ErrTimeout)
+
+	_, err = dev.Label(ctx)
+	c.Check(err, IsNil)
+
+	device.SetLoss(1)
+
+	_, err = dev.Label(ctx)
+	c.Check(err, Equals, lifx.ErrTimeout)
+
+	device.SetLoss(0)
+	device.SetLatency(100 * time.Millisecond)
+
+	// the response arrives after the client's timeout
+	_, err = dev.Label(ctx)
+	c.Check(err, Equals, lifx.ErrTimeout)
+
+	device.SetLatency(10 * time.Millisecond)
+
+	start := time.Now()
+	_, err = dev.Label(ctx)
+	c.Check(err, IsNil)
+	c.Check(time.Since(start) >= 10*time.Millisecond, Equals, true)
+
+	// every packet is recorded, even the dropped ones
+	c.Check(device.Received(), HasLen, 5)
+}
+
+func (*TestSuite) TestDevice_Received(c *C) {
+	device, err := NewDevice(nil)
+	c.Assert(err, IsNil)
+	defer device.Close()
+
+	// the packets are for another device, so they're recorded but not
+	// answered
+	packets := make([]*lifxprotocol.Packet, MaxReceived+10)
+
+	for i := range packets {
+		fra := lifxprotocol.NewFrameAddress()
+		fra.Target = net.HardwareAddr{1, 2, 3, 4, 5, 6}
+
+		packets[i] = &lifxprotocol.Packet{
+			Header: &lifxprotocol.Header{
+				Frame:          &lifxprotocol.Frame{Source: uint32(i)},
+				FrameAddress:   fra,
+				ProtocolHeader: &lifxprotocol.ProtocolHeader{Type: lifxprotocol.DeviceGetLabel},
+			},
+			Payload: &lifxpayloads.Empty{},
+		}
+
+		c.Check(device.receive(packets[i]), HasLen, 0)
+
+		if i == 2 {
+			c.Check(device.Received(), DeepEquals, packets[:3])
+		}
+	}
+
+	// only the latest packets are remembered
+	c.Check(device.Received(), DeepEquals, packets[10:])
+
+	device.ResetReceived()
+	c.Check(device.Received(), HasLen, 0)
+
+	c.Check(device.receive(packets[0]), HasLen, 0)
+	c.Check(device.Received(), DeepEquals, packets[:1])
+}
@@ -0,0 +1,340 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxemulator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/protocol/payloads"
+	"github.com/theckman/go-lifx/util"
+)
+
+// ErrNetworkClosed is the error returned when adding a device to a *Network
+// that has been closed.
+var ErrNetworkClosed = errors.New("the network has been closed")
+
+// Network is a virtual network of emulated devices sharing a single UDP
+// socket. A message sent to the address of the network is delivered to the
+// device it's addressed to, or to all of the devices if it's a broadcast, so
+// a *lifx.Client with its Broadcast address set to the address of the network
+// can discover and control a whole fleet of devices on the loopback interface.
+//
+// The packet loss, latency, duplicate delivery, and reordering of each device
+// are set on the *Device itself. It's safe for concurrent use by multiple
+// goroutines.
+type Network struct {
+	conn net.PacketConn
+	addr *net.UDPAddr
+
+	mu      sync.Mutex
+	devices map[string]*Device
+	closed  bool
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewNetwork returns a new *Network listening on the address. If the address
+// is empty, a random port on the IPv4 loopback interface is used. The network
+// must be closed when it's no longer needed.
+func NewNetwork(addr string) (*Network, error) {
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+
+	conn, err := net.ListenPacket("udp4", addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Network{
+		conn:    conn,
+		addr:    conn.LocalAddr().(*net.UDPAddr),
+		devices: make(map[string]*Device),
+		done:    make(chan struct{}),
+	}
+
+	go n.serve()
+
+	return n, nil
+}
+
+// Addr returns the address the network is listening on. It's the address of
+// every device on the network, and the one to broadcast to.
+func (n *Network) Addr() *net.UDPAddr { return n.addr }
+
+// Close closes the network, and removes all of its devices.
+func (n *Network) Close() error {
+	var err error
+
+	n.closeOnce.Do(func() {
+		n.mu.Lock()
+		n.closed = true
+		n.devices = make(map[string]*Device)
+		n.mu.Unlock()
+
+		err = n.conn.Close()
+		<-n.done
+	})
+
+	return err
+}
+
+// AddDevice creates a device on the network. The config can be nil to use the
+// defaults; its Addr field is ignored. An error is returned if a device with
+// the same MAC address is already on the network.
+func (n *Network) AddDevice(config *Config) (*Device, error) {
+	if config == nil {
+		config = &Config{}
+	}
+
+	d := newDevice(config)
+	d.addr = n.addr
+	d.network = n
+
+	if err := n.Join(d); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Join adds a device that was created by AddDevice back to the network,
+// after it was removed.
+func (n *Network) Join(d *Device) error {
+	if d.network != n {
+		return errors.New("the device was not created on this network")
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		return ErrNetworkClosed
+	}
+
+	key := d.mac.String()
+
+	if _, ok := n.devices[key]; ok {
+		return fmt.Errorf("a device with the MAC address %s is already on the network", key)
+	}
+
+	n.devices[key] = d
+
+	return nil
+}
+
+// Remove takes the device with the MAC address off the network, so it stops
+// receiving messages. It returns the device so it can rejoin the network
+// later, or nil if there's no device with the MAC address.
+func (n *Network) Remove(mac net.HardwareAddr) *Device {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	key := mac.String()
+	d := n.devices[key]
+	delete(n.devices, key)
+
+	return d
+}
+
+// Device returns the device with the MAC address, or nil if it isn't on the
+// network.
+func (n *Network) Device(mac net.HardwareAddr) *Device {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.devices[mac.String()]
+}
+
+// Devices returns the devices on the network, sorted by MAC address.
+func (n *Network) Devices() []*Device {
+	n.mu.Lock()
+
+	devices := make([]*Device, 0, len(n.devices))
+
+	for _, d := range n.devices {
+		devices = append(devices, d)
+	}
+
+	n.mu.Unlock()
+
+	sort.Sort(byHardwareAddr(devices))
+
+	return devices
+}
+
+type byHardwareAddr []*Device
+
+func (b byHardwareAddr) Len() int           { return len(b) }
+func (b byHardwareAddr) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byHardwareAddr) Less(i, j int) bool { return bytes.Compare(b[i].mac, b[j].mac) < 0 }
+
+// FleetConfig is the configuration for a fleet of devices created by
+// Network.AddFleet. The zero value creates no devices.
+type FleetConfig struct {
+	// Devices is the number of devices to create.
+	Devices int
+
+	// Groups and Locations are the number of groups and locations the
+	// devices are spread across, in turn. If 0, all of the devices are in
+	// one group or location.
+	Groups    int
+	Locations int
+
+	// Products are the product IDs the devices are given, in turn. If
+	// empty, the product of DefaultState is used.
+	Products []uint32
+
+	// Seed seeds the random number generators of the devices. Each device
+	// gets a different seed derived from it. If 0, the current time is
+	// used.
+	Seed int64
+
+	// Clock is the source of the current time for all of the devices. If
+	// nil, the system clock is used.
+	Clock lifxutil.Clock
+}
+
+// AddFleet creates many devices on the network at once. Device i (counting
+// from 0) has the MAC address d0:73:d5 followed by i+1 as 3 big-endian bytes,
+// the label "Bulb <i+1>", and is in group "Group <i % Groups + 1>" and
+// location "Location <i % Locations + 1>". If any of the devices can't be
+// added, the ones that were added are removed again. A nil config is the
+// same as the zero FleetConfig, which adds no devices.
+func (n *Network) AddFleet(config *FleetConfig) ([]*Device, error) {
+	if config == nil {
+		config = &FleetConfig{}
+	}
+
+	if config.Devices < 0 || config.Devices > 0xffffff {
+		return nil, fmt.Errorf("a fleet must have between 0 and %d devices", 0xffffff)
+	}
+
+	groups, locations := config.Groups, config.Locations
+
+	if groups <= 0 {
+		groups = 1
+	}
+
+	if locations <= 0 {
+		locations = 1
+	}
+
+	devices := make([]*Device, 0, config.Devices)
+
+	for i := 0; i < config.Devices; i++ {
+		id := i + 1
+
+		state := DefaultState()
+		state.Label = lifxpayloads.NewDeviceLabelTrunc([]byte(fmt.Sprintf("Bulb %d", id)))
+		state.Group = lifxpayloads.DeviceStateGroup{
+			Group: fleetID(0x01, i%groups),
+			Label: lifxpayloads.NewDeviceLabelTrunc([]byte(fmt.Sprintf("Group %d", i%groups+1))),
+		}
+		state.Location = lifxpayloads.DeviceStateLocation{
+			Location: fleetID(0x02, i%locations),
+			Label:    lifxpayloads.NewDeviceLabelTrunc([]byte(fmt.Sprintf("Location %d", i%locations+1))),
+		}
+
+		if len(config.Products) > 0 {
+			state.Version.Product = config.Products[i%len(config.Products)]
+		}
+
+		var seed int64
+
+		if config.Seed != 0 {
+			seed = config.Seed + int64(i)
+		}
+
+		d, err := n.AddDevice(&Config{
+			HardwareAddr: net.HardwareAddr{0xd0, 0x73, 0xd5, byte(id >> 16), byte(id >> 8), byte(id)},
+			State:        &state,
+			Seed:         seed,
+			Clock:        config.Clock,
+		})
+
+		if err != nil {
+			for _, d := range devices {
+				n.Remove(d.mac)
+			}
+
+			return nil, err
+		}
+
+		devices = append(devices, d)
+	}
+
+	return devices, nil
+}
+
+// fleetID returns the ID of the i-th group or location of a fleet. The kind
+// byte keeps the IDs of the groups and locations apart.
+func fleetID(kind byte, i int) [16]byte {
+	var id [16]byte
+
+	id[0] = kind
+	id[12] = byte(i >> 24)
+	id[13] = byte(i >> 16)
+	id[14] = byte(i >> 8)
+	id[15] = byte(i)
+
+	return id
+}
+
+// serve reads packets from the connection, and delivers them to the devices.
+func (n *Network) serve() {
+	defer close(n.done)
+
+	buf := make([]byte, maxPacketSize)
+
+	for {
+		size, addr, err := n.conn.ReadFrom(buf)
+
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+
+			return
+		}
+
+		req := &lifxprotocol.Packet{}
+
+		// ignore anything that isn't a valid packet for a known message type
+		if err := req.UnmarshalPacket(bytes.NewReader(buf[:size]), byteOrder); err != nil {
+			continue
+		}
+
+		for _, d := range n.route(req) {
+			deliver(n.conn, d.receive(req), addr)
+		}
+	}
+}
+
+// route returns the devices the packet is addressed to.
+func (n *Network) route(req *lifxprotocol.Packet) []*Device {
+	target := req.Header.FrameAddress.Target
+
+	if req.Header.Frame.Tagged || len(target) == 0 || bytes.Equal(target, make([]byte, len(target))) {
+		return n.Devices()
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if d, ok := n.devices[net.HardwareAddr(target).String()]; ok {
+		return []*Device{d}
+	}
+
+	return nil
+}
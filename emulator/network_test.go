@@ -0,0 +1,214 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxemulator
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"time"
+
+	"github.com/theckman/go-lifx"
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/protocol/payloads"
+
+	. "gopkg.in/check.v1"
+)
+
+func label(s string) lifxpayloads.DeviceLabel {
+	return lifxpayloads.NewDeviceLabelTrunc([]byte(s))
+}
+
+func (*TestSuite) TestNetwork_Fleet(c *C) {
+	network, err := NewNetwork("")
+	c.Assert(err, IsNil)
+	defer network.Close()
+
+	fleet, err := network.AddFleet(&FleetConfig{
+		Devices:   200,
+		Groups:    4,
+		Locations: 2,
+		Products:  []uint32{27, 43},
+		Seed:      1,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(fleet, HasLen, 200)
+
+	c.Check(fleet[0].HardwareAddr(), DeepEquals, net.HardwareAddr{0xd0, 0x73, 0xd5, 0, 0, 1})
+	c.Check(fleet[199].HardwareAddr(), DeepEquals, net.HardwareAddr{0xd0, 0x73, 0xd5, 0, 0, 200})
+	c.Check(fleet[199].Addr(), DeepEquals, network.Addr())
+	c.Check(network.Devices(), DeepEquals, fleet)
+	c.Check(network.Device(fleet[5].HardwareAddr()), Equals, fleet[5])
+
+	state := fleet[5].State()
+	c.Check(state.Label, Equals, label("Bulb 6"))
+	c.Check(state.Group.Label, Equals, label("Group 2"))
+	c.Check(state.Location.Label, Equals, label("Location 2"))
+	c.Check(state.Version.Product, Equals, uint32(43))
+
+	// a nil config adds no devices
+	none, err := network.AddFleet(nil)
+	c.Check(err, IsNil)
+	c.Check(none, HasLen, 0)
+	c.Check(network.Devices(), HasLen, 200)
+
+	// the MAC addresses must be unique
+	_, err = network.AddDevice(&Config{HardwareAddr: fleet[0].HardwareAddr()})
+	c.Check(err, NotNil)
+
+	client := newTestClient(c, &lifx.Config{Broadcast: network.Addr(), Timeout: 250 * time.Millisecond})
+	defer client.Close()
+
+	ctx := context.Background()
+
+	devices, err := client.Discover(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(devices, HasLen, 200)
+
+	for i, device := range devices {
+		c.Check(device.HardwareAddr.String(), Equals, fleet[i].HardwareAddr().String())
+		c.Check(device.Addr.String(), Equals, network.Addr().String())
+	}
+
+	groups, err := lifx.Groups(ctx, devices)
+	c.Assert(err, IsNil)
+	c.Assert(groups, HasLen, 4)
+	c.Check(groups[0].Label, Equals, "Group 1")
+	c.Check(groups[0].Devices, HasLen, 50)
+
+	locations, err := lifx.Locations(ctx, devices)
+	c.Assert(err, IsNil)
+	c.Assert(locations, HasLen, 2)
+	c.Check(locations[1].Devices, HasLen, 100)
+
+	// unicast messages only reach the device they're addressed to
+	c.Assert(devices[7].SetLabel(ctx, "Porch"), IsNil)
+	c.Check(fleet[7].State().Label, Equals, label("Porch"))
+	c.Check(fleet[8].State().Label, Equals, label("Bulb 9"))
+}
+
+func (*TestSuite) TestNetwork_JoinAndLeave(c *C) {
+	network, err := NewNetwork("")
+	c.Assert(err, IsNil)
+	defer network.Close()
+
+	fleet, err := network.AddFleet(&FleetConfig{Devices: 3})
+	c.Assert(err, IsNil)
+
+	client := newTestClient(c, &lifx.Config{Broadcast: network.Addr(), Retries: -1})
+	defer client.Close()
+
+	ctx := context.Background()
+
+	left := network.Remove(fleet[1].HardwareAddr())
+	c.Check(left, Equals, fleet[1])
+	c.Check(network.Remove(fleet[1].HardwareAddr()), IsNil)
+
+	devices, err := client.Discover(ctx)
+	c.Assert(err, IsNil)
+	c.Check(devices, HasLen, 2)
+
+	// a device that has left doesn't answer
+	_, err = client.Device(fleet[1].HardwareAddr(), network.Addr()).Label(ctx)
+	c.Check(err, Equals, lifx.ErrTimeout)
+
+	c.Assert(network.Join(left), IsNil)
+	c.Check(network.Join(left), NotNil)
+
+	devices, err = client.Discover(ctx)
+	c.Assert(err, IsNil)
+	c.Check(devices, HasLen, 3)
+
+	// closing a device on a network takes it off the network
+	c.Assert(fleet[2].Close(), IsNil)
+	c.Check(network.Devices(), HasLen, 2)
+
+	// only devices created on the network can join it
+	device, err := NewDevice(nil)
+	c.Assert(err, IsNil)
+	defer device.Close()
+
+	c.Check(network.Join(device), NotNil)
+
+	c.Assert(network.Close(), IsNil)
+
+	_, err = network.AddDevice(nil)
+	c.Check(err, Equals, ErrNetworkClosed)
+}
+
+func (*TestSuite) TestNetwork_DuplicatesAndReordering(c *C) {
+	network, err := NewNetwork("")
+	c.Assert(err, IsNil)
+	defer network.Close()
+
+	device, err := network.AddDevice(&Config{Seed: 1})
+	c.Assert(err, IsNil)
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	send := func(sequence uint8) {
+		fra := lifxprotocol.NewFrameAddress()
+		fra.Target = device.HardwareAddr()
+		fra.Sequence = sequence
+
+		packet := &lifxprotocol.Packet{
+			Header: &lifxprotocol.Header{
+				Frame:          &lifxprotocol.Frame{Source: 42},
+				FrameAddress:   fra,
+				ProtocolHeader: &lifxprotocol.ProtocolHeader{Type: lifxprotocol.DeviceGetLabel},
+			},
+			Payload: &lifxpayloads.Empty{},
+		}
+
+		data, err := packet.MarshalPacket(byteOrder)
+		c.Assert(err, IsNil)
+
+		_, err = conn.WriteTo(data, network.Addr())
+		c.Assert(err, IsNil)
+	}
+
+	// receive returns the sequence numbers of the responses that arrive
+	// within the timeout, in the order they arrived
+	receive := func(timeout time.Duration) []uint8 {
+		var sequences []uint8
+
+		buf := make([]byte, maxPacketSize)
+		conn.SetReadDeadline(time.Now().Add(timeout))
+
+		for {
+			n, _, err := conn.ReadFrom(buf)
+
+			if err != nil {
+				return sequences
+			}
+
+			packet := &lifxprotocol.Packet{}
+			c.Assert(packet.UnmarshalPacket(bytes.NewReader(buf[:n]), byteOrder), IsNil)
+
+			sequences = append(sequences, packet.Header.FrameAddress.Sequence)
+		}
+	}
+
+	device.SetDuplicate(1)
+	send(1)
+	c.Check(receive(50*time.Millisecond), DeepEquals, []uint8{1, 1})
+
+	device.SetDuplicate(0)
+	device.SetReorder(1, 30*time.Millisecond)
+	send(2)
+
+	// wait for the device to see the packet before changing the ratio
+	for len(device.Received()) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	device.SetReorder(0, 0)
+	send(3)
+
+	// the first response is held back, so the second overtakes it
+	c.Check(receive(100*time.Millisecond), DeepEquals, []uint8{3, 2})
+}
@@ -0,0 +1,143 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxemulator
+
+import (
+	"math"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol/payloads"
+)
+
+// fade is a transition that started at a point in time, and runs for the
+// duration.
+type fade struct {
+	start    time.Time
+	duration time.Duration
+}
+
+// progress returns how far along the fade is at the time, from 0 to 1.
+func (f *fade) progress(now time.Time) float64 {
+	if f.duration <= 0 {
+		return 1
+	}
+
+	t := float64(now.Sub(f.start)) / float64(f.duration)
+
+	switch {
+	case t < 0:
+		return 0
+	case t > 1:
+		return 1
+	}
+
+	return t
+}
+
+// colorFade is a transition from one color to another, caused by a
+// LightSetColor message with a duration.
+type colorFade struct {
+	fade
+	from lifxpayloads.LightHSBK
+	to   lifxpayloads.LightHSBK
+}
+
+// at returns the color at the time. Bulbs fade the hue, saturation,
+// brightness, and Kelvin values directly, with the hue taking the shortest
+// path around the color wheel.
+func (cf *colorFade) at(now time.Time) lifxpayloads.LightHSBK {
+	return *lifxpayloads.Interpolate(&cf.from, &cf.to, cf.progress(now), lifxpayloads.ColorSpaceHSB)
+}
+
+// powerFade is a transition from one power level to another, caused by a
+// LightSetPower message with a duration.
+type powerFade struct {
+	fade
+	from uint16
+	to   uint16
+}
+
+// at returns the power level at the time.
+func (pf *powerFade) at(now time.Time) uint16 {
+	t := pf.progress(now)
+
+	return uint16(math.Floor(float64(pf.from) + (float64(pf.to)-float64(pf.from))*t + 0.5))
+}
+
+// waveform is a waveform effect, caused by a LightSetWaveform message.
+type waveform struct {
+	fade
+	from  lifxpayloads.LightHSBK
+	msg   lifxpayloads.LightSetWaveform
+	color lifxpayloads.LightHSBK
+}
+
+func newWaveform(now time.Time, from lifxpayloads.LightHSBK, msg *lifxpayloads.LightSetWaveform) *waveform {
+	wf := &waveform{
+		fade:  fade{start: now, duration: time.Duration(float64(msg.Period) * float64(msg.Cycles))},
+		from:  from,
+		msg:   *msg,
+		color: *msg.Color,
+	}
+
+	wf.msg.Color = &wf.color
+
+	return wf
+}
+
+// final returns the color the light is left at once the effect finishes.
+func (wf *waveform) final() lifxpayloads.LightHSBK {
+	if wf.msg.Transient {
+		return wf.from
+	}
+
+	return wf.color
+}
+
+// at returns the color at the time.
+func (wf *waveform) at(now time.Time) lifxpayloads.LightHSBK {
+	elapsed := now.Sub(wf.start)
+
+	if elapsed >= wf.duration || wf.msg.Period <= 0 {
+		return wf.final()
+	}
+
+	if elapsed < 0 {
+		return wf.from
+	}
+
+	// the position within the current cycle, from 0 to 1
+	t := math.Mod(float64(elapsed), float64(wf.msg.Period)) / float64(wf.msg.Period)
+
+	return *lifxpayloads.Interpolate(&wf.from, &wf.color, waveformValue(wf.msg.Waveform, t, wf.msg.SkewRatio), lifxpayloads.ColorSpaceHSB)
+}
+
+// waveformValue returns how far from the original color (0) to the waveform
+// color (1) the light is at the position t (0-1) within a cycle.
+func waveformValue(w lifxpayloads.Waveform, t float64, skewRatio int16) float64 {
+	switch w {
+	case lifxpayloads.WaveformSine:
+		return (1 - math.Cos(2*math.Pi*t)) / 2
+	case lifxpayloads.WaveformHalfSine:
+		return math.Sin(math.Pi * t / 2)
+	case lifxpayloads.WaveformTriangle:
+		if t < 0.5 {
+			return 2 * t
+		}
+
+		return 2 - 2*t
+	case lifxpayloads.WaveformPulse:
+		// the skew ratio is the fraction of the cycle spent at the
+		// original color, scaled to an int16
+		if t < (float64(skewRatio)+32768)/65535 {
+			return 0
+		}
+
+		return 1
+	default:
+		// WaveformSaw, and anything unknown
+		return t
+	}
+}
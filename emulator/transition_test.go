@@ -0,0 +1,167 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxemulator
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol/payloads"
+	"github.com/theckman/go-lifx/util"
+
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) Test_waveformValue(c *C) {
+	tests := []struct {
+		waveform lifxpayloads.Waveform
+		values   [5]float64 // at 0, 0.25, 0.5, 0.75, and 0.99
+	}{
+		{lifxpayloads.WaveformSaw, [5]float64{0, 0.25, 0.5, 0.75, 0.99}},
+		{lifxpayloads.WaveformSine, [5]float64{0, 0.5, 1, 0.5, 0.00099}},
+		{lifxpayloads.WaveformHalfSine, [5]float64{0, 0.3827, 0.7071, 0.9239, 0.99988}},
+		{lifxpayloads.WaveformTriangle, [5]float64{0, 0.5, 1, 0.5, 0.02}},
+		// a skew ratio of 0 is just over half of the cycle
+		{lifxpayloads.WaveformPulse, [5]float64{0, 0, 0, 1, 1}},
+	}
+
+	for _, test := range tests {
+		for i, t := range []float64{0, 0.25, 0.5, 0.75, 0.99} {
+			v := waveformValue(test.waveform, t, 0)
+			c.Check(math.Abs(v-test.values[i]) < 0.0001, Equals, true, Commentf("%s at %g: %g", test.waveform, t, v))
+		}
+	}
+
+	// a skew ratio of 32767 spends the whole cycle at the original color
+	c.Check(waveformValue(lifxpayloads.WaveformPulse, 0.9, 32767), Equals, float64(0))
+	c.Check(waveformValue(lifxpayloads.WaveformPulse, 0.1, -32768), Equals, float64(1))
+}
+
+func (*TestSuite) TestDevice_Transitions(c *C) {
+	clock := lifxutil.NewManualClock(time.Unix(1456790400, 0))
+
+	device, err := NewDevice(&Config{Clock: clock})
+	c.Assert(err, IsNil)
+	defer device.Close()
+
+	client := newTestClient(c, nil)
+	defer client.Close()
+
+	light := client.Light(device.HardwareAddr(), device.Addr())
+	ctx := context.Background()
+
+	//
+	// Test that the power level fades over the duration
+	//
+	c.Assert(light.SetPower(ctx, true, 4*time.Second), IsNil)
+
+	state, err := light.State(ctx)
+	c.Assert(err, IsNil)
+	c.Check(state.Power, Equals, uint16(0))
+
+	clock.Advance(time.Second)
+
+	state, err = light.State(ctx)
+	c.Assert(err, IsNil)
+	c.Check(state.Power, Equals, uint16(16384))
+
+	clock.Advance(3 * time.Second)
+
+	on, err := light.Power(ctx)
+	c.Assert(err, IsNil)
+	c.Check(on, Equals, true)
+	c.Check(device.State().Power, Equals, uint16(65535))
+
+	//
+	// Test that the color fades over the duration, with the hue taking the
+	// shortest path
+	//
+	red := lifxpayloads.LightHSBK{Saturation: 65535, Brightness: 65535, Kelvin: 2500}
+	c.Assert(light.SetColor(ctx, red, 0), IsNil)
+
+	magenta := lifxpayloads.LightHSBK{Hue: 54613, Saturation: 65535, Brightness: 32767, Kelvin: 6500}
+	c.Assert(light.SetColor(ctx, magenta, 10*time.Second), IsNil)
+
+	clock.Advance(5 * time.Second)
+
+	color, err := light.Color(ctx)
+	c.Assert(err, IsNil)
+	c.Check(color.HueDegrees() > 329 && color.HueDegrees() < 331, Equals, true, Commentf("hue: %f", color.HueDegrees()))
+	c.Check(color.Brightness, Equals, uint16(49151))
+	c.Check(color.Kelvin, Equals, uint16(4500))
+
+	// a new color fades from wherever the light is now
+	c.Assert(light.SetColor(ctx, red, 5*time.Second), IsNil)
+
+	clock.Advance(time.Second)
+
+	color, err = light.Color(ctx)
+	c.Assert(err, IsNil)
+	c.Check(color.Kelvin, Equals, uint16(4100))
+
+	clock.Advance(4 * time.Second)
+
+	color, err = light.Color(ctx)
+	c.Assert(err, IsNil)
+	c.Check(color, Equals, red)
+
+	//
+	// Test the waveforms
+	//
+	blue := lifxpayloads.LightHSBK{Hue: 43690, Saturation: 65535, Brightness: 65535, Kelvin: 2500}
+
+	c.Assert(light.SetWaveform(ctx, &lifxpayloads.LightSetWaveform{
+		Transient: true,
+		Color:     &blue,
+		Period:    2 * time.Second,
+		Cycles:    2,
+		Waveform:  lifxpayloads.WaveformTriangle,
+	}), IsNil)
+
+	clock.Advance(time.Second)
+	c.Check(device.State().Color, Equals, blue)
+
+	clock.Advance(time.Second)
+	c.Check(device.State().Color, Equals, red)
+
+	clock.Advance(time.Second)
+	c.Check(device.State().Color, Equals, blue)
+
+	// a transient waveform goes back to the original color
+	clock.Advance(time.Second)
+	c.Check(device.State().Color, Equals, red)
+
+	c.Assert(light.SetWaveform(ctx, &lifxpayloads.LightSetWaveform{
+		Color:    &blue,
+		Period:   time.Second,
+		Cycles:   1,
+		Waveform: lifxpayloads.WaveformSaw,
+	}), IsNil)
+
+	clock.Advance(500 * time.Millisecond)
+
+	color, err = light.Color(ctx)
+	c.Assert(err, IsNil)
+	c.Check(color.HueDegrees() > 299 && color.HueDegrees() < 301, Equals, true, Commentf("hue: %f", color.HueDegrees()))
+
+	clock.Advance(500 * time.Millisecond)
+	c.Check(device.State().Color, Equals, blue)
+
+	//
+	// Test that Update stops the transitions where they are
+	//
+	c.Assert(light.SetColor(ctx, red, 10*time.Second), IsNil)
+	clock.Advance(5 * time.Second)
+
+	device.Update(func(s *State) {
+		c.Check(s.Color.HueDegrees() > 299 && s.Color.HueDegrees() < 301, Equals, true, Commentf("hue: %f", s.Color.HueDegrees()))
+	})
+
+	clock.Advance(5 * time.Second)
+
+	color = device.State().Color
+	c.Check(color.HueDegrees() > 299 && color.HueDegrees() < 301, Equals, true, Commentf("hue: %f", color.HueDegrees()))
+}
@@ -0,0 +1,167 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/protocol/payloads"
+)
+
+// Light is a LIFX light on the network. It provides the operations that are
+// supported by lights, in addition to the ones supported by all devices.
+type Light struct {
+	*Device
+}
+
+// Light returns a *Light for the light with the MAC address at the network
+// address.
+func (c *Client) Light(mac net.HardwareAddr, addr *net.UDPAddr) *Light {
+	return &Light{Device: c.Device(mac, addr)}
+}
+
+func (l *Light) String() string {
+	if l == nil || l.Device == nil {
+		return "<*lifx.Light(nil)>"
+	}
+
+	return fmt.Sprintf("<*lifx.Light(%p): HardwareAddr: %s, Addr: %s>", l, l.HardwareAddr, l.Addr)
+}
+
+// State returns the color, power level, and label of the light.
+func (l *Light) State(ctx context.Context) (*lifxpayloads.LightState, error) {
+	pc, err := l.get(ctx, lifxprotocol.LightGet, lifxprotocol.LightState)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ls, ok := pc.(*lifxpayloads.LightState)
+
+	if !ok {
+		return nil, unexpectedPayload(pc)
+	}
+
+	if ls.Color == nil {
+		return nil, errors.New("the light state did not include a color")
+	}
+
+	return ls, nil
+}
+
+// Color returns the current color of the light.
+func (l *Light) Color(ctx context.Context) (lifxpayloads.LightHSBK, error) {
+	ls, err := l.State(ctx)
+
+	if err != nil {
+		return lifxpayloads.LightHSBK{}, err
+	}
+
+	return *ls.Color, nil
+}
+
+// SetColor changes the color of the light, fading to it over the duration.
+func (l *Light) SetColor(ctx context.Context, hsbk lifxpayloads.LightHSBK, duration time.Duration) error {
+	return l.set(ctx, lifxprotocol.LightSetColor, &lifxpayloads.LightSetColor{Color: &hsbk, Duration: duration})
+}
+
+// SetHue changes the hue of the light to the number of degrees around the
+// color wheel, keeping its current saturation, brightness, and Kelvin values.
+func (l *Light) SetHue(ctx context.Context, degrees float64, duration time.Duration) error {
+	v, err := lifxpayloads.NewHSBK(degrees, 0, 0, lifxpayloads.MinKelvin)
+
+	if err != nil {
+		return err
+	}
+
+	return l.update(ctx, duration, func(hsbk *lifxpayloads.LightHSBK) { hsbk.Hue = v.Hue })
+}
+
+// SetSaturation changes the saturation of the light to the percentage
+// (0-100), keeping its current hue, brightness, and Kelvin values.
+func (l *Light) SetSaturation(ctx context.Context, percent float64, duration time.Duration) error {
+	v, err := lifxpayloads.NewHSBK(0, percent, 0, lifxpayloads.MinKelvin)
+
+	if err != nil {
+		return err
+	}
+
+	return l.update(ctx, duration, func(hsbk *lifxpayloads.LightHSBK) { hsbk.Saturation = v.Saturation })
+}
+
+// SetBrightness changes the brightness of the light to the percentage
+// (0-100), keeping its current hue, saturation, and Kelvin values.
+func (l *Light) SetBrightness(ctx context.Context, percent float64, duration time.Duration) error {
+	v, err := lifxpayloads.NewHSBK(0, 0, percent, lifxpayloads.MinKelvin)
+
+	if err != nil {
+		return err
+	}
+
+	return l.update(ctx, duration, func(hsbk *lifxpayloads.LightHSBK) { hsbk.Brightness = v.Brightness })
+}
+
+// SetKelvin changes the color temperature of the light, keeping its current
+// hue, saturation, and brightness values. The Kelvin value must be between
+// MinKelvin and MaxKelvin.
+func (l *Light) SetKelvin(ctx context.Context, kelvin uint16, duration time.Duration) error {
+	if kelvin < lifxpayloads.MinKelvin || kelvin > lifxpayloads.MaxKelvin {
+		return lifxpayloads.ErrKelvinRange
+	}
+
+	return l.update(ctx, duration, func(hsbk *lifxpayloads.LightHSBK) { hsbk.Kelvin = kelvin })
+}
+
+// update reads the current color of the light, and sets it to the color
+// after it's been modified by fn. This isn't atomic; a change made by someone
+// else between the two messages is overwritten.
+func (l *Light) update(ctx context.Context, duration time.Duration, fn func(*lifxpayloads.LightHSBK)) error {
+	hsbk, err := l.Color(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	fn(&hsbk)
+
+	return l.SetColor(ctx, hsbk, duration)
+}
+
+// Power returns whether the light is powered on.
+func (l *Light) Power(ctx context.Context) (bool, error) {
+	pc, err := l.get(ctx, lifxprotocol.LightGetPower, lifxprotocol.LightStatePower)
+
+	if err != nil {
+		return false, err
+	}
+
+	lsp, ok := pc.(*lifxpayloads.LightStatePower)
+
+	if !ok {
+		return false, unexpectedPayload(pc)
+	}
+
+	return lsp.Level != 0, nil
+}
+
+// SetPower powers the light on or off, fading it over the duration.
+func (l *Light) SetPower(ctx context.Context, on bool, duration time.Duration) error {
+	return l.set(ctx, lifxprotocol.LightSetPower, &lifxpayloads.LightSetPower{Level: powerLevel(on), Duration: duration})
+}
+
+// SetWaveform runs the waveform effect on the light. The call returns once
+// the light has acknowledged the message, and not when the effect finishes.
+func (l *Light) SetWaveform(ctx context.Context, waveform *lifxpayloads.LightSetWaveform) error {
+	if waveform == nil {
+		return errors.New("the waveform cannot be nil")
+	}
+
+	return l.set(ctx, lifxprotocol.LightSetWaveform, waveform)
+}
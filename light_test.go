@@ -0,0 +1,149 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/protocol/payloads"
+
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) TestLight_String(c *C) {
+	light := &Light{Device: &Device{HardwareAddr: net.HardwareAddr{1, 2, 3, 4, 5, 6}, Addr: &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 56700}}}
+	c.Check(light.String(), Equals, fmt.Sprintf("<*lifx.Light(%p): HardwareAddr: 01:02:03:04:05:06, Addr: 10.0.0.1:56700>", light))
+
+	light = nil
+	c.Check(light.String(), Equals, "<*lifx.Light(nil)>")
+}
+
+func (*TestSuite) TestLight_Color(c *C) {
+	fd := newFakeDevice(c)
+	defer fd.close()
+
+	client := newTestClient(c, nil)
+	defer client.Close()
+
+	light := client.Light(fd.mac, fd.addr())
+	ctx := context.Background()
+
+	state, err := light.State(ctx)
+	c.Assert(err, IsNil)
+	c.Check(state.Label, Equals, lifxpayloads.NewDeviceLabelTrunc([]byte("Kitchen")))
+
+	hsbk, err := light.Color(ctx)
+	c.Assert(err, IsNil)
+	c.Check(hsbk, Equals, lifxpayloads.LightHSBK{Hue: 21845, Saturation: 65535, Brightness: 32768, Kelvin: 3500})
+
+	red := lifxpayloads.LightHSBK{Saturation: 65535, Brightness: 65535, Kelvin: 2700}
+	c.Assert(light.SetColor(ctx, red, time.Second), IsNil)
+
+	hsbk, err = light.Color(ctx)
+	c.Assert(err, IsNil)
+	c.Check(hsbk, Equals, red)
+
+	packets := fd.packets()
+	c.Assert(packets, HasLen, 4)
+	c.Check(packets[2].Header.ProtocolHeader.Type, Equals, lifxprotocol.LightSetColor)
+	c.Check(packets[2].Header.FrameAddress.AckRequired, Equals, true)
+	c.Check(packets[2].Payload.(*lifxpayloads.LightSetColor).Duration, Equals, time.Second)
+}
+
+func (*TestSuite) TestLight_PartialUpdates(c *C) {
+	fd := newFakeDevice(c)
+	defer fd.close()
+
+	client := newTestClient(c, nil)
+	defer client.Close()
+
+	light := client.Light(fd.mac, fd.addr())
+	ctx := context.Background()
+
+	c.Assert(light.SetBrightness(ctx, 100, 0), IsNil)
+
+	hsbk, err := light.Color(ctx)
+	c.Assert(err, IsNil)
+	c.Check(hsbk, Equals, lifxpayloads.LightHSBK{Hue: 21845, Saturation: 65535, Brightness: 65535, Kelvin: 3500})
+
+	c.Assert(light.SetHue(ctx, 240, 0), IsNil)
+	c.Assert(light.SetSaturation(ctx, 50, 0), IsNil)
+	c.Assert(light.SetKelvin(ctx, 2500, 0), IsNil)
+
+	hsbk, err = light.Color(ctx)
+	c.Assert(err, IsNil)
+	c.Check(hsbk, Equals, lifxpayloads.LightHSBK{Hue: 43691, Saturation: 32768, Brightness: 65535, Kelvin: 2500})
+
+	// invalid values should be rejected without sending anything
+	n := len(fd.packets())
+
+	c.Check(light.SetBrightness(ctx, 101, 0), ErrorMatches, "the brightness must be a percentage between 0 and 100, got 101")
+	c.Check(light.SetSaturation(ctx, -1, 0), ErrorMatches, "the saturation must be a percentage between 0 and 100, got -1")
+	c.Check(light.SetKelvin(ctx, 1000, 0), Equals, lifxpayloads.ErrKelvinRange)
+	c.Check(fd.packets(), HasLen, n)
+}
+
+func (*TestSuite) TestLight_Power(c *C) {
+	fd := newFakeDevice(c)
+	defer fd.close()
+
+	client := newTestClient(c, nil)
+	defer client.Close()
+
+	light := client.Light(fd.mac, fd.addr())
+	ctx := context.Background()
+
+	on, err := light.Power(ctx)
+	c.Assert(err, IsNil)
+	c.Check(on, Equals, false)
+
+	c.Assert(light.SetPower(ctx, true, 0), IsNil)
+
+	on, err = light.Power(ctx)
+	c.Assert(err, IsNil)
+	c.Check(on, Equals, true)
+
+	packets := fd.packets()
+	c.Assert(packets, HasLen, 3)
+	c.Check(packets[0].Header.ProtocolHeader.Type, Equals, lifxprotocol.LightGetPower)
+	c.Check(packets[1].Header.ProtocolHeader.Type, Equals, lifxprotocol.LightSetPower)
+}
+
+func (*TestSuite) TestLight_SetWaveform(c *C) {
+	fd := newFakeDevice(c)
+	defer fd.close()
+
+	client := newTestClient(c, nil)
+	defer client.Close()
+
+	light := client.Light(fd.mac, fd.addr())
+	ctx := context.Background()
+
+	blue := &lifxpayloads.LightHSBK{Hue: 43690, Saturation: 65535, Brightness: 65535, Kelvin: 3500}
+
+	c.Assert(light.SetWaveform(ctx, &lifxpayloads.LightSetWaveform{
+		Transient: true,
+		Color:     blue,
+		Period:    time.Second,
+		Cycles:    3,
+		Waveform:  lifxpayloads.WaveformSine,
+	}), IsNil)
+
+	packets := fd.packets()
+	c.Assert(packets, HasLen, 1)
+	c.Check(packets[0].Header.ProtocolHeader.Type, Equals, lifxprotocol.LightSetWaveform)
+
+	lsw := packets[0].Payload.(*lifxpayloads.LightSetWaveform)
+	c.Check(*lsw.Color, Equals, *blue)
+	c.Check(lsw.Period, Equals, time.Second)
+	c.Check(lsw.Cycles, Equals, float32(3))
+	c.Check(lsw.Waveform, Equals, lifxpayloads.WaveformSine)
+
+	c.Check(light.SetWaveform(ctx, nil), ErrorMatches, "the waveform cannot be nil")
+}
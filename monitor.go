@@ -0,0 +1,413 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol"
+)
+
+const (
+	// DefaultMonitorInterval is the default amount of time between the
+	// health probes of a *Monitor.
+	DefaultMonitorInterval = 10 * time.Second
+
+	// DefaultDegradedAfter is the default number of consecutive failed
+	// probes before a device is considered degraded.
+	DefaultDegradedAfter = 1
+
+	// DefaultOfflineAfter is the default number of consecutive failed probes
+	// before a device is considered offline.
+	DefaultOfflineAfter = 3
+)
+
+// monitorEventBuffer is the number of events buffered by a *Monitor.
+const monitorEventBuffer = 64
+
+// echoTokenSize is the size of the random token sent in echo probes.
+const echoTokenSize = 16
+
+// ErrMonitorRunning is the error returned by Monitor.Run when the monitor is
+// already running, or has been run before.
+var ErrMonitorRunning = errors.New("the monitor has already been run")
+
+// Probe is the message a *Monitor uses to check that a device is reachable.
+type Probe uint8
+
+const (
+	// ProbeEcho sends a DeviceEchoRequest with a random payload, and
+	// expects the same payload back.
+	ProbeEcho Probe = iota
+
+	// ProbeGetService sends a DeviceGetService message, and expects a
+	// DeviceStateService response.
+	ProbeGetService
+)
+
+func (p Probe) String() string {
+	switch p {
+	case ProbeEcho:
+		return "Echo"
+	case ProbeGetService:
+		return "GetService"
+	default:
+		return fmt.Sprintf("Probe(%d)", uint8(p))
+	}
+}
+
+// Health is the reachability of a device, as determined by a *Monitor.
+type Health uint8
+
+const (
+	// HealthUnknown is the health of a device that hasn't been probed yet.
+	HealthUnknown Health = iota
+
+	// HealthOnline is the health of a device that's answering its probes.
+	HealthOnline
+
+	// HealthDegraded is the health of a device that's missed some probes,
+	// or is answering them slowly.
+	HealthDegraded
+
+	// HealthOffline is the health of a device that's missed enough probes
+	// in a row that it's considered gone.
+	HealthOffline
+)
+
+func (h Health) String() string {
+	switch h {
+	case HealthUnknown:
+		return "Unknown"
+	case HealthOnline:
+		return "Online"
+	case HealthDegraded:
+		return "Degraded"
+	case HealthOffline:
+		return "Offline"
+	default:
+		return fmt.Sprintf("Health(%d)", uint8(h))
+	}
+}
+
+// MonitorConfig is the configuration for a *Monitor. The zero value is
+// usable, and any fields that aren't set use their defaults.
+type MonitorConfig struct {
+	// Interval is the amount of time between probes. If 0,
+	// DefaultMonitorInterval is used.
+	Interval time.Duration
+
+	// Probe is the message used to probe the devices.
+	Probe Probe
+
+	// DegradedAfter is the number of consecutive failed probes before a
+	// device is degraded. If 0, DefaultDegradedAfter is used.
+	DegradedAfter int
+
+	// OfflineAfter is the number of consecutive failed probes before a
+	// device is offline. If 0, DefaultOfflineAfter is used.
+	OfflineAfter int
+
+	// DegradedRTT is the round-trip time above which a device answering its
+	// probes is considered degraded. If 0, the RTT doesn't affect the health.
+	DegradedRTT time.Duration
+}
+
+// DeviceHealth is the health of a single device, and the probe results that
+// it was determined from.
+type DeviceHealth struct {
+	Device *Device
+	Health Health
+
+	// RTT is the round-trip time of the last successful probe, including
+	// the time spent on any retries.
+	RTT time.Duration
+
+	// SmoothedRTT is an exponentially weighted moving average of the RTT,
+	// calculated the same way TCP does.
+	SmoothedRTT time.Duration
+
+	// ConsecutiveFailures is the number of probes that have failed since
+	// the last successful one.
+	ConsecutiveFailures int
+
+	// LastProbe is when the device was last probed, and LastSeen is when it
+	// last answered a probe.
+	LastProbe time.Time
+	LastSeen  time.Time
+
+	// LastError is the error from the last failed probe.
+	LastError error
+}
+
+// HealthEvent is sent by a *Monitor when the health of a device changes.
+type HealthEvent struct {
+	Previous Health
+	Current  Health
+	Time     time.Time
+	Status   DeviceHealth
+}
+
+func (he *HealthEvent) String() string {
+	if he == nil {
+		return "<*lifx.HealthEvent(nil)>"
+	}
+
+	return fmt.Sprintf(
+		"<*lifx.HealthEvent(%p): HardwareAddr: %s, Previous: %s, Current: %s, Time: %s>",
+		he, he.Status.Device.HardwareAddr, he.Previous, he.Current, he.Time,
+	)
+}
+
+// Monitor periodically probes a set of devices, and tracks whether they are
+// online, degraded, or offline.
+type Monitor struct {
+	client *Client
+	config MonitorConfig
+
+	mu      sync.Mutex
+	devices map[string]*DeviceHealth
+	running bool
+
+	events chan HealthEvent
+}
+
+// NewMonitor returns a *Monitor that uses the client to probe the devices.
+// The config can be nil to use the defaults.
+func NewMonitor(client *Client, config *MonitorConfig) *Monitor {
+	m := &Monitor{
+		client:  client,
+		devices: make(map[string]*DeviceHealth),
+		events:  make(chan HealthEvent, monitorEventBuffer),
+	}
+
+	if config != nil {
+		m.config = *config
+	}
+
+	if m.config.Interval <= 0 {
+		m.config.Interval = DefaultMonitorInterval
+	}
+
+	if m.config.DegradedAfter <= 0 {
+		m.config.DegradedAfter = DefaultDegradedAfter
+	}
+
+	if m.config.OfflineAfter <= 0 {
+		m.config.OfflineAfter = DefaultOfflineAfter
+	}
+
+	return m
+}
+
+// Add starts monitoring the device. Its health is HealthUnknown until it's
+// been probed. Adding a device that's already monitored does nothing.
+func (m *Monitor) Add(device *Device) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := device.HardwareAddr.String()
+
+	if _, ok := m.devices[key]; !ok {
+		m.devices[key] = &DeviceHealth{Device: device}
+	}
+}
+
+// Remove stops monitoring the device with the MAC address.
+func (m *Monitor) Remove(mac net.HardwareAddr) {
+	m.mu.Lock()
+	delete(m.devices, mac.String())
+	m.mu.Unlock()
+}
+
+// Events returns the channel the HealthEvents are sent on. It's closed when
+// Run returns. If the events aren't read quickly enough the buffer fills up,
+// and new events are dropped.
+func (m *Monitor) Events() <-chan HealthEvent {
+	return m.events
+}
+
+// Status returns the health of the device with the MAC address. The second
+// value is false if the device isn't monitored.
+func (m *Monitor) Status(mac net.HardwareAddr) (DeviceHealth, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dh, ok := m.devices[mac.String()]
+
+	if !ok {
+		return DeviceHealth{}, false
+	}
+
+	return *dh, true
+}
+
+// Statuses returns the health of all of the monitored devices, sorted by MAC
+// address.
+func (m *Monitor) Statuses() []DeviceHealth {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]DeviceHealth, 0, len(m.devices))
+
+	for _, dh := range m.devices {
+		statuses = append(statuses, *dh)
+	}
+
+	sort.Sort(byHealthHardwareAddr(statuses))
+
+	return statuses
+}
+
+type byHealthHardwareAddr []DeviceHealth
+
+func (b byHealthHardwareAddr) Len() int      { return len(b) }
+func (b byHealthHardwareAddr) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byHealthHardwareAddr) Less(i, j int) bool {
+	return bytes.Compare(b[i].Device.HardwareAddr, b[j].Device.HardwareAddr) < 0
+}
+
+// Run probes the devices immediately, and then once every interval, until
+// the context is done. It returns the context's error. A *Monitor can only be
+// run once; its events channel is closed when Run returns.
+func (m *Monitor) Run(ctx context.Context) error {
+	m.mu.Lock()
+
+	if m.running {
+		m.mu.Unlock()
+		return ErrMonitorRunning
+	}
+
+	m.running = true
+	m.mu.Unlock()
+
+	defer close(m.events)
+
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		m.probeAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// probeAll probes all of the devices concurrently, and waits for them to
+// finish. Each probe is given one interval to complete.
+func (m *Monitor) probeAll(ctx context.Context) {
+	m.mu.Lock()
+
+	devices := make([]*Device, 0, len(m.devices))
+
+	for _, dh := range m.devices {
+		devices = append(devices, dh.Device)
+	}
+
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, m.config.Interval)
+	defer cancel()
+
+	forEach(ctx, devices, func(ctx context.Context, device *Device) error {
+		start := time.Now()
+		err := m.probe(ctx, device)
+		rtt := time.Since(start)
+
+		// a probe cut short by the parent context isn't the device's fault
+		if err != nil && ctx.Err() == context.Canceled {
+			return err
+		}
+
+		m.record(device, start, rtt, err)
+
+		return err
+	})
+}
+
+// probe sends the configured probe to the device.
+func (m *Monitor) probe(ctx context.Context, device *Device) error {
+	if m.config.Probe == ProbeGetService {
+		_, err := device.get(ctx, lifxprotocol.DeviceGetService, lifxprotocol.DeviceStateService)
+		return err
+	}
+
+	token := make([]byte, echoTokenSize)
+
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+
+	_, err := device.Echo(ctx, token)
+
+	return err
+}
+
+// record updates the health of the device from the result of a probe, and
+// sends an event if it changed.
+func (m *Monitor) record(device *Device, start time.Time, rtt time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dh, ok := m.devices[device.HardwareAddr.String()]
+
+	// the device was removed while it was being probed
+	if !ok || dh.Device != device {
+		return
+	}
+
+	prev := dh.Health
+	dh.LastProbe = start
+
+	if err != nil {
+		dh.ConsecutiveFailures++
+		dh.LastError = err
+
+		switch {
+		case dh.ConsecutiveFailures >= m.config.OfflineAfter:
+			dh.Health = HealthOffline
+		case dh.ConsecutiveFailures >= m.config.DegradedAfter:
+			dh.Health = HealthDegraded
+		}
+	} else {
+		dh.ConsecutiveFailures = 0
+		dh.LastError = nil
+		dh.LastSeen = start.Add(rtt)
+		dh.RTT = rtt
+
+		if dh.SmoothedRTT == 0 {
+			dh.SmoothedRTT = rtt
+		} else {
+			dh.SmoothedRTT = (7*dh.SmoothedRTT + rtt) / 8
+		}
+
+		if m.config.DegradedRTT > 0 && rtt > m.config.DegradedRTT {
+			dh.Health = HealthDegraded
+		} else {
+			dh.Health = HealthOnline
+		}
+	}
+
+	if dh.Health == prev {
+		return
+	}
+
+	select {
+	case m.events <- HealthEvent{Previous: prev, Current: dh.Health, Time: start.Add(rtt), Status: *dh}:
+	default:
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"context"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/protocol/payloads"
+
+	. "gopkg.in/check.v1"
+)
+
+// nextHealthEvent returns the next event from the monitor, failing the test
+// if one doesn't arrive quickly.
+func nextHealthEvent(c *C, m *Monitor) HealthEvent {
+	select {
+	case event, ok := <-m.Events():
+		c.Assert(ok, Equals, true)
+		return event
+	case <-time.After(time.Second):
+		c.Fatal("timed out waiting for a health event")
+		return HealthEvent{}
+	}
+}
+
+func (*TestSuite) TestHealth_String(c *C) {
+	c.Check(HealthUnknown.String(), Equals, "Unknown")
+	c.Check(HealthOnline.String(), Equals, "Online")
+	c.Check(HealthDegraded.String(), Equals, "Degraded")
+	c.Check(HealthOffline.String(), Equals, "Offline")
+	c.Check(Health(42).String(), Equals, "Health(42)")
+
+	c.Check(ProbeEcho.String(), Equals, "Echo")
+	c.Check(ProbeGetService.String(), Equals, "GetService")
+	c.Check(Probe(42).String(), Equals, "Probe(42)")
+}
+
+func (*TestSuite) TestNewMonitor(c *C) {
+	m := NewMonitor(nil, nil)
+	c.Check(m.config.Interval, Equals, DefaultMonitorInterval)
+	c.Check(m.config.DegradedAfter, Equals, DefaultDegradedAfter)
+	c.Check(m.config.OfflineAfter, Equals, DefaultOfflineAfter)
+	c.Check(m.config.Probe, Equals, ProbeEcho)
+
+	m = NewMonitor(nil, &MonitorConfig{Interval: time.Second, DegradedAfter: 2, OfflineAfter: 5, Probe: ProbeGetService})
+	c.Check(m.config.Interval, Equals, time.Second)
+	c.Check(m.config.DegradedAfter, Equals, 2)
+	c.Check(m.config.OfflineAfter, Equals, 5)
+	c.Check(m.config.Probe, Equals, ProbeGetService)
+}
+
+func (*TestSuite) TestMonitor(c *C) {
+	fd := newFakeDevice(c)
+	defer fd.close()
+
+	client := newTestClient(c, &Config{Timeout: 20 * time.Millisecond, Retries: -1})
+	defer client.Close()
+
+	device := client.Device(fd.mac, fd.addr())
+
+	m := NewMonitor(client, &MonitorConfig{Interval: 50 * time.Millisecond, OfflineAfter: 2})
+	m.Add(device)
+	m.Add(client.Device(fd.mac, fd.addr()))
+
+	status, ok := m.Status(fd.mac)
+	c.Assert(ok, Equals, true)
+	c.Check(status.Health, Equals, HealthUnknown)
+	c.Check(status.Device, Equals, device)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+
+	go func() { errs <- m.Run(ctx) }()
+
+	event := nextHealthEvent(c, m)
+	c.Check(event.Previous, Equals, HealthUnknown)
+	c.Check(event.Current, Equals, HealthOnline)
+	c.Check(event.Status.RTT > 0, Equals, true)
+	c.Check(event.Status.SmoothedRTT > 0, Equals, true)
+	c.Check(event.Status.LastSeen.IsZero(), Equals, false)
+
+	// the echo probes should use a random payload
+	packets := fd.packets()
+	c.Assert(len(packets) > 0, Equals, true)
+	c.Check(packets[0].Header.ProtocolHeader.Type, Equals, lifxprotocol.DeviceEchoRequest)
+	c.Check(packets[0].Payload.(*lifxpayloads.DeviceEcho).Payload, Not(Equals), lifxpayloads.DeviceEchoPayload{})
+
+	//
+	// Test that missed probes degrade the device, and then take it offline
+	//
+	fd.mu.Lock()
+	fd.drop = 1000
+	fd.mu.Unlock()
+
+	event = nextHealthEvent(c, m)
+	c.Check(event.Previous, Equals, HealthOnline)
+	c.Check(event.Current, Equals, HealthDegraded)
+	c.Check(event.Status.ConsecutiveFailures, Equals, 1)
+	c.Check(event.Status.LastError, Equals, ErrTimeout)
+
+	event = nextHealthEvent(c, m)
+	c.Check(event.Current, Equals, HealthOffline)
+	c.Check(event.Status.ConsecutiveFailures, Equals, 2)
+
+	status, _ = m.Status(fd.mac)
+	c.Check(status.Health, Equals, HealthOffline)
+
+	fd.mu.Lock()
+	fd.drop = 0
+	fd.mu.Unlock()
+
+	event = nextHealthEvent(c, m)
+	c.Check(event.Previous, Equals, HealthOffline)
+	c.Check(event.Current, Equals, HealthOnline)
+	c.Check(event.Status.ConsecutiveFailures, Equals, 0)
+	c.Check(event.Status.LastError, IsNil)
+
+	statuses := m.Statuses()
+	c.Assert(statuses, HasLen, 1)
+	c.Check(statuses[0].Health, Equals, HealthOnline)
+
+	cancel()
+	c.Check(<-errs, Equals, context.Canceled)
+
+	// the channel should be closed once Run returns
+	for range m.Events() {
+	}
+
+	c.Check(m.Run(context.Background()), Equals, ErrMonitorRunning)
+
+	m.Remove(fd.mac)
+	_, ok = m.Status(fd.mac)
+	c.Check(ok, Equals, false)
+}
+
+func (*TestSuite) TestMonitor_GetServiceAndRTT(c *C) {
+	fd := newFakeDevice(c)
+	defer fd.close()
+
+	client := newTestClient(c, nil)
+	defer client.Close()
+
+	// every probe is slower than a nanosecond, so the device is degraded
+	m := NewMonitor(client, &MonitorConfig{Interval: time.Hour, Probe: ProbeGetService, DegradedRTT: time.Nanosecond})
+	m.Add(client.Device(fd.mac, fd.addr()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+
+	go func() { errs <- m.Run(ctx) }()
+
+	event := nextHealthEvent(c, m)
+	c.Check(event.Current, Equals, HealthDegraded)
+	c.Check(event.Status.ConsecutiveFailures, Equals, 0)
+
+	cancel()
+	c.Check(<-errs, Equals, context.Canceled)
+
+	packets := fd.packets()
+	c.Assert(packets, HasLen, 1)
+	c.Check(packets[0].Header.ProtocolHeader.Type, Equals, lifxprotocol.DeviceGetService)
+}
@@ -0,0 +1,581 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxprotocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol/payloads"
+)
+
+// dissectIndent is the indentation used for each level of the dissector tree.
+const dissectIndent = "    "
+
+// hexDumpWidth is the number of bytes rendered on each line of a hex dump.
+const hexDumpWidth = 8
+
+// dissectField is a single node within the dissector tree. The size is the
+// number of bytes the field occupies on the wire. Bitfields that share bytes
+// with their parent have a size of zero, and are only rendered in the tree.
+type dissectField struct {
+	name   string
+	value  string
+	size   int
+	fields []dissectField
+}
+
+// Dissect renders the packet as a human-readable tree, similar to what a
+// packet dissector like Wireshark would display. Every header field is
+// included, as well as each decoded payload field rendered in human units
+// (degrees of hue, percentages, Kelvin, durations, timestamps). Unlike the
+// String() method, the output contains no pointer addresses so it's stable
+// between runs and safe to use in logs.
+func Dissect(p *Packet) string {
+	if p == nil {
+		return "LIFX Packet: <nil>"
+	}
+
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "LIFX Packet: %s", dissectPacketType(p))
+
+	writeDissectTree(buf, dissectPacket(p), 1)
+
+	return buf.String()
+}
+
+// DissectHex renders an annotated hex dump of the packet. The packet is
+// marshaled using the provided byte order, and each field is printed with its
+// offset within the packet, the raw bytes, and the decoded value.
+//
+// Unlike Packet.MarshalPacket, this does not modify the Frame.Size field of the
+// packet. The value within the header is rendered as-is.
+func DissectHex(p *Packet, order binary.ByteOrder) (string, error) {
+	if p == nil || p.Header == nil {
+		return "", errors.New("the Header field cannot be nil")
+	}
+
+	if p.Payload == nil {
+		return "", errors.New("the Payload field cannot be nil")
+	}
+
+	header, err := p.Header.MarshalPacket(order)
+
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := p.Payload.MarshalPacket(order)
+
+	if err != nil {
+		return "", err
+	}
+
+	data := make([]byte, 0, len(header)+len(payload))
+	data = append(data, header...)
+	data = append(data, payload...)
+
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "LIFX Packet: %s, %d bytes", dissectPacketType(p), len(data))
+
+	offset := writeHexDump(buf, data, 0, "", dissectPacket(p))
+
+	// anything left over wasn't described by the dissector, so render it
+	// as opaque data instead of silently dropping it
+	if offset < len(data) {
+		writeHexLine(buf, data[offset:], offset, "Payload.Data", fmt.Sprintf("%d bytes", len(data)-offset))
+	}
+
+	return buf.String(), nil
+}
+
+// Format is a function that satisfies the fmt.Formatter interface. The %+v
+// verb renders the packet using Dissect, and the %x verb renders an
+// annotated hex dump of the little-endian packet using DissectHex. All other
+// verbs render the value returned from String().
+func (p *Packet) Format(f fmt.State, verb rune) {
+	switch {
+	case verb == 'v' && f.Flag('+'):
+		io.WriteString(f, Dissect(p))
+
+	case verb == 'x':
+		dump, err := DissectHex(p, binary.LittleEndian)
+
+		if err != nil {
+			fmt.Fprintf(f, "%%!x(%s)", err)
+			return
+		}
+
+		io.WriteString(f, dump)
+
+	default:
+		io.WriteString(f, p.String())
+	}
+}
+
+func dissectPacketType(p *Packet) string {
+	if p.Header == nil || p.Header.ProtocolHeader == nil {
+		return "<unknown>"
+	}
+
+	return dissectTypeName(p.Header.ProtocolHeader.Type)
+}
+
+func dissectTypeName(t uint16) string {
+	return fmt.Sprintf("%s (%d)", TypeName(t), t)
+}
+
+func dissectPacket(p *Packet) []dissectField {
+	var fields []dissectField
+
+	if p.Header == nil {
+		fields = append(fields, dissectField{name: "Header", value: "<nil>"})
+	} else {
+		fields = append(fields,
+			dissectFrame(p.Header.Frame),
+			dissectFrameAddress(p.Header.FrameAddress),
+			dissectProtocolHeader(p.Header.ProtocolHeader),
+		)
+	}
+
+	return append(fields, dissectPayload(p.Payload))
+}
+
+func dissectFrame(frame *Frame) dissectField {
+	if frame == nil {
+		return dissectField{name: "Frame", value: "<nil>"}
+	}
+
+	mid := uint64(frame.Origin)<<14 | uint64(frame.Protocol<<4>>4)
+
+	if frame.Tagged {
+		mid = mid | (1 << 13)
+	}
+
+	if frame.Addressable {
+		mid = mid | (1 << 12)
+	}
+
+	return dissectField{
+		name: "Frame",
+		fields: []dissectField{
+			{name: "Size", value: fmt.Sprintf("%d bytes", frame.Size), size: 2},
+			{
+				name:  "Flags",
+				value: fmt.Sprintf("0x%04x", uint16(mid)),
+				size:  2,
+				fields: []dissectField{
+					{name: bitmask(mid, 16, 0, 2) + " = Origin", value: strconv.Itoa(int(frame.Origin))},
+					{name: bitmask(mid, 16, 2, 1) + " = Tagged", value: strconv.FormatBool(frame.Tagged)},
+					{name: bitmask(mid, 16, 3, 1) + " = Addressable", value: strconv.FormatBool(frame.Addressable)},
+					{name: bitmask(mid, 16, 4, 12) + " = Protocol", value: strconv.Itoa(int(frame.Protocol))},
+				},
+			},
+			{name: "Source", value: fmt.Sprintf("0x%08x", frame.Source), size: 4},
+		},
+	}
+}
+
+func dissectFrameAddress(fra *FrameAddress) dissectField {
+	if fra == nil {
+		return dissectField{name: "Frame Address", value: "<nil>"}
+	}
+
+	target := fra.Target
+
+	if len(target) < 6 {
+		target = make([]byte, 6)
+	}
+
+	targetStr := target[:6].String()
+
+	if bytes.Equal(target[:6], make([]byte, 6)) {
+		targetStr += " (all devices)"
+	}
+
+	var ack, res uint64
+
+	if fra.AckRequired {
+		ack = 1
+	}
+
+	if fra.ResRequired {
+		res = 1
+	}
+
+	flags := uint64(fra.Reserved)<<2 | ack<<1 | res
+
+	return dissectField{
+		name: "Frame Address",
+		fields: []dissectField{
+			{name: "Target", value: targetStr, size: 8},
+			{name: "Reserved Block", value: hex.EncodeToString(fra.ReservedBlock[:]), size: 6},
+			{
+				name:  "Flags",
+				value: fmt.Sprintf("0x%02x", uint8(flags)),
+				size:  1,
+				fields: []dissectField{
+					{name: bitmask(flags, 8, 0, 6) + " = Reserved", value: strconv.Itoa(int(fra.Reserved))},
+					{name: bitmask(flags, 8, 6, 1) + " = Ack Required", value: strconv.FormatBool(fra.AckRequired)},
+					{name: bitmask(flags, 8, 7, 1) + " = Res Required", value: strconv.FormatBool(fra.ResRequired)},
+				},
+			},
+			{name: "Sequence", value: strconv.Itoa(int(fra.Sequence)), size: 1},
+		},
+	}
+}
+
+func dissectProtocolHeader(ph *ProtocolHeader) dissectField {
+	if ph == nil {
+		return dissectField{name: "Protocol Header", value: "<nil>"}
+	}
+
+	return dissectField{
+		name: "Protocol Header",
+		fields: []dissectField{
+			{name: "Reserved", value: strconv.FormatUint(ph.Reserved, 10), size: 8},
+			{name: "Type", value: dissectTypeName(ph.Type), size: 2},
+			{name: "Reserved End", value: strconv.Itoa(int(ph.ReservedEnd)), size: 2},
+		},
+	}
+}
+
+func dissectPayload(pc PacketComponent) dissectField {
+	var fields []dissectField
+	var name string
+
+	switch pl := pc.(type) {
+	case nil:
+		return dissectField{name: "Payload", value: "<nil>"}
+
+	case *lifxpayloads.Empty:
+		name = "Empty"
+
+	case *lifxpayloads.DeviceStateService:
+		name = "DeviceStateService"
+
+		var service string
+
+		if pl.Service == 1 {
+			service = " (UDP)"
+		}
+
+		fields = []dissectField{
+			{name: "Service", value: strconv.Itoa(int(pl.Service)) + service, size: 1},
+			{name: "Port", value: strconv.FormatUint(uint64(pl.Port), 10), size: 4},
+		}
+
+	case *lifxpayloads.DeviceStateHostInfo:
+		name = "DeviceStateHostInfo"
+		fields = dissectSignalInfo(pl.Signal, pl.Tx, pl.Rx, pl.Reserved)
+
+	case *lifxpayloads.DeviceStateWifiInfo:
+		name = "DeviceStateWifiInfo"
+		fields = dissectSignalInfo(pl.Signal, pl.Tx, pl.Rx, pl.Reserved)
+
+	case *lifxpayloads.DeviceStateHostFirmware:
+		name = "DeviceStateHostFirmware"
+		fields = dissectFirmware(pl.Build, pl.Reserved, pl.Version)
+
+	case *lifxpayloads.DeviceStateWifiFirmware:
+		name = "DeviceStateWifiFirmware"
+		fields = dissectFirmware(pl.Build, pl.Reserved, pl.Version)
+
+	case *lifxpayloads.DeviceStatePower:
+		name = "DeviceStatePower"
+		fields = []dissectField{dissectPowerLevel("Level", pl.Level)}
+
+	case *lifxpayloads.DeviceStateLabel:
+		name = "DeviceStateLabel"
+		fields = []dissectField{dissectLabel(pl.Label)}
+
+	case *lifxpayloads.DeviceStateVersion:
+		name = "DeviceStateVersion"
+		fields = []dissectField{
+			{name: "Vendor", value: strconv.FormatUint(uint64(pl.Vendor), 10), size: 4},
+			{name: "Product", value: strconv.FormatUint(uint64(pl.Product), 10), size: 4},
+			{name: "Version", value: strconv.FormatUint(uint64(pl.Version), 10), size: 4},
+		}
+
+	case *lifxpayloads.DeviceStateInfo:
+		name = "DeviceStateInfo"
+		fields = []dissectField{
+			dissectTimestamp("Time", pl.Time),
+			{name: "Uptime", value: time.Duration(pl.Uptime).String(), size: 8},
+			{name: "Downtime", value: time.Duration(pl.Downtime).String(), size: 8},
+		}
+
+	case *lifxpayloads.DeviceStateLocation:
+		name = "DeviceStateLocation"
+		fields = []dissectField{
+			{name: "Location", value: hex.EncodeToString(pl.Location[:]), size: 16},
+			dissectLabel(pl.Label),
+			dissectTimestamp("Updated At", pl.UpdatedAt),
+		}
+
+	case *lifxpayloads.DeviceStateGroup:
+		name = "DeviceStateGroup"
+		fields = []dissectField{
+			{name: "Group", value: hex.EncodeToString(pl.Group[:]), size: 16},
+			dissectLabel(pl.Label),
+			dissectTimestamp("Updated At", pl.UpdatedAt),
+		}
+
+	case *lifxpayloads.DeviceEcho:
+		name = "DeviceEcho"
+		fields = []dissectField{
+			{name: "Payload", value: strconv.Quote(string(bytes.TrimRight(pl.Payload[:], "\x00"))), size: len(pl.Payload)},
+		}
+
+	case *lifxpayloads.LightSetColor:
+		name = "LightSetColor"
+		fields = []dissectField{
+			{name: "Reserved", value: strconv.Itoa(int(pl.Reserved)), size: 1},
+			dissectHSBK(pl.Color),
+			dissectDuration(pl.Duration),
+		}
+
+	case *lifxpayloads.LightSetWaveform:
+		name = "LightSetWaveform"
+
+		var transient uint8
+
+		if pl.Transient {
+			transient = 1
+		}
+
+		fields = []dissectField{
+			{name: "Reserved", value: strconv.Itoa(int(pl.Reserved)), size: 1},
+			{name: "Transient", value: fmt.Sprintf("%d (%t)", transient, pl.Transient), size: 1},
+			dissectHSBK(pl.Color),
+			{name: "Period", value: fmt.Sprintf("%s (%d ms)", pl.Period, pl.Period/time.Millisecond), size: 4},
+			{name: "Cycles", value: strconv.FormatFloat(float64(pl.Cycles), 'g', -1, 32), size: 4},
+			{name: "Skew Ratio", value: fmt.Sprintf("%d (%.2f)", pl.SkewRatio, (float64(pl.SkewRatio)+32768)/65535), size: 2},
+			{name: "Waveform", value: fmt.Sprintf("%d (%s)", uint8(pl.Waveform), pl.Waveform), size: 1},
+		}
+
+	case *lifxpayloads.LightState:
+		name = "LightState"
+		fields = []dissectField{
+			dissectHSBK(pl.Color),
+			{name: "Reserved", value: strconv.Itoa(int(pl.Reserved)), size: 2},
+			dissectPowerLevel("Power", pl.Power),
+			dissectLabel(pl.Label),
+			{name: "Reserved B", value: strconv.FormatUint(pl.ReservedB, 10), size: 8},
+		}
+
+	case *lifxpayloads.LightSetPower:
+		name = "LightSetPower"
+		fields = []dissectField{
+			dissectPowerLevel("Level", pl.Level),
+			dissectDuration(pl.Duration),
+		}
+
+	case *lifxpayloads.LightStatePower:
+		name = "LightStatePower"
+		fields = []dissectField{dissectPowerLevel("Level", pl.Level)}
+
+	default:
+		// the payload is opaque to us, so the hex dump
+		// renders it as a single block of data
+		return dissectField{name: "Payload", value: fmt.Sprintf("%T", pc)}
+	}
+
+	return dissectField{name: "Payload", value: name, fields: fields}
+}
+
+func dissectSignalInfo(signal float32, tx, rx uint32, reserved int16) []dissectField {
+	return []dissectField{
+		{name: "Signal", value: strconv.FormatFloat(float64(signal), 'g', -1, 32) + " mW", size: 4},
+		{name: "Tx", value: strconv.FormatUint(uint64(tx), 10) + " bytes", size: 4},
+		{name: "Rx", value: strconv.FormatUint(uint64(rx), 10) + " bytes", size: 4},
+		{name: "Reserved", value: strconv.Itoa(int(reserved)), size: 2},
+	}
+}
+
+func dissectFirmware(build, reserved uint64, version uint32) []dissectField {
+	return []dissectField{
+		dissectTimestamp("Build", build),
+		{name: "Reserved", value: strconv.FormatUint(reserved, 10), size: 8},
+		{name: "Version", value: fmt.Sprintf("%d (%d.%d)", version, version>>16, version&0xffff), size: 4},
+	}
+}
+
+func dissectTimestamp(name string, nanoseconds uint64) dissectField {
+	if nanoseconds == 0 {
+		return dissectField{name: name, value: "0 (not set)", size: 8}
+	}
+
+	ts := time.Unix(0, int64(nanoseconds)).UTC()
+
+	return dissectField{name: name, value: ts.Format(time.RFC3339Nano), size: 8}
+}
+
+func dissectPowerLevel(name string, level uint16) dissectField {
+	var state string
+
+	switch level {
+	case 0:
+		state = " (off)"
+	case 65535:
+		state = " (on)"
+	}
+
+	return dissectField{name: name, value: strconv.Itoa(int(level)) + state, size: 2}
+}
+
+func dissectLabel(label lifxpayloads.DeviceLabel) dissectField {
+	return dissectField{
+		name:  "Label",
+		value: strconv.Quote(string(bytes.TrimRight(label[:], "\x00"))),
+		size:  len(label),
+	}
+}
+
+func dissectDuration(dur time.Duration) dissectField {
+	return dissectField{
+		name:  "Duration",
+		value: fmt.Sprintf("%s (%d ms)", dur, dur/time.Millisecond),
+		size:  4,
+	}
+}
+
+func dissectHSBK(hsbk *lifxpayloads.LightHSBK) dissectField {
+	if hsbk == nil {
+		return dissectField{name: "Color", value: "<nil>", size: 8}
+	}
+
+	hue := hsbk.HueDegrees()
+	sat := hsbk.SaturationPercent()
+	bri := hsbk.BrightnessPercent()
+
+	return dissectField{
+		name: "Color",
+		fields: []dissectField{
+			{name: "Hue", value: fmt.Sprintf("%d (%.2f°)", hsbk.Hue, hue), size: 2},
+			{name: "Saturation", value: fmt.Sprintf("%d (%.2f%%)", hsbk.Saturation, sat), size: 2},
+			{name: "Brightness", value: fmt.Sprintf("%d (%.2f%%)", hsbk.Brightness, bri), size: 2},
+			{name: "Kelvin", value: fmt.Sprintf("%d K", hsbk.Kelvin), size: 2},
+		},
+	}
+}
+
+// bitmask renders the bits of value in the style of a packet dissector. Only
+// the n bits starting at offset (counted from the most significant bit) are
+// rendered, with all other bits rendered as periods: "..1. .... .... ....".
+func bitmask(value uint64, width, offset, n int) string {
+	buf := &bytes.Buffer{}
+
+	for i := 0; i < width; i++ {
+		if i > 0 && i%4 == 0 {
+			buf.WriteByte(' ')
+		}
+
+		if i < offset || i >= offset+n {
+			buf.WriteByte('.')
+			continue
+		}
+
+		if value>>uint(width-i-1)&1 == 1 {
+			buf.WriteByte('1')
+		} else {
+			buf.WriteByte('0')
+		}
+	}
+
+	return buf.String()
+}
+
+func writeDissectTree(buf *bytes.Buffer, fields []dissectField, depth int) {
+	indent := strings.Repeat(dissectIndent, depth)
+
+	for _, field := range fields {
+		buf.WriteString("\n")
+		buf.WriteString(indent)
+		buf.WriteString(field.name)
+
+		if field.value != "" {
+			buf.WriteString(": ")
+			buf.WriteString(field.value)
+		}
+
+		writeDissectTree(buf, field.fields, depth+1)
+	}
+}
+
+// writeHexDump walks the dissector tree and writes a line to the buffer for
+// each field that occupies bytes on the wire. It returns the offset after the
+// last field it consumed.
+func writeHexDump(buf *bytes.Buffer, data []byte, offset int, prefix string, fields []dissectField) int {
+	for _, field := range fields {
+		name := prefix + strings.Replace(field.name, " ", "", -1)
+
+		if field.size == 0 {
+			offset = writeHexDump(buf, data, offset, name+".", field.fields)
+			continue
+		}
+
+		end := offset + field.size
+
+		if end > len(data) {
+			return offset
+		}
+
+		writeHexLine(buf, data[offset:end], offset, name, hexFieldValue(field))
+
+		offset = end
+	}
+
+	return offset
+}
+
+// hexFieldValue returns the annotation for a field in the hex dump. Bitfields
+// are flattened in to a single line since they share the same bytes.
+func hexFieldValue(field dissectField) string {
+	if len(field.fields) == 0 {
+		return field.value
+	}
+
+	bits := make([]string, 0, len(field.fields))
+
+	for _, bit := range field.fields {
+		name := bit.name[strings.Index(bit.name, "= ")+2:]
+		bits = append(bits, fmt.Sprintf("%s=%s", strings.Replace(name, " ", "", -1), bit.value))
+	}
+
+	return fmt.Sprintf("%s (%s)", field.value, strings.Join(bits, " "))
+}
+
+func writeHexLine(buf *bytes.Buffer, data []byte, offset int, name, value string) {
+	for i := 0; i < len(data); i += hexDumpWidth {
+		end := i + hexDumpWidth
+
+		if end > len(data) {
+			end = len(data)
+		}
+
+		chunk := make([]string, 0, hexDumpWidth)
+
+		for _, b := range data[i:end] {
+			chunk = append(chunk, fmt.Sprintf("%02x", b))
+		}
+
+		// only annotate the first line of a multi-line field
+		if i == 0 {
+			fmt.Fprintf(buf, "\n%04x  %-23s  %s: %s", offset+i, strings.Join(chunk, " "), name, value)
+		} else {
+			fmt.Fprintf(buf, "\n%04x  %s", offset+i, strings.Join(chunk, " "))
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxprotocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol/payloads"
+
+	. "gopkg.in/check.v1"
+)
+
+func dissectTestPacket(c *C) *Packet {
+	hwaddr, err := net.ParseMAC("d0:73:d5:01:02:03")
+	c.Assert(err, IsNil)
+
+	return &Packet{
+		Header: &Header{
+			Frame: &Frame{
+				Size:        49,
+				Addressable: true,
+				Protocol:    1024,
+				Source:      42,
+			},
+			FrameAddress: &FrameAddress{
+				Target:      hwaddr,
+				AckRequired: true,
+				Sequence:    5,
+			},
+			ProtocolHeader: &ProtocolHeader{Type: LightSetColor},
+		},
+		Payload: &lifxpayloads.LightSetColor{
+			Color: &lifxpayloads.LightHSBK{
+				Hue:        21845,
+				Saturation: 65535,
+				Brightness: 32768,
+				Kelvin:     3500,
+			},
+			Duration: 1500 * time.Millisecond,
+		},
+	}
+}
+
+func (*TestSuite) Test_Dissect(c *C) {
+	var str string
+
+	exp := `LIFX Packet: LightSetColor (102)
+    Frame
+        Size: 49 bytes
+        Flags: 0x1400
+            00.. .... .... .... = Origin: 0
+            ..0. .... .... .... = Tagged: false
+            ...1 .... .... .... = Addressable: true
+            .... 0100 0000 0000 = Protocol: 1024
+        Source: 0x0000002a
+    Frame Address
+        Target: d0:73:d5:01:02:03
+        Reserved Block: 000000000000
+        Flags: 0x02
+            0000 00.. = Reserved: 0
+            .... ..1. = Ack Required: true
+            .... ...0 = Res Required: false
+        Sequence: 5
+    Protocol Header
+        Reserved: 0
+        Type: LightSetColor (102)
+        Reserved End: 0
+    Payload: LightSetColor
+        Reserved: 0
+        Color
+            Hue: 21845 (120.00°)
+            Saturation: 65535 (100.00%)
+            Brightness: 32768 (50.00%)
+            Kelvin: 3500 K
+        Duration: 1.5s (1500 ms)`
+
+	p := dissectTestPacket(c)
+
+	str = Dissect(p)
+	c.Check(str, Equals, exp)
+
+	// the output should be stable between calls
+	c.Check(Dissect(p), Equals, str)
+
+	//
+	// Test that nil values are rendered
+	//
+	c.Check(Dissect(nil), Equals, "LIFX Packet: <nil>")
+
+	str = Dissect(&Packet{})
+	c.Check(str, Equals, "LIFX Packet: <unknown>\n    Header: <nil>\n    Payload: <nil>")
+
+	//
+	// Test that human units are rendered for state payloads
+	//
+	label, err := lifxpayloads.NewDeviceLabel([]byte("kitchen"))
+	c.Assert(err, IsNil)
+
+	p = &Packet{
+		Header: &Header{
+			Frame:          &Frame{Tagged: true},
+			FrameAddress:   &FrameAddress{},
+			ProtocolHeader: &ProtocolHeader{Type: LightState},
+		},
+		Payload: &lifxpayloads.LightState{
+			Color: &lifxpayloads.LightHSBK{Kelvin: 2500},
+			Power: 65535,
+			Label: label,
+		},
+	}
+
+	str = Dissect(p)
+	c.Check(strings.Contains(str, "Target: 00:00:00:00:00:00 (all devices)\n"), Equals, true)
+	c.Check(strings.Contains(str, "Power: 65535 (on)\n"), Equals, true)
+	c.Check(strings.Contains(str, "Label: \"kitchen\"\n"), Equals, true)
+	c.Check(strings.Contains(str, "Kelvin: 2500 K\n"), Equals, true)
+
+	p.Header.ProtocolHeader.Type = DeviceStateInfo
+	p.Payload = &lifxpayloads.DeviceStateInfo{
+		Time:     1456790400000000000,
+		Uptime:   uint64(90 * time.Minute),
+		Downtime: 0,
+	}
+
+	str = Dissect(p)
+	c.Check(strings.HasSuffix(str, "    Payload: DeviceStateInfo\n        Time: 2016-03-01T00:00:00Z\n        Uptime: 1h30m0s\n        Downtime: 0s"), Equals, true)
+
+	p.Header.ProtocolHeader.Type = LightSetWaveform
+	p.Payload = &lifxpayloads.LightSetWaveform{
+		Transient: true,
+		Color:     &lifxpayloads.LightHSBK{Kelvin: 3500},
+		Period:    time.Second,
+		Cycles:    5,
+		Waveform:  lifxpayloads.WaveformPulse,
+	}
+
+	str = Dissect(p)
+	c.Check(strings.Contains(str, "Period: 1s (1000 ms)\n"), Equals, true)
+	c.Check(strings.Contains(str, "Waveform: 4 (pulse)"), Equals, true)
+}
+
+func (t *TestSuite) Test_DissectHex(c *C) {
+	var str string
+	var err error
+
+	exp := `LIFX Packet: LightSetColor (102), 49 bytes
+0000  31 00                    Frame.Size: 49 bytes
+0002  00 14                    Frame.Flags: 0x1400 (Origin=0 Tagged=false Addressable=true Protocol=1024)
+0004  2a 00 00 00              Frame.Source: 0x0000002a
+0008  00 80 01 81 80 ea 39 68  FrameAddress.Target: d0:73:d5:01:02:03
+0010  00 00 00 00 00 00        FrameAddress.ReservedBlock: 000000000000
+0016  02                       FrameAddress.Flags: 0x02 (Reserved=0 AckRequired=true ResRequired=false)
+0017  05                       FrameAddress.Sequence: 5
+0018  00 00 00 00 00 00 00 00  ProtocolHeader.Reserved: 0
+0020  66 00                    ProtocolHeader.Type: LightSetColor (102)
+0022  00 00                    ProtocolHeader.ReservedEnd: 0
+0024  00                       Payload.Reserved: 0
+0025  55 55                    Payload.Color.Hue: 21845 (120.00°)
+0027  ff ff                    Payload.Color.Saturation: 65535 (100.00%)
+0029  00 80                    Payload.Color.Brightness: 32768 (50.00%)
+002b  ac 0d                    Payload.Color.Kelvin: 3500 K
+002d  dc 05 00 00              Payload.Duration: 1.5s (1500 ms)`
+
+	p := dissectTestPacket(c)
+
+	str, err = DissectHex(p, t.order)
+	c.Assert(err, IsNil)
+	c.Check(str, Equals, exp)
+
+	//
+	// Test that fields larger than a single line wrap
+	//
+	label, err := lifxpayloads.NewDeviceLabel([]byte("kitchen"))
+	c.Assert(err, IsNil)
+
+	p.Header.ProtocolHeader.Type = DeviceStateLabel
+	p.Payload = &lifxpayloads.DeviceStateLabel{Label: label}
+
+	str, err = DissectHex(p, t.order)
+	c.Assert(err, IsNil)
+	c.Check(strings.HasSuffix(str, `
+0024  6b 69 74 63 68 65 6e 00  Payload.Label: "kitchen"
+002c  00 00 00 00 00 00 00 00
+0034  00 00 00 00 00 00 00 00
+003c  00 00 00 00 00 00 00 00`), Equals, true)
+
+	//
+	// Test that nil values return an error
+	//
+	_, err = DissectHex(nil, t.order)
+	c.Check(err, NotNil)
+
+	_, err = DissectHex(&Packet{Header: p.Header}, t.order)
+	c.Check(err, NotNil)
+}
+
+func (*TestSuite) TestPacket_Format(c *C) {
+	p := dissectTestPacket(c)
+
+	c.Check(fmt.Sprintf("%+v", p), Equals, Dissect(p))
+	c.Check(fmt.Sprintf("%v", p), Equals, p.String())
+	c.Check(fmt.Sprintf("%s", p), Equals, p.String())
+
+	dump, err := DissectHex(p, binary.LittleEndian)
+	c.Assert(err, IsNil)
+	c.Check(fmt.Sprintf("%x", p), Equals, dump)
+
+	c.Check(fmt.Sprintf("%x", &Packet{}), Equals, "%!x(the Header field cannot be nil)")
+}
@@ -0,0 +1,343 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxprotocol
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// This file contains the JSON representation of each of the header
+// components, as well as the Packet itself. When unmarshaling in to an
+// existing value, fields missing from the JSON retain their current values.
+// This allows packets to be authored in JSON by only specifying the fields
+// that differ from the defaults.
+
+type frameJSON struct {
+	Size        uint16 `json:"size"`
+	Origin      uint8  `json:"origin"`
+	Tagged      bool   `json:"tagged"`
+	Addressable bool   `json:"addressable"`
+	Protocol    uint16 `json:"protocol"`
+	Source      uint32 `json:"source"`
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+func (frame *Frame) MarshalJSON() ([]byte, error) {
+	return json.Marshal(frameJSON{
+		Size:        frame.Size,
+		Origin:      frame.Origin,
+		Tagged:      frame.Tagged,
+		Addressable: frame.Addressable,
+		Protocol:    frame.Protocol,
+		Source:      frame.Source,
+	})
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+func (frame *Frame) UnmarshalJSON(data []byte) error {
+	aux := frameJSON{
+		Size:        frame.Size,
+		Origin:      frame.Origin,
+		Tagged:      frame.Tagged,
+		Addressable: frame.Addressable,
+		Protocol:    frame.Protocol,
+		Source:      frame.Source,
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	frame.Size = aux.Size
+	frame.Origin = aux.Origin
+	frame.Tagged = aux.Tagged
+	frame.Addressable = aux.Addressable
+	frame.Protocol = aux.Protocol
+	frame.Source = aux.Source
+
+	return nil
+}
+
+type frameAddressJSON struct {
+	Target        string `json:"target"`
+	ReservedBlock string `json:"reserved_block,omitempty"`
+	Reserved      uint8  `json:"reserved,omitempty"`
+	AckRequired   bool   `json:"ack_required"`
+	ResRequired   bool   `json:"res_required"`
+	Sequence      uint8  `json:"sequence"`
+}
+
+func newFrameAddressJSON(fra *FrameAddress) frameAddressJSON {
+	target := fra.Target
+
+	if len(target) == 0 {
+		target = make(net.HardwareAddr, 6)
+	}
+
+	var reservedBlock string
+
+	if fra.ReservedBlock != [6]uint8{} {
+		reservedBlock = hex.EncodeToString(fra.ReservedBlock[0:])
+	}
+
+	return frameAddressJSON{
+		Target:        target.String(),
+		ReservedBlock: reservedBlock,
+		Reserved:      fra.Reserved,
+		AckRequired:   fra.AckRequired,
+		ResRequired:   fra.ResRequired,
+		Sequence:      fra.Sequence,
+	}
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+// The Target is rendered as a MAC address string (e.g., "d0:73:d5:01:02:03").
+func (fra *FrameAddress) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newFrameAddressJSON(fra))
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+// An empty Target string results in a nil Target, which targets all devices.
+func (fra *FrameAddress) UnmarshalJSON(data []byte) error {
+	aux := newFrameAddressJSON(fra)
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	var target net.HardwareAddr
+
+	if aux.Target != "" {
+		var err error
+
+		if target, err = net.ParseMAC(aux.Target); err != nil {
+			return err
+		}
+	}
+
+	var reservedBlock [6]uint8
+
+	if aux.ReservedBlock != "" {
+		b, err := hex.DecodeString(aux.ReservedBlock)
+
+		if err != nil {
+			return err
+		}
+
+		if len(b) != len(reservedBlock) {
+			return fmt.Errorf("the reserved_block must be %d bytes, got %d", len(reservedBlock), len(b))
+		}
+
+		copy(reservedBlock[0:], b)
+	}
+
+	fra.Target = target
+	fra.ReservedBlock = reservedBlock
+	fra.Reserved = aux.Reserved
+	fra.AckRequired = aux.AckRequired
+	fra.ResRequired = aux.ResRequired
+	fra.Sequence = aux.Sequence
+
+	return nil
+}
+
+type protocolHeaderJSON struct {
+	Reserved    uint64  `json:"reserved,omitempty"`
+	Type        *uint16 `json:"type,omitempty"`
+	TypeName    string  `json:"type_name,omitempty"`
+	ReservedEnd uint16  `json:"reserved_end,omitempty"`
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+// In addition to the numeric message type, the name of the type is rendered
+// in the "type_name" field.
+func (ph *ProtocolHeader) MarshalJSON() ([]byte, error) {
+	t := ph.Type
+
+	return json.Marshal(protocolHeaderJSON{
+		Reserved:    ph.Reserved,
+		Type:        &t,
+		TypeName:    TypeName(ph.Type),
+		ReservedEnd: ph.ReservedEnd,
+	})
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+// The message type can be provided as either the numeric "type" or as the
+// "type_name" field. If both are present the numeric value is used.
+func (ph *ProtocolHeader) UnmarshalJSON(data []byte) error {
+	aux := protocolHeaderJSON{
+		Reserved:    ph.Reserved,
+		ReservedEnd: ph.ReservedEnd,
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	switch {
+	case aux.Type != nil:
+		ph.Type = *aux.Type
+
+	case aux.TypeName != "":
+		t, ok := TypeFromName(aux.TypeName)
+
+		if !ok {
+			return fmt.Errorf("unknown message type %q", aux.TypeName)
+		}
+
+		ph.Type = t
+	}
+
+	ph.Reserved = aux.Reserved
+	ph.ReservedEnd = aux.ReservedEnd
+
+	return nil
+}
+
+type headerJSON struct {
+	Frame          *Frame          `json:"frame"`
+	FrameAddress   *FrameAddress   `json:"frame_address"`
+	ProtocolHeader *ProtocolHeader `json:"protocol_header"`
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+func (h *Header) MarshalJSON() ([]byte, error) {
+	return json.Marshal(headerJSON{
+		Frame:          h.Frame,
+		FrameAddress:   h.FrameAddress,
+		ProtocolHeader: h.ProtocolHeader,
+	})
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+// Any nil components of the header are populated with their defaults (see
+// NewFrame) before unmarshaling, so the JSON only needs to contain the fields
+// that differ from the defaults.
+func (h *Header) UnmarshalJSON(data []byte) error {
+	if h.Frame == nil {
+		h.Frame = NewFrame()
+	}
+
+	if h.FrameAddress == nil {
+		h.FrameAddress = NewFrameAddress()
+	}
+
+	if h.ProtocolHeader == nil {
+		h.ProtocolHeader = &ProtocolHeader{}
+	}
+
+	aux := headerJSON{
+		Frame:          h.Frame,
+		FrameAddress:   h.FrameAddress,
+		ProtocolHeader: h.ProtocolHeader,
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	// an explicit null removes the component entirely
+	h.Frame = aux.Frame
+	h.FrameAddress = aux.FrameAddress
+	h.ProtocolHeader = aux.ProtocolHeader
+
+	return nil
+}
+
+type packetJSON struct {
+	Type    string          `json:"type"`
+	Header  *Header         `json:"header"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface. The
+// packet is rendered as an object containing the name of the message type,
+// the header, and the payload.
+func (p *Packet) MarshalJSON() ([]byte, error) {
+	var name string
+
+	if p.Header != nil && p.Header.ProtocolHeader != nil {
+		name = TypeName(p.Header.ProtocolHeader.Type)
+	}
+
+	payload, err := json.Marshal(p.Payload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(packetJSON{
+		Type:    name,
+		Header:  p.Header,
+		Payload: payload,
+	})
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+// The message type is taken from the header, or from the top-level "type"
+// field if the header doesn't specify one. The payload is unmarshaled in to
+// the payload type for that message, which allows packets to be authored in
+// JSON and then marshaled to the wire:
+//
+//	{
+//		"type": "LightSetColor",
+//		"header": {"frame_address": {"target": "d0:73:d5:01:02:03", "ack_required": true}},
+//		"payload": {"color": {"hue_degrees": 120, "saturation_percent": 100, "brightness_percent": 50, "kelvin": 3500}, "duration": "1s"}
+//	}
+func (p *Packet) UnmarshalJSON(data []byte) error {
+	if p.Header == nil {
+		p.Header = &Header{}
+	}
+
+	aux := packetJSON{Header: p.Header}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	if aux.Header == nil || aux.Header.ProtocolHeader == nil {
+		return errors.New("the ProtocolHeader cannot be nil")
+	}
+
+	ph := aux.Header.ProtocolHeader
+
+	if aux.Type != "" {
+		t, ok := TypeFromName(aux.Type)
+
+		if !ok {
+			return fmt.Errorf("unknown message type %q", aux.Type)
+		}
+
+		switch ph.Type {
+		case 0:
+			ph.Type = t
+		case t:
+		default:
+			return fmt.Errorf("the type %q does not match the header type %d", aux.Type, ph.Type)
+		}
+	}
+
+	var pc PacketComponent
+
+	if pc = packetComponentByType(ph.Type); pc == nil {
+		return ErrUnknownMessageType
+	}
+
+	if len(aux.Payload) > 0 && string(aux.Payload) != "null" {
+		if err := json.Unmarshal(aux.Payload, pc); err != nil {
+			return err
+		}
+	}
+
+	p.Header = aux.Header
+	p.Payload = pc
+
+	return nil
+}
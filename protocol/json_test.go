@@ -0,0 +1,187 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxprotocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol/payloads"
+
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) TestFrame_MarshalJSON(c *C) {
+	frame := &Frame{
+		Size:        49,
+		Origin:      0,
+		Tagged:      true,
+		Addressable: true,
+		Protocol:    1024,
+		Source:      42,
+	}
+
+	data, err := json.Marshal(frame)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"size":49,"origin":0,"tagged":true,"addressable":true,"protocol":1024,"source":42}`)
+
+	result := &Frame{}
+	c.Assert(json.Unmarshal(data, result), IsNil)
+	c.Check(*result, Equals, *frame)
+
+	// fields not in the JSON should retain their values
+	result = NewFrame()
+	c.Assert(json.Unmarshal([]byte(`{"source":7}`), result), IsNil)
+	c.Check(result.Addressable, Equals, true)
+	c.Check(result.Protocol, Equals, uint16(1024))
+	c.Check(result.Source, Equals, uint32(7))
+}
+
+func (*TestSuite) TestFrameAddress_MarshalJSON(c *C) {
+	fra := &FrameAddress{
+		Target:      []byte{0xd0, 0x73, 0xd5, 1, 2, 3},
+		AckRequired: true,
+		Sequence:    5,
+	}
+
+	data, err := json.Marshal(fra)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"target":"d0:73:d5:01:02:03","ack_required":true,"res_required":false,"sequence":5}`)
+
+	result := &FrameAddress{}
+	c.Assert(json.Unmarshal(data, result), IsNil)
+	c.Check(result.Target.String(), Equals, "d0:73:d5:01:02:03")
+	c.Check(result.AckRequired, Equals, true)
+	c.Check(result.ResRequired, Equals, false)
+	c.Check(result.Sequence, Equals, uint8(5))
+
+	//
+	// Test that the reserved fields are rendered when set
+	//
+	fra = &FrameAddress{ReservedBlock: [6]uint8{1, 2, 3, 4, 5, 6}, Reserved: 3}
+
+	data, err = json.Marshal(fra)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"target":"00:00:00:00:00:00","reserved_block":"010203040506","reserved":3,"ack_required":false,"res_required":false,"sequence":0}`)
+
+	result = &FrameAddress{}
+	c.Assert(json.Unmarshal(data, result), IsNil)
+	c.Check(result.ReservedBlock, Equals, [6]uint8{1, 2, 3, 4, 5, 6})
+	c.Check(result.Reserved, Equals, uint8(3))
+
+	//
+	// Test that an empty target targets all devices
+	//
+	c.Assert(json.Unmarshal([]byte(`{"target":""}`), result), IsNil)
+	c.Check(result.Target, IsNil)
+
+	//
+	// Test that malformed values fail
+	//
+	c.Check(json.Unmarshal([]byte(`{"target":"nope"}`), result), NotNil)
+	c.Check(json.Unmarshal([]byte(`{"reserved_block":"0102"}`), result), NotNil)
+}
+
+func (*TestSuite) TestProtocolHeader_MarshalJSON(c *C) {
+	data, err := json.Marshal(&ProtocolHeader{Type: LightSetColor})
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"type":102,"type_name":"LightSetColor"}`)
+
+	ph := &ProtocolHeader{}
+	c.Assert(json.Unmarshal(data, ph), IsNil)
+	c.Check(ph.Type, Equals, LightSetColor)
+
+	// the type name should be used if the numeric type is missing
+	c.Assert(json.Unmarshal([]byte(`{"type_name":"DeviceGetService","reserved":1,"reserved_end":2}`), ph), IsNil)
+	c.Check(*ph, Equals, ProtocolHeader{Reserved: 1, Type: DeviceGetService, ReservedEnd: 2})
+
+	c.Check(json.Unmarshal([]byte(`{"type_name":"DeviceGetNothing"}`), ph), NotNil)
+}
+
+func (*TestSuite) TestHeader_MarshalJSON(c *C) {
+	header := &Header{
+		Frame:          &Frame{Addressable: true, Protocol: 1024},
+		FrameAddress:   &FrameAddress{Sequence: 1},
+		ProtocolHeader: &ProtocolHeader{Type: DeviceGetService},
+	}
+
+	data, err := json.Marshal(header)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"frame":{"size":0,"origin":0,"tagged":false,"addressable":true,"protocol":1024,"source":0},"frame_address":{"target":"00:00:00:00:00:00","ack_required":false,"res_required":false,"sequence":1},"protocol_header":{"type":2,"type_name":"DeviceGetService"}}`)
+
+	//
+	// Test that missing components are populated with the defaults
+	//
+	result := &Header{}
+	c.Assert(json.Unmarshal([]byte(`{"frame":{"source":42}}`), result), IsNil)
+	c.Assert(result.Frame, NotNil)
+	c.Assert(result.FrameAddress, NotNil)
+	c.Assert(result.ProtocolHeader, NotNil)
+	c.Check(result.Frame.Addressable, Equals, true)
+	c.Check(result.Frame.Protocol, Equals, uint16(1024))
+	c.Check(result.Frame.Source, Equals, uint32(42))
+}
+
+func (t *TestSuite) TestPacket_MarshalJSON(c *C) {
+	p := dissectTestPacket(c)
+
+	data, err := json.Marshal(p)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"type":"LightSetColor","header":{"frame":{"size":49,"origin":0,"tagged":false,"addressable":true,"protocol":1024,"source":42},"frame_address":{"target":"d0:73:d5:01:02:03","ack_required":true,"res_required":false,"sequence":5},"protocol_header":{"type":102,"type_name":"LightSetColor"}},"payload":{"color":{"hue":21845,"hue_degrees":120,"saturation":65535,"saturation_percent":100,"brightness":32768,"brightness_percent":50,"kelvin":3500},"duration":"1.5s"}}`)
+
+	//
+	// Test that the packet survives a round trip
+	//
+	result := &Packet{}
+	c.Assert(json.Unmarshal(data, result), IsNil)
+	c.Check(Dissect(result), Equals, Dissect(p))
+
+	//
+	// Test that a packet authored in JSON can be marshaled to the wire
+	//
+	authored := `{
+		"type": "LightSetColor",
+		"header": {"frame": {"source": 42}, "frame_address": {"target": "d0:73:d5:01:02:03", "ack_required": true, "sequence": 5}},
+		"payload": {"color": {"hue_degrees": 120, "saturation_percent": 100, "brightness_percent": 50, "kelvin": 3500}, "duration": "1.5s"}
+	}`
+
+	result = &Packet{}
+	c.Assert(json.Unmarshal([]byte(authored), result), IsNil)
+
+	packet, err := result.MarshalPacket(t.order)
+	c.Assert(err, IsNil)
+
+	expected, err := p.MarshalPacket(t.order)
+	c.Assert(err, IsNil)
+	c.Check(packet, DeepEquals, expected)
+
+	decoded := &Packet{}
+	c.Assert(decoded.UnmarshalPacket(bytes.NewReader(packet), t.order), IsNil)
+
+	lsc, ok := decoded.Payload.(*lifxpayloads.LightSetColor)
+	c.Assert(ok, Equals, true)
+	c.Check(lsc.Duration, Equals, 1500*time.Millisecond)
+
+	//
+	// Test that messages without a payload can be authored
+	//
+	result = &Packet{}
+	c.Assert(json.Unmarshal([]byte(`{"type":"DeviceGetService","header":{"frame":{"tagged":true}}}`), result), IsNil)
+	c.Check(result.Header.ProtocolHeader.Type, Equals, DeviceGetService)
+	c.Check(result.Payload, DeepEquals, &lifxpayloads.Empty{})
+
+	packet, err = result.MarshalPacket(t.order)
+	c.Assert(err, IsNil)
+	c.Check(len(packet), Equals, HeaderByteSize)
+
+	//
+	// Test that invalid types fail
+	//
+	c.Check(json.Unmarshal([]byte(`{"type":"DeviceGetNothing"}`), &Packet{}), NotNil)
+	c.Check(json.Unmarshal([]byte(`{"header":{"protocol_header":{"type":1}}}`), &Packet{}), NotNil)
+	c.Check(json.Unmarshal([]byte(`{"type":"LightGet","header":{"protocol_header":{"type":2}}}`), &Packet{}), NotNil)
+	c.Check(json.Unmarshal([]byte(`{"type":"LightGet","header":{"protocol_header":null}}`), &Packet{}), NotNil)
+}
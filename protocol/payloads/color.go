@@ -0,0 +1,195 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxpayloads
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RGBWhiteKelvin is the color temperature of the white point of the sRGB color
+// space (D65). Colors converted from RGB use this as their Kelvin value, so
+// that RGB white (#ffffff) is rendered as the same white when converted back.
+const RGBWhiteKelvin uint16 = 6500
+
+// HSBKModel is the color.Model for converting colors to a *LightHSBK.
+var HSBKModel = color.ModelFunc(hsbkModel)
+
+func hsbkModel(c color.Color) color.Color {
+	return FromColor(c)
+}
+
+// RGBA is a function that satisfies the image/color.Color interface. It
+// returns the alpha-premultiplied red, green, blue and alpha values. The alpha
+// value is always fully opaque.
+//
+// The color is rendered the way a LIFX bulb mixes it: the fully saturated hue
+// is blended with white, where the Saturation determines the ratio, and the
+// result is scaled by the Brightness. The white that's blended in is the white
+// point of the Kelvin value, so unsaturated colors are rendered as a warm
+// (low Kelvin) or cool (high Kelvin) white. A Kelvin value of RGBWhiteKelvin,
+// or of 0, is rendered as pure RGB white.
+func (hsbk *LightHSBK) RGBA() (r, g, b, a uint32) {
+	if hsbk == nil {
+		return 0, 0, 0, 0
+	}
+
+	rf, gf, bf := hsbk.rgb()
+
+	return uint32(round(rf * 0xffff)), uint32(round(gf * 0xffff)), uint32(round(bf * 0xffff)), 0xffff
+}
+
+// Hex returns the color as an RGB hex string (e.g., "#ff8800"). See the
+// RGBA function for details on how the color is rendered.
+func (hsbk *LightHSBK) Hex() string {
+	if hsbk == nil {
+		return "#000000"
+	}
+
+	r, g, b := hsbk.rgb()
+
+	return fmt.Sprintf("#%02x%02x%02x", uint8(round(r*255)), uint8(round(g*255)), uint8(round(b*255)))
+}
+
+// rgb returns the red, green, and blue values of the color in the range 0-1.
+func (hsbk *LightHSBK) rgb() (r, g, b float64) {
+	sat := float64(hsbk.Saturation) / maxUint16
+	bri := float64(hsbk.Brightness) / maxUint16
+
+	// the fully saturated color for the hue
+	hr, hg, hb := hueToRGB(hueToDegrees(hsbk.Hue))
+
+	// the white blended in as saturation decreases
+	wr, wg, wb := kelvinWhitePoint(hsbk.Kelvin)
+
+	r = bri * (sat*hr + (1-sat)*wr)
+	g = bri * (sat*hg + (1-sat)*wg)
+	b = bri * (sat*hb + (1-sat)*wb)
+
+	return
+}
+
+// FromRGB returns the *LightHSBK for an 8-bit RGB color. The Kelvin value is
+// set to RGBWhiteKelvin so that the color survives a round trip through the
+// RGBA function.
+func FromRGB(r, g, b uint8) *LightHSBK {
+	return fromRGB(float64(r)/255, float64(g)/255, float64(b)/255)
+}
+
+// FromColor returns the *LightHSBK for any color.Color. If the color is
+// already a *LightHSBK a copy of it is returned. Otherwise the color is
+// converted from its RGB value, and the alpha channel is discarded. See
+// FromRGB for more details.
+func FromColor(c color.Color) *LightHSBK {
+	if hsbk, ok := c.(*LightHSBK); ok {
+		if hsbk == nil {
+			return &LightHSBK{Kelvin: RGBWhiteKelvin}
+		}
+
+		cp := *hsbk
+		return &cp
+	}
+
+	r, g, b, a := c.RGBA()
+
+	if a == 0 {
+		return &LightHSBK{Kelvin: RGBWhiteKelvin}
+	}
+
+	// the values are alpha-premultiplied, which we need to reverse
+	alpha := float64(a)
+
+	return fromRGB(float64(r)/alpha, float64(g)/alpha, float64(b)/alpha)
+}
+
+// FromHex returns the *LightHSBK for an RGB hex string. The string can be in
+// the long (#ff8800) or short (#f80) form, and the leading # is optional. See
+// FromRGB for more details.
+func FromHex(s string) (*LightHSBK, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+
+	switch len(hex) {
+	case 3:
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	case 6:
+	default:
+		return nil, fmt.Errorf("%q is not a valid hex color: must be in the form #rrggbb or #rgb", s)
+	}
+
+	u64, err := strconv.ParseUint(hex, 16, 32)
+
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a valid hex color: contains non-hex characters", s)
+	}
+
+	return FromRGB(uint8(u64>>16), uint8(u64>>8), uint8(u64)), nil
+}
+
+// fromRGB converts RGB values in the range 0-1 to a *LightHSBK.
+func fromRGB(r, g, b float64) *LightHSBK {
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	delta := max - min
+
+	var hue, sat float64
+
+	if max > 0 {
+		sat = delta / max
+	}
+
+	if delta > 0 {
+		switch max {
+		case r:
+			hue = 60 * math.Mod((g-b)/delta, 6)
+		case g:
+			hue = 60 * ((b-r)/delta + 2)
+		default:
+			hue = 60 * ((r-g)/delta + 4)
+		}
+	}
+
+	return &LightHSBK{
+		Hue:        degreesToHue(hue),
+		Saturation: uint16(round(clamp01(sat) * maxUint16)),
+		Brightness: uint16(round(clamp01(max) * maxUint16)),
+		Kelvin:     RGBWhiteKelvin,
+	}
+}
+
+// hueToRGB returns the fully saturated and fully bright RGB color, in the
+// range 0-1, for the hue in degrees.
+func hueToRGB(degrees float64) (r, g, b float64) {
+	h := degrees / 60
+	x := 1 - math.Abs(math.Mod(h, 2)-1)
+
+	switch {
+	case h < 1:
+		return 1, x, 0
+	case h < 2:
+		return x, 1, 0
+	case h < 3:
+		return 0, 1, x
+	case h < 4:
+		return 0, x, 1
+	case h < 5:
+		return x, 0, 1
+	default:
+		return 1, 0, x
+	}
+}
+
+func clamp01(f float64) float64 {
+	switch {
+	case f < 0:
+		return 0
+	case f > 1:
+		return 1
+	default:
+		return f
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxpayloads
+
+import (
+	"image/color"
+
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) TestLightHSBK_RGBA(c *C) {
+	var r, g, b, a uint32
+
+	// the *LightHSBK should be usable as a color.Color
+	var col color.Color = &LightHSBK{Hue: 0, Saturation: 65535, Brightness: 65535, Kelvin: 3500}
+
+	r, g, b, a = col.RGBA()
+	c.Check(r, Equals, uint32(0xffff))
+	c.Check(g, Equals, uint32(0))
+	c.Check(b, Equals, uint32(0))
+	c.Check(a, Equals, uint32(0xffff))
+
+	// cyan at half brightness
+	r, g, b, a = (&LightHSBK{Hue: 32768, Saturation: 65535, Brightness: 32768}).RGBA()
+	c.Check(r, Equals, uint32(0))
+	c.Check(g, Equals, uint32(0x8000))
+	c.Check(b, Equals, uint32(0x8000))
+	c.Check(a, Equals, uint32(0xffff))
+
+	// white at the sRGB white point should be pure white
+	r, g, b, _ = (&LightHSBK{Brightness: 65535, Kelvin: RGBWhiteKelvin}).RGBA()
+	c.Check(r, Equals, uint32(0xffff))
+	c.Check(g, Equals, uint32(0xffff))
+	c.Check(b, Equals, uint32(0xffff))
+
+	// warm white should have more red than blue
+	r, g, b, _ = (&LightHSBK{Brightness: 65535, Kelvin: 2500}).RGBA()
+	c.Check(r, Equals, uint32(0xffff))
+	c.Check(g < r, Equals, true)
+	c.Check(b < g, Equals, true)
+
+	// cool white should have more blue than red
+	r, g, b, _ = (&LightHSBK{Brightness: 65535, Kelvin: 9000}).RGBA()
+	c.Check(b, Equals, uint32(0xffff))
+	c.Check(r < b, Equals, true)
+
+	// black is black regardless of the hue
+	r, g, b, _ = (&LightHSBK{Hue: 1234, Saturation: 65535, Kelvin: 2500}).RGBA()
+	c.Check(r+g+b, Equals, uint32(0))
+
+	var hsbk *LightHSBK
+
+	r, g, b, a = hsbk.RGBA()
+	c.Check(r+g+b+a, Equals, uint32(0))
+}
+
+func (*TestSuite) TestLightHSBK_Hex(c *C) {
+	c.Check((&LightHSBK{Saturation: 65535, Brightness: 65535}).Hex(), Equals, "#ff0000")
+	c.Check((&LightHSBK{Hue: 43690, Saturation: 65535, Brightness: 65535}).Hex(), Equals, "#0000ff")
+	c.Check((&LightHSBK{Brightness: 65535, Kelvin: RGBWhiteKelvin}).Hex(), Equals, "#ffffff")
+
+	var hsbk *LightHSBK
+	c.Check(hsbk.Hex(), Equals, "#000000")
+}
+
+func (*TestSuite) Test_FromRGB(c *C) {
+	hsbk := FromRGB(255, 0, 0)
+	c.Check(*hsbk, Equals, LightHSBK{Hue: 0, Saturation: 65535, Brightness: 65535, Kelvin: RGBWhiteKelvin})
+
+	hsbk = FromRGB(0, 255, 0)
+	c.Check(*hsbk, Equals, LightHSBK{Hue: 21845, Saturation: 65535, Brightness: 65535, Kelvin: RGBWhiteKelvin})
+
+	hsbk = FromRGB(0, 0, 128)
+	c.Check(*hsbk, Equals, LightHSBK{Hue: 43691, Saturation: 65535, Brightness: 32896, Kelvin: RGBWhiteKelvin})
+
+	hsbk = FromRGB(255, 255, 255)
+	c.Check(*hsbk, Equals, LightHSBK{Hue: 0, Saturation: 0, Brightness: 65535, Kelvin: RGBWhiteKelvin})
+
+	hsbk = FromRGB(0, 0, 0)
+	c.Check(*hsbk, Equals, LightHSBK{Hue: 0, Saturation: 0, Brightness: 0, Kelvin: RGBWhiteKelvin})
+
+	// colors should survive a round trip
+	for r := 0; r < 256; r += 15 {
+		for g := 0; g < 256; g += 15 {
+			for b := 0; b < 256; b += 15 {
+				rgba := color.RGBAModel.Convert(FromRGB(uint8(r), uint8(g), uint8(b))).(color.RGBA)
+
+				if rgba != (color.RGBA{uint8(r), uint8(g), uint8(b), 255}) {
+					c.Fatalf("rgb(%d, %d, %d) did not survive a round trip: %v", r, g, b, rgba)
+				}
+			}
+		}
+	}
+}
+
+func (*TestSuite) Test_FromColor(c *C) {
+	hsbk := FromColor(color.RGBA{R: 255, G: 136, B: 0, A: 255})
+	c.Check(hsbk.Hex(), Equals, "#ff8800")
+
+	// alpha-premultiplied values should be handled
+	hsbk = FromColor(color.RGBA{R: 128, G: 0, B: 0, A: 128})
+	c.Check(*hsbk, Equals, LightHSBK{Hue: 0, Saturation: 65535, Brightness: 65535, Kelvin: RGBWhiteKelvin})
+
+	hsbk = FromColor(color.Transparent)
+	c.Check(*hsbk, Equals, LightHSBK{Kelvin: RGBWhiteKelvin})
+
+	hsbk = FromColor(color.Gray16{Y: 0x8000})
+	c.Check(*hsbk, Equals, LightHSBK{Brightness: 0x8000, Kelvin: RGBWhiteKelvin})
+
+	// a *LightHSBK should be copied as-is
+	orig := &LightHSBK{Hue: 1, Saturation: 2, Brightness: 3, Kelvin: 2700}
+	hsbk = FromColor(orig)
+	c.Check(*hsbk, Equals, *orig)
+	c.Check(hsbk == orig, Equals, false)
+
+	// the model should convert colors
+	converted, ok := HSBKModel.Convert(color.White).(*LightHSBK)
+	c.Assert(ok, Equals, true)
+	c.Check(*converted, Equals, LightHSBK{Brightness: 65535, Kelvin: RGBWhiteKelvin})
+}
+
+func (*TestSuite) Test_FromHex(c *C) {
+	hsbk, err := FromHex("#ff8800")
+	c.Assert(err, IsNil)
+	c.Check(hsbk.Hex(), Equals, "#ff8800")
+
+	hsbk, err = FromHex("f80")
+	c.Assert(err, IsNil)
+	c.Check(hsbk.Hex(), Equals, "#ff8800")
+
+	hsbk, err = FromHex(" #00FF00 ")
+	c.Assert(err, IsNil)
+	c.Check(*hsbk, Equals, *FromRGB(0, 255, 0))
+
+	_, err = FromHex("#ff88")
+	c.Check(err, ErrorMatches, `"#ff88" is not a valid hex color: must be in the form #rrggbb or #rgb`)
+
+	_, err = FromHex("#gg8800")
+	c.Check(err, ErrorMatches, `"#gg8800" is not a valid hex color: contains non-hex characters`)
+}
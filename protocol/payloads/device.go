@@ -274,7 +274,9 @@ func (dshf *DeviceStateHostFirmware) UnmarshalPacket(data io.Reader, order binar
 // DeviceStateWifiInfo is the response to the DeviceGetWifiInfo message.
 // It provides Wifi subsystem information.
 type DeviceStateWifiInfo struct {
-	// Signal is the radio receive signal strength in milliwatts
+	// Signal is the radio receive signal strength. Depending on the
+	// firmware it's in milliwatts, or is a signal-to-noise ratio; use the
+	// SignalDBm and SignalRating functions to interpret it.
 	Signal float32
 
 	// Tx is the number of bytes transmitted since power on.
@@ -0,0 +1,35 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxpayloads
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Empty is the payload for messages that don't carry any data. This includes
+// all of the Get messages (e.g., DeviceGetService and LightGet) as well as the
+// DeviceAcknowledgement message. It marshals to zero bytes.
+type Empty struct{}
+
+func (e *Empty) String() string {
+	if e == nil {
+		return "<*lifxpayloads.Empty(nil)>"
+	}
+
+	return "<*lifxpayloads.Empty>"
+}
+
+// MarshalPacket is a function that satisfies the lifxprotocol.Marshaler
+// interface.
+func (e *Empty) MarshalPacket(order binary.ByteOrder) ([]byte, error) {
+	return []byte{}, nil
+}
+
+// UnmarshalPacket is a function that satisfies the lifxprotocol.Unmarshaler
+// interface.
+func (e *Empty) UnmarshalPacket(data io.Reader, order binary.ByteOrder) error {
+	return nil
+}
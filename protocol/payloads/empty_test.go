@@ -0,0 +1,35 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxpayloads
+
+import (
+	"bytes"
+
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) TestEmpty_String(c *C) {
+	var e *Empty
+	c.Check(e.String(), Equals, "<*lifxpayloads.Empty(nil)>")
+
+	e = &Empty{}
+	c.Check(e.String(), Equals, "<*lifxpayloads.Empty>")
+}
+
+func (t *TestSuite) TestEmpty_MarshalPacket(c *C) {
+	packet, err := (&Empty{}).MarshalPacket(t.order)
+	c.Assert(err, IsNil)
+	c.Assert(packet, NotNil)
+	c.Check(len(packet), Equals, 0)
+}
+
+func (t *TestSuite) TestEmpty_UnmarshalPacket(c *C) {
+	reader := bytes.NewReader([]byte{1, 2, 3})
+
+	c.Assert((&Empty{}).UnmarshalPacket(reader, t.order), IsNil)
+
+	// it should not consume anything from the reader
+	c.Check(reader.Len(), Equals, 3)
+}
@@ -0,0 +1,319 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxpayloads
+
+import (
+	"fmt"
+	"math"
+)
+
+// ColorSpace is the color space used to interpolate between two colors.
+type ColorSpace uint8
+
+const (
+	// ColorSpaceHSB interpolates the hue, saturation, and brightness values
+	// directly. The hue takes the shortest path around the color wheel, so a
+	// fade from red (0°) to magenta (300°) passes through 330° and not
+	// through green.
+	ColorSpaceHSB ColorSpace = iota
+
+	// ColorSpaceLinearRGB interpolates the red, green, and blue values after
+	// removing the sRGB gamma curve. This is how light physically mixes.
+	ColorSpaceLinearRGB
+
+	// ColorSpaceLab interpolates in the CIE L*a*b* color space, which is
+	// designed so that equal steps look like equal changes in color.
+	ColorSpaceLab
+
+	// ColorSpaceOklab interpolates in the Oklab color space, which is a more
+	// perceptually uniform successor to CIE L*a*b*. It keeps the hue of
+	// blues more stable, and is a good default for fades.
+	ColorSpaceOklab
+)
+
+func (cs ColorSpace) String() string {
+	switch cs {
+	case ColorSpaceHSB:
+		return "HSB"
+	case ColorSpaceLinearRGB:
+		return "LinearRGB"
+	case ColorSpaceLab:
+		return "Lab"
+	case ColorSpaceOklab:
+		return "Oklab"
+	default:
+		return fmt.Sprintf("ColorSpace(%d)", uint8(cs))
+	}
+}
+
+// Interpolate returns the color at t between the a and b colors, where a t
+// of 0 is a and a t of 1 is b. The value of t is clamped to the range 0-1.
+//
+// The Kelvin value is always interpolated linearly. In the RGB, Lab, and
+// Oklab color spaces the hue, saturation, and brightness are rendered as
+// RGB without the Kelvin white point, so that fading between two whites
+// doesn't pick up a tint. When one of the colors is white (no saturation)
+// or black (no brightness), its hue is ignored so the fade doesn't sweep
+// through the color wheel.
+func Interpolate(a, b *LightHSBK, t float64, space ColorSpace) *LightHSBK {
+	if a == nil || b == nil {
+		return nil
+	}
+
+	switch {
+	case t <= 0 || math.IsNaN(t):
+		cp := *a
+		return &cp
+	case t >= 1:
+		cp := *b
+		return &cp
+	}
+
+	hsb := interpolateHSB(a, b, t)
+
+	var r, g, bl float64
+
+	switch space {
+	case ColorSpaceLinearRGB:
+		r1, g1, b1 := hsbToLinearRGB(a)
+		r2, g2, b2 := hsbToLinearRGB(b)
+
+		r, g, bl = lerp(r1, r2, t), lerp(g1, g2, t), lerp(b1, b2, t)
+	case ColorSpaceLab:
+		l1, a1, b1 := linearRGBToLab(hsbToLinearRGB(a))
+		l2, a2, b2 := linearRGBToLab(hsbToLinearRGB(b))
+
+		r, g, bl = labToLinearRGB(lerp(l1, l2, t), lerp(a1, a2, t), lerp(b1, b2, t))
+	case ColorSpaceOklab:
+		l1, a1, b1 := linearRGBToOklab(hsbToLinearRGB(a))
+		l2, a2, b2 := linearRGBToOklab(hsbToLinearRGB(b))
+
+		r, g, bl = oklabToLinearRGB(lerp(l1, l2, t), lerp(a1, a2, t), lerp(b1, b2, t))
+	default:
+		return hsb
+	}
+
+	hsbk := fromRGB(
+		linearToSRGB(clamp01(r)),
+		linearToSRGB(clamp01(g)),
+		linearToSRGB(clamp01(bl)),
+	)
+
+	// without any saturation the hue is meaningless, so use the HSB one to
+	// avoid the hue jumping around during the fade
+	if hsbk.Saturation == 0 {
+		hsbk.Hue = hsb.Hue
+	}
+
+	hsbk.Kelvin = hsb.Kelvin
+
+	return hsbk
+}
+
+// Gradient returns n colors evenly spaced between the a and b colors,
+// including both of them. See Interpolate for details on how the colors are
+// interpolated. If n is 1 only a is returned, and if n is less than 1 or
+// either color is nil the returned slice is nil.
+func Gradient(a, b *LightHSBK, n int, space ColorSpace) []*LightHSBK {
+	return GradientStops([]*LightHSBK{a, b}, n, space)
+}
+
+// GradientStops returns n colors evenly spaced along a gradient that passes
+// through each of the stops, which are themselves evenly spaced. The first and
+// last colors returned are the first and last stops. This is useful for
+// rendering a gradient across the zones of a multizone light. If n is less
+// than 1, or there are no stops or any of them are nil, the returned slice is
+// nil.
+func GradientStops(stops []*LightHSBK, n int, space ColorSpace) []*LightHSBK {
+	if n < 1 || len(stops) == 0 {
+		return nil
+	}
+
+	for _, stop := range stops {
+		if stop == nil {
+			return nil
+		}
+	}
+
+	colors := make([]*LightHSBK, n)
+
+	if n == 1 || len(stops) == 1 {
+		for i := range colors {
+			cp := *stops[0]
+			colors[i] = &cp
+		}
+
+		return colors
+	}
+
+	segments := float64(len(stops) - 1)
+
+	for i := range colors {
+		// position along the whole gradient, in segments
+		pos := float64(i) / float64(n-1) * segments
+		seg := int(pos)
+
+		if seg >= len(stops)-1 {
+			seg = len(stops) - 2
+		}
+
+		colors[i] = Interpolate(stops[seg], stops[seg+1], pos-float64(seg), space)
+	}
+
+	return colors
+}
+
+// interpolateHSB interpolates the values of the two colors directly, with
+// the hue taking the shortest path around the color wheel.
+func interpolateHSB(a, b *LightHSBK, t float64) *LightHSBK {
+	hueA, hueB := a.Hue, b.Hue
+
+	// a color without saturation or brightness has no meaningful hue
+	if a.Saturation == 0 || a.Brightness == 0 {
+		hueA = hueB
+	}
+
+	if b.Saturation == 0 || b.Brightness == 0 {
+		hueB = hueA
+	}
+
+	diff := float64(hueB) - float64(hueA)
+
+	switch {
+	case diff > (maxUint16+1)/2:
+		diff -= maxUint16 + 1
+	case diff < -(maxUint16+1)/2:
+		diff += maxUint16 + 1
+	}
+
+	hue := math.Mod(round(float64(hueA)+diff*t), maxUint16+1)
+
+	if hue < 0 {
+		hue += maxUint16 + 1
+	}
+
+	return &LightHSBK{
+		Hue:        uint16(hue),
+		Saturation: uint16(round(lerp(float64(a.Saturation), float64(b.Saturation), t))),
+		Brightness: uint16(round(lerp(float64(a.Brightness), float64(b.Brightness), t))),
+		Kelvin:     uint16(round(lerp(float64(a.Kelvin), float64(b.Kelvin), t))),
+	}
+}
+
+func lerp(a, b, t float64) float64 {
+	return a + (b-a)*t
+}
+
+// hsbToLinearRGB returns the linear RGB values of the color, ignoring the
+// Kelvin value.
+func hsbToLinearRGB(hsbk *LightHSBK) (r, g, b float64) {
+	sat := float64(hsbk.Saturation) / maxUint16
+	bri := float64(hsbk.Brightness) / maxUint16
+
+	hr, hg, hb := hueToRGB(hueToDegrees(hsbk.Hue))
+
+	r = srgbToLinear(bri * (sat*hr + 1 - sat))
+	g = srgbToLinear(bri * (sat*hg + 1 - sat))
+	b = srgbToLinear(bri * (sat*hb + 1 - sat))
+
+	return
+}
+
+// srgbToLinear removes the sRGB gamma curve from a value in the range 0-1.
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// linearToSRGB applies the sRGB gamma curve to a value in the range 0-1.
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// the CIE XYZ values of the D65 white point, used by sRGB
+const (
+	d65X = 0.95047
+	d65Y = 1.0
+	d65Z = 1.08883
+)
+
+// labDelta is the point where the CIE L*a*b* function switches from a cube
+// root to a linear segment.
+const labDelta = 6.0 / 29
+
+func linearRGBToLab(r, g, b float64) (l, a, bb float64) {
+	x := 0.4124564*r + 0.3575761*g + 0.1804375*b
+	y := 0.2126729*r + 0.7151522*g + 0.0721750*b
+	z := 0.0193339*r + 0.1191920*g + 0.9503041*b
+
+	fx, fy, fz := labF(x/d65X), labF(y/d65Y), labF(z/d65Z)
+
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+func labToLinearRGB(l, a, bb float64) (r, g, b float64) {
+	fy := (l + 16) / 116
+	fx := fy + a/500
+	fz := fy - bb/200
+
+	x, y, z := d65X*labFInv(fx), d65Y*labFInv(fy), d65Z*labFInv(fz)
+
+	r = 3.2404542*x - 1.5371385*y - 0.4985314*z
+	g = -0.9692660*x + 1.8760108*y + 0.0415560*z
+	b = 0.0556434*x - 0.2040259*y + 1.0572252*z
+
+	return
+}
+
+func labF(t float64) float64 {
+	if t > labDelta*labDelta*labDelta {
+		return math.Cbrt(t)
+	}
+
+	return t/(3*labDelta*labDelta) + 4.0/29
+}
+
+func labFInv(t float64) float64 {
+	if t > labDelta {
+		return t * t * t
+	}
+
+	return 3 * labDelta * labDelta * (t - 4.0/29)
+}
+
+// linearRGBToOklab and oklabToLinearRGB use the matrices from Björn
+// Ottosson's definition of Oklab: https://bottosson.github.io/posts/oklab/
+func linearRGBToOklab(r, g, b float64) (l, a, bb float64) {
+	lc := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b)
+	mc := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b)
+	sc := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b)
+
+	l = 0.2104542553*lc + 0.7936177850*mc - 0.0040720468*sc
+	a = 1.9779984951*lc - 2.4285922050*mc + 0.4505937099*sc
+	bb = 0.0259040371*lc + 0.7827717662*mc - 0.8086757660*sc
+
+	return
+}
+
+func oklabToLinearRGB(l, a, bb float64) (r, g, b float64) {
+	lc := l + 0.3963377774*a + 0.2158037573*bb
+	mc := l - 0.1055613458*a - 0.0638541728*bb
+	sc := l - 0.0894841775*a - 1.2914855480*bb
+
+	lc, mc, sc = lc*lc*lc, mc*mc*mc, sc*sc*sc
+
+	r = 4.0767416621*lc - 3.3077115913*mc + 0.2309699292*sc
+	g = -1.2684380046*lc + 2.6097574011*mc - 0.3413193965*sc
+	b = -0.0041960863*lc - 0.7034186147*mc + 1.7076147010*sc
+
+	return
+}
@@ -0,0 +1,163 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxpayloads
+
+import (
+	"math"
+
+	. "gopkg.in/check.v1"
+)
+
+var colorSpaces = []ColorSpace{ColorSpaceHSB, ColorSpaceLinearRGB, ColorSpaceLab, ColorSpaceOklab}
+
+func (*TestSuite) TestColorSpace_String(c *C) {
+	c.Check(ColorSpaceHSB.String(), Equals, "HSB")
+	c.Check(ColorSpaceLinearRGB.String(), Equals, "LinearRGB")
+	c.Check(ColorSpaceLab.String(), Equals, "Lab")
+	c.Check(ColorSpaceOklab.String(), Equals, "Oklab")
+	c.Check(ColorSpace(42).String(), Equals, "ColorSpace(42)")
+}
+
+func (*TestSuite) Test_Interpolate(c *C) {
+	red := &LightHSBK{Hue: 0, Saturation: 65535, Brightness: 65535, Kelvin: 2500}
+	magenta := &LightHSBK{Hue: degreesToHue(300), Saturation: 65535, Brightness: 65535, Kelvin: 9000}
+
+	// the endpoints should be returned exactly in every color space
+	for _, space := range colorSpaces {
+		c.Check(*Interpolate(red, magenta, 0, space), Equals, *red, Commentf("space: %s", space))
+		c.Check(*Interpolate(red, magenta, 1, space), Equals, *magenta, Commentf("space: %s", space))
+		c.Check(*Interpolate(red, magenta, -1, space), Equals, *red, Commentf("space: %s", space))
+		c.Check(*Interpolate(red, magenta, 2, space), Equals, *magenta, Commentf("space: %s", space))
+		c.Check(Interpolate(nil, magenta, 0.5, space), IsNil)
+	}
+
+	//
+	// Test that the hue takes the shortest path around the color wheel
+	//
+	hsbk := Interpolate(red, magenta, 0.5, ColorSpaceHSB)
+	c.Check(math.Abs(hsbk.HueDegrees()-330) < 0.01, Equals, true, Commentf("hue: %f", hsbk.HueDegrees()))
+	c.Check(hsbk.Saturation, Equals, uint16(65535))
+	c.Check(hsbk.Kelvin, Equals, uint16(5750))
+
+	hsbk = Interpolate(magenta, red, 0.5, ColorSpaceHSB)
+	c.Check(math.Abs(hsbk.HueDegrees()-330) < 0.01, Equals, true, Commentf("hue: %f", hsbk.HueDegrees()))
+
+	hsbk = Interpolate(&LightHSBK{Hue: 60000, Saturation: 1, Brightness: 1}, &LightHSBK{Hue: 5000, Saturation: 1, Brightness: 1}, 0.5, ColorSpaceHSB)
+	c.Check(hsbk.Hue, Equals, uint16(65268))
+
+	//
+	// Test that a fade from white doesn't sweep through the color wheel; the
+	// perceptual color spaces drift slightly towards orange, but stay red
+	//
+	white := &LightHSBK{Hue: degreesToHue(240), Brightness: 65535, Kelvin: 2500}
+
+	for _, space := range colorSpaces {
+		hsbk = Interpolate(white, red, 0.5, space)
+
+		if space == ColorSpaceHSB || space == ColorSpaceLinearRGB {
+			c.Check(hsbk.Hue, Equals, uint16(0), Commentf("space: %s", space))
+		} else {
+			c.Check(hsbk.HueDegrees() < 20, Equals, true, Commentf("space: %s, hue: %f", space, hsbk.HueDegrees()))
+		}
+
+		c.Check(hsbk.Saturation > 0 && hsbk.Saturation < 65535, Equals, true, Commentf("space: %s", space))
+		c.Check(hsbk.Kelvin, Equals, uint16(2500), Commentf("space: %s", space))
+	}
+
+	//
+	// Test the RGB-based color spaces
+	//
+	lime := &LightHSBK{Hue: degreesToHue(120), Saturation: 65535, Brightness: 65535, Kelvin: 2500}
+
+	hsbk = Interpolate(red, lime, 0.5, ColorSpaceLinearRGB)
+	c.Check(hsbk.Hex(), Equals, "#bcbc00")
+	c.Check(hsbk.Hue, Equals, degreesToHue(60))
+
+	black := &LightHSBK{Kelvin: 3500}
+	whiteRGB := &LightHSBK{Brightness: 65535, Kelvin: 3500}
+
+	hsbk = Interpolate(black, whiteRGB, 0.5, ColorSpaceLinearRGB)
+	c.Check(hsbk.Saturation, Equals, uint16(0))
+	c.Check(hsbk.Kelvin, Equals, uint16(3500))
+	c.Check(hsbk.Brightness, Equals, percentToUint16(linearToSRGB(0.5)*100))
+
+	// L* of 50 is middle gray in CIE L*a*b*
+	hsbk = Interpolate(black, whiteRGB, 0.5, ColorSpaceLab)
+	l, _, _ := linearRGBToLab(hsbToLinearRGB(hsbk))
+	c.Check(math.Abs(l-50) < 0.01, Equals, true, Commentf("L*: %f", l))
+
+	hsbk = Interpolate(black, whiteRGB, 0.5, ColorSpaceOklab)
+	l, _, _ = linearRGBToOklab(hsbToLinearRGB(hsbk))
+	c.Check(math.Abs(l-0.5) < 0.0001, Equals, true, Commentf("L: %f", l))
+}
+
+func (*TestSuite) Test_Gradient(c *C) {
+	red := &LightHSBK{Hue: 0, Saturation: 65535, Brightness: 65535, Kelvin: 3500}
+	blue := &LightHSBK{Hue: degreesToHue(240), Saturation: 65535, Brightness: 65535, Kelvin: 3500}
+
+	colors := Gradient(red, blue, 5, ColorSpaceHSB)
+	c.Assert(colors, HasLen, 5)
+	c.Check(*colors[0], Equals, *red)
+	c.Check(*colors[4], Equals, *blue)
+
+	// red to blue is shortest through magenta
+	c.Check(colors[1].Hue, Equals, degreesToHue(330))
+	c.Check(colors[2].Hue, Equals, degreesToHue(300))
+	c.Check(colors[3].Hue, Equals, degreesToHue(270))
+
+	// the colors should be copies
+	c.Check(colors[0] == red, Equals, false)
+
+	colors = Gradient(red, blue, 1, ColorSpaceOklab)
+	c.Assert(colors, HasLen, 1)
+	c.Check(*colors[0], Equals, *red)
+
+	c.Check(Gradient(red, blue, 0, ColorSpaceOklab), IsNil)
+	c.Check(GradientStops(nil, 5, ColorSpaceOklab), IsNil)
+
+	// nil stops
+	c.Check(Gradient(nil, blue, 5, ColorSpaceHSB), IsNil)
+	c.Check(GradientStops([]*LightHSBK{nil}, 3, ColorSpaceHSB), IsNil)
+	c.Check(GradientStops([]*LightHSBK{red, blue, nil}, 5, ColorSpaceLab), IsNil)
+
+	//
+	// Test that the gradient passes through each of the stops
+	//
+	green := &LightHSBK{Hue: degreesToHue(120), Saturation: 65535, Brightness: 65535, Kelvin: 3500}
+
+	for _, space := range colorSpaces {
+		colors = GradientStops([]*LightHSBK{red, green, blue}, 9, space)
+		c.Assert(colors, HasLen, 9)
+		c.Check(*colors[0], Equals, *red, Commentf("space: %s", space))
+		c.Check(*colors[4], Equals, *green, Commentf("space: %s", space))
+		c.Check(*colors[8], Equals, *blue, Commentf("space: %s", space))
+	}
+
+	colors = GradientStops([]*LightHSBK{green}, 3, ColorSpaceLab)
+	c.Assert(colors, HasLen, 3)
+
+	for _, color := range colors {
+		c.Check(*color, Equals, *green)
+	}
+}
+
+func (*TestSuite) Test_colorSpaceConversions(c *C) {
+	l, a, b := linearRGBToLab(1, 1, 1)
+	c.Check(math.Abs(l-100) < 0.01 && math.Abs(a) < 0.01 && math.Abs(b) < 0.01, Equals, true, Commentf("Lab: %f %f %f", l, a, b))
+
+	l, a, b = linearRGBToOklab(1, 1, 1)
+	c.Check(math.Abs(l-1) < 0.0001 && math.Abs(a) < 0.0001 && math.Abs(b) < 0.0001, Equals, true, Commentf("Oklab: %f %f %f", l, a, b))
+
+	// the conversions should survive a round trip
+	for _, rgb := range [][3]float64{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {0, 0, 1}, {0.2, 0.5, 0.8}, {0.01, 0.001, 0.5}} {
+		r, g, bl := labToLinearRGB(linearRGBToLab(rgb[0], rgb[1], rgb[2]))
+		c.Check(math.Abs(r-rgb[0])+math.Abs(g-rgb[1])+math.Abs(bl-rgb[2]) < 1e-6, Equals, true, Commentf("Lab: %v", rgb))
+
+		r, g, bl = oklabToLinearRGB(linearRGBToOklab(rgb[0], rgb[1], rgb[2]))
+		c.Check(math.Abs(r-rgb[0])+math.Abs(g-rgb[1])+math.Abs(bl-rgb[2]) < 1e-6, Equals, true, Commentf("Oklab: %v", rgb))
+
+		c.Check(math.Abs(linearToSRGB(srgbToLinear(rgb[2]))-rgb[2]) < 1e-9, Equals, true)
+	}
+}
@@ -0,0 +1,902 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxpayloads
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// This file contains the JSON representation of each payload. The goal is to
+// render the payloads in a way that is useful for humans (labels as strings,
+// timestamps in RFC 3339 format, durations as strings like "1.5s", etc.) while
+// still allowing the JSON to be unmarshaled back in to a payload that can be
+// marshaled to the wire.
+//
+// Values that have both a raw and human representation (e.g., Hue) include
+// both. When unmarshaling the raw value takes precedence, if present.
+
+// MarshalText is a function that satisfies the encoding.TextMarshaler
+// interface. The label is rendered with all null bytes trimmed off the end.
+func (dl DeviceLabel) MarshalText() ([]byte, error) {
+	return bytes.TrimRight(dl[0:], "\x00"), nil
+}
+
+// UnmarshalText is a function that satisfies the encoding.TextUnmarshaler
+// interface. If the text is larger than 32 bytes this returns an error.
+func (dl *DeviceLabel) UnmarshalText(text []byte) error {
+	label, err := NewDeviceLabel(text)
+
+	if err != nil {
+		return err
+	}
+
+	*dl = label
+
+	return nil
+}
+
+// MarshalText is a function that satisfies the encoding.TextMarshaler
+// interface. The payload is base64 encoded with all null bytes trimmed off the
+// end, as the payload is arbitrary binary data.
+func (dep DeviceEchoPayload) MarshalText() ([]byte, error) {
+	trimmed := bytes.TrimRight(dep[0:], "\x00")
+
+	text := make([]byte, base64.StdEncoding.EncodedLen(len(trimmed)))
+	base64.StdEncoding.Encode(text, trimmed)
+
+	return text, nil
+}
+
+// UnmarshalText is a function that satisfies the encoding.TextUnmarshaler
+// interface. If the decoded text is larger than 64 bytes this returns an error.
+func (dep *DeviceEchoPayload) UnmarshalText(text []byte) error {
+	data := make([]byte, base64.StdEncoding.DecodedLen(len(text)))
+
+	n, err := base64.StdEncoding.Decode(data, text)
+
+	if err != nil {
+		return err
+	}
+
+	if n > len(dep) {
+		return fmt.Errorf("the echo payload cannot be larger than %d bytes", len(dep))
+	}
+
+	*dep = NewDeviceEchoPayloadTrunc(data[:n])
+
+	return nil
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+func (e *Empty) MarshalJSON() ([]byte, error) {
+	return []byte("{}"), nil
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+// Any fields within the object are ignored.
+func (e *Empty) UnmarshalJSON(data []byte) error {
+	var v map[string]json.RawMessage
+	return json.Unmarshal(data, &v)
+}
+
+type deviceStateServiceJSON struct {
+	Service uint8  `json:"service"`
+	Port    uint32 `json:"port"`
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+func (dss *DeviceStateService) MarshalJSON() ([]byte, error) {
+	return json.Marshal(deviceStateServiceJSON{
+		Service: dss.Service,
+		Port:    dss.Port,
+	})
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+func (dss *DeviceStateService) UnmarshalJSON(data []byte) error {
+	aux := deviceStateServiceJSON{
+		Service: dss.Service,
+		Port:    dss.Port,
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	dss.Service = aux.Service
+	dss.Port = aux.Port
+
+	return nil
+}
+
+type signalInfoJSON struct {
+	Signal   float32 `json:"signal"`
+	Tx       uint32  `json:"tx"`
+	Rx       uint32  `json:"rx"`
+	Reserved int16   `json:"reserved,omitempty"`
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+func (dshi *DeviceStateHostInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(signalInfoJSON{
+		Signal:   dshi.Signal,
+		Tx:       dshi.Tx,
+		Rx:       dshi.Rx,
+		Reserved: dshi.Reserved,
+	})
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+func (dshi *DeviceStateHostInfo) UnmarshalJSON(data []byte) error {
+	aux := signalInfoJSON{
+		Signal:   dshi.Signal,
+		Tx:       dshi.Tx,
+		Rx:       dshi.Rx,
+		Reserved: dshi.Reserved,
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	dshi.Signal = aux.Signal
+	dshi.Tx = aux.Tx
+	dshi.Rx = aux.Rx
+	dshi.Reserved = aux.Reserved
+
+	return nil
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+func (dswi *DeviceStateWifiInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(signalInfoJSON{
+		Signal:   dswi.Signal,
+		Tx:       dswi.Tx,
+		Rx:       dswi.Rx,
+		Reserved: dswi.Reserved,
+	})
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+func (dswi *DeviceStateWifiInfo) UnmarshalJSON(data []byte) error {
+	aux := signalInfoJSON{
+		Signal:   dswi.Signal,
+		Tx:       dswi.Tx,
+		Rx:       dswi.Rx,
+		Reserved: dswi.Reserved,
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	dswi.Signal = aux.Signal
+	dswi.Tx = aux.Tx
+	dswi.Rx = aux.Rx
+	dswi.Reserved = aux.Reserved
+
+	return nil
+}
+
+type firmwareJSON struct {
+	Build    string `json:"build"`
+	Reserved uint64 `json:"reserved,omitempty"`
+	Version  uint32 `json:"version"`
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+// The Build field is rendered as an RFC 3339 timestamp.
+func (dshf *DeviceStateHostFirmware) MarshalJSON() ([]byte, error) {
+	return json.Marshal(firmwareJSON{
+		Build:    jsonTimestamp(dshf.Build),
+		Reserved: dshf.Reserved,
+		Version:  dshf.Version,
+	})
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+func (dshf *DeviceStateHostFirmware) UnmarshalJSON(data []byte) error {
+	aux := firmwareJSON{
+		Build:    jsonTimestamp(dshf.Build),
+		Reserved: dshf.Reserved,
+		Version:  dshf.Version,
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	build, err := parseJSONTimestamp(aux.Build)
+
+	if err != nil {
+		return err
+	}
+
+	dshf.Build = build
+	dshf.Reserved = aux.Reserved
+	dshf.Version = aux.Version
+
+	return nil
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+// The Build field is rendered as an RFC 3339 timestamp.
+func (dswf *DeviceStateWifiFirmware) MarshalJSON() ([]byte, error) {
+	return json.Marshal(firmwareJSON{
+		Build:    jsonTimestamp(dswf.Build),
+		Reserved: dswf.Reserved,
+		Version:  dswf.Version,
+	})
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+func (dswf *DeviceStateWifiFirmware) UnmarshalJSON(data []byte) error {
+	aux := firmwareJSON{
+		Build:    jsonTimestamp(dswf.Build),
+		Reserved: dswf.Reserved,
+		Version:  dswf.Version,
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	build, err := parseJSONTimestamp(aux.Build)
+
+	if err != nil {
+		return err
+	}
+
+	dswf.Build = build
+	dswf.Reserved = aux.Reserved
+	dswf.Version = aux.Version
+
+	return nil
+}
+
+type powerLevelJSON struct {
+	Level *uint16 `json:"level,omitempty"`
+	On    *bool   `json:"on,omitempty"`
+}
+
+func newPowerLevelJSON(level uint16) powerLevelJSON {
+	on := level != 0
+	return powerLevelJSON{Level: &level, On: &on}
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+func (dsp *DeviceStatePower) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newPowerLevelJSON(dsp.Level))
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+// The power level can be provided as either the raw "level" or as the boolean
+// "on" field.
+func (dsp *DeviceStatePower) UnmarshalJSON(data []byte) error {
+	var aux powerLevelJSON
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	dsp.Level = jsonPowerLevel(aux.Level, aux.On, dsp.Level)
+
+	return nil
+}
+
+type deviceStateLabelJSON struct {
+	Label DeviceLabel `json:"label"`
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+func (dsl *DeviceStateLabel) MarshalJSON() ([]byte, error) {
+	return json.Marshal(deviceStateLabelJSON{Label: dsl.Label})
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+func (dsl *DeviceStateLabel) UnmarshalJSON(data []byte) error {
+	aux := deviceStateLabelJSON{Label: dsl.Label}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	dsl.Label = aux.Label
+
+	return nil
+}
+
+type deviceStateVersionJSON struct {
+	Vendor  uint32 `json:"vendor"`
+	Product uint32 `json:"product"`
+	Version uint32 `json:"version"`
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+func (dsv *DeviceStateVersion) MarshalJSON() ([]byte, error) {
+	return json.Marshal(deviceStateVersionJSON{
+		Vendor:  dsv.Vendor,
+		Product: dsv.Product,
+		Version: dsv.Version,
+	})
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+func (dsv *DeviceStateVersion) UnmarshalJSON(data []byte) error {
+	aux := deviceStateVersionJSON{
+		Vendor:  dsv.Vendor,
+		Product: dsv.Product,
+		Version: dsv.Version,
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	dsv.Vendor = aux.Vendor
+	dsv.Product = aux.Product
+	dsv.Version = aux.Version
+
+	return nil
+}
+
+type deviceStateInfoJSON struct {
+	Time     string `json:"time"`
+	Uptime   string `json:"uptime"`
+	Downtime string `json:"downtime"`
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+// The Time field is rendered as an RFC 3339 timestamp, and the Uptime and
+// Downtime fields are rendered as durations (e.g., "1h30m0s").
+func (dsi *DeviceStateInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(deviceStateInfoJSON{
+		Time:     jsonTimestamp(dsi.Time),
+		Uptime:   time.Duration(dsi.Uptime).String(),
+		Downtime: time.Duration(dsi.Downtime).String(),
+	})
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+func (dsi *DeviceStateInfo) UnmarshalJSON(data []byte) error {
+	aux := deviceStateInfoJSON{
+		Time:     jsonTimestamp(dsi.Time),
+		Uptime:   time.Duration(dsi.Uptime).String(),
+		Downtime: time.Duration(dsi.Downtime).String(),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	t, err := parseJSONTimestamp(aux.Time)
+
+	if err != nil {
+		return err
+	}
+
+	uptime, err := parseJSONDuration(aux.Uptime)
+
+	if err != nil {
+		return err
+	}
+
+	downtime, err := parseJSONDuration(aux.Downtime)
+
+	if err != nil {
+		return err
+	}
+
+	dsi.Time = t
+	dsi.Uptime = uint64(uptime)
+	dsi.Downtime = uint64(downtime)
+
+	return nil
+}
+
+type deviceStateLocationJSON struct {
+	Location  string      `json:"location"`
+	Label     DeviceLabel `json:"label"`
+	UpdatedAt string      `json:"updated_at"`
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+// The Location ID is rendered as a hex string, and the UpdatedAt field is
+// rendered as an RFC 3339 timestamp.
+func (dsl *DeviceStateLocation) MarshalJSON() ([]byte, error) {
+	return json.Marshal(deviceStateLocationJSON{
+		Location:  hex.EncodeToString(dsl.Location[0:]),
+		Label:     dsl.Label,
+		UpdatedAt: jsonTimestamp(dsl.UpdatedAt),
+	})
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+func (dsl *DeviceStateLocation) UnmarshalJSON(data []byte) error {
+	aux := deviceStateLocationJSON{
+		Location:  hex.EncodeToString(dsl.Location[0:]),
+		Label:     dsl.Label,
+		UpdatedAt: jsonTimestamp(dsl.UpdatedAt),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	location, err := parseJSONID(aux.Location)
+
+	if err != nil {
+		return err
+	}
+
+	updatedAt, err := parseJSONTimestamp(aux.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	dsl.Location = location
+	dsl.Label = aux.Label
+	dsl.UpdatedAt = updatedAt
+
+	return nil
+}
+
+type deviceStateGroupJSON struct {
+	Group     string      `json:"group"`
+	Label     DeviceLabel `json:"label"`
+	UpdatedAt string      `json:"updated_at"`
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+// The Group ID is rendered as a hex string, and the UpdatedAt field is
+// rendered as an RFC 3339 timestamp.
+func (dsg *DeviceStateGroup) MarshalJSON() ([]byte, error) {
+	return json.Marshal(deviceStateGroupJSON{
+		Group:     hex.EncodeToString(dsg.Group[0:]),
+		Label:     dsg.Label,
+		UpdatedAt: jsonTimestamp(dsg.UpdatedAt),
+	})
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+func (dsg *DeviceStateGroup) UnmarshalJSON(data []byte) error {
+	aux := deviceStateGroupJSON{
+		Group:     hex.EncodeToString(dsg.Group[0:]),
+		Label:     dsg.Label,
+		UpdatedAt: jsonTimestamp(dsg.UpdatedAt),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	group, err := parseJSONID(aux.Group)
+
+	if err != nil {
+		return err
+	}
+
+	updatedAt, err := parseJSONTimestamp(aux.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	dsg.Group = group
+	dsg.Label = aux.Label
+	dsg.UpdatedAt = updatedAt
+
+	return nil
+}
+
+type deviceEchoJSON struct {
+	Payload DeviceEchoPayload `json:"payload"`
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+func (de *DeviceEcho) MarshalJSON() ([]byte, error) {
+	return json.Marshal(deviceEchoJSON{Payload: de.Payload})
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+func (de *DeviceEcho) UnmarshalJSON(data []byte) error {
+	aux := deviceEchoJSON{Payload: de.Payload}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	de.Payload = aux.Payload
+
+	return nil
+}
+
+type lightHSBKJSON struct {
+	Hue               *uint16  `json:"hue,omitempty"`
+	HueDegrees        *float64 `json:"hue_degrees,omitempty"`
+	Saturation        *uint16  `json:"saturation,omitempty"`
+	SaturationPercent *float64 `json:"saturation_percent,omitempty"`
+	Brightness        *uint16  `json:"brightness,omitempty"`
+	BrightnessPercent *float64 `json:"brightness_percent,omitempty"`
+	Kelvin            uint16   `json:"kelvin"`
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface. In
+// addition to the raw values, the hue is rendered in degrees and the saturation
+// and brightness are rendered as percentages.
+func (hsbk *LightHSBK) MarshalJSON() ([]byte, error) {
+	hue, sat, bri := hsbk.Hue, hsbk.Saturation, hsbk.Brightness
+
+	hueDeg := roundPlaces(hueToDegrees(hue), 2)
+	satPerc := roundPlaces(uint16ToPercent(sat), 2)
+	briPerc := roundPlaces(uint16ToPercent(bri), 2)
+
+	return json.Marshal(lightHSBKJSON{
+		Hue:               &hue,
+		HueDegrees:        &hueDeg,
+		Saturation:        &sat,
+		SaturationPercent: &satPerc,
+		Brightness:        &bri,
+		BrightnessPercent: &briPerc,
+		Kelvin:            hsbk.Kelvin,
+	})
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+// Each of the hue, saturation, and brightness values can be provided as either
+// the raw value or in human units. If both are present the raw value is used.
+func (hsbk *LightHSBK) UnmarshalJSON(data []byte) error {
+	aux := lightHSBKJSON{Kelvin: hsbk.Kelvin}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	switch {
+	case aux.Hue != nil:
+		hsbk.Hue = *aux.Hue
+	case aux.HueDegrees != nil:
+		hsbk.Hue = degreesToHue(*aux.HueDegrees)
+	}
+
+	switch {
+	case aux.Saturation != nil:
+		hsbk.Saturation = *aux.Saturation
+	case aux.SaturationPercent != nil:
+		hsbk.Saturation = percentToUint16(*aux.SaturationPercent)
+	}
+
+	switch {
+	case aux.Brightness != nil:
+		hsbk.Brightness = *aux.Brightness
+	case aux.BrightnessPercent != nil:
+		hsbk.Brightness = percentToUint16(*aux.BrightnessPercent)
+	}
+
+	hsbk.Kelvin = aux.Kelvin
+
+	return nil
+}
+
+type lightSetColorJSON struct {
+	Reserved uint8      `json:"reserved,omitempty"`
+	Color    *LightHSBK `json:"color"`
+	Duration string     `json:"duration"`
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+// The Duration field is rendered as a duration string (e.g., "1.5s").
+func (lsc *LightSetColor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(lightSetColorJSON{
+		Reserved: lsc.Reserved,
+		Color:    lsc.Color,
+		Duration: lsc.Duration.String(),
+	})
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+func (lsc *LightSetColor) UnmarshalJSON(data []byte) error {
+	if lsc.Color == nil {
+		lsc.Color = &LightHSBK{}
+	}
+
+	aux := lightSetColorJSON{
+		Reserved: lsc.Reserved,
+		Color:    lsc.Color,
+		Duration: lsc.Duration.String(),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	dur, err := parseJSONDuration(aux.Duration)
+
+	if err != nil {
+		return err
+	}
+
+	lsc.Reserved = aux.Reserved
+	lsc.Color = aux.Color
+	lsc.Duration = dur
+
+	return nil
+}
+
+type lightSetWaveformJSON struct {
+	Reserved  uint8      `json:"reserved,omitempty"`
+	Transient bool       `json:"transient"`
+	Color     *LightHSBK `json:"color"`
+	Period    string     `json:"period"`
+	Cycles    float32    `json:"cycles"`
+	SkewRatio int16      `json:"skew_ratio"`
+	Waveform  Waveform   `json:"waveform"`
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+// The Period field is rendered as a duration string (e.g., "1.5s"), and the
+// Waveform field is rendered by name (e.g., "sine").
+func (lsw *LightSetWaveform) MarshalJSON() ([]byte, error) {
+	return json.Marshal(lightSetWaveformJSON{
+		Reserved:  lsw.Reserved,
+		Transient: lsw.Transient,
+		Color:     lsw.Color,
+		Period:    lsw.Period.String(),
+		Cycles:    lsw.Cycles,
+		SkewRatio: lsw.SkewRatio,
+		Waveform:  lsw.Waveform,
+	})
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+func (lsw *LightSetWaveform) UnmarshalJSON(data []byte) error {
+	if lsw.Color == nil {
+		lsw.Color = &LightHSBK{}
+	}
+
+	aux := lightSetWaveformJSON{
+		Reserved:  lsw.Reserved,
+		Transient: lsw.Transient,
+		Color:     lsw.Color,
+		Period:    lsw.Period.String(),
+		Cycles:    lsw.Cycles,
+		SkewRatio: lsw.SkewRatio,
+		Waveform:  lsw.Waveform,
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	period, err := parseJSONDuration(aux.Period)
+
+	if err != nil {
+		return err
+	}
+
+	lsw.Reserved = aux.Reserved
+	lsw.Transient = aux.Transient
+	lsw.Color = aux.Color
+	lsw.Period = period
+	lsw.Cycles = aux.Cycles
+	lsw.SkewRatio = aux.SkewRatio
+	lsw.Waveform = aux.Waveform
+
+	return nil
+}
+
+type lightStateJSON struct {
+	Color     *LightHSBK  `json:"color"`
+	Reserved  uint16      `json:"reserved,omitempty"`
+	Power     *uint16     `json:"power,omitempty"`
+	On        *bool       `json:"on,omitempty"`
+	Label     DeviceLabel `json:"label"`
+	ReservedB uint64      `json:"reserved_b,omitempty"`
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+func (ls *LightState) MarshalJSON() ([]byte, error) {
+	power := newPowerLevelJSON(ls.Power)
+
+	return json.Marshal(lightStateJSON{
+		Color:     ls.Color,
+		Reserved:  ls.Reserved,
+		Power:     power.Level,
+		On:        power.On,
+		Label:     ls.Label,
+		ReservedB: ls.ReservedB,
+	})
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+// The power level can be provided as either the raw "power" or as the boolean
+// "on" field.
+func (ls *LightState) UnmarshalJSON(data []byte) error {
+	if ls.Color == nil {
+		ls.Color = &LightHSBK{}
+	}
+
+	aux := lightStateJSON{
+		Color:     ls.Color,
+		Reserved:  ls.Reserved,
+		Label:     ls.Label,
+		ReservedB: ls.ReservedB,
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	ls.Color = aux.Color
+	ls.Reserved = aux.Reserved
+	ls.Power = jsonPowerLevel(aux.Power, aux.On, ls.Power)
+	ls.Label = aux.Label
+	ls.ReservedB = aux.ReservedB
+
+	return nil
+}
+
+type lightSetPowerJSON struct {
+	Level    *uint16 `json:"level,omitempty"`
+	On       *bool   `json:"on,omitempty"`
+	Duration string  `json:"duration"`
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+// The Duration field is rendered as a duration string (e.g., "1.5s").
+func (lsp *LightSetPower) MarshalJSON() ([]byte, error) {
+	power := newPowerLevelJSON(lsp.Level)
+
+	return json.Marshal(lightSetPowerJSON{
+		Level:    power.Level,
+		On:       power.On,
+		Duration: lsp.Duration.String(),
+	})
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+// The power level can be provided as either the raw "level" or as the boolean
+// "on" field.
+func (lsp *LightSetPower) UnmarshalJSON(data []byte) error {
+	aux := lightSetPowerJSON{Duration: lsp.Duration.String()}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	dur, err := parseJSONDuration(aux.Duration)
+
+	if err != nil {
+		return err
+	}
+
+	lsp.Level = jsonPowerLevel(aux.Level, aux.On, lsp.Level)
+	lsp.Duration = dur
+
+	return nil
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+func (lsp *LightStatePower) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newPowerLevelJSON(lsp.Level))
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+// The power level can be provided as either the raw "level" or as the boolean
+// "on" field.
+func (lsp *LightStatePower) UnmarshalJSON(data []byte) error {
+	var aux powerLevelJSON
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	lsp.Level = jsonPowerLevel(aux.Level, aux.On, lsp.Level)
+
+	return nil
+}
+
+// jsonPowerLevel returns the power level from its JSON representation. The
+// raw level takes precedence over the boolean value. If neither is set the
+// current value is returned.
+func jsonPowerLevel(level *uint16, on *bool, current uint16) uint16 {
+	switch {
+	case level != nil:
+		return *level
+	case on != nil && *on:
+		return uint16(maxUint16)
+	case on != nil:
+		return 0
+	default:
+		return current
+	}
+}
+
+// jsonTimestamp renders a UNIX epoch with nanosecond precision as an RFC 3339
+// timestamp. A zero value is rendered as an empty string.
+func jsonTimestamp(nanoseconds uint64) string {
+	if nanoseconds == 0 {
+		return ""
+	}
+
+	return nsecEpochToTime(nanoseconds).Format(time.RFC3339Nano)
+}
+
+// parseJSONTimestamp is the inverse of jsonTimestamp.
+func parseJSONTimestamp(s string) (uint64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, s)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(t.UnixNano()), nil
+}
+
+// parseJSONDuration parses a duration string (e.g., "1.5s"). None of the
+// durations on the wire can be negative, so negative ones are rejected rather
+// than wrapping around when the packet is marshaled.
+func parseJSONDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(s)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if d < 0 {
+		return 0, fmt.Errorf("invalid duration %q: it can't be negative", s)
+	}
+
+	return d, nil
+}
+
+// parseJSONID parses the hex representation of a 16 byte ID, such as the ID of
+// a group or location.
+func parseJSONID(s string) ([16]byte, error) {
+	var id [16]byte
+
+	if s == "" {
+		return id, nil
+	}
+
+	b, err := hex.DecodeString(s)
+
+	if err != nil {
+		return id, err
+	}
+
+	if len(b) != len(id) {
+		return id, fmt.Errorf("the ID must be %d bytes, got %d", len(id), len(b))
+	}
+
+	copy(id[0:], b)
+
+	return id, nil
+}
+
+// roundPlaces rounds the value to the given number of decimal places.
+func roundPlaces(f float64, places int) float64 {
+	shift := 1.0
+
+	for i := 0; i < places; i++ {
+		shift *= 10
+	}
+
+	return round(f*shift) / shift
+}
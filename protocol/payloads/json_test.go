@@ -0,0 +1,389 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxpayloads
+
+import (
+	"encoding/json"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) TestDeviceLabel_MarshalText(c *C) {
+	data, err := json.Marshal(NewDeviceLabelTrunc([]byte("kitchen")))
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `"kitchen"`)
+
+	var dl DeviceLabel
+
+	c.Assert(json.Unmarshal([]byte(`"bedroom"`), &dl), IsNil)
+	c.Check(dl, Equals, NewDeviceLabelTrunc([]byte("bedroom")))
+
+	err = json.Unmarshal([]byte(`"ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456"`), &dl)
+	c.Check(err, NotNil)
+}
+
+func (*TestSuite) TestDeviceEchoPayload_MarshalText(c *C) {
+	data, err := json.Marshal(NewDeviceEchoPayloadTrunc([]byte("ohai")))
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `"b2hhaQ=="`)
+
+	var dep DeviceEchoPayload
+
+	c.Assert(json.Unmarshal([]byte(`"b2hhaQ=="`), &dep), IsNil)
+	c.Check(dep, Equals, NewDeviceEchoPayloadTrunc([]byte("ohai")))
+
+	err = json.Unmarshal([]byte(`"not base64"`), &dep)
+	c.Check(err, NotNil)
+}
+
+func (*TestSuite) TestEmpty_MarshalJSON(c *C) {
+	data, err := json.Marshal(&Empty{})
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{}`)
+
+	c.Check(json.Unmarshal([]byte(`{"ignored": true}`), &Empty{}), IsNil)
+	c.Check(json.Unmarshal([]byte(`[]`), &Empty{}), NotNil)
+}
+
+func (*TestSuite) TestDeviceStateService_MarshalJSON(c *C) {
+	data, err := json.Marshal(&DeviceStateService{Service: 1, Port: 56700})
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"service":1,"port":56700}`)
+
+	dss := &DeviceStateService{}
+	c.Assert(json.Unmarshal(data, dss), IsNil)
+	c.Check(dss.Service, Equals, uint8(1))
+	c.Check(dss.Port, Equals, uint32(56700))
+}
+
+func (*TestSuite) TestDeviceStateHostInfo_MarshalJSON(c *C) {
+	data, err := json.Marshal(&DeviceStateHostInfo{Signal: 0.5, Tx: 10, Rx: 20})
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"signal":0.5,"tx":10,"rx":20}`)
+
+	dshi := &DeviceStateHostInfo{}
+	c.Assert(json.Unmarshal([]byte(`{"signal":0.5,"tx":10,"rx":20,"reserved":3}`), dshi), IsNil)
+	c.Check(dshi.Signal, Equals, float32(0.5))
+	c.Check(dshi.Tx, Equals, uint32(10))
+	c.Check(dshi.Rx, Equals, uint32(20))
+	c.Check(dshi.Reserved, Equals, int16(3))
+}
+
+func (*TestSuite) TestDeviceStateWifiInfo_MarshalJSON(c *C) {
+	data, err := json.Marshal(&DeviceStateWifiInfo{Signal: 0.25, Tx: 1, Rx: 2})
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"signal":0.25,"tx":1,"rx":2}`)
+
+	dswi := &DeviceStateWifiInfo{}
+	c.Assert(json.Unmarshal(data, dswi), IsNil)
+	c.Check(dswi.Signal, Equals, float32(0.25))
+	c.Check(dswi.Tx, Equals, uint32(1))
+	c.Check(dswi.Rx, Equals, uint32(2))
+}
+
+func (*TestSuite) TestDeviceStateHostFirmware_MarshalJSON(c *C) {
+	dshf := &DeviceStateHostFirmware{
+		Build:   1456790400000000042,
+		Version: 65538,
+	}
+
+	data, err := json.Marshal(dshf)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"build":"2016-03-01T00:00:00.000000042Z","version":65538}`)
+
+	dshf = &DeviceStateHostFirmware{}
+	c.Assert(json.Unmarshal(data, dshf), IsNil)
+	c.Check(dshf.Build, Equals, uint64(1456790400000000042))
+	c.Check(dshf.Version, Equals, uint32(65538))
+
+	// a zero Build value is rendered as an empty string
+	data, err = json.Marshal(&DeviceStateHostFirmware{})
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"build":"","version":0}`)
+
+	err = json.Unmarshal([]byte(`{"build":"yesterday"}`), dshf)
+	c.Check(err, NotNil)
+}
+
+func (*TestSuite) TestDeviceStateWifiFirmware_MarshalJSON(c *C) {
+	dswf := &DeviceStateWifiFirmware{
+		Build:    1456790400000000000,
+		Reserved: 7,
+		Version:  42,
+	}
+
+	data, err := json.Marshal(dswf)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"build":"2016-03-01T00:00:00Z","reserved":7,"version":42}`)
+
+	dswf = &DeviceStateWifiFirmware{}
+	c.Assert(json.Unmarshal(data, dswf), IsNil)
+	c.Check(dswf.Build, Equals, uint64(1456790400000000000))
+	c.Check(dswf.Reserved, Equals, uint64(7))
+	c.Check(dswf.Version, Equals, uint32(42))
+}
+
+func (*TestSuite) TestDeviceStatePower_MarshalJSON(c *C) {
+	data, err := json.Marshal(&DeviceStatePower{Level: 65535})
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"level":65535,"on":true}`)
+
+	data, err = json.Marshal(&DeviceStatePower{})
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"level":0,"on":false}`)
+
+	dsp := &DeviceStatePower{}
+
+	c.Assert(json.Unmarshal([]byte(`{"on":true}`), dsp), IsNil)
+	c.Check(dsp.Level, Equals, uint16(65535))
+
+	c.Assert(json.Unmarshal([]byte(`{"on":false}`), dsp), IsNil)
+	c.Check(dsp.Level, Equals, uint16(0))
+
+	// the raw level takes precedence
+	c.Assert(json.Unmarshal([]byte(`{"level":42,"on":false}`), dsp), IsNil)
+	c.Check(dsp.Level, Equals, uint16(42))
+}
+
+func (*TestSuite) TestDeviceStateLabel_MarshalJSON(c *C) {
+	data, err := json.Marshal(&DeviceStateLabel{Label: NewDeviceLabelTrunc([]byte("test.bulb"))})
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"label":"test.bulb"}`)
+
+	dsl := &DeviceStateLabel{}
+	c.Assert(json.Unmarshal(data, dsl), IsNil)
+	c.Check(dsl.Label, Equals, NewDeviceLabelTrunc([]byte("test.bulb")))
+}
+
+func (*TestSuite) TestDeviceStateVersion_MarshalJSON(c *C) {
+	data, err := json.Marshal(&DeviceStateVersion{Vendor: 1, Product: 22, Version: 3})
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"vendor":1,"product":22,"version":3}`)
+
+	dsv := &DeviceStateVersion{}
+	c.Assert(json.Unmarshal(data, dsv), IsNil)
+	c.Check(*dsv, Equals, DeviceStateVersion{Vendor: 1, Product: 22, Version: 3})
+}
+
+func (*TestSuite) TestDeviceStateInfo_MarshalJSON(c *C) {
+	dsi := &DeviceStateInfo{
+		Time:     1456790400000000000,
+		Uptime:   uint64(90 * time.Minute),
+		Downtime: uint64(5 * time.Second),
+	}
+
+	data, err := json.Marshal(dsi)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"time":"2016-03-01T00:00:00Z","uptime":"1h30m0s","downtime":"5s"}`)
+
+	dsi = &DeviceStateInfo{}
+	c.Assert(json.Unmarshal(data, dsi), IsNil)
+	c.Check(dsi.Time, Equals, uint64(1456790400000000000))
+	c.Check(dsi.Uptime, Equals, uint64(90*time.Minute))
+	c.Check(dsi.Downtime, Equals, uint64(5*time.Second))
+
+	err = json.Unmarshal([]byte(`{"uptime":"forever"}`), dsi)
+	c.Check(err, NotNil)
+}
+
+func (*TestSuite) TestDeviceStateLocation_MarshalJSON(c *C) {
+	dsl := &DeviceStateLocation{
+		Location:  [16]byte{0xde, 0xad, 0xbe, 0xef},
+		Label:     NewDeviceLabelTrunc([]byte("home")),
+		UpdatedAt: 1456790400000000000,
+	}
+
+	data, err := json.Marshal(dsl)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"location":"deadbeef000000000000000000000000","label":"home","updated_at":"2016-03-01T00:00:00Z"}`)
+
+	dsl = &DeviceStateLocation{}
+	c.Assert(json.Unmarshal(data, dsl), IsNil)
+	c.Check(dsl.Location, Equals, [16]byte{0xde, 0xad, 0xbe, 0xef})
+	c.Check(dsl.Label, Equals, NewDeviceLabelTrunc([]byte("home")))
+	c.Check(dsl.UpdatedAt, Equals, uint64(1456790400000000000))
+
+	err = json.Unmarshal([]byte(`{"location":"deadbeef"}`), dsl)
+	c.Check(err, NotNil)
+}
+
+func (*TestSuite) TestDeviceStateGroup_MarshalJSON(c *C) {
+	dsg := &DeviceStateGroup{
+		Group: [16]byte{15: 1},
+		Label: NewDeviceLabelTrunc([]byte("kitchen")),
+	}
+
+	data, err := json.Marshal(dsg)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"group":"00000000000000000000000000000001","label":"kitchen","updated_at":""}`)
+
+	dsg = &DeviceStateGroup{}
+	c.Assert(json.Unmarshal(data, dsg), IsNil)
+	c.Check(dsg.Group, Equals, [16]byte{15: 1})
+	c.Check(dsg.Label, Equals, NewDeviceLabelTrunc([]byte("kitchen")))
+	c.Check(dsg.UpdatedAt, Equals, uint64(0))
+
+	err = json.Unmarshal([]byte(`{"group":"zz"}`), dsg)
+	c.Check(err, NotNil)
+}
+
+func (*TestSuite) TestDeviceEcho_MarshalJSON(c *C) {
+	data, err := json.Marshal(&DeviceEcho{Payload: NewDeviceEchoPayloadTrunc([]byte("ohai"))})
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"payload":"b2hhaQ=="}`)
+
+	de := &DeviceEcho{}
+	c.Assert(json.Unmarshal(data, de), IsNil)
+	c.Check(de.Payload, Equals, NewDeviceEchoPayloadTrunc([]byte("ohai")))
+}
+
+func (*TestSuite) TestLightHSBK_MarshalJSON(c *C) {
+	hsbk := &LightHSBK{
+		Hue:        21845,
+		Saturation: 65535,
+		Brightness: 32768,
+		Kelvin:     3500,
+	}
+
+	data, err := json.Marshal(hsbk)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"hue":21845,"hue_degrees":120,"saturation":65535,"saturation_percent":100,"brightness":32768,"brightness_percent":50,"kelvin":3500}`)
+
+	//
+	// Test that the raw values round trip
+	//
+	hsbk = &LightHSBK{}
+	c.Assert(json.Unmarshal(data, hsbk), IsNil)
+	c.Check(*hsbk, Equals, LightHSBK{Hue: 21845, Saturation: 65535, Brightness: 32768, Kelvin: 3500})
+
+	//
+	// Test that human units are used if the raw values are missing
+	//
+	hsbk = &LightHSBK{}
+	c.Assert(json.Unmarshal([]byte(`{"hue_degrees":180,"saturation_percent":50,"brightness_percent":25,"kelvin":2500}`), hsbk), IsNil)
+	c.Check(hsbk.Hue, Equals, uint16(32768))
+	c.Check(hsbk.Saturation, Equals, uint16(32768))
+	c.Check(hsbk.Brightness, Equals, uint16(16384))
+	c.Check(hsbk.Kelvin, Equals, uint16(2500))
+
+	//
+	// Test that missing values are left untouched
+	//
+	c.Assert(json.Unmarshal([]byte(`{"brightness":1}`), hsbk), IsNil)
+	c.Check(*hsbk, Equals, LightHSBK{Hue: 32768, Saturation: 32768, Brightness: 1, Kelvin: 2500})
+}
+
+func (*TestSuite) TestLightSetColor_MarshalJSON(c *C) {
+	lsc := &LightSetColor{
+		Color:    &LightHSBK{Hue: 1, Saturation: 2, Brightness: 3, Kelvin: 4},
+		Duration: 1500 * time.Millisecond,
+	}
+
+	data, err := json.Marshal(lsc)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"color":{"hue":1,"hue_degrees":0.01,"saturation":2,"saturation_percent":0,"brightness":3,"brightness_percent":0,"kelvin":4},"duration":"1.5s"}`)
+
+	lsc = &LightSetColor{}
+	c.Assert(json.Unmarshal(data, lsc), IsNil)
+	c.Assert(lsc.Color, NotNil)
+	c.Check(*lsc.Color, Equals, LightHSBK{Hue: 1, Saturation: 2, Brightness: 3, Kelvin: 4})
+	c.Check(lsc.Duration, Equals, 1500*time.Millisecond)
+
+	err = json.Unmarshal([]byte(`{"duration":"soon"}`), lsc)
+	c.Check(err, NotNil)
+
+	// negative durations would wrap around on the wire
+	err = json.Unmarshal([]byte(`{"duration":"-1s"}`), lsc)
+	c.Check(err, ErrorMatches, `invalid duration "-1s": it can't be negative`)
+}
+
+func (*TestSuite) TestLightSetWaveform_MarshalJSON(c *C) {
+	lsw := &LightSetWaveform{
+		Transient: true,
+		Color:     &LightHSBK{Hue: 1, Saturation: 2, Brightness: 3, Kelvin: 4},
+		Period:    time.Second,
+		Cycles:    2.5,
+		SkewRatio: -10,
+		Waveform:  WaveformSine,
+	}
+
+	data, err := json.Marshal(lsw)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"transient":true,"color":{"hue":1,"hue_degrees":0.01,"saturation":2,"saturation_percent":0,"brightness":3,"brightness_percent":0,"kelvin":4},"period":"1s","cycles":2.5,"skew_ratio":-10,"waveform":"sine"}`)
+
+	result := &LightSetWaveform{}
+	c.Assert(json.Unmarshal(data, result), IsNil)
+	c.Check(*result.Color, Equals, *lsw.Color)
+	result.Color = lsw.Color
+	c.Check(*result, Equals, *lsw)
+
+	c.Check(json.Unmarshal([]byte(`{"period":"soon"}`), result), NotNil)
+	c.Check(json.Unmarshal([]byte(`{"period":"-1s"}`), result), ErrorMatches, `invalid duration "-1s": it can't be negative`)
+	c.Check(json.Unmarshal([]byte(`{"waveform":"square"}`), result), NotNil)
+	c.Check(json.Unmarshal([]byte(`{"waveform":"Waveform(256)"}`), result), ErrorMatches, `unknown waveform "Waveform\(256\)"`)
+	c.Check(json.Unmarshal([]byte(`{"waveform":"-1"}`), result), ErrorMatches, `unknown waveform "-1"`)
+
+	// the waveforms the lights don't know round-trip too, and can be given
+	// as a number
+	lsw.Waveform = 9
+
+	data, err = json.Marshal(lsw)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Matches, `.*"waveform":"Waveform\(9\)"}`)
+
+	result = &LightSetWaveform{}
+	c.Assert(json.Unmarshal(data, result), IsNil)
+	c.Check(result.Waveform, Equals, Waveform(9))
+
+	c.Assert(json.Unmarshal([]byte(`{"waveform":"200"}`), result), IsNil)
+	c.Check(result.Waveform, Equals, Waveform(200))
+}
+
+func (*TestSuite) TestLightState_MarshalJSON(c *C) {
+	ls := &LightState{
+		Color: &LightHSBK{Kelvin: 9000},
+		Power: 65535,
+		Label: NewDeviceLabelTrunc([]byte("lamp")),
+	}
+
+	data, err := json.Marshal(ls)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"color":{"hue":0,"hue_degrees":0,"saturation":0,"saturation_percent":0,"brightness":0,"brightness_percent":0,"kelvin":9000},"power":65535,"on":true,"label":"lamp"}`)
+
+	ls = &LightState{}
+	c.Assert(json.Unmarshal(data, ls), IsNil)
+	c.Assert(ls.Color, NotNil)
+	c.Check(ls.Color.Kelvin, Equals, uint16(9000))
+	c.Check(ls.Power, Equals, uint16(65535))
+	c.Check(ls.Label, Equals, NewDeviceLabelTrunc([]byte("lamp")))
+
+	c.Assert(json.Unmarshal([]byte(`{"on":false}`), ls), IsNil)
+	c.Check(ls.Power, Equals, uint16(0))
+}
+
+func (*TestSuite) TestLightSetPower_MarshalJSON(c *C) {
+	data, err := json.Marshal(&LightSetPower{Level: 65535, Duration: time.Second})
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"level":65535,"on":true,"duration":"1s"}`)
+
+	lsp := &LightSetPower{}
+	c.Assert(json.Unmarshal([]byte(`{"on":true,"duration":"250ms"}`), lsp), IsNil)
+	c.Check(lsp.Level, Equals, uint16(65535))
+	c.Check(lsp.Duration, Equals, 250*time.Millisecond)
+
+	err = json.Unmarshal([]byte(`{"on":true,"duration":"-250ms"}`), lsp)
+	c.Check(err, ErrorMatches, `invalid duration "-250ms": it can't be negative`)
+}
+
+func (*TestSuite) TestLightStatePower_MarshalJSON(c *C) {
+	data, err := json.Marshal(&LightStatePower{Level: 0})
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"level":0,"on":false}`)
+
+	lsp := &LightStatePower{}
+	c.Assert(json.Unmarshal([]byte(`{"level":65535}`), lsp), IsNil)
+	c.Check(lsp.Level, Equals, uint16(65535))
+}
@@ -0,0 +1,171 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxpayloads
+
+import (
+	"math"
+	"sync"
+)
+
+// KelvinToRGB returns an 8-bit RGB approximation of white light at the color
+// temperature, for previewing a Kelvin value on a screen. The color is
+// relative to the white point of the sRGB color space, so RGBWhiteKelvin is
+// pure white (#ffffff), lower values are orange, and higher values are blue.
+// This matches how the RGBA function renders unsaturated colors.
+func KelvinToRGB(kelvin uint16) (r, g, b uint8) {
+	rf, gf, bf := kelvinWhitePoint(kelvin)
+
+	return uint8(round(rf * 255)), uint8(round(gf * 255)), uint8(round(bf * 255))
+}
+
+// RGBToKelvin returns the color temperature, between MinKelvin and MaxKelvin,
+// whose white is closest to the RGB color. It's the inverse of KelvinToRGB,
+// and is useful for matching a bulb to the white point of a screen or photo.
+// The color is scaled so its brightest channel is fully on before it's
+// compared, so the brightness of the color is ignored. Black has no white
+// point, so RGBWhiteKelvin is returned for it.
+func RGBToKelvin(r, g, b uint8) uint16 {
+	if r == 0 && g == 0 && b == 0 {
+		return RGBWhiteKelvin
+	}
+
+	// scale the color so its brightest channel is fully on, like the
+	// previews returned by KelvinToRGB
+	scale := 255 / math.Max(float64(r), math.Max(float64(g), float64(b)))
+	rt, gt, bt := float64(r)*scale, float64(g)*scale, float64(b)*scale
+
+	// the white points don't change monotonically with the temperature:
+	// the curve fit changes at 6600K, and the red channel rises again just
+	// above it. So every temperature is checked, rather than searching for
+	// the first one that's cool enough. The closest preview wins, and the
+	// temperatures with the same preview are told apart by their unrounded
+	// white points.
+	kelvinPreviewsOnce.Do(initKelvinPreviews)
+
+	var (
+		best                uint16
+		bestDist, bestExact = math.Inf(1), math.Inf(1)
+	)
+
+	for i, kp := range kelvinPreviews {
+		dist := sqDist(kp.preview, rt, gt, bt)
+		exact := sqDist(kp.exact, rt, gt, bt)
+
+		if dist < bestDist || (dist == bestDist && exact < bestExact) {
+			best, bestDist, bestExact = MinKelvin+uint16(i), dist, exact
+		}
+	}
+
+	return best
+}
+
+// kelvinPreview is the white point of a color temperature, as returned by
+// KelvinToRGB and before it's rounded, in the range 0-255.
+type kelvinPreview struct {
+	preview [3]float64
+	exact   [3]float64
+}
+
+var (
+	kelvinPreviews     []kelvinPreview // from MinKelvin to MaxKelvin
+	kelvinPreviewsOnce sync.Once
+)
+
+func initKelvinPreviews() {
+	kelvinPreviews = make([]kelvinPreview, int(MaxKelvin-MinKelvin)+1)
+
+	for i := range kelvinPreviews {
+		r, g, b := kelvinWhitePoint(MinKelvin + uint16(i))
+
+		kelvinPreviews[i] = kelvinPreview{
+			preview: [3]float64{round(r * 255), round(g * 255), round(b * 255)},
+			exact:   [3]float64{r * 255, g * 255, b * 255},
+		}
+	}
+}
+
+// sqDist returns the squared distance between two RGB colors.
+func sqDist(c [3]float64, r, g, b float64) float64 {
+	return (c[0]-r)*(c[0]-r) + (c[1]-g)*(c[1]-g) + (c[2]-b)*(c[2]-b)
+}
+
+// WarmDimKelvin returns the color temperature for the brightness using a
+// "warm dim" curve, which mimics an incandescent bulb by lowering the color
+// temperature as the light is dimmed. A full brightness returns maxKelvin,
+// and the Kelvin value falls towards minKelvin as the brightness approaches
+// 0. The curve falls faster at lower brightness levels, where the eye is most
+// sensitive to the warmth of the light. Typical values are 2000 and 3000.
+func WarmDimKelvin(brightness, minKelvin, maxKelvin uint16) uint16 {
+	if minKelvin > maxKelvin {
+		minKelvin, maxKelvin = maxKelvin, minKelvin
+	}
+
+	frac := math.Sqrt(float64(brightness) / maxUint16)
+
+	return minKelvin + uint16(round(frac*float64(maxKelvin-minKelvin)))
+}
+
+// WarmDim returns a copy of the color with the Kelvin value set using the
+// WarmDimKelvin curve for its Brightness. This can be used when building a
+// LightSetColor payload, so that dimming a white light makes it warmer:
+//
+//	color := &lifxpayloads.LightHSBK{Brightness: 16384}
+//	payload := &lifxpayloads.LightSetColor{Color: lifxpayloads.WarmDim(color, 2000, 3000)}
+func WarmDim(hsbk *LightHSBK, minKelvin, maxKelvin uint16) *LightHSBK {
+	if hsbk == nil {
+		return nil
+	}
+
+	cp := *hsbk
+	cp.Kelvin = WarmDimKelvin(hsbk.Brightness, minKelvin, maxKelvin)
+
+	return &cp
+}
+
+// kelvinWhitePoint returns the RGB values, in the range 0-1, of white light at
+// the color temperature. The values are relative to RGBWhiteKelvin, so that
+// temperature (as well as 0) is pure white (1, 1, 1).
+func kelvinWhitePoint(kelvin uint16) (r, g, b float64) {
+	if kelvin == 0 || kelvin == RGBWhiteKelvin {
+		return 1, 1, 1
+	}
+
+	r, g, b = blackbodyRGB(float64(kelvin))
+	rw, gw, bw := blackbodyRGB(float64(RGBWhiteKelvin))
+
+	r, g, b = r/rw, g/gw, b/bw
+
+	// normalize so the brightest channel is fully on
+	max := math.Max(r, math.Max(g, b))
+
+	return r / max, g / max, b / max
+}
+
+// blackbodyRGB approximates the RGB color, in the range 0-1, of a black body
+// radiator at the color temperature. This uses the curve fit popularized by
+// Tanner Helland, which is accurate enough for previewing colors between
+// 1000K and 40000K.
+func blackbodyRGB(kelvin float64) (r, g, b float64) {
+	temp := kelvin / 100
+
+	if temp <= 66 {
+		r = 255
+		g = 99.4708025861*math.Log(temp) - 161.1195681661
+	} else {
+		r = 329.698727446 * math.Pow(temp-60, -0.1332047592)
+		g = 288.1221695283 * math.Pow(temp-60, -0.0755148492)
+	}
+
+	switch {
+	case temp >= 66:
+		b = 255
+	case temp <= 19:
+		b = 0
+	default:
+		b = 138.5177312231*math.Log(temp-10) - 305.0447927307
+	}
+
+	return clamp01(r / 255), clamp01(g / 255), clamp01(b / 255)
+}
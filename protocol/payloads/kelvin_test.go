@@ -0,0 +1,92 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxpayloads
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) Test_KelvinToRGB(c *C) {
+	var r, g, b uint8
+
+	r, g, b = KelvinToRGB(RGBWhiteKelvin)
+	c.Check([]uint8{r, g, b}, DeepEquals, []uint8{255, 255, 255})
+
+	// warm white is orange
+	r, g, b = KelvinToRGB(2700)
+	c.Check(r, Equals, uint8(255))
+	c.Check(g < r && b < g, Equals, true, Commentf("rgb: %d %d %d", r, g, b))
+
+	// cool white is blue
+	r, g, b = KelvinToRGB(MaxKelvin)
+	c.Check(b, Equals, uint8(255))
+	c.Check(r < g && g < b, Equals, true, Commentf("rgb: %d %d %d", r, g, b))
+
+	// the preview should match how an unsaturated color is rendered
+	for _, kelvin := range []uint16{MinKelvin, 2500, 3500, 5000, 7500, MaxKelvin} {
+		r, g, b = KelvinToRGB(kelvin)
+		c.Check((&LightHSBK{Brightness: 65535, Kelvin: kelvin}).Hex(), Equals, FromRGB(r, g, b).Hex())
+	}
+}
+
+func (*TestSuite) Test_RGBToKelvin(c *C) {
+	c.Check(RGBToKelvin(255, 255, 255), Equals, RGBWhiteKelvin)
+	c.Check(RGBToKelvin(128, 128, 128), Equals, RGBWhiteKelvin)
+	c.Check(RGBToKelvin(0, 0, 0), Equals, RGBWhiteKelvin)
+
+	// colors beyond the supported range should be clamped
+	c.Check(RGBToKelvin(255, 0, 0), Equals, MinKelvin)
+	c.Check(RGBToKelvin(0, 0, 255), Equals, MaxKelvin)
+
+	// the white points aren't monotonic just above 6600K, which used to
+	// throw these off
+	c.Check(RGBToKelvin(KelvinToRGB(6600)), Equals, uint16(6600))
+
+	// every preview should map back to a temperature with the same preview,
+	// and (roughly) the same temperature; some temperatures close to each
+	// other share a preview, so they can't all be told apart
+	for kelvin := MinKelvin; kelvin <= MaxKelvin; kelvin++ {
+		r, g, b := KelvinToRGB(kelvin)
+		result := RGBToKelvin(r, g, b)
+		diff := int(result) - int(kelvin)
+
+		if r2, g2, b2 := KelvinToRGB(result); r2 != r || g2 != g || b2 != b || diff < -100 || diff > 100 {
+			c.Errorf("%dK did not survive a round trip: got %dK", kelvin, result)
+		}
+	}
+
+	// the brightness of the color doesn't matter, apart from rounding
+	r, g, b := KelvinToRGB(2700)
+	result := RGBToKelvin(r/2, g/2, b/2)
+	c.Check(result >= 2650 && result <= 2750, Equals, true, Commentf("got %dK", result))
+}
+
+func (*TestSuite) Test_WarmDimKelvin(c *C) {
+	c.Check(WarmDimKelvin(65535, 2000, 3000), Equals, uint16(3000))
+	c.Check(WarmDimKelvin(0, 2000, 3000), Equals, uint16(2000))
+	c.Check(WarmDimKelvin(16384, 2000, 3000), Equals, uint16(2500))
+
+	// the order of the temperatures shouldn't matter
+	c.Check(WarmDimKelvin(65535, 3000, 2000), Equals, uint16(3000))
+
+	// the Kelvin value should never rise as the light is dimmed
+	last := uint16(3000)
+
+	for bri := 65535; bri >= 0; bri -= 1024 {
+		kelvin := WarmDimKelvin(uint16(bri), 2000, 3000)
+		c.Assert(kelvin <= last, Equals, true)
+		last = kelvin
+	}
+}
+
+func (*TestSuite) Test_WarmDim(c *C) {
+	hsbk := &LightHSBK{Hue: 100, Saturation: 200, Brightness: 16384, Kelvin: 9000}
+
+	dimmed := WarmDim(hsbk, 2000, 3000)
+	c.Check(*dimmed, Equals, LightHSBK{Hue: 100, Saturation: 200, Brightness: 16384, Kelvin: 2500})
+	c.Check(hsbk.Kelvin, Equals, uint16(9000))
+
+	c.Check(WarmDim(nil, 2000, 3000), IsNil)
+}
@@ -10,19 +10,32 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"time"
 )
 
-// the Duration field within the protocol specification determines how long an
-// action takes to finish -- this is in milliseconds and is a uint32 on the wire
-// so, we need to calculate the maximum Duration value we can support in uint32:
-// 49 days, 17 hours, 2 minutes, 47.295 seconds
-const lightMaxDuration = time.Millisecond * time.Duration(^uint32(0))
+// MaxDuration is the longest duration of a transition, or period of a
+// waveform, that can be sent to a light. The Duration field within the
+// protocol specification is in milliseconds, and is a uint32 on the wire, so
+// it's 49 days, 17 hours, 2 minutes, 47.295 seconds.
+const MaxDuration = time.Millisecond * time.Duration(^uint32(0))
 
 // ErrLightColorNotSet is the error returned when the color is not set
 // on the strut trying to be marshaled.
 var ErrLightColorNotSet = errors.New("a *lifxpayloads.LightHSBK must be set on the Color field before marshaling")
 
+const (
+	// MinKelvin is the lowest color temperature supported by LIFX bulbs.
+	MinKelvin uint16 = 1500
+
+	// MaxKelvin is the highest color temperature supported by LIFX bulbs.
+	MaxKelvin uint16 = 9000
+)
+
+// ErrKelvinRange is the error returned by NewHSBK when the Kelvin value is
+// outside of the range supported by LIFX bulbs.
+var ErrKelvinRange = fmt.Errorf("the Kelvin value must be between %d and %d", MinKelvin, MaxKelvin)
+
 // LightHSBK is the struct used to represent the color and color temperature
 // of a light.
 //
@@ -42,17 +55,64 @@ type LightHSBK struct {
 	Kelvin uint16
 }
 
+// NewHSBK returns a *LightHSBK using human-friendly units. The hue is in
+// degrees around the color wheel, and values outside of 0-360 wrap around.
+// The saturation and brightness are percentages (0-100), and the Kelvin value
+// must be between MinKelvin and MaxKelvin.
+//
+// The values are rounded to the nearest value on the wire, so the values
+// returned by the HueDegrees, SaturationPercent, and BrightnessPercent
+// functions can be passed back in to get the same *LightHSBK.
+func NewHSBK(hueDegrees, satPercent, brightPercent float64, kelvin uint16) (*LightHSBK, error) {
+	if kelvin < MinKelvin || kelvin > MaxKelvin {
+		return nil, ErrKelvinRange
+	}
+
+	if math.IsNaN(hueDegrees) || math.IsInf(hueDegrees, 0) {
+		return nil, fmt.Errorf("the hue must be a finite number of degrees, got %v", hueDegrees)
+	}
+
+	if satPercent < 0 || satPercent > 100 || math.IsNaN(satPercent) {
+		return nil, fmt.Errorf("the saturation must be a percentage between 0 and 100, got %v", satPercent)
+	}
+
+	if brightPercent < 0 || brightPercent > 100 || math.IsNaN(brightPercent) {
+		return nil, fmt.Errorf("the brightness must be a percentage between 0 and 100, got %v", brightPercent)
+	}
+
+	return &LightHSBK{
+		Hue:        degreesToHue(hueDegrees),
+		Saturation: percentToUint16(satPercent),
+		Brightness: percentToUint16(brightPercent),
+		Kelvin:     kelvin,
+	}, nil
+}
+
+// HueDegrees returns the Hue in degrees around the color wheel, in the range
+// 0 to just under 360.
+func (hsbk *LightHSBK) HueDegrees() float64 {
+	return hueToDegrees(hsbk.Hue)
+}
+
+// SaturationPercent returns the Saturation as a percentage (0-100).
+func (hsbk *LightHSBK) SaturationPercent() float64 {
+	return uint16ToPercent(hsbk.Saturation)
+}
+
+// BrightnessPercent returns the Brightness as a percentage (0-100).
+func (hsbk *LightHSBK) BrightnessPercent() float64 {
+	return uint16ToPercent(hsbk.Brightness)
+}
+
 func (hsbk *LightHSBK) String() string {
 	if hsbk == nil {
 		return "<*lifxpayloads.LightHSBK(nil)>"
 	}
 
-	// scale hue value to 0-359
-	hue := colorRange(float64(hsbk.Hue))
-
-	// scale saturation and brightness values to 0-100
-	sat := percentageRange(float64(hsbk.Saturation))
-	bri := percentageRange(float64(hsbk.Brightness))
+	// the values are truncated so that they don't round up past 359° / 100%
+	hue := uint16(hsbk.HueDegrees())
+	sat := uint8(hsbk.SaturationPercent())
+	bri := uint8(hsbk.BrightnessPercent())
 
 	return fmt.Sprintf(
 		"<*lifxpayloads.LightHSBK(%p): Hue: %d (%d°), Saturation: %d (%d%%), Brightness: %d (%d%%), Kelvin: %d>",
@@ -143,7 +203,7 @@ func (lsc *LightSetColor) MarshalPacket(order binary.ByteOrder) ([]byte, error)
 	}
 
 	// if the length of the Duration would overflow uint32
-	if lsc.Duration > lightMaxDuration {
+	if lsc.Duration > MaxDuration {
 		return nil, errors.New("LightSetColor.Duration would overflow uint32")
 	}
 
@@ -345,7 +405,7 @@ func (lsp *LightSetPower) String() string {
 // interface.
 func (lsp *LightSetPower) MarshalPacket(order binary.ByteOrder) ([]byte, error) {
 	// if the length of the Duration would overflow uint32
-	if lsp.Duration > lightMaxDuration {
+	if lsp.Duration > MaxDuration {
 		return nil, errors.New("LightSetPower.Duration would overflow uint32")
 	}
 
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"math"
 	"time"
 
 	. "gopkg.in/check.v1"
@@ -28,6 +29,56 @@ func (*TestSuite) TestLightHSBK_String(c *C) {
 	c.Check(str, Equals, exp)
 }
 
+func (*TestSuite) Test_NewHSBK(c *C) {
+	hsbk, err := NewHSBK(120, 100, 50, 3500)
+	c.Assert(err, IsNil)
+	c.Check(*hsbk, Equals, LightHSBK{Hue: 21845, Saturation: 65535, Brightness: 32768, Kelvin: 3500})
+
+	// hues outside of the color wheel should wrap around
+	hsbk, err = NewHSBK(-90, 0, 0, MinKelvin)
+	c.Assert(err, IsNil)
+	c.Check(hsbk.Hue, Equals, uint16(49152))
+
+	hsbk, err = NewHSBK(360, 0, 0, MaxKelvin)
+	c.Assert(err, IsNil)
+	c.Check(hsbk.Hue, Equals, uint16(0))
+
+	_, err = NewHSBK(0, 0, 0, MinKelvin-1)
+	c.Check(err, Equals, ErrKelvinRange)
+
+	_, err = NewHSBK(0, 0, 0, MaxKelvin+1)
+	c.Check(err, Equals, ErrKelvinRange)
+
+	_, err = NewHSBK(0, 100.1, 0, 3500)
+	c.Check(err, ErrorMatches, "the saturation must be a percentage between 0 and 100, got 100.1")
+
+	_, err = NewHSBK(0, 0, -1, 3500)
+	c.Check(err, ErrorMatches, "the brightness must be a percentage between 0 and 100, got -1")
+
+	_, err = NewHSBK(math.Inf(1), 0, 0, 3500)
+	c.Check(err, ErrorMatches, "the hue must be a finite number of degrees, got \\+Inf")
+}
+
+func (*TestSuite) TestLightHSBK_Accessors(c *C) {
+	hsbk := &LightHSBK{Hue: 32768, Saturation: 65535, Brightness: 0, Kelvin: 3500}
+	c.Check(hsbk.HueDegrees(), Equals, float64(180))
+	c.Check(hsbk.SaturationPercent(), Equals, float64(100))
+	c.Check(hsbk.BrightnessPercent(), Equals, float64(0))
+
+	// the human-friendly values should survive a round trip
+	for i := 0; i <= 65535; i += 7 {
+		v := uint16(i)
+		hsbk = &LightHSBK{Hue: v, Saturation: v, Brightness: ^v, Kelvin: 2700}
+
+		result, err := NewHSBK(hsbk.HueDegrees(), hsbk.SaturationPercent(), hsbk.BrightnessPercent(), hsbk.Kelvin)
+		c.Assert(err, IsNil)
+
+		if *result != *hsbk {
+			c.Fatalf("%s did not survive a round trip: %s", hsbk, result)
+		}
+	}
+}
+
 func (t *TestSuite) TestLightHSBK_MarshalPacket(c *C) {
 	var packet []byte
 	var err error
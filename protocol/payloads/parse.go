@@ -0,0 +1,352 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxpayloads
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParseColor parses a human-friendly color string in to a *LightHSBK. The
+// string is case-insensitive, and can be any of:
+//
+//   - a CSS color name: "cornflowerblue" (see NamedColor)
+//   - a hex color: "#ff8800" or "#f80" (see FromHex)
+//   - a CSS rgb() color: "rgb(255, 136, 0)" or "rgb(100% 50% 0%)"
+//   - a CSS hsl() color: "hsl(32, 100%, 50%)"
+//   - a LIFX color string: "hue:120 saturation:1.0 brightness:0.5 kelvin:3500"
+//
+// The LIFX color string is the format used by the LIFX HTTP API. It's a list
+// of space-separated modifiers, which can follow any of the other forms to
+// adjust the color (e.g., "red brightness:0.5"). The supported modifiers are:
+//
+//   - hue:[0-360]
+//   - saturation:[0.0-1.0]
+//   - brightness:[0.0-1.0]
+//   - kelvin:[1500-9000]
+//   - rgb:[0-255],[0-255],[0-255]
+//
+// Like the LIFX HTTP API, the kelvin modifier sets the saturation to 0 (white)
+// unless the saturation modifier is also given. When only modifiers are given,
+// the color starts as a fully bright white at RGBWhiteKelvin, and the hue
+// modifier makes the color fully saturated unless the saturation modifier is
+// also given.
+//
+// The alpha value of rgba() and hsla() colors is accepted but discarded.
+func ParseColor(s string) (*LightHSBK, error) {
+	str := strings.ToLower(strings.TrimSpace(s))
+
+	if str == "" {
+		return nil, fmt.Errorf("%q is not a valid color: it's empty", s)
+	}
+
+	base, rest, err := parseBaseColor(str)
+
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a valid color: %s", s, err)
+	}
+
+	hsbk, err := applyColorModifiers(base, rest)
+
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a valid color: %s", s, err)
+	}
+
+	return hsbk, nil
+}
+
+// parseBaseColor parses the color at the beginning of the string, if there
+// is one, and returns the remainder of the string. If the string begins with
+// a modifier the returned *LightHSBK is nil.
+func parseBaseColor(str string) (*LightHSBK, string, error) {
+	for _, fn := range []string{"rgba(", "rgb(", "hsla(", "hsl("} {
+		if !strings.HasPrefix(str, fn) {
+			continue
+		}
+
+		end := strings.IndexByte(str, ')')
+
+		if end == -1 {
+			return nil, "", fmt.Errorf("%s) is missing its closing parenthesis", fn)
+		}
+
+		args := str[len(fn):end]
+
+		var hsbk *LightHSBK
+		var err error
+
+		if strings.HasPrefix(fn, "rgb") {
+			hsbk, err = parseRGBFunc(args)
+		} else {
+			hsbk, err = parseHSLFunc(args)
+		}
+
+		if err != nil {
+			return nil, "", fmt.Errorf("%s): %s", fn, err)
+		}
+
+		return hsbk, str[end+1:], nil
+	}
+
+	first := str
+
+	if i := strings.IndexFunc(str, unicode.IsSpace); i != -1 {
+		first = str[:i]
+	}
+
+	// the string begins with a modifier
+	if strings.Contains(first, ":") {
+		return nil, str, nil
+	}
+
+	if hsbk, ok := NamedColor(first); ok {
+		return hsbk, str[len(first):], nil
+	}
+
+	if strings.HasPrefix(first, "#") {
+		hsbk, err := FromHex(first)
+
+		if err != nil {
+			return nil, "", fmt.Errorf("%s is not a valid hex color", first)
+		}
+
+		return hsbk, str[len(first):], nil
+	}
+
+	return nil, "", fmt.Errorf("unknown color name %q", first)
+}
+
+// applyColorModifiers applies the LIFX-style modifiers in str to the base
+// color. The base color can be nil if there are no other colors in the string.
+func applyColorModifiers(base *LightHSBK, str string) (*LightHSBK, error) {
+	var hue, sat, bri *float64
+	var kelvin *uint16
+
+	for _, mod := range strings.Fields(str) {
+		parts := strings.SplitN(mod, ":", 2)
+
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%q is not a modifier, expected the form key:value", mod)
+		}
+
+		key, value := parts[0], parts[1]
+
+		switch key {
+		case "rgb":
+			if base != nil {
+				return nil, fmt.Errorf("%q cannot be used with another color", mod)
+			}
+
+			hsbk, err := parseRGBModifier(value)
+
+			if err != nil {
+				return nil, fmt.Errorf("%q: %s", mod, err)
+			}
+
+			base = hsbk
+		case "kelvin":
+			u64, err := strconv.ParseUint(value, 10, 16)
+
+			if err != nil || uint16(u64) < MinKelvin || uint16(u64) > MaxKelvin {
+				return nil, fmt.Errorf("%q: kelvin must be between %d and %d", mod, MinKelvin, MaxKelvin)
+			}
+
+			k := uint16(u64)
+			kelvin = &k
+		case "hue":
+			f, err := parseColorFloat(value, 0, 360)
+
+			if err != nil {
+				return nil, fmt.Errorf("%q: hue must be between 0 and 360", mod)
+			}
+
+			hue = &f
+		case "saturation", "brightness":
+			f, err := parseColorFloat(value, 0, 1)
+
+			if err != nil {
+				return nil, fmt.Errorf("%q: %s must be between 0.0 and 1.0", mod, key)
+			}
+
+			if key == "saturation" {
+				sat = &f
+			} else {
+				bri = &f
+			}
+		default:
+			return nil, fmt.Errorf("%q is not a known modifier", key)
+		}
+	}
+
+	hsbk := &LightHSBK{Brightness: uint16(maxUint16), Kelvin: RGBWhiteKelvin}
+
+	if base != nil {
+		*hsbk = *base
+	}
+
+	if hue != nil {
+		hsbk.Hue = degreesToHue(*hue)
+
+		// a hue on its own would otherwise be white
+		if base == nil {
+			hsbk.Saturation = uint16(maxUint16)
+		}
+	}
+
+	if kelvin != nil {
+		hsbk.Kelvin = *kelvin
+		hsbk.Saturation = 0
+	}
+
+	if sat != nil {
+		hsbk.Saturation = percentToUint16(*sat * 100)
+	}
+
+	if bri != nil {
+		hsbk.Brightness = percentToUint16(*bri * 100)
+	}
+
+	return hsbk, nil
+}
+
+// parseRGBModifier parses the value of the rgb:[0-255],[0-255],[0-255]
+// modifier.
+func parseRGBModifier(value string) (*LightHSBK, error) {
+	parts := strings.Split(value, ",")
+
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("expected three comma-separated values")
+	}
+
+	var rgb [3]uint8
+
+	for i, part := range parts {
+		u64, err := strconv.ParseUint(part, 10, 8)
+
+		if err != nil {
+			return nil, fmt.Errorf("%q must be between 0 and 255", part)
+		}
+
+		rgb[i] = uint8(u64)
+	}
+
+	return FromRGB(rgb[0], rgb[1], rgb[2]), nil
+}
+
+// parseRGBFunc parses the arguments to the CSS rgb() and rgba() functions.
+// The channels can be numbers (0-255) or percentages.
+func parseRGBFunc(args string) (*LightHSBK, error) {
+	values, err := splitColorFuncArgs(args)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rgb [3]float64
+
+	for i, value := range values[:3] {
+		if strings.HasSuffix(value, "%") {
+			rgb[i], err = parseColorFloat(strings.TrimSuffix(value, "%"), 0, 100)
+			rgb[i] /= 100
+		} else {
+			rgb[i], err = parseColorFloat(value, 0, 255)
+			rgb[i] /= 255
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%q must be between 0 and 255, or 0%% and 100%%", value)
+		}
+	}
+
+	return fromRGB(rgb[0], rgb[1], rgb[2]), nil
+}
+
+// parseHSLFunc parses the arguments to the CSS hsl() and hsla() functions.
+// The hue is in degrees, and the saturation and lightness are percentages.
+func parseHSLFunc(args string) (*LightHSBK, error) {
+	values, err := splitColorFuncArgs(args)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hue, err := strconv.ParseFloat(strings.TrimSuffix(values[0], "deg"), 64)
+
+	if err != nil || math.IsNaN(hue) || math.IsInf(hue, 0) {
+		return nil, fmt.Errorf("%q is not a valid hue", values[0])
+	}
+
+	sat, err := parseColorFloat(strings.TrimSuffix(values[1], "%"), 0, 100)
+
+	if err != nil {
+		return nil, fmt.Errorf("%q must be between 0%% and 100%%", values[1])
+	}
+
+	light, err := parseColorFloat(strings.TrimSuffix(values[2], "%"), 0, 100)
+
+	if err != nil {
+		return nil, fmt.Errorf("%q must be between 0%% and 100%%", values[2])
+	}
+
+	sat, light = sat/100, light/100
+
+	// chroma, and the amount of white added to each channel
+	chroma := (1 - math.Abs(2*light-1)) * sat
+	m := light - chroma/2
+
+	hue = math.Mod(hue, 360)
+
+	if hue < 0 {
+		hue += 360
+	}
+
+	r, g, b := hueToRGB(hue)
+
+	return fromRGB(m+chroma*r, m+chroma*g, m+chroma*b), nil
+}
+
+// splitColorFuncArgs splits the arguments to a CSS color function, which can
+// be separated by commas or spaces, with an optional alpha value at the end.
+// The alpha value is validated but not returned.
+func splitColorFuncArgs(args string) ([]string, error) {
+	values := strings.Fields(strings.NewReplacer(",", " ", "/", " ").Replace(args))
+
+	switch len(values) {
+	case 3:
+	case 4:
+		alpha := values[3]
+		max := float64(1)
+
+		if strings.HasSuffix(alpha, "%") {
+			alpha, max = strings.TrimSuffix(alpha, "%"), 100
+		}
+
+		if _, err := parseColorFloat(alpha, 0, max); err != nil {
+			return nil, fmt.Errorf("%q is not a valid alpha value", values[3])
+		}
+	default:
+		return nil, fmt.Errorf("expected three values and an optional alpha value, got %d values", len(values))
+	}
+
+	return values[:3], nil
+}
+
+// parseColorFloat parses a float and validates it's between min and max.
+func parseColorFloat(s string, min, max float64) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if math.IsNaN(f) || f < min || f > max {
+		return 0, fmt.Errorf("%v is not between %v and %v", f, min, max)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxpayloads
+
+import (
+	"fmt"
+
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) Test_ParseColor(c *C) {
+	const full = uint16(65535)
+
+	tests := []struct {
+		input string
+		hsbk  LightHSBK
+	}{
+		// CSS names
+		{"red", LightHSBK{Hue: 0, Saturation: full, Brightness: full, Kelvin: RGBWhiteKelvin}},
+		{"Lime", LightHSBK{Hue: 21845, Saturation: full, Brightness: full, Kelvin: RGBWhiteKelvin}},
+		{" BLUE ", LightHSBK{Hue: 43691, Saturation: full, Brightness: full, Kelvin: RGBWhiteKelvin}},
+		{"green", LightHSBK{Hue: 21845, Saturation: full, Brightness: 32896, Kelvin: RGBWhiteKelvin}},
+		{"white", LightHSBK{Brightness: full, Kelvin: RGBWhiteKelvin}},
+		{"black", LightHSBK{Kelvin: RGBWhiteKelvin}},
+		{"rebeccapurple", *FromRGB(0x66, 0x33, 0x99)},
+		{"cornflowerblue", *FromRGB(0x64, 0x95, 0xed)},
+
+		// hex colors
+		{"#ff0000", LightHSBK{Saturation: full, Brightness: full, Kelvin: RGBWhiteKelvin}},
+		{"#F00", LightHSBK{Saturation: full, Brightness: full, Kelvin: RGBWhiteKelvin}},
+		{"#ff8800", *FromRGB(0xff, 0x88, 0x00)},
+
+		// CSS rgb()
+		{"rgb(255, 0, 0)", LightHSBK{Saturation: full, Brightness: full, Kelvin: RGBWhiteKelvin}},
+		{"rgb(255 136 0)", *FromRGB(0xff, 0x88, 0x00)},
+		{"rgb(100%, 0%, 0%)", LightHSBK{Saturation: full, Brightness: full, Kelvin: RGBWhiteKelvin}},
+		{"rgba(255, 136, 0, 0.5)", *FromRGB(0xff, 0x88, 0x00)},
+		{"rgb(255 136 0 / 50%)", *FromRGB(0xff, 0x88, 0x00)},
+
+		// CSS hsl()
+		{"hsl(0, 100%, 50%)", LightHSBK{Saturation: full, Brightness: full, Kelvin: RGBWhiteKelvin}},
+		{"hsl(120deg 100% 25%)", LightHSBK{Hue: 21845, Saturation: full, Brightness: 32768, Kelvin: RGBWhiteKelvin}},
+		{"hsl(-120, 100%, 50%)", LightHSBK{Hue: 43691, Saturation: full, Brightness: full, Kelvin: RGBWhiteKelvin}},
+		{"hsla(0, 0%, 100%, 1)", LightHSBK{Brightness: full, Kelvin: RGBWhiteKelvin}},
+
+		// LIFX color strings
+		{"hue:120 saturation:1.0 brightness:0.5 kelvin:3500", LightHSBK{Hue: 21845, Saturation: full, Brightness: 32768, Kelvin: 3500}},
+		{"hue:120", LightHSBK{Hue: 21845, Saturation: full, Brightness: full, Kelvin: RGBWhiteKelvin}},
+		{"hue:360", LightHSBK{Hue: 0, Saturation: full, Brightness: full, Kelvin: RGBWhiteKelvin}},
+		{"kelvin:2700", LightHSBK{Brightness: full, Kelvin: 2700}},
+		{"kelvin:2700 brightness:0.25", LightHSBK{Brightness: 16384, Kelvin: 2700}},
+		{"saturation:0.5", LightHSBK{Saturation: 32768, Brightness: full, Kelvin: RGBWhiteKelvin}},
+		{"rgb:0,0,255", LightHSBK{Hue: 43691, Saturation: full, Brightness: full, Kelvin: RGBWhiteKelvin}},
+		{"rgb:0,0,255 brightness:0.5", LightHSBK{Hue: 43691, Saturation: full, Brightness: 32768, Kelvin: RGBWhiteKelvin}},
+
+		// modifiers applied to other colors
+		{"red brightness:0.5", LightHSBK{Saturation: full, Brightness: 32768, Kelvin: RGBWhiteKelvin}},
+		{"red hue:120", LightHSBK{Hue: 21845, Saturation: full, Brightness: full, Kelvin: RGBWhiteKelvin}},
+		{"red kelvin:3500", LightHSBK{Brightness: full, Kelvin: 3500}},
+		{"red kelvin:3500 saturation:0.5", LightHSBK{Saturation: 32768, Brightness: full, Kelvin: 3500}},
+		{"#00f saturation:0", LightHSBK{Hue: 43691, Brightness: full, Kelvin: RGBWhiteKelvin}},
+		{"rgb(255, 0, 0) brightness:0", LightHSBK{Saturation: full, Kelvin: RGBWhiteKelvin}},
+		{"hsl(0, 100%, 50%)  kelvin:9000\tsaturation:1", LightHSBK{Saturation: full, Brightness: full, Kelvin: 9000}},
+	}
+
+	for _, test := range tests {
+		hsbk, err := ParseColor(test.input)
+
+		if !c.Check(err, IsNil, Commentf("input: %q", test.input)) {
+			continue
+		}
+
+		c.Check(*hsbk, Equals, test.hsbk, Commentf("input: %q", test.input))
+	}
+}
+
+func (*TestSuite) Test_ParseColor_Errors(c *C) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"", `"" is not a valid color: it's empty`},
+		{"   ", `"   " is not a valid color: it's empty`},
+		{"reddish", `"reddish" is not a valid color: unknown color name "reddish"`},
+		{"#ff88", `"#ff88" is not a valid color: #ff88 is not a valid hex color`},
+		{"#gggggg", `"#gggggg" is not a valid color: #gggggg is not a valid hex color`},
+		{"rgb(255, 0, 0", `"rgb\(255, 0, 0" is not a valid color: rgb\(\) is missing its closing parenthesis`},
+		{"rgb(255, 0)", `"rgb\(255, 0\)" is not a valid color: rgb\(\): expected three values and an optional alpha value, got 2 values`},
+		{"rgb(256, 0, 0)", `"rgb\(256, 0, 0\)" is not a valid color: rgb\(\): "256" must be between 0 and 255, or 0% and 100%`},
+		{"rgb(101%, 0%, 0%)", `.*rgb\(\): "101%" must be between 0 and 255, or 0% and 100%`},
+		{"rgba(255, 0, 0, 2)", `.*rgba\(\): "2" is not a valid alpha value`},
+		{"hsl(red, 100%, 50%)", `.*hsl\(\): "red" is not a valid hue`},
+		{"hsl(0, 110%, 50%)", `.*hsl\(\): "110%" must be between 0% and 100%`},
+		{"hsl(0, 100%, -50%)", `.*hsl\(\): "-50%" must be between 0% and 100%`},
+		{"hue:361", `"hue:361" is not a valid color: "hue:361": hue must be between 0 and 360`},
+		{"hue:abc", `.*"hue:abc": hue must be between 0 and 360`},
+		{"saturation:1.5", `.*"saturation:1.5": saturation must be between 0.0 and 1.0`},
+		{"brightness:-1", `.*"brightness:-1": brightness must be between 0.0 and 1.0`},
+		{"kelvin:1000", `.*"kelvin:1000": kelvin must be between 1500 and 9000`},
+		{"kelvin:warm", `.*"kelvin:warm": kelvin must be between 1500 and 9000`},
+		{"rgb:0,0", `.*"rgb:0,0": expected three comma-separated values`},
+		{"rgb:0,0,256", `.*"rgb:0,0,256": "256" must be between 0 and 255`},
+		{"red rgb:0,0,255", `.*"rgb:0,0,255" cannot be used with another color`},
+		{"red blue", `"red blue" is not a valid color: "blue" is not a modifier, expected the form key:value`},
+		{"red glow:1", `.*"glow" is not a known modifier`},
+		{"rgb(0, 0, 0)x", `.*"x" is not a modifier, expected the form key:value`},
+	}
+
+	for _, test := range tests {
+		_, err := ParseColor(test.input)
+		c.Check(err, ErrorMatches, test.err, Commentf("input: %q", test.input))
+	}
+}
+
+func (*TestSuite) Test_NamedColor(c *C) {
+	hsbk, ok := NamedColor("DarkOrange")
+	c.Assert(ok, Equals, true)
+	c.Check(hsbk.Hex(), Equals, "#ff8c00")
+
+	_, ok = NamedColor("notacolor")
+	c.Check(ok, Equals, false)
+
+	// every named color should render back to its RGB value
+	for name, rgb := range cssColors {
+		hsbk, ok := NamedColor(name)
+		c.Assert(ok, Equals, true)
+
+		c.Check(hsbk.Hex(), Equals, fmt.Sprintf("#%06x", rgb), Commentf("name: %s", name))
+	}
+}
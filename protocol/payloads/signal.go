@@ -0,0 +1,128 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxpayloads
+
+import (
+	"fmt"
+	"math"
+)
+
+// SignalRating is a qualitative rating of the signal strength reported by a
+// device, using the same thresholds as the LIFX app.
+type SignalRating uint8
+
+const (
+	// SignalNone means there's no signal, or it couldn't be interpreted.
+	SignalNone SignalRating = iota
+
+	// SignalVeryBad is a signal weaker than -80 dBm.
+	SignalVeryBad
+
+	// SignalSomewhatBad is a signal between -80 and -70 dBm.
+	SignalSomewhatBad
+
+	// SignalAlright is a signal between -70 and -60 dBm.
+	SignalAlright
+
+	// SignalGood is a signal stronger than -60 dBm.
+	SignalGood
+)
+
+func (sr SignalRating) String() string {
+	switch sr {
+	case SignalNone:
+		return "none"
+	case SignalVeryBad:
+		return "very bad"
+	case SignalSomewhatBad:
+		return "somewhat bad"
+	case SignalAlright:
+		return "alright"
+	case SignalGood:
+		return "good"
+	default:
+		return fmt.Sprintf("SignalRating(%d)", uint8(sr))
+	}
+}
+
+// noSignal is the value some firmware reports when there is no signal.
+const noSignal = 200
+
+// signalValue converts the raw signal to decibels, which is dBm for firmware
+// reporting milliwatts and a signal-to-noise ratio for firmware that doesn't.
+// The second value is false if the signal can't be converted.
+func signalValue(signal float32) (int, bool) {
+	s := float64(signal)
+
+	if s <= 0 || math.IsNaN(s) || math.IsInf(s, 0) {
+		return 0, false
+	}
+
+	return int(math.Floor(10*math.Log10(s) + 0.5)), true
+}
+
+// SignalDBm converts the raw Signal field of the DeviceStateHostInfo and
+// DeviceStateWifiInfo messages to dBm. Depending on the firmware the field is
+// either in milliwatts, or is a signal-to-noise ratio that can't be converted
+// to dBm; the second value is false for the latter, or if there's no signal.
+func SignalDBm(signal float32) (int, bool) {
+	v, ok := signalValue(signal)
+
+	if !ok || v >= 0 || v == noSignal {
+		return 0, false
+	}
+
+	return v, true
+}
+
+// RateSignal returns a qualitative rating of the raw Signal field of the
+// DeviceStateHostInfo and DeviceStateWifiInfo messages. Both of the units
+// used by the firmware are supported.
+func RateSignal(signal float32) SignalRating {
+	v, ok := signalValue(signal)
+
+	if !ok || v == noSignal {
+		return SignalNone
+	}
+
+	// a negative value is in dBm
+	if v < 0 {
+		switch {
+		case v < -80:
+			return SignalVeryBad
+		case v < -70:
+			return SignalSomewhatBad
+		case v < -60:
+			return SignalAlright
+		default:
+			return SignalGood
+		}
+	}
+
+	// otherwise it's a signal-to-noise ratio in dB
+	switch {
+	case v >= 17:
+		return SignalGood
+	case v >= 12:
+		return SignalAlright
+	case v >= 7:
+		return SignalSomewhatBad
+	case v >= 4:
+		return SignalVeryBad
+	default:
+		return SignalNone
+	}
+}
+
+// SignalDBm returns the signal strength in dBm. See the SignalDBm function
+// for details.
+func (dswi *DeviceStateWifiInfo) SignalDBm() (int, bool) {
+	return SignalDBm(dswi.Signal)
+}
+
+// SignalRating returns a qualitative rating of the signal strength.
+func (dswi *DeviceStateWifiInfo) SignalRating() SignalRating {
+	return RateSignal(dswi.Signal)
+}
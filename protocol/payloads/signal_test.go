@@ -0,0 +1,83 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxpayloads
+
+import (
+	"math"
+
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) TestSignalRating_String(c *C) {
+	c.Check(SignalNone.String(), Equals, "none")
+	c.Check(SignalVeryBad.String(), Equals, "very bad")
+	c.Check(SignalSomewhatBad.String(), Equals, "somewhat bad")
+	c.Check(SignalAlright.String(), Equals, "alright")
+	c.Check(SignalGood.String(), Equals, "good")
+	c.Check(SignalRating(42).String(), Equals, "SignalRating(42)")
+}
+
+func (*TestSuite) Test_SignalDBm(c *C) {
+	tests := []struct {
+		signal float32
+		dbm    int
+		ok     bool
+	}{
+		{signal: 1e-5, dbm: -50, ok: true},
+		{signal: 1e-8, dbm: -80, ok: true},
+		{signal: 3.1622776e-7, dbm: -65, ok: true},
+		{signal: 1, ok: false},
+		{signal: 20, ok: false},
+		{signal: 0, ok: false},
+		{signal: -1, ok: false},
+		{signal: float32(math.NaN()), ok: false},
+		{signal: float32(math.Inf(1)), ok: false},
+	}
+
+	for _, test := range tests {
+		dbm, ok := SignalDBm(test.signal)
+		c.Check(ok, Equals, test.ok, Commentf("signal: %g", test.signal))
+		c.Check(dbm, Equals, test.dbm, Commentf("signal: %g", test.signal))
+	}
+}
+
+func (*TestSuite) Test_RateSignal(c *C) {
+	tests := []struct {
+		signal float32
+		rating SignalRating
+	}{
+		// milliwatts
+		{1e-5, SignalGood},
+		{1e-6, SignalGood},
+		{3.1622776e-7, SignalAlright},
+		{1e-7, SignalAlright},
+		{3.1622776e-8, SignalSomewhatBad},
+		{1e-8, SignalSomewhatBad},
+		{1e-9, SignalVeryBad},
+
+		// signal-to-noise ratio
+		{100, SignalGood},
+		{50, SignalGood},
+		{20, SignalAlright},
+		{10, SignalSomewhatBad},
+		{3, SignalVeryBad},
+		{1, SignalNone},
+
+		{0, SignalNone},
+		{1e20, SignalNone},
+		{float32(math.NaN()), SignalNone},
+	}
+
+	for _, test := range tests {
+		c.Check(RateSignal(test.signal), Equals, test.rating, Commentf("signal: %g", test.signal))
+	}
+
+	dswi := &DeviceStateWifiInfo{Signal: 1e-5}
+
+	dbm, ok := dswi.SignalDBm()
+	c.Check(ok, Equals, true)
+	c.Check(dbm, Equals, -50)
+	c.Check(dswi.SignalRating(), Equals, SignalGood)
+}
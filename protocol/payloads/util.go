@@ -5,28 +5,45 @@ import (
 	"time"
 )
 
-const (
-	maxUint16 float64 = 65535
-
-	colorRangeMax   float64 = 359
-	colorRangeMin   float64 = 0
-	hueRange                = maxUint16 - colorRangeMin
-	colorWheelRange         = colorRangeMax - colorRangeMin
-
-	percRangeMax    float64 = 100
-	percRangeMin    float64 = 0
-	percValueRange          = maxUint16 - percRangeMin
-	percScaledRange         = percRangeMax - percRangeMin
-)
+const maxUint16 float64 = 65535
+
+// hueToDegrees scales a hue value from the 0-65535 range used on the wire
+// to degrees around the color wheel (0-360).
+func hueToDegrees(hue uint16) float64 {
+	return float64(hue) * 360 / (maxUint16 + 1)
+}
+
+// degreesToHue scales degrees around the color wheel to the 0-65535 range
+// used on the wire. Values outside of 0-360 wrap around the color wheel.
+func degreesToHue(degrees float64) uint16 {
+	degrees = math.Mod(degrees, 360)
+
+	if degrees < 0 {
+		degrees += 360
+	}
+
+	// values just below 360 degrees round up to 65536, which should
+	// wrap back around to 0 (red) instead of overflowing
+	return uint16(uint32(round(degrees*(maxUint16+1)/360)) % (uint32(maxUint16) + 1))
+}
 
-func colorRange(value float64) uint16 {
-	scaledValue := (((value - colorRangeMin) * colorWheelRange) / hueRange) + colorRangeMin
-	return uint16(scaledValue)
+// uint16ToPercent scales a value from the 0-65535 range used on the wire to
+// a percentage (0-100).
+func uint16ToPercent(value uint16) float64 {
+	return float64(value) * 100 / maxUint16
 }
 
-func percentageRange(value float64) uint8 {
-	scaledValue := (((value - percRangeMin) * percScaledRange) / percValueRange) + percRangeMin
-	return uint8(scaledValue)
+// percentToUint16 scales a percentage (0-100) to the 0-65535 range used on
+// the wire. Values outside of 0-100 are clamped.
+func percentToUint16(percent float64) uint16 {
+	switch {
+	case percent <= 0:
+		return 0
+	case percent >= 100:
+		return uint16(maxUint16)
+	}
+
+	return uint16(round(percent * maxUint16 / 100))
 }
 
 // nsecEpochToTime converts a UNIX epoch with nanosecond
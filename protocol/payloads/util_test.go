@@ -0,0 +1,52 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxpayloads
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) Test_hueToDegrees(c *C) {
+	c.Check(hueToDegrees(0), Equals, float64(0))
+	c.Check(hueToDegrees(16384), Equals, float64(90))
+	c.Check(hueToDegrees(32768), Equals, float64(180))
+	c.Check(hueToDegrees(65535) < 360, Equals, true)
+}
+
+func (*TestSuite) Test_degreesToHue(c *C) {
+	c.Check(degreesToHue(0), Equals, uint16(0))
+	c.Check(degreesToHue(90), Equals, uint16(16384))
+	c.Check(degreesToHue(180), Equals, uint16(32768))
+
+	// values outside of the color wheel should wrap around
+	c.Check(degreesToHue(360), Equals, uint16(0))
+	c.Check(degreesToHue(450), Equals, uint16(16384))
+	c.Check(degreesToHue(-90), Equals, uint16(49152))
+	c.Check(degreesToHue(359.999), Equals, uint16(0))
+
+	// every hue value should survive a round trip
+	for i := 0; i <= 65535; i++ {
+		if hue := uint16(i); degreesToHue(hueToDegrees(hue)) != hue {
+			c.Fatalf("hue %d did not survive a round trip", hue)
+		}
+	}
+}
+
+func (*TestSuite) Test_percentToUint16(c *C) {
+	c.Check(percentToUint16(0), Equals, uint16(0))
+	c.Check(percentToUint16(50), Equals, uint16(32768))
+	c.Check(percentToUint16(100), Equals, uint16(65535))
+
+	// values outside of 0-100 should be clamped
+	c.Check(percentToUint16(-1), Equals, uint16(0))
+	c.Check(percentToUint16(101), Equals, uint16(65535))
+
+	// every value should survive a round trip
+	for i := 0; i <= 65535; i++ {
+		if value := uint16(i); percentToUint16(uint16ToPercent(value)) != value {
+			c.Fatalf("value %d did not survive a round trip", value)
+		}
+	}
+}
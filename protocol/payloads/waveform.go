@@ -0,0 +1,245 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxpayloads
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Waveform is the shape of the transition for the LightSetWaveform message.
+type Waveform uint8
+
+// These are the waveforms supported by LIFX lights.
+const (
+	// WaveformSaw transitions linearly from the current color to the
+	// waveform color, and then snaps back.
+	WaveformSaw Waveform = 0
+
+	// WaveformSine transitions smoothly from the current color to the
+	// waveform color and back again.
+	WaveformSine Waveform = 1
+
+	// WaveformHalfSine transitions smoothly from the current color to the
+	// waveform color, and then snaps back.
+	WaveformHalfSine Waveform = 2
+
+	// WaveformTriangle transitions linearly from the current color to the
+	// waveform color and back again.
+	WaveformTriangle Waveform = 3
+
+	// WaveformPulse switches between the current color and the waveform
+	// color, with the SkewRatio determining the duty cycle.
+	WaveformPulse Waveform = 4
+)
+
+var waveformNames = map[Waveform]string{
+	WaveformSaw:      "saw",
+	WaveformSine:     "sine",
+	WaveformHalfSine: "half_sine",
+	WaveformTriangle: "triangle",
+	WaveformPulse:    "pulse",
+}
+
+func (w Waveform) String() string {
+	if name, ok := waveformNames[w]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Waveform(%d)", uint8(w))
+}
+
+// MarshalText is a function that satisfies the encoding.TextMarshaler
+// interface.
+func (w Waveform) MarshalText() ([]byte, error) {
+	return []byte(w.String()), nil
+}
+
+// UnmarshalText is a function that satisfies the encoding.TextUnmarshaler
+// interface. Besides the names of the waveforms, it accepts the values the
+// lights don't know as a number, or in the "Waveform(N)" form they're
+// marshaled as.
+func (w *Waveform) UnmarshalText(text []byte) error {
+	name := strings.ToLower(string(text))
+
+	for wf, wfName := range waveformNames {
+		if name == wfName {
+			*w = wf
+			return nil
+		}
+	}
+
+	if strings.HasPrefix(name, "waveform(") && strings.HasSuffix(name, ")") {
+		name = name[len("waveform(") : len(name)-1]
+	}
+
+	n, err := strconv.ParseUint(name, 10, 8)
+
+	if err != nil {
+		return fmt.Errorf("unknown waveform %q", string(text))
+	}
+
+	*w = Waveform(n)
+
+	return nil
+}
+
+// LightSetWaveform is the struct representing the payload sent by a client
+// to apply an effect to the light. The light transitions between its current
+// color and the Color in the shape of the Waveform, once per Period, for the
+// number of Cycles.
+type LightSetWaveform struct {
+	Reserved uint8
+
+	// Transient determines whether the light returns to its original color
+	// after the effect (true), or stays at the waveform color (false).
+	Transient bool
+
+	Color *LightHSBK
+
+	// Period is the duration of a single cycle.
+	Period time.Duration
+
+	// Cycles is the number of cycles. It can be fractional.
+	Cycles float32
+
+	// SkewRatio is used by the WaveformPulse waveform. It's the ratio of the
+	// period spent at the original color, scaled from 0-1 to -32768-32767.
+	SkewRatio int16
+
+	Waveform Waveform
+}
+
+func (lsw *LightSetWaveform) String() string {
+	if lsw == nil {
+		return "<*lifxpayloads.LightSetWaveform(nil)>"
+	}
+
+	var color string
+
+	if lsw.Color != nil {
+		color = lsw.Color.String()
+	} else {
+		color = "<nil>"
+	}
+
+	return fmt.Sprintf(
+		"<*lifxpayloads.LightSetWaveform(%p): Transient: %t, Color: %s, Period: %s, Cycles: %g, SkewRatio: %d, Waveform: %d (%s)>",
+		lsw, lsw.Transient, color, lsw.Period, lsw.Cycles, lsw.SkewRatio, uint8(lsw.Waveform), lsw.Waveform,
+	)
+}
+
+// MarshalPacket is a function that satisfies the lifxprotocol.Marshaler
+// interface.
+func (lsw *LightSetWaveform) MarshalPacket(order binary.ByteOrder) ([]byte, error) {
+	if lsw.Color == nil {
+		return nil, ErrLightColorNotSet
+	}
+
+	// if the length of the Period would overflow uint32
+	if lsw.Period > MaxDuration {
+		return nil, errors.New("LightSetWaveform.Period would overflow uint32")
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := binary.Write(buf, order, lsw.Reserved); err != nil {
+		return nil, err
+	}
+
+	var transient uint8
+
+	if lsw.Transient {
+		transient = 1
+	}
+
+	if err := binary.Write(buf, order, transient); err != nil {
+		return nil, err
+	}
+
+	colorPacket, err := lsw.Color.MarshalPacket(order)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := buf.Write(colorPacket); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Write(buf, order, durToMs(lsw.Period)); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Write(buf, order, lsw.Cycles); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Write(buf, order, lsw.SkewRatio); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Write(buf, order, uint8(lsw.Waveform)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalPacket is a function that satisfies the lifxprotocol.Unmarshaler
+// interface.
+func (lsw *LightSetWaveform) UnmarshalPacket(data io.Reader, order binary.ByteOrder) (err error) {
+	if err = binary.Read(data, order, &lsw.Reserved); err != nil {
+		return
+	}
+
+	var transient uint8
+
+	if err = binary.Read(data, order, &transient); err != nil {
+		return
+	}
+
+	lsw.Transient = transient != 0
+
+	if lsw.Color == nil {
+		lsw.Color = &LightHSBK{}
+	}
+
+	if err = lsw.Color.UnmarshalPacket(data, order); err != nil {
+		return
+	}
+
+	var u32 uint32
+
+	if err = binary.Read(data, order, &u32); err != nil {
+		return
+	}
+
+	lsw.Period = msToDur(u32)
+
+	if err = binary.Read(data, order, &lsw.Cycles); err != nil {
+		return
+	}
+
+	if err = binary.Read(data, order, &lsw.SkewRatio); err != nil {
+		return
+	}
+
+	var u8 uint8
+
+	if err = binary.Read(data, order, &u8); err != nil {
+		return
+	}
+
+	lsw.Waveform = Waveform(u8)
+
+	return
+}
@@ -0,0 +1,150 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxpayloads
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) TestWaveform_String(c *C) {
+	c.Check(WaveformSaw.String(), Equals, "saw")
+	c.Check(WaveformSine.String(), Equals, "sine")
+	c.Check(WaveformHalfSine.String(), Equals, "half_sine")
+	c.Check(WaveformTriangle.String(), Equals, "triangle")
+	c.Check(WaveformPulse.String(), Equals, "pulse")
+	c.Check(Waveform(42).String(), Equals, "Waveform(42)")
+}
+
+func (*TestSuite) TestWaveform_UnmarshalText(c *C) {
+	var w Waveform
+
+	c.Assert(w.UnmarshalText([]byte("Half_Sine")), IsNil)
+	c.Check(w, Equals, WaveformHalfSine)
+
+	c.Check(w.UnmarshalText([]byte("square")), ErrorMatches, `unknown waveform "square"`)
+}
+
+func (*TestSuite) TestLightSetWaveform_String(c *C) {
+	hsbk := &LightHSBK{Hue: 1, Saturation: 2, Brightness: 3, Kelvin: 3500}
+
+	lsw := &LightSetWaveform{
+		Transient: true,
+		Color:     hsbk,
+		Period:    time.Second,
+		Cycles:    2.5,
+		SkewRatio: -100,
+		Waveform:  WaveformPulse,
+	}
+
+	exp := fmt.Sprintf(
+		"<*lifxpayloads.LightSetWaveform(%p): Transient: true, Color: %s, Period: 1s, Cycles: 2.5, SkewRatio: -100, Waveform: 4 (pulse)>",
+		lsw, hsbk,
+	)
+
+	c.Check(lsw.String(), Equals, exp)
+
+	lsw = nil
+	c.Check(lsw.String(), Equals, "<*lifxpayloads.LightSetWaveform(nil)>")
+}
+
+func (t *TestSuite) TestLightSetWaveform_MarshalPacket(c *C) {
+	var u32 uint32
+	var u16 uint16
+	var i16 int16
+	var u8 uint8
+	var f32 float32
+
+	lsw := &LightSetWaveform{
+		Reserved:  20,
+		Transient: true,
+		Color:     &LightHSBK{Hue: 1, Saturation: 2, Brightness: 3, Kelvin: 4},
+		Period:    1500 * time.Millisecond,
+		Cycles:    2.5,
+		SkewRatio: -16384,
+		Waveform:  WaveformTriangle,
+	}
+
+	packet, err := lsw.MarshalPacket(t.order)
+	c.Assert(err, IsNil)
+	c.Assert(packet, HasLen, 21)
+
+	reader := bytes.NewReader(packet)
+
+	// Reserved
+	c.Assert(binary.Read(reader, t.order, &u8), IsNil)
+	c.Check(u8, Equals, uint8(20))
+
+	// Transient
+	c.Assert(binary.Read(reader, t.order, &u8), IsNil)
+	c.Check(u8, Equals, uint8(1))
+
+	// Color
+	for i := uint16(1); i <= 4; i++ {
+		c.Assert(binary.Read(reader, t.order, &u16), IsNil)
+		c.Check(u16, Equals, i)
+	}
+
+	// Period (written as uint32 milliseconds on the wire)
+	c.Assert(binary.Read(reader, t.order, &u32), IsNil)
+	c.Check(u32, Equals, uint32(1500))
+
+	// Cycles
+	c.Assert(binary.Read(reader, t.order, &f32), IsNil)
+	c.Check(f32, Equals, float32(2.5))
+
+	// SkewRatio
+	c.Assert(binary.Read(reader, t.order, &i16), IsNil)
+	c.Check(i16, Equals, int16(-16384))
+
+	// Waveform
+	c.Assert(binary.Read(reader, t.order, &u8), IsNil)
+	c.Check(u8, Equals, uint8(3))
+
+	//
+	// Test that invalid values are handled gracefully
+	//
+	lsw.Period = (time.Millisecond * time.Duration(^uint32(0))) + 1
+	_, err = lsw.MarshalPacket(t.order)
+	c.Check(err, ErrorMatches, "LightSetWaveform.Period would overflow uint32")
+
+	lsw.Color = nil
+	_, err = lsw.MarshalPacket(t.order)
+	c.Check(err, Equals, ErrLightColorNotSet)
+}
+
+func (t *TestSuite) TestLightSetWaveform_UnmarshalPacket(c *C) {
+	buf := &bytes.Buffer{}
+
+	c.Assert(binary.Write(buf, t.order, uint8(11)), IsNil)               // Reserved
+	c.Assert(binary.Write(buf, t.order, uint8(1)), IsNil)                // Transient
+	c.Assert(binary.Write(buf, t.order, uint16(22)), IsNil)              // Color.Hue
+	c.Assert(binary.Write(buf, t.order, uint16(33)), IsNil)              // Color.Saturation
+	c.Assert(binary.Write(buf, t.order, uint16(44)), IsNil)              // Color.Brightness
+	c.Assert(binary.Write(buf, t.order, uint16(55)), IsNil)              // Color.Kelvin
+	c.Assert(binary.Write(buf, t.order, uint32(66)), IsNil)              // Period
+	c.Assert(binary.Write(buf, t.order, float32(math.Inf(1))), IsNil)    // Cycles
+	c.Assert(binary.Write(buf, t.order, int16(32767)), IsNil)            // SkewRatio
+	c.Assert(binary.Write(buf, t.order, uint8(WaveformHalfSine)), IsNil) // Waveform
+
+	lsw := &LightSetWaveform{}
+
+	c.Assert(lsw.UnmarshalPacket(bytes.NewReader(buf.Bytes()), t.order), IsNil)
+	c.Check(lsw.Reserved, Equals, uint8(11))
+	c.Check(lsw.Transient, Equals, true)
+	c.Check(*lsw.Color, Equals, LightHSBK{Hue: 22, Saturation: 33, Brightness: 44, Kelvin: 55})
+	c.Check(lsw.Period, Equals, 66*time.Millisecond)
+	c.Check(math.IsInf(float64(lsw.Cycles), 1), Equals, true)
+	c.Check(lsw.SkewRatio, Equals, int16(32767))
+	c.Check(lsw.Waveform, Equals, WaveformHalfSine)
+
+	// short payloads should fail
+	c.Check(lsw.UnmarshalPacket(bytes.NewReader(buf.Bytes()[:20]), t.order), NotNil)
+}
@@ -7,7 +7,7 @@
 // meant to be consumed by those wanting to interface with their LIFX devices
 // in Golang. This package is designed to be used by the LIFX Golang library
 // for communicating with devices. Users are meant to consume that package
-// (which unfortunately doesn't exist, yet).
+// (github.com/theckman/go-lifx) instead.
 //
 // This package uses the lifpayloads sub-package to generate payloads for
 // the individual packets.
@@ -24,6 +24,11 @@ import (
 
 const maxUint16 = int(^uint16(0))
 
+// ErrUnknownMessageType is the error returned when unmarshaling a packet
+// whose message type doesn't have a known payload. The Header field of the
+// packet is still set, so the header can be inspected.
+var ErrUnknownMessageType = errors.New("unknown message type")
+
 // Marshaler is the interface for Marshaling packets.
 // The order parameter can either be binary.LittleEndian or binary.BigEndian.
 // The LIFX protocol uses little-endian encoding at the time of writing.
@@ -131,6 +136,13 @@ func (p *Packet) MarshalPacket(order binary.ByteOrder) ([]byte, error) {
 
 func packetComponentByType(t uint16) PacketComponent {
 	switch t {
+	case DeviceGetService, DeviceGetHostInfo, DeviceGetHostFirmware,
+		DeviceGetWifiInfo, DeviceGetWifiFirmware, DeviceGetPower,
+		DeviceGetLabel, DeviceGetVersion, DeviceGetInfo,
+		DeviceAcknowledgement, DeviceGetLocation, DeviceGetGroup,
+		LightGet, LightGetPower:
+		return &lifxpayloads.Empty{}
+
 	case DeviceStateService:
 		return &lifxpayloads.DeviceStateService{}
 
@@ -159,7 +171,7 @@ func packetComponentByType(t uint16) PacketComponent {
 		return &lifxpayloads.DeviceStateInfo{}
 
 	case DeviceStateLocation:
-		return &lifxpayloads.DeviceStateInfo{}
+		return &lifxpayloads.DeviceStateLocation{}
 
 	case DeviceStateGroup:
 		return &lifxpayloads.DeviceStateGroup{}
@@ -170,6 +182,9 @@ func packetComponentByType(t uint16) PacketComponent {
 	case LightSetColor:
 		return &lifxpayloads.LightSetColor{}
 
+	case LightSetWaveform:
+		return &lifxpayloads.LightSetWaveform{}
+
 	case LightState:
 		return &lifxpayloads.LightState{}
 
@@ -193,7 +208,7 @@ func (p *Packet) unmarshalPayload(data io.Reader, order binary.ByteOrder) (Packe
 
 	// figure out the payload type so we can unmarshal it
 	if pc = packetComponentByType(p.Header.ProtocolHeader.Type); pc == nil {
-		return nil, errors.New("unknown message type")
+		return nil, ErrUnknownMessageType
 	}
 
 	if err := pc.UnmarshalPacket(data, order); err != nil {
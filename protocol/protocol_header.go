@@ -9,6 +9,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"strings"
 )
 
 // ProtocolHeaderByteSize is the number of bytes in a marshaled packet.
@@ -51,14 +52,34 @@ const (
 // message within the payload of the packet. This group of values are for
 // device messages specific to LIFX lightbulbs.
 const (
-	LightGet        uint16 = 101
-	LightSetColor   uint16 = 102
-	LightState      uint16 = 107
-	LightGetPower   uint16 = 116
-	LightSetPower   uint16 = 117
-	LightStatePower uint16 = 118
+	LightGet         uint16 = 101
+	LightSetColor    uint16 = 102
+	LightSetWaveform uint16 = 103
+	LightState       uint16 = 107
+	LightGetPower    uint16 = 116
+	LightSetPower    uint16 = 117
+	LightStatePower  uint16 = 118
 )
 
+// messageTypes is the list of all the message types this package knows about.
+var messageTypes = []uint16{
+	DeviceGetService, DeviceStateService,
+	DeviceGetHostInfo, DeviceStateHostInfo,
+	DeviceGetHostFirmware, DeviceStateHostFirmware,
+	DeviceGetWifiInfo, DeviceStateWifiInfo,
+	DeviceGetWifiFirmware, DeviceStateWifiFirmware,
+	DeviceGetPower, DeviceSetPower, DeviceStatePower,
+	DeviceGetLabel, DeviceSetLabel, DeviceStateLabel,
+	DeviceGetVersion, DeviceStateVersion,
+	DeviceGetInfo, DeviceStateInfo,
+	DeviceAcknowledgement,
+	DeviceGetLocation, DeviceStateLocation,
+	DeviceGetGroup, DeviceStateGroup,
+	DeviceEchoRequest, DeviceEchoResponse,
+	LightGet, LightSetColor, LightSetWaveform, LightState,
+	LightGetPower, LightSetPower, LightStatePower,
+}
+
 // ProtocolHeader is a struct that contains information about the payload contents
 // (i.e., what actions to take)
 type ProtocolHeader struct {
@@ -192,6 +213,8 @@ func phTypetoString(t uint16) string {
 		s = "LightGet"
 	case LightSetColor:
 		s = "LightSetColor"
+	case LightSetWaveform:
+		s = "LightSetWaveform"
 	case LightState:
 		s = "LightState"
 	case LightGetPower:
@@ -206,3 +229,25 @@ func phTypetoString(t uint16) string {
 
 	return "lifxprotocol." + s
 }
+
+// TypeName returns the name of the message type without the package prefix
+// (e.g., "LightSetColor"). If the message type is unknown this returns
+// "UnknownType".
+func TypeName(t uint16) string {
+	return strings.TrimPrefix(phTypetoString(t), "lifxprotocol.")
+}
+
+// TypeFromName is the inverse of TypeName. It returns the message type
+// for the name, which may optionally include the "lifxprotocol." prefix. The
+// boolean return value is false if the message type is unknown.
+func TypeFromName(name string) (uint16, bool) {
+	name = strings.TrimPrefix(name, "lifxprotocol.")
+
+	for _, t := range messageTypes {
+		if TypeName(t) == name {
+			return t, true
+		}
+	}
+
+	return 0, false
+}
@@ -49,6 +49,32 @@ func (*TestSuite) Test_phTypeToString(c *C) {
 	c.Check(phTypetoString(^uint16(0)), Equals, "UnknownType")
 }
 
+func (*TestSuite) Test_TypeName(c *C) {
+	c.Check(TypeName(DeviceGetService), Equals, "DeviceGetService")
+	c.Check(TypeName(LightSetColor), Equals, "LightSetColor")
+	c.Check(TypeName(^uint16(0)), Equals, "UnknownType")
+
+	// every known type should survive a round trip
+	for _, t := range messageTypes {
+		typ, ok := TypeFromName(TypeName(t))
+		c.Check(ok, Equals, true)
+		c.Check(typ, Equals, t)
+	}
+}
+
+func (*TestSuite) Test_TypeFromName(c *C) {
+	t, ok := TypeFromName("LightState")
+	c.Check(ok, Equals, true)
+	c.Check(t, Equals, LightState)
+
+	t, ok = TypeFromName("lifxprotocol.DeviceEchoRequest")
+	c.Check(ok, Equals, true)
+	c.Check(t, Equals, DeviceEchoRequest)
+
+	_, ok = TypeFromName("UnknownType")
+	c.Check(ok, Equals, false)
+}
+
 func (t *TestSuite) TestProtocolHeaderDeviceTypes(c *C) {
 	c.Check(DeviceGetService, Equals, uint16(2))
 	c.Check(DeviceStateService, Equals, uint16(3))
@@ -301,4 +301,79 @@ func (t *TestSuite) TestPacket_UnmarshalPacket(c *C) {
 	c.Check(payload.Time, Equals, uint64(11223344))
 	c.Check(payload.Uptime, Equals, uint64(22334455))
 	c.Check(payload.Downtime, Equals, uint64(33445566))
+
+	//
+	// Test that an unknown message type still sets the header
+	//
+	data := buf.Bytes()
+	t.order.PutUint16(data[32:34], 9999)
+
+	p = &Packet{}
+
+	err = p.UnmarshalPacket(bytes.NewReader(data), t.order)
+	c.Check(err, Equals, ErrUnknownMessageType)
+	c.Assert(p.Header, NotNil)
+	c.Check(p.Header.ProtocolHeader.Type, Equals, uint16(9999))
+	c.Check(p.Payload, IsNil)
+}
+
+// roundTrip marshals a packet of the message type with the payload, and
+// unmarshals it again.
+func (t *TestSuite) roundTrip(c *C, msgType uint16, payload PacketComponent) *Packet {
+	p := &Packet{
+		Header: &Header{
+			Frame:          NewFrame(),
+			FrameAddress:   NewFrameAddress(),
+			ProtocolHeader: &ProtocolHeader{Type: msgType},
+		},
+		Payload: payload,
+	}
+
+	data, err := p.MarshalPacket(t.order)
+	c.Assert(err, IsNil)
+
+	p = &Packet{}
+	c.Assert(p.UnmarshalPacket(bytes.NewReader(data), t.order), IsNil)
+	c.Check(p.Header.ProtocolHeader.Type, Equals, msgType)
+
+	return p
+}
+
+func (t *TestSuite) TestPacket_UnmarshalPacket_EmptyPayload(c *C) {
+	types := []uint16{
+		DeviceGetService, DeviceGetHostInfo, DeviceGetHostFirmware,
+		DeviceGetWifiInfo, DeviceGetWifiFirmware, DeviceGetPower,
+		DeviceGetLabel, DeviceGetVersion, DeviceGetInfo,
+		DeviceAcknowledgement, DeviceGetLocation, DeviceGetGroup,
+		LightGet, LightGetPower,
+	}
+
+	// the messages without a payload are decoded instead of being rejected
+	// as unknown
+	for _, typ := range types {
+		p := t.roundTrip(c, typ, &lifxpayloads.Empty{})
+		c.Check(p.Header.Frame.Size, Equals, uint16(HeaderByteSize))
+		c.Check(p.Payload, DeepEquals, &lifxpayloads.Empty{}, Commentf("type %d", typ))
+	}
+}
+
+func (t *TestSuite) TestPacket_UnmarshalPacket_DeviceStateLocation(c *C) {
+	location := &lifxpayloads.DeviceStateLocation{
+		Location:  [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		Label:     lifxpayloads.NewDeviceLabelTrunc([]byte("Kitchen")),
+		UpdatedAt: 1456790400000000000,
+	}
+
+	// the payload used to be decoded as a DeviceStateInfo
+	p := t.roundTrip(c, DeviceStateLocation, location)
+	c.Check(p.Payload, DeepEquals, location)
+}
+
+func (t *TestSuite) Test_packetComponentByType(c *C) {
+	c.Check(packetComponentByType(^uint16(0)), IsNil)
+
+	// every known message type should have a payload
+	for _, typ := range messageTypes {
+		c.Check(packetComponentByType(typ), NotNil)
+	}
 }
@@ -0,0 +1,389 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/theckman/go-lifx/protocol/payloads"
+	"gopkg.in/yaml.v2"
+)
+
+// SceneFormat is the format of a scene definition.
+type SceneFormat string
+
+const (
+	// SceneJSON is a scene definition in JSON.
+	SceneJSON SceneFormat = "json"
+
+	// SceneYAML is a scene definition in YAML.
+	SceneYAML SceneFormat = "yaml"
+
+	// SceneTOML is a scene definition in TOML.
+	SceneTOML SceneFormat = "toml"
+)
+
+var errSceneDuration = fmt.Errorf("the duration must be between 0s and %s", lifxpayloads.MaxDuration)
+
+// Scene is the state of a set of lights, which can be applied all at once
+// with Client.ApplyScene.
+type Scene struct {
+	Name    string
+	Entries []*SceneEntry
+}
+
+// SceneEntry is the state of the lights picked by any of its selectors.
+type SceneEntry struct {
+	Selectors []Selector
+
+	// Color is the color the lights are changed to. If nil, their color is
+	// left alone.
+	Color *lifxpayloads.LightHSBK
+
+	// Power is whether the lights are powered on or off. If nil, their
+	// power is left alone.
+	Power *bool
+
+	// Duration is how long the lights take to fade to the color and power
+	// level. It must be between 0 and lifxpayloads.MaxDuration.
+	Duration time.Duration
+}
+
+// Validate returns an error if the scene can't be sent to the lights.
+func (s *Scene) Validate() error {
+	if len(s.Entries) == 0 {
+		return errors.New("the scene has no entries")
+	}
+
+	for i, entry := range s.Entries {
+		if err := entry.validate(); err != nil {
+			return fmt.Errorf("scene entry %d: %s", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+func (entry *SceneEntry) validate() error {
+	if len(entry.Selectors) == 0 {
+		return errors.New("it has no selectors")
+	}
+
+	if entry.Color == nil && entry.Power == nil {
+		return errors.New("it sets neither the color nor the power")
+	}
+
+	if entry.Color != nil && (entry.Color.Kelvin < lifxpayloads.MinKelvin || entry.Color.Kelvin > lifxpayloads.MaxKelvin) {
+		return lifxpayloads.ErrKelvinRange
+	}
+
+	if entry.Duration < 0 || entry.Duration > lifxpayloads.MaxDuration {
+		return errSceneDuration
+	}
+
+	return nil
+}
+
+// sceneFile is a scene as it's written in a scene definition.
+type sceneFile struct {
+	Name   string       `json:"name" yaml:"name" toml:"name"`
+	Lights []sceneLight `json:"lights" yaml:"lights" toml:"lights"`
+}
+
+// sceneLight is an entry of a scene definition. The power and duration can
+// be given as more than one type, so they're decoded in to empty interfaces.
+type sceneLight struct {
+	Selector string      `json:"selector" yaml:"selector" toml:"selector"`
+	Color    string      `json:"color" yaml:"color" toml:"color"`
+	Power    interface{} `json:"power" yaml:"power" toml:"power"`
+	Duration interface{} `json:"duration" yaml:"duration" toml:"duration"`
+}
+
+// ParseScene parses a scene definition, and validates it. A scene has a name,
+// and a list of lights; each of them has a selector, and any of a color, a
+// power level, and a duration:
+//
+//	name: Evening
+//	lights:
+//	  - selector: group:Downstairs
+//	    color: kelvin:2700 brightness:0.6
+//	    power: on
+//	    duration: 2s
+//	  - selector: Porch
+//	    power: off
+//
+// The selector is parsed by ParseSelector, and the color by
+// lifxpayloads.ParseColor. The power is "on" or "off", or a boolean. The
+// duration is a string parsed by time.ParseDuration, or a number of seconds.
+//
+// When more than one entry picks a light, the last one wins.
+func ParseScene(data []byte, format SceneFormat) (*Scene, error) {
+	var (
+		sf  sceneFile
+		err error
+	)
+
+	switch format {
+	case SceneJSON:
+		err = json.Unmarshal(data, &sf)
+	case SceneYAML:
+		err = yaml.Unmarshal(data, &sf)
+	case SceneTOML:
+		_, err = toml.Decode(string(data), &sf)
+	default:
+		return nil, fmt.Errorf("unknown scene format %q", string(format))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s scene: %s", strings.ToUpper(string(format)), err)
+	}
+
+	scene := &Scene{Name: sf.Name}
+
+	for i, light := range sf.Lights {
+		entry, err := light.entry()
+
+		if err != nil {
+			return nil, fmt.Errorf("scene entry %d: %s", i+1, err)
+		}
+
+		scene.Entries = append(scene.Entries, entry)
+	}
+
+	if err := scene.Validate(); err != nil {
+		return nil, err
+	}
+
+	return scene, nil
+}
+
+// LoadScene reads the scene definition from the file, and parses it with
+// ParseScene. The format is picked by the file's extension: .json, .yaml or
+// .yml, or .toml.
+func LoadScene(filename string) (*Scene, error) {
+	formats := map[string]SceneFormat{
+		".json": SceneJSON,
+		".yaml": SceneYAML,
+		".yml":  SceneYAML,
+		".toml": SceneTOML,
+	}
+
+	format, ok := formats[strings.ToLower(filepath.Ext(filename))]
+
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown scene format; the file must end in .json, .yaml, .yml, or .toml", filename)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	scene, err := ParseScene(data, format)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+
+	return scene, nil
+}
+
+func (light sceneLight) entry() (*SceneEntry, error) {
+	if light.Selector == "" {
+		return nil, errors.New("the selector is missing")
+	}
+
+	sel, err := ParseSelector(light.Selector)
+
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &SceneEntry{Selectors: []Selector{sel}}
+
+	if light.Color != "" {
+		if entry.Color, err = lifxpayloads.ParseColor(light.Color); err != nil {
+			return nil, err
+		}
+	}
+
+	switch v := light.Power.(type) {
+	case nil:
+	case bool:
+		entry.Power = &v
+	case string:
+		on := strings.ToLower(v) == "on"
+
+		if !on && strings.ToLower(v) != "off" {
+			return nil, fmt.Errorf("the power must be on or off, got %q", v)
+		}
+
+		entry.Power = &on
+	default:
+		return nil, fmt.Errorf("the power must be on or off, got %v", v)
+	}
+
+	switch v := light.Duration.(type) {
+	case nil:
+	case string:
+		if entry.Duration, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("invalid duration %q: %s", v, err)
+		}
+	case int:
+		entry.Duration, err = secondsDuration(float64(v))
+	case int64:
+		entry.Duration, err = secondsDuration(float64(v))
+	case float64:
+		entry.Duration, err = secondsDuration(v)
+	default:
+		return nil, fmt.Errorf("the duration must be a string or a number of seconds, got %v", v)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// secondsDuration returns the number of seconds as a time.Duration, checking
+// its range before it can overflow. NaN is out of range.
+func secondsDuration(seconds float64) (time.Duration, error) {
+	if !(seconds >= 0 && seconds <= lifxpayloads.MaxDuration.Seconds()) {
+		return 0, errSceneDuration
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// SceneResult is the result of applying a scene to a single device.
+type SceneResult struct {
+	Device *Device
+
+	// Entry is the entry of the scene applied to the device. It's nil if the
+	// device failed to answer while the selectors were being matched, so it
+	// isn't known whether the device is part of the scene, or which of the
+	// entries picks it.
+	Entry *SceneEntry
+
+	// Err is the error from the device, if it failed.
+	Err error
+}
+
+// ApplyScene validates the scene, discovers the devices on the network, and
+// changes the lights picked by the scene to their color and power level. The
+// lights are changed concurrently; the color of each light is sent before its
+// power level, so a light that's powered on fades in to its new color.
+//
+// The results are sorted by the MAC address of the devices. An error is only
+// returned if the scene is invalid or the discovery fails; the errors of the
+// individual devices are in their results.
+func (c *Client) ApplyScene(ctx context.Context, scene *Scene) ([]*SceneResult, error) {
+	if err := scene.Validate(); err != nil {
+		return nil, err
+	}
+
+	devices, err := c.Discover(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return applyScene(ctx, devices, scene), nil
+}
+
+// applyScene applies the scene to the devices it picks, and returns the
+// results in the same order as the devices.
+func applyScene(ctx context.Context, devices []*Device, scene *Scene) []*SceneResult {
+	var selectors []Selector
+
+	for _, entry := range scene.Entries {
+		selectors = append(selectors, entry.Selectors...)
+	}
+
+	m, err := newMatcher(ctx, devices, selectors)
+	me, _ := err.(MultiError)
+
+	unknown := make(map[*Device]error)
+
+	for _, de := range me {
+		unknown[de.Device] = de.Err
+	}
+
+	var (
+		results []*SceneResult
+		picked  []*Device
+	)
+
+	byDevice := make(map[*Device]*SceneResult)
+
+	for _, device := range devices {
+		var entry *SceneEntry
+
+		// a device that didn't answer is only given an entry if none of the
+		// later entries could have overridden it
+		uncertain := false
+
+		for _, e := range scene.Entries {
+			for _, sel := range e.Selectors {
+				if m.match(device, sel) {
+					entry = e
+					uncertain = false
+					break
+				}
+
+				if !m.known(device, sel) {
+					uncertain = true
+				}
+			}
+		}
+
+		switch {
+		case uncertain && unknown[device] != nil:
+			results = append(results, &SceneResult{Device: device, Err: unknown[device]})
+		case entry != nil:
+			result := &SceneResult{Device: device, Entry: entry}
+			results = append(results, result)
+			byDevice[device] = result
+			picked = append(picked, device)
+		}
+	}
+
+	err = forEach(ctx, picked, func(ctx context.Context, device *Device) error {
+		return byDevice[device].Entry.apply(ctx, &Light{Device: device})
+	})
+
+	me, _ = err.(MultiError)
+
+	for _, de := range me {
+		byDevice[de.Device].Err = de.Err
+	}
+
+	return results
+}
+
+// apply changes the light to the color and power level of the entry.
+func (entry *SceneEntry) apply(ctx context.Context, light *Light) error {
+	if entry.Color != nil {
+		if err := light.SetColor(ctx, *entry.Color, entry.Duration); err != nil {
+			return err
+		}
+	}
+
+	if entry.Power != nil {
+		return light.SetPower(ctx, *entry.Power, entry.Duration)
+	}
+
+	return nil
+}
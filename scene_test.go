@@ -0,0 +1,301 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol/payloads"
+
+	. "gopkg.in/check.v1"
+)
+
+var sceneDefinitions = map[SceneFormat]string{
+	SceneJSON: `{
+		"name": "Evening",
+		"lights": [
+			{"selector": "group:Downstairs", "color": "kelvin:2700 brightness:0.5", "power": "on", "duration": "2s"},
+			{"selector": "d0:73:d5:00:00:01", "color": "red", "duration": 1.5},
+			{"selector": "Porch", "power": false}
+		]
+	}`,
+
+	SceneYAML: `
+name: Evening
+lights:
+  - selector: group:Downstairs
+    color: kelvin:2700 brightness:0.5
+    power: on
+    duration: 2s
+  - selector: d0:73:d5:00:00:01
+    color: red
+    duration: 1.5
+  - selector: Porch
+    power: off
+`,
+
+	SceneTOML: `
+name = "Evening"
+
+[[lights]]
+selector = "group:Downstairs"
+color = "kelvin:2700 brightness:0.5"
+power = "on"
+duration = "2s"
+
+[[lights]]
+selector = "d0:73:d5:00:00:01"
+color = "red"
+duration = 1.5
+
+[[lights]]
+selector = "Porch"
+power = "Off"
+`,
+}
+
+func (*TestSuite) TestParseScene(c *C) {
+	on, off := true, false
+
+	want := &Scene{
+		Name: "Evening",
+		Entries: []*SceneEntry{
+			{
+				Selectors: []Selector{{Kind: SelectGroup, Value: "Downstairs"}},
+				Color:     &lifxpayloads.LightHSBK{Brightness: 32768, Kelvin: 2700},
+				Power:     &on,
+				Duration:  2 * time.Second,
+			},
+			{
+				Selectors: []Selector{{Kind: SelectHardwareAddr, HardwareAddr: net.HardwareAddr{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x01}}},
+				Color:     &lifxpayloads.LightHSBK{Saturation: 65535, Brightness: 65535, Kelvin: lifxpayloads.RGBWhiteKelvin},
+				Duration:  1500 * time.Millisecond,
+			},
+			{
+				Selectors: []Selector{{Kind: SelectLabel, Value: "Porch"}},
+				Power:     &off,
+			},
+		},
+	}
+
+	for format, data := range sceneDefinitions {
+		scene, err := ParseScene([]byte(data), format)
+		c.Assert(err, IsNil, Commentf("%s", format))
+		c.Check(scene, DeepEquals, want, Commentf("%s", format))
+	}
+
+	//
+	// Test that LoadScene picks the format by the extension
+	//
+	dir := c.MkDir()
+
+	for ext, format := range map[string]SceneFormat{".json": SceneJSON, ".yml": SceneYAML, ".TOML": SceneTOML} {
+		filename := filepath.Join(dir, "evening"+ext)
+		c.Assert(ioutil.WriteFile(filename, []byte(sceneDefinitions[format]), 0644), IsNil)
+
+		scene, err := LoadScene(filename)
+		c.Assert(err, IsNil, Commentf("%s", ext))
+		c.Check(scene, DeepEquals, want, Commentf("%s", ext))
+	}
+
+	_, err := LoadScene(filepath.Join(dir, "evening.ini"))
+	c.Check(err, ErrorMatches, ".*evening.ini: unknown scene format; .*")
+
+	filename := filepath.Join(dir, "bad.yaml")
+	c.Assert(ioutil.WriteFile(filename, []byte("lights:\n  - selector: Porch\n    power: dim\n"), 0644), IsNil)
+
+	_, err = LoadScene(filename)
+	c.Check(err, ErrorMatches, `.*bad.yaml: scene entry 1: the power must be on or off, got "dim"`)
+}
+
+func (*TestSuite) TestParseScene_Invalid(c *C) {
+	tests := []struct {
+		scene string
+		err   string
+	}{
+		{`{"lights": [{"selector": "Porch", "power": "on"}`, "invalid JSON scene: .*"},
+		{`{"name": "Empty", "lights": []}`, "the scene has no entries"},
+		{`{"lights": [{"power": "on"}]}`, "scene entry 1: the selector is missing"},
+		{`{"lights": [{"selector": "mac:porch", "power": "on"}]}`, `scene entry 1: invalid selector "mac:porch": .*`},
+		{`{"lights": [{"selector": "Porch", "power": "on"}, {"selector": "Porch"}]}`, "scene entry 2: it sets neither the color nor the power"},
+		{`{"lights": [{"selector": "Porch", "color": "kelvin:1000"}]}`, `scene entry 1: "kelvin:1000" is not a valid color: .*`},
+		{`{"lights": [{"selector": "Porch", "color": "blurple"}]}`, `scene entry 1: "blurple" is not a valid color: .*`},
+		{`{"lights": [{"selector": "Porch", "power": 1}]}`, "scene entry 1: the power must be on or off, got 1"},
+		{`{"lights": [{"selector": "Porch", "power": "on", "duration": "soon"}]}`, `scene entry 1: invalid duration "soon": .*`},
+		{`{"lights": [{"selector": "Porch", "power": "on", "duration": "-1s"}]}`, `scene entry 1: the duration must be between 0s and 1193h2m47.295s`},
+		{`{"lights": [{"selector": "Porch", "power": "on", "duration": "1194h"}]}`, `scene entry 1: the duration must be between 0s and 1193h2m47.295s`},
+		{`{"lights": [{"selector": "Porch", "power": "on", "duration": 1e300}]}`, `scene entry 1: the duration must be between 0s and 1193h2m47.295s`},
+		{`{"lights": [{"selector": "Porch", "power": "on", "duration": [1]}]}`, `scene entry 1: the duration must be a string or a number of seconds, got \[1\]`},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseScene([]byte(tt.scene), SceneJSON)
+		c.Check(err, ErrorMatches, tt.err, Commentf("%s", tt.scene))
+	}
+
+	_, err := ParseScene([]byte("lights = ["), SceneTOML)
+	c.Check(err, ErrorMatches, "invalid TOML scene: .*")
+
+	_, err = ParseScene([]byte("lights: {"), SceneYAML)
+	c.Check(err, ErrorMatches, "invalid YAML scene: .*")
+
+	_, err = ParseScene(nil, SceneFormat("ini"))
+	c.Check(err, ErrorMatches, `unknown scene format "ini"`)
+
+	// scenes built in code are validated too
+	on := true
+	scene := &Scene{Entries: []*SceneEntry{{
+		Selectors: []Selector{{Kind: SelectAll}},
+		Color:     &lifxpayloads.LightHSBK{Kelvin: 10000},
+		Power:     &on,
+	}}}
+
+	c.Check(scene.Validate(), ErrorMatches, "scene entry 1: "+lifxpayloads.ErrKelvinRange.Error())
+
+	_, err = (&Client{}).ApplyScene(context.Background(), scene)
+	c.Check(err, ErrorMatches, "scene entry 1: "+lifxpayloads.ErrKelvinRange.Error())
+}
+
+func (*TestSuite) TestApplyScene(c *C) {
+	fd1 := newFakeGroupDevice(c, 1, 1, "Upstairs", 1)
+	defer fd1.close()
+
+	fd2 := newFakeGroupDevice(c, 2, 2, "Downstairs", 1)
+	defer fd2.close()
+
+	fd3 := newFakeGroupDevice(c, 3, 2, "Downstairs", 1)
+	defer fd3.close()
+
+	fd4 := newFakeGroupDevice(c, 4, 3, "Garden", 1)
+	defer fd4.close()
+
+	fd3.mu.Lock()
+	fd3.label = lifxpayloads.NewDeviceLabelTrunc([]byte("Porch"))
+	fd3.mu.Unlock()
+
+	// the fourth device doesn't answer
+	fd4.close()
+
+	client := newTestClient(c, &Config{Retries: -1})
+	defer client.Close()
+
+	devices := []*Device{
+		client.Device(fd1.mac, fd1.addr()),
+		client.Device(fd2.mac, fd2.addr()),
+		client.Device(fd3.mac, fd3.addr()),
+		client.Device(fd4.mac, fd4.addr()),
+	}
+
+	scene, err := ParseScene([]byte(sceneDefinitions[SceneYAML]), SceneYAML)
+	c.Assert(err, IsNil)
+
+	fd1.mu.Lock()
+	fd1.power = 65535
+	fd1.mu.Unlock()
+
+	results := applyScene(context.Background(), devices, scene)
+	c.Assert(results, HasLen, 4)
+
+	for i, result := range results {
+		c.Check(result.Device, Equals, devices[i])
+	}
+
+	// the first device is only picked by its MAC address, so its power is
+	// left alone
+	c.Check(results[0].Entry, Equals, scene.Entries[1])
+	c.Check(results[0].Err, IsNil)
+
+	fd1.mu.Lock()
+	c.Check(fd1.color, Equals, *scene.Entries[1].Color)
+	c.Check(fd1.power, Equals, uint16(65535))
+	fd1.mu.Unlock()
+
+	c.Check(results[1].Entry, Equals, scene.Entries[0])
+	c.Check(results[1].Err, IsNil)
+
+	fd2.mu.Lock()
+	c.Check(fd2.color, Equals, *scene.Entries[0].Color)
+	c.Check(fd2.power, Equals, uint16(65535))
+	fd2.mu.Unlock()
+
+	// the last entry that picks a device wins
+	c.Check(results[2].Entry, Equals, scene.Entries[2])
+	c.Check(results[2].Err, IsNil)
+
+	fd3.mu.Lock()
+	c.Check(fd3.color, Not(Equals), *scene.Entries[0].Color)
+	c.Check(fd3.power, Equals, uint16(0))
+	fd3.mu.Unlock()
+
+	// a device that didn't answer might be in the scene
+	c.Check(results[3].Entry, IsNil)
+	c.Check(results[3].Err, Equals, ErrTimeout)
+
+	//
+	// Test that the devices that fail are reported in their results
+	//
+	fd2.close()
+
+	results = applyScene(context.Background(), devices[:3], &Scene{Entries: []*SceneEntry{scene.Entries[1], {
+		Selectors: []Selector{{Kind: SelectHardwareAddr, HardwareAddr: fd2.mac}},
+		Power:     scene.Entries[0].Power,
+	}}})
+
+	c.Assert(results, HasLen, 2)
+	c.Check(results[0].Device, Equals, devices[0])
+	c.Check(results[0].Err, IsNil)
+	c.Check(results[1].Device, Equals, devices[1])
+	c.Check(results[1].Err, Equals, ErrTimeout)
+
+	//
+	// Test that a device that didn't answer isn't given an earlier entry
+	// that a later one might override
+	//
+	byMAC := &SceneEntry{Selectors: []Selector{{Kind: SelectHardwareAddr, HardwareAddr: fd4.mac}}, Power: scene.Entries[0].Power}
+	byLabel := &SceneEntry{Selectors: []Selector{{Kind: SelectLabel, Value: "Garden"}}, Power: scene.Entries[0].Power}
+
+	results = applyScene(context.Background(), devices[3:], &Scene{Entries: []*SceneEntry{byMAC, byLabel}})
+	c.Assert(results, HasLen, 1)
+	c.Check(results[0].Entry, IsNil)
+	c.Check(results[0].Err, Equals, ErrTimeout)
+
+	// a later entry that picks it by its MAC address is certain
+	results = applyScene(context.Background(), devices[3:], &Scene{Entries: []*SceneEntry{byLabel, byMAC}})
+	c.Assert(results, HasLen, 1)
+	c.Check(results[0].Entry, Equals, byMAC)
+	c.Check(results[0].Err, Equals, ErrTimeout)
+}
+
+func (*TestSuite) TestClient_ApplyScene(c *C) {
+	fd := newFakeDevice(c)
+	defer fd.close()
+
+	client := newTestClient(c, &Config{Broadcast: fd.addr(), Retries: -1})
+	defer client.Close()
+
+	scene, err := ParseScene([]byte(`{"lights": [{"selector": "kitchen", "color": "blue", "power": "on", "duration": "1s"}]}`), SceneJSON)
+	c.Assert(err, IsNil)
+
+	results, err := client.ApplyScene(context.Background(), scene)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 1)
+	c.Check(results[0].Device.HardwareAddr.String(), Equals, fd.mac.String())
+	c.Check(results[0].Entry, Equals, scene.Entries[0])
+	c.Check(results[0].Err, IsNil)
+
+	fd.mu.Lock()
+	c.Check(fd.color, Equals, *scene.Entries[0].Color)
+	c.Check(fd.power, Equals, uint16(65535))
+	fd.mu.Unlock()
+
+	client.Close()
+
+	_, err = client.ApplyScene(context.Background(), scene)
+	c.Check(err, Equals, ErrClientClosed)
+}
@@ -0,0 +1,292 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SelectorKind is the property of a device a Selector matches on.
+type SelectorKind uint8
+
+const (
+	// SelectAll matches every device.
+	SelectAll SelectorKind = iota
+
+	// SelectLabel matches the devices with a label.
+	SelectLabel
+
+	// SelectHardwareAddr matches the device with a MAC address.
+	SelectHardwareAddr
+
+	// SelectGroup matches the devices in the groups with a label.
+	SelectGroup
+
+	// SelectLocation matches the devices in the locations with a label.
+	SelectLocation
+)
+
+// Selector picks devices by their label, MAC address, group, or location.
+// Labels are matched without regard to case.
+type Selector struct {
+	Kind SelectorKind
+
+	// Value is the label of the device, group, or location.
+	Value string
+
+	// HardwareAddr is the MAC address matched by SelectHardwareAddr.
+	HardwareAddr net.HardwareAddr
+}
+
+// ParseSelector parses a selector of the form "label:<label>",
+// "mac:<mac address>", "group:<group label>", or "location:<location label>".
+// A selector without a prefix is a MAC address if it looks like one, and a
+// label otherwise; "all" and "*" select every device.
+func ParseSelector(s string) (Selector, error) {
+	if s == "all" || s == "*" {
+		return Selector{Kind: SelectAll}, nil
+	}
+
+	kind, value := SelectLabel, s
+
+	if i := strings.IndexByte(s, ':'); i != -1 {
+		prefixes := map[string]SelectorKind{
+			"label":    SelectLabel,
+			"mac":      SelectHardwareAddr,
+			"group":    SelectGroup,
+			"location": SelectLocation,
+		}
+
+		if k, ok := prefixes[strings.ToLower(s[:i])]; ok {
+			kind, value = k, s[i+1:]
+		} else if mac, err := net.ParseMAC(s); err == nil && len(mac) == 6 {
+			// a MAC address without a prefix
+			return Selector{Kind: SelectHardwareAddr, HardwareAddr: mac}, nil
+		}
+	}
+
+	if value == "" {
+		return Selector{}, fmt.Errorf("invalid selector %q: the value is empty", s)
+	}
+
+	if kind != SelectHardwareAddr {
+		return Selector{Kind: kind, Value: value}, nil
+	}
+
+	mac, err := net.ParseMAC(value)
+
+	if err != nil || len(mac) != 6 {
+		return Selector{}, fmt.Errorf("invalid selector %q: %q is not a MAC address", s, value)
+	}
+
+	return Selector{Kind: SelectHardwareAddr, HardwareAddr: mac}, nil
+}
+
+func (s Selector) String() string {
+	switch s.Kind {
+	case SelectAll:
+		return "all"
+	case SelectHardwareAddr:
+		return "mac:" + s.HardwareAddr.String()
+	case SelectGroup:
+		return "group:" + s.Value
+	case SelectLocation:
+		return "location:" + s.Value
+	default:
+		return "label:" + s.Value
+	}
+}
+
+// Select returns the devices picked by any of the selectors, in the same
+// order as the devices. The labels, groups, and locations of the devices are
+// only requested if a selector needs them.
+//
+// A device that fails to answer can't be matched, so it's left out, and the
+// matching devices are returned along with a MultiError of the devices that
+// failed.
+func Select(ctx context.Context, devices []*Device, selectors []Selector) ([]*Device, error) {
+	m, err := newMatcher(ctx, devices, selectors)
+
+	var selected []*Device
+
+	for _, device := range devices {
+		for _, sel := range selectors {
+			if m.match(device, sel) {
+				selected = append(selected, device)
+				break
+			}
+		}
+	}
+
+	return selected, err
+}
+
+// matcher matches devices against selectors, using the labels, groups, and
+// locations it requested from them.
+type matcher struct {
+	labels    map[string]string
+	groups    []*Collection
+	locations []*Collection
+}
+
+// newMatcher requests the properties of the devices needed by the selectors.
+// The devices that fail to answer are returned in a MultiError, along with
+// the matcher; they never match a selector that needs the property they
+// didn't send.
+func newMatcher(ctx context.Context, devices []*Device, selectors []Selector) (*matcher, error) {
+	var needLabels, needGroups, needLocations bool
+
+	for _, sel := range selectors {
+		switch sel.Kind {
+		case SelectLabel:
+			needLabels = true
+		case SelectGroup:
+			needGroups = true
+		case SelectLocation:
+			needLocations = true
+		}
+	}
+
+	m := &matcher{labels: make(map[string]string)}
+	failed := make(map[*Device]*DeviceError)
+
+	// a device is only reported once, even if it failed more than one
+	// request
+	addErr := func(err error) {
+		me, _ := err.(MultiError)
+
+		for _, de := range me {
+			if _, ok := failed[de.Device]; !ok {
+				failed[de.Device] = de
+			}
+		}
+	}
+
+	if needLabels {
+		var mu sync.Mutex
+
+		err := forEach(ctx, devices, func(ctx context.Context, device *Device) error {
+			label, err := device.Label(ctx)
+
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			m.labels[device.HardwareAddr.String()] = label
+			mu.Unlock()
+
+			return nil
+		})
+
+		addErr(err)
+	}
+
+	if needGroups {
+		var err error
+
+		m.groups, err = Groups(ctx, devices)
+		addErr(err)
+	}
+
+	if needLocations {
+		var err error
+
+		m.locations, err = Locations(ctx, devices)
+		addErr(err)
+	}
+
+	if len(failed) == 0 {
+		return m, nil
+	}
+
+	errs := make(MultiError, 0, len(failed))
+
+	for _, de := range failed {
+		errs = append(errs, de)
+	}
+
+	sort.Sort(byDeviceError(errs))
+
+	return m, errs
+}
+
+// match returns whether the device is picked by the selector.
+func (m *matcher) match(device *Device, sel Selector) bool {
+	mac := device.HardwareAddr.String()
+
+	switch sel.Kind {
+	case SelectAll:
+		return true
+	case SelectLabel:
+		label, ok := m.labels[mac]
+		return ok && strings.EqualFold(label, sel.Value)
+	case SelectHardwareAddr:
+		return bytes.Equal(device.HardwareAddr, sel.HardwareAddr)
+	case SelectGroup:
+		return inCollection(m.groups, sel.Value, mac)
+	case SelectLocation:
+		return inCollection(m.locations, sel.Value, mac)
+	}
+
+	return false
+}
+
+// known returns whether the matcher has the property of the device the
+// selector needs. If not, the device didn't answer when it was asked for it,
+// so it's unknown whether the selector picks it.
+func (m *matcher) known(device *Device, sel Selector) bool {
+	mac := device.HardwareAddr.String()
+
+	switch sel.Kind {
+	case SelectLabel:
+		_, ok := m.labels[mac]
+		return ok
+	case SelectGroup:
+		return inAnyCollection(m.groups, mac)
+	case SelectLocation:
+		return inAnyCollection(m.locations, mac)
+	}
+
+	return true
+}
+
+// inAnyCollection returns whether the device with the MAC address is in any
+// of the groups or locations.
+func inAnyCollection(cols []*Collection, mac string) bool {
+	for _, col := range cols {
+		for _, device := range col.Devices {
+			if device.HardwareAddr.String() == mac {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// inCollection returns whether the device with the MAC address is in the
+// group or location with the label.
+func inCollection(cols []*Collection, label, mac string) bool {
+	for _, col := range cols {
+		if !strings.EqualFold(col.Label, label) {
+			continue
+		}
+
+		for _, device := range col.Devices {
+			if device.HardwareAddr.String() == mac {
+				return true
+			}
+		}
+	}
+
+	return false
+}
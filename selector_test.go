@@ -0,0 +1,117 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"context"
+	"net"
+
+	"github.com/theckman/go-lifx/protocol/payloads"
+
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) TestParseSelector(c *C) {
+	mac := net.HardwareAddr{0xd0, 0x73, 0xd5, 0x01, 0x02, 0x03}
+
+	tests := []struct {
+		in  string
+		sel Selector
+		str string
+	}{
+		{"all", Selector{Kind: SelectAll}, "all"},
+		{"*", Selector{Kind: SelectAll}, "all"},
+		{"Kitchen", Selector{Kind: SelectLabel, Value: "Kitchen"}, "label:Kitchen"},
+		{"label:all", Selector{Kind: SelectLabel, Value: "all"}, "label:all"},
+		{"Label:Living Room", Selector{Kind: SelectLabel, Value: "Living Room"}, "label:Living Room"},
+		{"Lamp: left", Selector{Kind: SelectLabel, Value: "Lamp: left"}, "label:Lamp: left"},
+		{"d0:73:d5:01:02:03", Selector{Kind: SelectHardwareAddr, HardwareAddr: mac}, "mac:d0:73:d5:01:02:03"},
+		{"mac:D0-73-D5-01-02-03", Selector{Kind: SelectHardwareAddr, HardwareAddr: mac}, "mac:d0:73:d5:01:02:03"},
+		{"group:Downstairs", Selector{Kind: SelectGroup, Value: "Downstairs"}, "group:Downstairs"},
+		{"location:Home", Selector{Kind: SelectLocation, Value: "Home"}, "location:Home"},
+	}
+
+	for _, tt := range tests {
+		sel, err := ParseSelector(tt.in)
+		c.Assert(err, IsNil, Commentf("%q", tt.in))
+		c.Check(sel, DeepEquals, tt.sel, Commentf("%q", tt.in))
+		c.Check(sel.String(), Equals, tt.str, Commentf("%q", tt.in))
+	}
+
+	errs := map[string]string{
+		"label:":                      `invalid selector "label:": the value is empty`,
+		"group:":                      `invalid selector "group:": the value is empty`,
+		"mac:kitchen":                 `invalid selector "mac:kitchen": "kitchen" is not a MAC address`,
+		"mac:d0:73:d5:01:02:03:04:05": `invalid selector "mac:d0:73:d5:01:02:03:04:05": "d0:73:d5:01:02:03:04:05" is not a MAC address`,
+	}
+
+	for in, msg := range errs {
+		_, err := ParseSelector(in)
+		c.Check(err, ErrorMatches, msg, Commentf("%q", in))
+	}
+}
+
+func (*TestSuite) TestSelect(c *C) {
+	fd1 := newFakeGroupDevice(c, 1, 1, "Upstairs", 1)
+	defer fd1.close()
+
+	fd2 := newFakeGroupDevice(c, 2, 2, "Downstairs", 1)
+	defer fd2.close()
+
+	fd3 := newFakeGroupDevice(c, 3, 2, "Downstairs", 1)
+	defer fd3.close()
+
+	fd1.mu.Lock()
+	fd1.label = lifxpayloads.NewDeviceLabelTrunc([]byte("Bedroom"))
+	fd1.mu.Unlock()
+
+	client := newTestClient(c, &Config{Retries: -1})
+	defer client.Close()
+
+	devices := []*Device{
+		client.Device(fd1.mac, fd1.addr()),
+		client.Device(fd2.mac, fd2.addr()),
+		client.Device(fd3.mac, fd3.addr()),
+	}
+
+	sel := func(s string) Selector {
+		v, err := ParseSelector(s)
+		c.Assert(err, IsNil)
+		return v
+	}
+
+	tests := []struct {
+		selectors []Selector
+		selected  []*Device
+	}{
+		{[]Selector{sel("all")}, devices},
+		{[]Selector{sel("bedroom")}, devices[:1]},
+		{[]Selector{sel("group:downstairs")}, devices[1:]},
+		{[]Selector{sel("location:Home")}, devices},
+		{[]Selector{sel(fd3.mac.String()), sel("Bedroom")}, []*Device{devices[0], devices[2]}},
+		{[]Selector{sel("group:Attic")}, nil},
+	}
+
+	for _, tt := range tests {
+		selected, err := Select(context.Background(), devices, tt.selectors)
+		c.Assert(err, IsNil, Commentf("%v", tt.selectors))
+		c.Check(selected, DeepEquals, tt.selected, Commentf("%v", tt.selectors))
+	}
+
+	//
+	// Test that the devices that don't answer are left out, and reported
+	// once
+	//
+	fd2.close()
+
+	selected, err := Select(context.Background(), devices, []Selector{sel("Kitchen"), sel("group:Downstairs")})
+	c.Check(selected, DeepEquals, devices[2:])
+
+	me, ok := err.(MultiError)
+	c.Assert(ok, Equals, true)
+	c.Assert(me, HasLen, 1)
+	c.Check(me[0].Device, Equals, devices[1])
+	c.Check(me[0].Err, Equals, ErrTimeout)
+}
@@ -0,0 +1,182 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol/payloads"
+)
+
+// Snapshot is the state of a set of lights at a point in time, taken with
+// Client.Snapshot so it can be put back with Client.Restore. It can be
+// marshaled to JSON, to restore it from another process.
+type Snapshot struct {
+	// Time is when the snapshot was taken.
+	Time time.Time `json:"time"`
+
+	// Lights are the states of the lights, sorted by their MAC addresses.
+	Lights []*LightSnapshot `json:"lights"`
+}
+
+// LightSnapshot is the state of a single light in a Snapshot.
+type LightSnapshot struct {
+	HardwareAddr net.HardwareAddr
+	Addr         *net.UDPAddr
+
+	// State is the color, power level, and label of the light.
+	State *lifxpayloads.LightState
+}
+
+func (ls *LightSnapshot) String() string {
+	if ls == nil {
+		return "<*lifx.LightSnapshot(nil)>"
+	}
+
+	return fmt.Sprintf("<*lifx.LightSnapshot(%p): HardwareAddr: %s, Addr: %s, State: %s>", ls, ls.HardwareAddr, ls.Addr, ls.State)
+}
+
+type lightSnapshotJSON struct {
+	HardwareAddr string                   `json:"mac"`
+	Addr         string                   `json:"addr"`
+	State        *lifxpayloads.LightState `json:"state"`
+}
+
+// MarshalJSON is a function that satisfies the json.Marshaler interface.
+func (ls *LightSnapshot) MarshalJSON() ([]byte, error) {
+	aux := lightSnapshotJSON{
+		HardwareAddr: ls.HardwareAddr.String(),
+		State:        ls.State,
+	}
+
+	if ls.Addr != nil {
+		aux.Addr = ls.Addr.String()
+	}
+
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON is a function that satisfies the json.Unmarshaler interface.
+func (ls *LightSnapshot) UnmarshalJSON(data []byte) error {
+	var aux lightSnapshotJSON
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	mac, err := net.ParseMAC(aux.HardwareAddr)
+
+	if err != nil {
+		return err
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", aux.Addr)
+
+	if err != nil {
+		return err
+	}
+
+	if aux.State == nil {
+		return fmt.Errorf("the snapshot of %s has no state", mac)
+	}
+
+	ls.HardwareAddr, ls.Addr, ls.State = mac, addr, aux.State
+
+	return nil
+}
+
+// Snapshot asks each of the devices for its color, power level, and label,
+// and returns them as a *Snapshot. The devices are queried concurrently; if
+// some of them fail the states of the others are returned along with a
+// MultiError.
+func (c *Client) Snapshot(ctx context.Context, devices []*Device) (*Snapshot, error) {
+	var mu sync.Mutex
+
+	snap := &Snapshot{Time: time.Now()}
+
+	err := forEach(ctx, devices, func(ctx context.Context, device *Device) error {
+		state, err := c.Light(device.HardwareAddr, device.Addr).State(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		snap.Lights = append(snap.Lights, &LightSnapshot{HardwareAddr: device.HardwareAddr, Addr: device.Addr, State: state})
+		mu.Unlock()
+
+		return nil
+	})
+
+	sort.Sort(byLightSnapshot(snap.Lights))
+
+	return snap, err
+}
+
+// Restore puts the lights back to the color and power level they had in the
+// snapshot, fading to them over the duration. The lights are restored
+// concurrently, at the addresses they had when the snapshot was taken.
+//
+// A light that was powered off is faded out, and set to the color it had, so
+// it comes back on in that color; it's never powered on to restore its color.
+// The labels in the snapshot aren't restored.
+//
+// The devices that fail, like the ones that went offline since the snapshot
+// was taken, are returned in a MultiError after the others have been
+// restored.
+func (c *Client) Restore(ctx context.Context, snap *Snapshot, duration time.Duration) error {
+	devices := make([]*Device, len(snap.Lights))
+	lights := make(map[*Device]*LightSnapshot)
+
+	for i, ls := range snap.Lights {
+		devices[i] = c.Device(ls.HardwareAddr, ls.Addr)
+		lights[devices[i]] = ls
+	}
+
+	return forEach(ctx, devices, func(ctx context.Context, device *Device) error {
+		return lights[device].restore(ctx, &Light{Device: device}, duration)
+	})
+}
+
+// restore changes the light to the state in the snapshot.
+func (ls *LightSnapshot) restore(ctx context.Context, light *Light, duration time.Duration) error {
+	if ls.Addr == nil || ls.State == nil || ls.State.Color == nil {
+		return errors.New("the snapshot of the light is incomplete")
+	}
+
+	color := *ls.State.Color
+
+	// a light that was on fades in to its color, and one that was off starts
+	// fading out before its color changes
+	if ls.State.Power != 0 {
+		if err := light.SetColor(ctx, color, duration); err != nil {
+			return err
+		}
+
+		return light.SetPower(ctx, true, duration)
+	}
+
+	if err := light.SetPower(ctx, false, duration); err != nil {
+		return err
+	}
+
+	return light.SetColor(ctx, color, duration)
+}
+
+type byLightSnapshot []*LightSnapshot
+
+func (b byLightSnapshot) Len() int      { return len(b) }
+func (b byLightSnapshot) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byLightSnapshot) Less(i, j int) bool {
+	return bytes.Compare(b[i].HardwareAddr, b[j].HardwareAddr) < 0
+}
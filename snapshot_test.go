@@ -0,0 +1,138 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/protocol/payloads"
+
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) TestClient_SnapshotRestore(c *C) {
+	on := newFakeGroupDevice(c, 2, 1, "Kitchen", 1)
+	defer on.close()
+
+	off := newFakeGroupDevice(c, 1, 1, "Kitchen", 1)
+	defer off.close()
+
+	gone := newFakeGroupDevice(c, 3, 1, "Kitchen", 1)
+	defer gone.close()
+
+	blue := lifxpayloads.LightHSBK{Hue: 43690, Saturation: 65535, Brightness: 65535, Kelvin: 3500}
+	red := lifxpayloads.LightHSBK{Saturation: 65535, Brightness: 65535, Kelvin: 3500}
+
+	on.mu.Lock()
+	on.power = 65535
+	on.mu.Unlock()
+
+	off.mu.Lock()
+	off.color = blue
+	off.label = lifxpayloads.NewDeviceLabelTrunc([]byte("Porch"))
+	off.mu.Unlock()
+
+	client := newTestClient(c, &Config{Retries: -1})
+	defer client.Close()
+
+	devices := []*Device{
+		client.Device(on.mac, on.addr()),
+		client.Device(off.mac, off.addr()),
+		client.Device(gone.mac, gone.addr()),
+	}
+
+	snap, err := client.Snapshot(context.Background(), devices)
+	c.Assert(err, IsNil)
+	c.Assert(snap.Lights, HasLen, 3)
+
+	// sorted by MAC address
+	c.Check(snap.Lights[0].HardwareAddr, DeepEquals, off.mac)
+	c.Check(snap.Lights[0].State.Power, Equals, uint16(0))
+	c.Check(*snap.Lights[0].State.Color, Equals, blue)
+	c.Check(snap.Lights[0].State.Label, Equals, lifxpayloads.NewDeviceLabelTrunc([]byte("Porch")))
+	c.Check(snap.Lights[1].HardwareAddr, DeepEquals, on.mac)
+	c.Check(snap.Lights[1].State.Power, Equals, uint16(65535))
+
+	// the snapshot survives a round trip through JSON
+	data, err := json.Marshal(snap)
+	c.Assert(err, IsNil)
+
+	var restored Snapshot
+	c.Assert(json.Unmarshal(data, &restored), IsNil)
+	c.Check(restored.Time.Equal(snap.Time), Equals, true)
+	c.Assert(restored.Lights, HasLen, 3)
+
+	for i, ls := range restored.Lights {
+		c.Check(ls.HardwareAddr, DeepEquals, snap.Lights[i].HardwareAddr)
+		c.Check(ls.Addr.String(), Equals, snap.Lights[i].Addr.String())
+		c.Check(ls.State, DeepEquals, snap.Lights[i].State)
+	}
+
+	// a notification flash turns everything on and red, and a device goes
+	// offline
+	for _, fd := range []*fakeDevice{on, off} {
+		fd.mu.Lock()
+		fd.power, fd.color = 65535, red
+		fd.received = nil
+		fd.mu.Unlock()
+	}
+
+	gone.close()
+
+	err = client.Restore(context.Background(), &restored, time.Second)
+
+	me, ok := err.(MultiError)
+	c.Assert(ok, Equals, true)
+	c.Assert(me, HasLen, 1)
+	c.Check(me[0].Device.HardwareAddr, DeepEquals, gone.mac)
+	c.Check(me[0].Err, Equals, ErrTimeout)
+
+	on.mu.Lock()
+	c.Check(on.power, Equals, uint16(65535))
+	c.Check(on.color, Equals, *snap.Lights[1].State.Color)
+	on.mu.Unlock()
+
+	// the light that was off is powered off before its color is restored
+	off.mu.Lock()
+	c.Check(off.power, Equals, uint16(0))
+	c.Check(off.color, Equals, blue)
+	off.mu.Unlock()
+
+	packets := off.packets()
+	c.Assert(packets, HasLen, 2)
+	c.Check(packets[0].Header.ProtocolHeader.Type, Equals, lifxprotocol.LightSetPower)
+	c.Check(packets[1].Header.ProtocolHeader.Type, Equals, lifxprotocol.LightSetColor)
+	c.Check(packets[1].Payload.(*lifxpayloads.LightSetColor).Duration, Equals, time.Second)
+
+	//
+	// Test that the devices that fail are left out of the snapshot
+	//
+	snap, err = client.Snapshot(context.Background(), devices)
+	c.Assert(snap.Lights, HasLen, 2)
+
+	me, ok = err.(MultiError)
+	c.Assert(ok, Equals, true)
+	c.Assert(me, HasLen, 1)
+	c.Check(me[0].Device, Equals, devices[2])
+}
+
+func (*TestSuite) TestLightSnapshot_UnmarshalJSON(c *C) {
+	tests := []struct {
+		data string
+		err  string
+	}{
+		{`{"mac": "nope", "addr": "127.0.0.1:56700", "state": {}}`, ".*invalid MAC address.*"},
+		{`{"mac": "d0:73:d5:00:00:01", "addr": "127.0.0.1", "state": {}}`, ".*missing port in address.*"},
+		{`{"mac": "d0:73:d5:00:00:01", "addr": "127.0.0.1:56700"}`, "the snapshot of d0:73:d5:00:00:01 has no state"},
+	}
+
+	for _, tt := range tests {
+		var ls LightSnapshot
+		c.Check(json.Unmarshal([]byte(tt.data), &ls), ErrorMatches, tt.err, Commentf("%s", tt.data))
+	}
+}
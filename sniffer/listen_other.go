@@ -0,0 +1,16 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package lifxsniffer
+
+import "net"
+
+// listenReuse listens on the UDP address. Sharing the port isn't supported on
+// this platform, so the port must be free.
+func listenReuse(addr string) (net.PacketConn, error) {
+	return net.ListenPacket("udp4", addr)
+}
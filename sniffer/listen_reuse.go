@@ -0,0 +1,56 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package lifxsniffer
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// listenReuse listens on the UDP address with SO_REUSEADDR and SO_REUSEPORT
+// set, so the port can be shared with the other sockets that set them.
+func listenReuse(addr string) (net.PacketConn, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp4", addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, syscall.IPPROTO_UDP)
+
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+
+	syscall.CloseOnExec(fd)
+
+	for _, opt := range []int{syscall.SO_REUSEADDR, soReusePort, syscall.SO_BROADCAST} {
+		if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, opt, 1); err != nil {
+			syscall.Close(fd)
+			return nil, os.NewSyscallError("setsockopt", err)
+		}
+	}
+
+	sa := &syscall.SockaddrInet4{Port: udpAddr.Port}
+
+	if ip := udpAddr.IP.To4(); ip != nil {
+		copy(sa.Addr[:], ip)
+	}
+
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+
+	// the *net.UDPConn has its own copy of the descriptor
+	f := os.NewFile(uintptr(fd), "lifxsniffer")
+	defer f.Close()
+
+	return net.FilePacketConn(f)
+}
@@ -0,0 +1,33 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package lifxsniffer
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) Test_listenReuse(c *C) {
+	first, err := listenReuse("127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer first.Close()
+
+	// the port can be shared
+	second, err := listenReuse(first.LocalAddr().String())
+	c.Assert(err, IsNil)
+	defer second.Close()
+
+	c.Check(second.LocalAddr().String(), Equals, first.LocalAddr().String())
+
+	s, err := New(&Config{Addr: first.LocalAddr().String()})
+	c.Assert(err, IsNil)
+	c.Check(s.LocalAddr().String(), Equals, first.LocalAddr().String())
+	c.Check(s.conn.Close(), IsNil)
+
+	_, err = listenReuse("localhost:http-nope")
+	c.Check(err, NotNil)
+}
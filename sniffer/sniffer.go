@@ -0,0 +1,426 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+// Package lifxsniffer passively decodes the LIFX LAN Protocol traffic on the
+// local network, including the traffic of other apps, so you can see what
+// they send and debug conflicts between controllers.
+//
+// A *Sniffer listens on the LIFX port with SO_REUSEADDR and SO_REUSEPORT set,
+// so it can bind the port while other programs are using it. Each packet is
+// decoded, classified as a request or a response, and responses are paired
+// with the request they answer using its source identifier and sequence
+// number:
+//
+//	sniffer, err := lifxsniffer.New(nil)
+//
+//	if err != nil {
+//		// handle err
+//	}
+//
+//	go sniffer.Run(ctx)
+//
+//	for p := range sniffer.Packets() {
+//		if p.Request != nil {
+//			fmt.Printf("%s answered in %s\n", p.Addr, p.Latency)
+//		}
+//	}
+//
+// The sniffer only sees the packets delivered to its socket. That includes
+// the broadcasts sent to the LIFX port, like the discovery of other apps, and
+// the responses the devices broadcast to clients using a source of 0. The
+// unicast traffic between other hosts can't be seen this way; to decode that,
+// give the sniffer a connection reading from a mirrored port, or decode a
+// packet capture with the lifx command.
+//
+// Don't run a sniffer on the same port as a device emulator, or a controller
+// listening on the LIFX port, on the same host. On Linux, SO_REUSEPORT
+// spreads the unicast datagrams sent to the port across all of the sockets
+// bound to it, so the sniffer silently takes some of the unicast requests
+// meant for the other program, which never sees them. Listen on a different
+// port, or on a mirrored interface, instead.
+package lifxsniffer
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/util"
+)
+
+const (
+	// DefaultAddr is the address a *Sniffer listens on by default: the
+	// LIFX port on all interfaces.
+	DefaultAddr = ":56700"
+
+	// DefaultPairTimeout is the default amount of time a request waits to
+	// be paired with its responses.
+	DefaultPairTimeout = 5 * time.Second
+)
+
+// maxPacketSize is the largest UDP datagram we'll read.
+const maxPacketSize = 65535
+
+// packetBuffer is the number of packets buffered by a *Sniffer.
+const packetBuffer = 256
+
+// ErrSnifferRunning is the error returned by Sniffer.Run when the sniffer is
+// already running, or has been run before.
+var ErrSnifferRunning = errors.New("the sniffer has already been run")
+
+// Kind is whether a packet is a request or a response.
+type Kind uint8
+
+const (
+	// KindUnknown is a packet whose message type isn't known, or whose
+	// header couldn't be decoded.
+	KindUnknown Kind = iota
+
+	// KindRequest is a message sent by a client, like LightSetColor.
+	KindRequest
+
+	// KindResponse is a message sent by a device, like LightState or
+	// DeviceAcknowledgement.
+	KindResponse
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindRequest:
+		return "request"
+	case KindResponse:
+		return "response"
+	default:
+		return "unknown"
+	}
+}
+
+// Config is the configuration for a *Sniffer. The zero value is usable, and
+// any fields that aren't set use their defaults.
+type Config struct {
+	// Conn is the connection the packets are read from. If nil, the sniffer
+	// listens on Addr, sharing the port with the other sockets bound to it,
+	// which lose some of their unicast packets to it on Linux.
+	Conn net.PacketConn
+
+	// Addr is the address to listen on if Conn is nil. If empty,
+	// DefaultAddr is used.
+	Addr string
+
+	// PairTimeout is how long a request waits to be paired with its
+	// responses. If 0, DefaultPairTimeout is used.
+	PairTimeout time.Duration
+
+	// Clock is the source of the packet times. If nil, the system clock is
+	// used.
+	Clock lifxutil.Clock
+}
+
+// Packet is a packet seen by a *Sniffer.
+type Packet struct {
+	// Time is when the packet was read, and Addr is who sent it.
+	Time time.Time
+	Addr net.Addr
+
+	// Data is the packet as it was received.
+	Data []byte
+
+	// Packet is the decoded packet. It's nil if the header couldn't be
+	// decoded. If there was an error decoding the packet it's in Err; the
+	// packet of an unknown message type has its header, but no payload.
+	Packet *lifxprotocol.Packet
+	Err    error
+
+	Kind Kind
+
+	// Request is the request a response answers, if it was seen within the
+	// pair timeout, and Latency is the time between the two.
+	Request *Packet
+	Latency time.Duration
+
+	// SourceConflict is the address of another client that sent a request
+	// with the same source identifier within the pair timeout, if there was
+	// one. Clients sharing a source see each other's responses.
+	SourceConflict net.Addr
+}
+
+func (p *Packet) String() string {
+	if p == nil {
+		return "<*lifxsniffer.Packet(nil)>"
+	}
+
+	return fmt.Sprintf(
+		"<*lifxsniffer.Packet(%p): Time: %s, Addr: %s, Kind: %s, Packet: %s>",
+		p, p.Time, p.Addr, p.Kind, p.Packet,
+	)
+}
+
+// requestKey identifies the request a response answers.
+type requestKey struct {
+	source   uint32
+	sequence uint8
+}
+
+// sourceUse is the last client to send a request with a source identifier.
+type sourceUse struct {
+	addr net.Addr
+	time time.Time
+}
+
+// Sniffer reads the LIFX packets sent to its socket, and pairs the responses
+// with their requests. It's safe for concurrent use by multiple goroutines.
+type Sniffer struct {
+	conn        net.PacketConn
+	ownsConn    bool
+	pairTimeout time.Duration
+	clock       lifxutil.Clock
+
+	mu      sync.Mutex
+	running bool
+
+	// these are only used by Run
+	pending map[requestKey]*Packet
+	sources map[uint32]sourceUse
+
+	packets chan *Packet
+}
+
+// New returns a new *Sniffer using the configuration. The config can be nil
+// to use the defaults. Call Run to start reading packets.
+func New(config *Config) (*Sniffer, error) {
+	if config == nil {
+		config = &Config{}
+	}
+
+	s := &Sniffer{
+		conn:        config.Conn,
+		pairTimeout: config.PairTimeout,
+		clock:       config.Clock,
+		pending:     make(map[requestKey]*Packet),
+		sources:     make(map[uint32]sourceUse),
+		packets:     make(chan *Packet, packetBuffer),
+	}
+
+	if s.conn == nil {
+		addr := config.Addr
+
+		if addr == "" {
+			addr = DefaultAddr
+		}
+
+		conn, err := listenReuse(addr)
+
+		if err != nil {
+			return nil, err
+		}
+
+		s.conn, s.ownsConn = conn, true
+	}
+
+	if s.pairTimeout <= 0 {
+		s.pairTimeout = DefaultPairTimeout
+	}
+
+	if s.clock == nil {
+		s.clock = lifxutil.SystemClock
+	}
+
+	return s, nil
+}
+
+// LocalAddr returns the local network address of the sniffer's connection.
+func (s *Sniffer) LocalAddr() net.Addr { return s.conn.LocalAddr() }
+
+// Packets returns the channel the packets are sent on. It's closed when Run
+// returns. Run waits for the packets to be read, so they're never dropped by
+// the sniffer, but the kernel drops them if its buffer fills up in the
+// meantime.
+func (s *Sniffer) Packets() <-chan *Packet {
+	return s.packets
+}
+
+// Run reads packets until the context is done, and returns the context's
+// error. If the sniffer created its own connection it's closed when Run
+// returns. A *Sniffer can only be run once; its packets channel is closed
+// when Run returns.
+func (s *Sniffer) Run(ctx context.Context) error {
+	s.mu.Lock()
+
+	if s.running {
+		s.mu.Unlock()
+		return ErrSnifferRunning
+	}
+
+	s.running = true
+	s.mu.Unlock()
+
+	defer close(s.packets)
+
+	if s.ownsConn {
+		defer s.conn.Close()
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		// unblock the read when the context is done
+		select {
+		case <-ctx.Done():
+			s.conn.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	buf := make([]byte, maxPacketSize)
+
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err != nil {
+			return err
+		}
+
+		p := s.decode(append([]byte(nil), buf[:n]...), addr)
+
+		select {
+		case s.packets <- p:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// decode decodes the packet, and pairs it with its request if it's a
+// response.
+func (s *Sniffer) decode(data []byte, addr net.Addr) *Packet {
+	p := &Packet{
+		Time: s.clock.Now(),
+		Addr: addr,
+		Data: data,
+	}
+
+	packet := &lifxprotocol.Packet{}
+	err := packet.UnmarshalPacket(bytes.NewReader(data), binary.LittleEndian)
+
+	switch {
+	case err == nil && int(packet.Header.Frame.Size) != len(data):
+		err = fmt.Errorf("the frame size is %d bytes, but the packet is %d bytes", packet.Header.Frame.Size, len(data))
+	case err != nil && packet.Header == nil:
+		p.Err = err
+		return p
+	}
+
+	p.Packet, p.Err = packet, err
+
+	s.expire(p.Time)
+
+	key := requestKey{
+		source:   packet.Header.Frame.Source,
+		sequence: packet.Header.FrameAddress.Sequence,
+	}
+
+	switch p.Kind = kindOf(packet.Header.ProtocolHeader.Type); p.Kind {
+	case KindRequest:
+		if use, ok := s.sources[key.source]; ok && use.addr.String() != addr.String() {
+			p.SourceConflict = use.addr
+		}
+
+		s.sources[key.source] = sourceUse{addr: addr, time: p.Time}
+		s.pending[key] = p
+
+	case KindResponse:
+		req, ok := s.pending[key]
+
+		if ok && answers(req.Packet, packet) {
+			p.Request = req
+			p.Latency = p.Time.Sub(req.Time)
+		}
+	}
+
+	return p
+}
+
+// expire forgets the requests and sources that are older than the pair
+// timeout.
+func (s *Sniffer) expire(now time.Time) {
+	for key, req := range s.pending {
+		if now.Sub(req.Time) > s.pairTimeout {
+			delete(s.pending, key)
+		}
+	}
+
+	for source, use := range s.sources {
+		if now.Sub(use.time) > s.pairTimeout {
+			delete(s.sources, source)
+		}
+	}
+}
+
+// answers returns whether the response could be from a device the request was
+// sent to. Requests to all devices can be answered by any of them.
+func answers(req, res *lifxprotocol.Packet) bool {
+	target := req.Header.FrameAddress.Target
+
+	if req.Header.Frame.Tagged || len(target) == 0 || bytes.Equal(target, make([]byte, len(target))) {
+		return true
+	}
+
+	return bytes.Equal(target, res.Header.FrameAddress.Target)
+}
+
+// kindOf returns whether the message type is sent by clients or devices.
+func kindOf(t uint16) Kind {
+	switch t {
+	case lifxprotocol.DeviceStateService,
+		lifxprotocol.DeviceStateHostInfo,
+		lifxprotocol.DeviceStateHostFirmware,
+		lifxprotocol.DeviceStateWifiInfo,
+		lifxprotocol.DeviceStateWifiFirmware,
+		lifxprotocol.DeviceStatePower,
+		lifxprotocol.DeviceStateLabel,
+		lifxprotocol.DeviceStateVersion,
+		lifxprotocol.DeviceStateInfo,
+		lifxprotocol.DeviceAcknowledgement,
+		lifxprotocol.DeviceStateLocation,
+		lifxprotocol.DeviceStateGroup,
+		lifxprotocol.DeviceEchoResponse,
+		lifxprotocol.LightState,
+		lifxprotocol.LightStatePower:
+		return KindResponse
+
+	case lifxprotocol.DeviceGetService,
+		lifxprotocol.DeviceGetHostInfo,
+		lifxprotocol.DeviceGetHostFirmware,
+		lifxprotocol.DeviceGetWifiInfo,
+		lifxprotocol.DeviceGetWifiFirmware,
+		lifxprotocol.DeviceGetPower,
+		lifxprotocol.DeviceSetPower,
+		lifxprotocol.DeviceGetLabel,
+		lifxprotocol.DeviceSetLabel,
+		lifxprotocol.DeviceGetVersion,
+		lifxprotocol.DeviceGetInfo,
+		lifxprotocol.DeviceGetLocation,
+		lifxprotocol.DeviceGetGroup,
+		lifxprotocol.DeviceEchoRequest,
+		lifxprotocol.LightGet,
+		lifxprotocol.LightSetColor,
+		lifxprotocol.LightSetWaveform,
+		lifxprotocol.LightGetPower,
+		lifxprotocol.LightSetPower:
+		return KindRequest
+	}
+
+	return KindUnknown
+}
@@ -0,0 +1,201 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxsniffer
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol"
+	"github.com/theckman/go-lifx/protocol/payloads"
+	"github.com/theckman/go-lifx/util"
+
+	. "gopkg.in/check.v1"
+)
+
+type TestSuite struct{}
+
+var _ = Suite(&TestSuite{})
+
+func Test(t *testing.T) { TestingT(t) }
+
+// newSniffer returns a running sniffer reading from a socket on the loopback
+// interface.
+func newSniffer(c *C, clock lifxutil.Clock) (*Sniffer, context.CancelFunc, chan error) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+
+	s, err := New(&Config{Conn: conn, Clock: clock})
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- s.Run(ctx)
+		conn.Close()
+	}()
+
+	return s, cancel, errs
+}
+
+// sendPacket sends the packet from the connection to the sniffer, and returns
+// what the sniffer made of it.
+func sendPacket(c *C, s *Sniffer, conn net.PacketConn, source uint32, seq uint8, target net.HardwareAddr, msgType uint16, payload lifxprotocol.PacketComponent) *Packet {
+	frame := lifxprotocol.NewFrame()
+	frame.Source = source
+	frame.Tagged = len(target) == 0
+
+	p := &lifxprotocol.Packet{
+		Header: &lifxprotocol.Header{
+			Frame:          frame,
+			FrameAddress:   &lifxprotocol.FrameAddress{Target: target, Sequence: seq},
+			ProtocolHeader: &lifxprotocol.ProtocolHeader{Type: msgType},
+		},
+		Payload: payload,
+	}
+
+	data, err := p.MarshalPacket(binary.LittleEndian)
+	c.Assert(err, IsNil)
+
+	return sendData(c, s, conn, data)
+}
+
+func sendData(c *C, s *Sniffer, conn net.PacketConn, data []byte) *Packet {
+	_, err := conn.WriteTo(data, s.LocalAddr())
+	c.Assert(err, IsNil)
+
+	select {
+	case p := <-s.Packets():
+		c.Assert(p, NotNil)
+		c.Check(p.Addr.String(), Equals, conn.LocalAddr().String())
+		c.Check(p.Data, DeepEquals, data)
+		return p
+	case <-time.After(2 * time.Second):
+		c.Fatal("timed out waiting for the sniffer")
+	}
+
+	return nil
+}
+
+func listen(c *C) net.PacketConn {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+
+	return conn
+}
+
+func (*TestSuite) TestSniffer_Pairing(c *C) {
+	clock := lifxutil.NewManualClock(time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC))
+
+	s, cancel, errs := newSniffer(c, clock)
+	defer cancel()
+
+	client, other, device := listen(c), listen(c), listen(c)
+	defer client.Close()
+	defer other.Close()
+	defer device.Close()
+
+	mac := net.HardwareAddr{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x01}
+	mac2 := net.HardwareAddr{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x02}
+
+	// a request, and its response 12ms later
+	req := sendPacket(c, s, client, 1234, 7, mac, lifxprotocol.LightGet, &lifxpayloads.Empty{})
+	c.Check(req.Err, IsNil)
+	c.Check(req.Kind, Equals, KindRequest)
+	c.Check(req.Request, IsNil)
+	c.Check(req.SourceConflict, IsNil)
+	c.Check(req.Packet.Header.ProtocolHeader.Type, Equals, lifxprotocol.LightGet)
+
+	clock.Advance(12 * time.Millisecond)
+
+	res := sendPacket(c, s, device, 1234, 7, mac, lifxprotocol.LightState, &lifxpayloads.LightState{Color: &lifxpayloads.LightHSBK{}})
+	c.Check(res.Err, IsNil)
+	c.Check(res.Kind, Equals, KindResponse)
+	c.Check(res.Request, Equals, req)
+	c.Check(res.Latency, Equals, 12*time.Millisecond)
+
+	// a response from a device the request wasn't sent to
+	res = sendPacket(c, s, device, 1234, 7, mac2, lifxprotocol.DeviceAcknowledgement, &lifxpayloads.Empty{})
+	c.Check(res.Kind, Equals, KindResponse)
+	c.Check(res.Request, IsNil)
+
+	// a broadcast is answered by every device
+	req = sendPacket(c, s, client, 1234, 8, nil, lifxprotocol.DeviceGetService, &lifxpayloads.Empty{})
+
+	for _, target := range []net.HardwareAddr{mac, mac2} {
+		clock.Advance(time.Millisecond)
+
+		res = sendPacket(c, s, device, 1234, 8, target, lifxprotocol.DeviceStateService, &lifxpayloads.DeviceStateService{Service: 1, Port: 56700})
+		c.Check(res.Request, Equals, req)
+	}
+
+	c.Check(res.Latency, Equals, 2*time.Millisecond)
+
+	// another client using the same source
+	req = sendPacket(c, s, other, 1234, 9, mac, lifxprotocol.LightGet, &lifxpayloads.Empty{})
+	c.Check(req.SourceConflict, NotNil)
+	c.Check(req.SourceConflict.String(), Equals, client.LocalAddr().String())
+
+	// the requests are forgotten after the pair timeout
+	clock.Advance(DefaultPairTimeout + time.Millisecond)
+
+	res = sendPacket(c, s, device, 1234, 9, mac, lifxprotocol.LightState, &lifxpayloads.LightState{Color: &lifxpayloads.LightHSBK{}})
+	c.Check(res.Request, IsNil)
+
+	req = sendPacket(c, s, client, 1234, 10, mac, lifxprotocol.LightGet, &lifxpayloads.Empty{})
+	c.Check(req.SourceConflict, IsNil)
+
+	cancel()
+
+	select {
+	case err := <-errs:
+		c.Check(err, Equals, context.Canceled)
+	case <-time.After(2 * time.Second):
+		c.Fatal("timed out waiting for Run to return")
+	}
+
+	_, ok := <-s.Packets()
+	c.Check(ok, Equals, false)
+	c.Check(s.Run(context.Background()), Equals, ErrSnifferRunning)
+}
+
+func (*TestSuite) TestSniffer_Malformed(c *C) {
+	s, cancel, _ := newSniffer(c, nil)
+	defer cancel()
+
+	conn := listen(c)
+	defer conn.Close()
+
+	// too short for a header
+	p := sendData(c, s, conn, []byte("hello"))
+	c.Check(p.Packet, IsNil)
+	c.Check(p.Err, NotNil)
+	c.Check(p.Kind, Equals, KindUnknown)
+
+	// an unknown message type still has its header
+	p = sendPacket(c, s, conn, 1234, 1, nil, lifxprotocol.DeviceGetService, &lifxpayloads.Empty{})
+	c.Assert(p.Err, IsNil)
+
+	get := p.Data
+
+	data := append([]byte(nil), get...)
+	binary.LittleEndian.PutUint16(data[32:], 9999)
+
+	p = sendData(c, s, conn, data)
+	c.Check(p.Err, Equals, lifxprotocol.ErrUnknownMessageType)
+	c.Assert(p.Packet, NotNil)
+	c.Check(p.Packet.Header.ProtocolHeader.Type, Equals, uint16(9999))
+	c.Check(p.Kind, Equals, KindUnknown)
+
+	// trailing bytes
+	p = sendData(c, s, conn, append(append([]byte(nil), get...), 0))
+	c.Check(p.Err, ErrorMatches, "the frame size is 36 bytes, but the packet is 37 bytes")
+	c.Assert(p.Packet, NotNil)
+	c.Check(p.Kind, Equals, KindRequest)
+}
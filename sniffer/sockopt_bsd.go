@@ -0,0 +1,13 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package lifxsniffer
+
+import "syscall"
+
+// soReusePort is SO_REUSEPORT.
+const soReusePort = syscall.SO_REUSEPORT
@@ -0,0 +1,12 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+// +build linux,!mips,!mipsle,!mips64,!mips64le
+
+package lifxsniffer
+
+// soReusePort is SO_REUSEPORT, which the syscall package doesn't define on all
+// of the Linux architectures.
+const soReusePort = 0xf
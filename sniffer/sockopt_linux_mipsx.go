@@ -0,0 +1,11 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+//go:build (linux && mips) || (linux && mipsle) || (linux && mips64) || (linux && mips64le)
+// +build linux,mips linux,mipsle linux,mips64 linux,mips64le
+
+package lifxsniffer
+
+// soReusePort is SO_REUSEPORT, which has a different value on MIPS.
+const soReusePort = 0x200
@@ -0,0 +1,355 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol"
+)
+
+// rttSamples is the number of the most recent RTT samples kept per device,
+// which the percentiles are calculated from.
+const rttSamples = 1024
+
+// RTTStats is a summary of the round-trip times of the requests to a device.
+// Only requests that were answered on the first attempt are sampled, because
+// a response to a retried request can't be matched to the attempt it answers.
+type RTTStats struct {
+	// Count and Sum are the number of samples and their total, since the
+	// client was created.
+	Count uint64
+	Sum   time.Duration
+
+	// Min, Max, and the percentiles are calculated from the most recent
+	// samples.
+	Min time.Duration
+	Max time.Duration
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+}
+
+// Mean returns the mean RTT, or 0 if there are no samples.
+func (rs RTTStats) Mean() time.Duration {
+	if rs.Count == 0 {
+		return 0
+	}
+
+	return rs.Sum / time.Duration(rs.Count)
+}
+
+// DeviceStats are the statistics of the requests a *Client has made to a
+// single device.
+type DeviceStats struct {
+	HardwareAddr net.HardwareAddr
+
+	// Requests is the number of requests made, and Responses the number of
+	// them that were answered.
+	Requests  uint64
+	Responses uint64
+
+	// Timeouts is the number of requests that went unanswered after all of
+	// their retries.
+	Timeouts uint64
+
+	// Retries is the number of times a request was sent again.
+	Retries uint64
+
+	// PacketsSent is the number of packets sent, including retries, and Lost
+	// is the number of them that weren't answered within the timeout.
+	PacketsSent uint64
+	Lost        uint64
+
+	// SentByType is the number of packets sent for each message type, keyed
+	// by the name of the type.
+	SentByType map[string]uint64
+
+	RTT RTTStats
+}
+
+// LossRatio returns the fraction of the packets sent that weren't answered
+// within the timeout, or 0 if no packets have been sent.
+func (ds DeviceStats) LossRatio() float64 {
+	if ds.PacketsSent == 0 {
+		return 0
+	}
+
+	return float64(ds.Lost) / float64(ds.PacketsSent)
+}
+
+// deviceStats is the mutable version of DeviceStats.
+type deviceStats struct {
+	DeviceStats
+
+	sentByType map[uint16]uint64
+
+	// samples is a ring buffer of the most recent RTT samples, with next
+	// being the index of the oldest once it's full
+	samples []time.Duration
+	next    int
+}
+
+// statsRecorder records the statistics of the requests made by a *Client.
+type statsRecorder struct {
+	mu      sync.Mutex
+	devices map[string]*deviceStats
+}
+
+func newStatsRecorder() *statsRecorder {
+	return &statsRecorder{devices: make(map[string]*deviceStats)}
+}
+
+// device returns the stats of the device. The caller must hold the lock.
+func (sr *statsRecorder) device(mac net.HardwareAddr) *deviceStats {
+	key := mac.String()
+
+	ds, ok := sr.devices[key]
+
+	if !ok {
+		ds = &deviceStats{
+			DeviceStats: DeviceStats{HardwareAddr: append(net.HardwareAddr(nil), mac...)},
+			sentByType:  make(map[uint16]uint64),
+		}
+
+		sr.devices[key] = ds
+	}
+
+	return ds
+}
+
+// request records a new request to the device.
+func (sr *statsRecorder) request(mac net.HardwareAddr) {
+	sr.mu.Lock()
+	sr.device(mac).Requests++
+	sr.mu.Unlock()
+}
+
+// sent records a packet sent to the device, which is a retry if it isn't the
+// first attempt.
+func (sr *statsRecorder) sent(mac net.HardwareAddr, msgType uint16, retry bool) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	ds := sr.device(mac)
+	ds.PacketsSent++
+	ds.sentByType[msgType]++
+
+	if retry {
+		ds.Retries++
+	}
+}
+
+// lost records a packet that wasn't answered within the timeout.
+func (sr *statsRecorder) lost(mac net.HardwareAddr) {
+	sr.mu.Lock()
+	sr.device(mac).Lost++
+	sr.mu.Unlock()
+}
+
+// timeout records a request that went unanswered after all of its retries.
+func (sr *statsRecorder) timeout(mac net.HardwareAddr) {
+	sr.mu.Lock()
+	sr.device(mac).Timeouts++
+	sr.mu.Unlock()
+}
+
+// answered records a request that was answered. If sample is false the RTT
+// isn't recorded.
+func (sr *statsRecorder) answered(mac net.HardwareAddr, rtt time.Duration, sample bool) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	ds := sr.device(mac)
+	ds.Responses++
+
+	if !sample {
+		return
+	}
+
+	ds.RTT.Count++
+	ds.RTT.Sum += rtt
+
+	if len(ds.samples) < rttSamples {
+		ds.samples = append(ds.samples, rtt)
+		return
+	}
+
+	ds.samples[ds.next] = rtt
+	ds.next = (ds.next + 1) % rttSamples
+}
+
+// snapshot returns a copy of the stats of the device, with the RTT summary
+// calculated. The caller must hold the lock.
+func (ds *deviceStats) snapshot() DeviceStats {
+	snap := ds.DeviceStats
+	snap.HardwareAddr = append(net.HardwareAddr(nil), ds.HardwareAddr...)
+	snap.SentByType = make(map[string]uint64, len(ds.sentByType))
+
+	for msgType, n := range ds.sentByType {
+		snap.SentByType[lifxprotocol.TypeName(msgType)] += n
+	}
+
+	if len(ds.samples) == 0 {
+		return snap
+	}
+
+	samples := append([]time.Duration(nil), ds.samples...)
+	sort.Sort(byDuration(samples))
+
+	snap.RTT.Min = samples[0]
+	snap.RTT.Max = samples[len(samples)-1]
+	snap.RTT.P50 = percentile(samples, 0.5)
+	snap.RTT.P90 = percentile(samples, 0.9)
+	snap.RTT.P99 = percentile(samples, 0.99)
+
+	return snap
+}
+
+// percentile returns the p percentile of the sorted samples, using the
+// nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(p*float64(len(sorted))+0.5) - 1
+
+	switch {
+	case rank < 0:
+		rank = 0
+	case rank >= len(sorted):
+		rank = len(sorted) - 1
+	}
+
+	return sorted[rank]
+}
+
+type byDuration []time.Duration
+
+func (b byDuration) Len() int           { return len(b) }
+func (b byDuration) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byDuration) Less(i, j int) bool { return b[i] < b[j] }
+
+// Stats returns the statistics of the requests the client has made to each
+// device, sorted by MAC address. Broadcasts aren't included.
+func (c *Client) Stats() []DeviceStats {
+	c.stats.mu.Lock()
+	defer c.stats.mu.Unlock()
+
+	stats := make([]DeviceStats, 0, len(c.stats.devices))
+
+	for _, ds := range c.stats.devices {
+		stats = append(stats, ds.snapshot())
+	}
+
+	sort.Sort(byStatsHardwareAddr(stats))
+
+	return stats
+}
+
+// DeviceStats returns the statistics of the requests the client has made to
+// the device with the MAC address. The second value is false if the client
+// hasn't made any requests to the device.
+func (c *Client) DeviceStats(mac net.HardwareAddr) (DeviceStats, bool) {
+	c.stats.mu.Lock()
+	defer c.stats.mu.Unlock()
+
+	ds, ok := c.stats.devices[mac.String()]
+
+	if !ok {
+		return DeviceStats{}, false
+	}
+
+	return ds.snapshot(), true
+}
+
+type byStatsHardwareAddr []DeviceStats
+
+func (b byStatsHardwareAddr) Len() int      { return len(b) }
+func (b byStatsHardwareAddr) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byStatsHardwareAddr) Less(i, j int) bool {
+	return bytes.Compare(b[i].HardwareAddr, b[j].HardwareAddr) < 0
+}
+
+// WritePrometheus writes the statistics of the client in the Prometheus text
+// exposition format. Each metric is labeled with the MAC address of the
+// device, and the RTT is exported as a summary in seconds.
+func (c *Client) WritePrometheus(w io.Writer) error {
+	stats := c.Stats()
+	bw := bufio.NewWriter(w)
+
+	counter := func(name, help string, value func(DeviceStats) uint64) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+
+		for _, ds := range stats {
+			fmt.Fprintf(bw, "%s{mac=%q} %d\n", name, ds.HardwareAddr.String(), value(ds))
+		}
+	}
+
+	counter("lifx_requests_total", "Number of requests made to the device.", func(ds DeviceStats) uint64 { return ds.Requests })
+	counter("lifx_responses_total", "Number of requests to the device that were answered.", func(ds DeviceStats) uint64 { return ds.Responses })
+	counter("lifx_timeouts_total", "Number of requests to the device that went unanswered after all retries.", func(ds DeviceStats) uint64 { return ds.Timeouts })
+	counter("lifx_retries_total", "Number of times a request to the device was retried.", func(ds DeviceStats) uint64 { return ds.Retries })
+	counter("lifx_packets_lost_total", "Number of packets sent to the device that were not answered within the timeout.", func(ds DeviceStats) uint64 { return ds.Lost })
+
+	fmt.Fprint(bw, "# HELP lifx_packets_sent_total Number of packets sent to the device, by message type.\n# TYPE lifx_packets_sent_total counter\n")
+
+	for _, ds := range stats {
+		types := make([]string, 0, len(ds.SentByType))
+
+		for name := range ds.SentByType {
+			types = append(types, name)
+		}
+
+		sort.Strings(types)
+
+		for _, name := range types {
+			fmt.Fprintf(bw, "lifx_packets_sent_total{mac=%q,type=%q} %d\n", ds.HardwareAddr.String(), name, ds.SentByType[name])
+		}
+	}
+
+	fmt.Fprint(bw, "# HELP lifx_packet_loss_ratio Fraction of the packets sent to the device that were lost.\n# TYPE lifx_packet_loss_ratio gauge\n")
+
+	for _, ds := range stats {
+		fmt.Fprintf(bw, "lifx_packet_loss_ratio{mac=%q} %s\n", ds.HardwareAddr.String(), formatFloat(ds.LossRatio()))
+	}
+
+	fmt.Fprint(bw, "# HELP lifx_rtt_seconds Round-trip time of the requests to the device.\n# TYPE lifx_rtt_seconds summary\n")
+
+	for _, ds := range stats {
+		mac := ds.HardwareAddr.String()
+
+		for _, q := range []struct {
+			quantile string
+			value    time.Duration
+		}{{"0.5", ds.RTT.P50}, {"0.9", ds.RTT.P90}, {"0.99", ds.RTT.P99}} {
+			fmt.Fprintf(bw, "lifx_rtt_seconds{mac=%q,quantile=%q} %s\n", mac, q.quantile, formatFloat(q.value.Seconds()))
+		}
+
+		fmt.Fprintf(bw, "lifx_rtt_seconds_sum{mac=%q} %s\n", mac, formatFloat(ds.RTT.Sum.Seconds()))
+		fmt.Fprintf(bw, "lifx_rtt_seconds_count{mac=%q} %d\n", mac, ds.RTT.Count)
+	}
+
+	return bw.Flush()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// StatsHandler returns an http.Handler that serves the statistics of the
+// client in the Prometheus text exposition format, so they can be scraped.
+func (c *Client) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.WritePrometheus(w)
+	})
+}
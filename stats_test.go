@@ -0,0 +1,149 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) Test_percentile(c *C) {
+	samples := make([]time.Duration, 100)
+
+	for i := range samples {
+		samples[i] = time.Duration(i+1) * time.Millisecond
+	}
+
+	c.Check(percentile(samples, 0.5), Equals, 50*time.Millisecond)
+	c.Check(percentile(samples, 0.9), Equals, 90*time.Millisecond)
+	c.Check(percentile(samples, 0.99), Equals, 99*time.Millisecond)
+	c.Check(percentile(samples, 0), Equals, time.Millisecond)
+	c.Check(percentile(samples, 1), Equals, 100*time.Millisecond)
+
+	c.Check(percentile(samples[:1], 0.5), Equals, time.Millisecond)
+}
+
+func (*TestSuite) Test_statsRecorder(c *C) {
+	sr := newStatsRecorder()
+	mac := net.HardwareAddr{1, 2, 3, 4, 5, 6}
+
+	// the oldest samples should be replaced once the buffer is full
+	for i := 0; i < rttSamples+10; i++ {
+		sr.answered(mac, time.Duration(i+1), true)
+	}
+
+	sr.answered(mac, time.Hour, false)
+
+	snap := sr.device(mac).snapshot()
+	c.Check(snap.Responses, Equals, uint64(rttSamples+11))
+	c.Check(snap.RTT.Count, Equals, uint64(rttSamples+10))
+	c.Check(snap.RTT.Min, Equals, time.Duration(11))
+	c.Check(snap.RTT.Max, Equals, time.Duration(rttSamples+10))
+	c.Check(snap.RTT.Mean(), Equals, snap.RTT.Sum/time.Duration(rttSamples+10))
+
+	c.Check(RTTStats{}.Mean(), Equals, time.Duration(0))
+	c.Check(DeviceStats{}.LossRatio(), Equals, float64(0))
+}
+
+func (*TestSuite) TestClient_Stats(c *C) {
+	fd := newFakeDevice(c)
+	defer fd.close()
+
+	client := newTestClient(c, &Config{Retries: 1})
+	defer client.Close()
+
+	device := client.Device(fd.mac, fd.addr())
+	ctx := context.Background()
+
+	c.Check(client.Stats(), HasLen, 0)
+
+	_, ok := client.DeviceStats(fd.mac)
+	c.Check(ok, Equals, false)
+
+	for i := 0; i < 3; i++ {
+		_, err := device.Label(ctx)
+		c.Assert(err, IsNil)
+	}
+
+	c.Assert(device.SetPower(ctx, true, 0), IsNil)
+
+	// the first attempt is lost, and the retry is answered
+	fd.mu.Lock()
+	fd.drop = 1
+	fd.mu.Unlock()
+
+	_, err := device.Label(ctx)
+	c.Assert(err, IsNil)
+
+	// both attempts are lost
+	fd.mu.Lock()
+	fd.drop = 2
+	fd.mu.Unlock()
+
+	_, err = device.Label(ctx)
+	c.Assert(err, Equals, ErrTimeout)
+
+	stats, ok := client.DeviceStats(fd.mac)
+	c.Assert(ok, Equals, true)
+	c.Check(stats.HardwareAddr.String(), Equals, fd.mac.String())
+	c.Check(stats.Requests, Equals, uint64(6))
+	c.Check(stats.Responses, Equals, uint64(5))
+	c.Check(stats.Timeouts, Equals, uint64(1))
+	c.Check(stats.Retries, Equals, uint64(2))
+	c.Check(stats.PacketsSent, Equals, uint64(8))
+	c.Check(stats.Lost, Equals, uint64(3))
+	c.Check(stats.LossRatio(), Equals, 3.0/8)
+	c.Check(stats.SentByType, DeepEquals, map[string]uint64{"DeviceGetLabel": 7, "DeviceSetPower": 1})
+
+	// the retried request isn't sampled
+	c.Check(stats.RTT.Count, Equals, uint64(4))
+	c.Check(stats.RTT.Min > 0, Equals, true)
+	c.Check(stats.RTT.Min <= stats.RTT.P50, Equals, true)
+	c.Check(stats.RTT.P50 <= stats.RTT.P99, Equals, true)
+	c.Check(stats.RTT.P99 <= stats.RTT.Max, Equals, true)
+
+	all := client.Stats()
+	c.Assert(all, HasLen, 1)
+	c.Check(all[0].Requests, Equals, uint64(6))
+
+	//
+	// Test the Prometheus exporter
+	//
+	buf := &bytes.Buffer{}
+	c.Assert(client.WritePrometheus(buf), IsNil)
+
+	out := buf.String()
+	mac := fd.mac.String()
+
+	for _, line := range []string{
+		"# TYPE lifx_requests_total counter\n",
+		fmt.Sprintf("lifx_requests_total{mac=%q} 6\n", mac),
+		fmt.Sprintf("lifx_responses_total{mac=%q} 5\n", mac),
+		fmt.Sprintf("lifx_timeouts_total{mac=%q} 1\n", mac),
+		fmt.Sprintf("lifx_retries_total{mac=%q} 2\n", mac),
+		fmt.Sprintf("lifx_packets_lost_total{mac=%q} 3\n", mac),
+		fmt.Sprintf("lifx_packets_sent_total{mac=%q,type=\"DeviceGetLabel\"} 7\n", mac),
+		fmt.Sprintf("lifx_packets_sent_total{mac=%q,type=\"DeviceSetPower\"} 1\n", mac),
+		fmt.Sprintf("lifx_packet_loss_ratio{mac=%q} 0.375\n", mac),
+		"# TYPE lifx_rtt_seconds summary\n",
+		fmt.Sprintf("lifx_rtt_seconds{mac=%q,quantile=\"0.99\"} ", mac),
+		fmt.Sprintf("lifx_rtt_seconds_count{mac=%q} 4\n", mac),
+	} {
+		c.Check(strings.Contains(out, line), Equals, true, Commentf("missing line: %q", line))
+	}
+
+	rec := httptest.NewRecorder()
+	client.StatsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	c.Check(rec.Code, Equals, 200)
+	c.Check(rec.Header().Get("Content-Type"), Equals, "text/plain; version=0.0.4; charset=utf-8")
+	c.Check(rec.Body.String(), Equals, out)
+}
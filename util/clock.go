@@ -0,0 +1,121 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxutil
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a source of time. It's used by the animation player to schedule
+// frames, by the device emulator to work out how far along its transitions
+// are, and by the sniffer to timestamp packets.
+type Clock interface {
+	Now() time.Time
+
+	// After waits for the duration to pass, and then sends the current
+	// time on the returned channel, like time.After.
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the Clock of the system's time.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// ManualClock is a Clock that only moves when it's told to, so tests can be
+// deterministic. It's safe for concurrent use by multiple goroutines.
+type ManualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []manualTimer
+}
+
+// manualTimer is a channel returned by ManualClock.After.
+type manualTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewManualClock returns a *ManualClock set to the time.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (mc *ManualClock) Now() time.Time {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	return mc.now
+}
+
+// After returns a channel the time is sent on once the clock has been
+// advanced by the duration. If the duration isn't positive, the time is sent
+// right away.
+func (mc *ManualClock) After(d time.Duration) <-chan time.Time {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+
+	if d <= 0 {
+		ch <- mc.now
+		return ch
+	}
+
+	mc.timers = append(mc.timers, manualTimer{at: mc.now.Add(d), ch: ch})
+
+	return ch
+}
+
+// Advance moves the clock forward by the duration, and fires the channels
+// returned by After that are due.
+func (mc *ManualClock) Advance(d time.Duration) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	mc.set(mc.now.Add(d))
+}
+
+// Set sets the time of the clock, and fires the channels returned by After
+// that are due.
+func (mc *ManualClock) Set(now time.Time) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	mc.set(now)
+}
+
+// set sets the time of the clock. The caller must hold the lock.
+func (mc *ManualClock) set(now time.Time) {
+	mc.now = now
+
+	pending := mc.timers[:0]
+
+	for _, t := range mc.timers {
+		if t.at.After(mc.now) {
+			pending = append(pending, t)
+			continue
+		}
+
+		t.ch <- mc.now
+	}
+
+	mc.timers = pending
+}
+
+// Waiters returns the number of channels returned by After that haven't
+// fired yet. A test can wait for it to become non-zero to know that the code
+// it's testing is waiting on the clock.
+func (mc *ManualClock) Waiters() int {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	return len(mc.timers)
+}
@@ -0,0 +1,45 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifxutil_test
+
+import (
+	"time"
+
+	"github.com/theckman/go-lifx/util"
+
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) TestManualClock(c *C) {
+	start := time.Unix(1456790400, 0)
+	clock := lifxutil.NewManualClock(start)
+	c.Check(clock.Now(), Equals, start)
+
+	// a duration that isn't positive fires right away
+	c.Check(<-clock.After(0), Equals, start)
+
+	ch1 := clock.After(time.Second)
+	ch2 := clock.After(time.Minute)
+	c.Check(clock.Waiters(), Equals, 2)
+
+	clock.Advance(time.Second)
+	c.Check(clock.Now(), Equals, start.Add(time.Second))
+	c.Check(<-ch1, Equals, start.Add(time.Second))
+	c.Check(clock.Waiters(), Equals, 1)
+
+	select {
+	case <-ch2:
+		c.Fatal("the timer fired early")
+	default:
+	}
+
+	clock.Set(start.Add(time.Hour))
+	c.Check(<-ch2, Equals, start.Add(time.Hour))
+	c.Check(clock.Waiters(), Equals, 0)
+
+	// the clock can be set back
+	clock.Set(start)
+	c.Check(clock.Now(), Equals, start)
+}
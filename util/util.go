@@ -4,7 +4,8 @@
 
 // Package lifxutil is a helper package that provides utility functionality
 // required by the different subpackges of the lifx package. This utility
-// functionality includes shared functions, as well as shared constants.
+// functionality includes shared functions, as well as shared constants, and
+// the Clock the subpackages use as their source of time.
 package lifxutil
 
 import "net"
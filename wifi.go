@@ -0,0 +1,89 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol/payloads"
+)
+
+// WifiReport is a summary of the Wi-Fi connectivity of a device.
+type WifiReport struct {
+	HardwareAddr net.HardwareAddr
+
+	// Signal is the raw signal value reported by the device.
+	Signal float32
+
+	// DBm is the signal strength in dBm. It's only set if DBmValid is true,
+	// which depends on the units the firmware reports the signal in.
+	DBm      int
+	DBmValid bool
+
+	Rating lifxpayloads.SignalRating
+
+	// Tx and Rx are the number of bytes transmitted and received since the
+	// device was powered on.
+	Tx uint32
+	Rx uint32
+
+	// FirmwareVersion and FirmwareBuild are the version and build time of
+	// the Wi-Fi subsystem firmware.
+	FirmwareVersion uint32
+	FirmwareBuild   time.Time
+}
+
+func (wr *WifiReport) String() string {
+	if wr == nil {
+		return "<*lifx.WifiReport(nil)>"
+	}
+
+	signal := "unknown"
+
+	if wr.DBmValid {
+		signal = fmt.Sprintf("%d dBm", wr.DBm)
+	}
+
+	return fmt.Sprintf(
+		"<*lifx.WifiReport(%p): HardwareAddr: %s, Signal: %s (%s), Tx: %d, Rx: %d, FirmwareVersion: %d.%d>",
+		wr, wr.HardwareAddr, signal, wr.Rating, wr.Tx, wr.Rx, wr.FirmwareVersion>>16, wr.FirmwareVersion&0xffff,
+	)
+}
+
+// WifiReport returns a summary of the Wi-Fi connectivity of the device, made
+// from its DeviceStateWifiInfo and DeviceStateWifiFirmware responses.
+func (d *Device) WifiReport(ctx context.Context) (*WifiReport, error) {
+	info, err := d.WifiInfo(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	firmware, err := d.WifiFirmware(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	wr := &WifiReport{
+		HardwareAddr:    d.HardwareAddr,
+		Signal:          info.Signal,
+		Rating:          info.SignalRating(),
+		Tx:              info.Tx,
+		Rx:              info.Rx,
+		FirmwareVersion: firmware.Version,
+	}
+
+	wr.DBm, wr.DBmValid = info.SignalDBm()
+
+	if firmware.Build != 0 {
+		wr.FirmwareBuild = time.Unix(0, int64(firmware.Build)).UTC()
+	}
+
+	return wr, nil
+}
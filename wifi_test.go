@@ -0,0 +1,49 @@
+// Copyright 2016 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package lifx
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/theckman/go-lifx/protocol/payloads"
+
+	. "gopkg.in/check.v1"
+)
+
+func (*TestSuite) TestDevice_WifiReport(c *C) {
+	fd := newFakeDevice(c)
+	defer fd.close()
+
+	client := newTestClient(c, nil)
+	defer client.Close()
+
+	device := client.Device(fd.mac, fd.addr())
+
+	wr, err := device.WifiReport(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(wr.HardwareAddr.String(), Equals, fd.mac.String())
+	c.Check(wr.Signal, Equals, float32(1e-6))
+	c.Check(wr.DBm, Equals, -60)
+	c.Check(wr.DBmValid, Equals, true)
+	c.Check(wr.Rating, Equals, lifxpayloads.SignalGood)
+	c.Check(wr.Tx, Equals, uint32(3))
+	c.Check(wr.Rx, Equals, uint32(4))
+	c.Check(wr.FirmwareVersion, Equals, uint32(4))
+	c.Check(wr.FirmwareBuild, Equals, time.Unix(0, 3).UTC())
+
+	c.Check(wr.String(), Equals, fmt.Sprintf(
+		"<*lifx.WifiReport(%p): HardwareAddr: %s, Signal: -60 dBm (good), Tx: 3, Rx: 4, FirmwareVersion: 0.4>", wr, fd.mac,
+	))
+
+	wr = &WifiReport{Signal: 20, Rating: lifxpayloads.RateSignal(20)}
+	c.Check(wr.String(), Equals, fmt.Sprintf(
+		"<*lifx.WifiReport(%p): HardwareAddr: , Signal: unknown (alright), Tx: 0, Rx: 0, FirmwareVersion: 0.0>", wr,
+	))
+
+	wr = nil
+	c.Check(wr.String(), Equals, "<*lifx.WifiReport(nil)>")
+}